@@ -36,6 +36,8 @@ func SetCommonFlags(command *cobra.Command) {
 	command.Flags().Bool("profile", false, "Enable profiling")
 	command.Flags().BoolP("foreground", "f", false, "Run in foreground")
 	command.Flags().Bool("allow_other", false, "Allow access from other users")
+	command.Flags().Bool("validate", false, "Validate configuration, credentials, and path mappings without mounting")
+	command.Flags().Bool("print_config", false, "Print effective configuration merged from config file, flags, and environment variables without mounting")
 
 	command.Flags().StringP("config", "c", "", "Set config file (yaml)")
 	command.Flags().String("instance_id", "", "Set instance ID")
@@ -48,9 +50,11 @@ func SetCommonFlags(command *cobra.Command) {
 	command.Flags().String("client_user", "", "Set iRODS client user")
 	command.Flags().StringP("user", "u", "", "Set iRODS user")
 	command.Flags().StringP("password", "p", "", "Set iRODS password")
+	command.Flags().String("password_file", "", "Read iRODS password from a file not accessible by group or others, \"-\" reads from stdin")
 	command.Flags().String("resource", "", "Set iRODS resource")
 
 	command.Flags().String("path_mapping_file", "", "Set path mapping file (yaml)")
+	command.Flags().StringArray("mount", []string{}, "Map an iRODS collection to a dir in the mount, in SRC=DST form, SRC is an iRODS URL or path (repeatable)")
 	command.Flags().Int("readahead", commons.ReadAheadMaxDefault, "Set read-ahead size")
 	command.Flags().Int("connection_max", commons.ConnectionMaxDefault, "Set max data transfer connections")
 	command.Flags().Duration("operation_timeout", commons.OperationTimeoutDefault, "Set filesystem operation timeout")
@@ -197,6 +201,7 @@ func ProcessCommonFlags(command *cobra.Command, args []string) (*commons.Config,
 
 					// overwrite config
 					config = serverConfig
+					config.ConfigPath, _ = filepath.Abs(configPath)
 					readConfig = true
 				} else {
 					// icommands environment
@@ -208,6 +213,7 @@ func ProcessCommonFlags(command *cobra.Command, args []string) (*commons.Config,
 
 					// overwrite config
 					config = serverConfig
+					config.ConfigPath, _ = filepath.Abs(configPath)
 					readConfig = true
 				}
 			}
@@ -372,6 +378,14 @@ func ProcessCommonFlags(command *cobra.Command, args []string) (*commons.Config,
 		}
 	}
 
+	passwordFileFlag := command.Flags().Lookup("password_file")
+	if passwordFileFlag != nil {
+		passwordFile := passwordFileFlag.Value.String()
+		if len(passwordFile) > 0 {
+			config.PasswordFile = passwordFile
+		}
+	}
+
 	resourceFlag := command.Flags().Lookup("resource")
 	if resourceFlag != nil {
 		resource := resourceFlag.Value.String()
@@ -575,41 +589,90 @@ func ProcessCommonFlags(command *cobra.Command, args []string) (*commons.Config,
 	}
 
 	// positional arguments
+	// mount point is not required to print config either
+	validate := IsValidateMode(command) || IsPrintConfigMode(command)
+
 	mountPath := ""
-	if len(args) == 0 {
+	irodsURLs := []string{}
+	if len(args) == 0 && !validate {
 		PrintHelp(command)
 		return nil, logWriter, false, xerrors.Errorf("mount point is not provided") // stop here
 	}
 
-	mountPath = args[len(args)-1]
+	if len(args) > 0 {
+		lastArg := args[len(args)-1]
+		if validate && strings.HasPrefix(lastArg, "irods://") {
+			// mount point is not required to validate
+			irodsURLs = args
+		} else {
+			mountPath = lastArg
+			irodsURLs = args[:len(args)-1]
+		}
+	}
 
-	if len(args) == 2 {
-		// first arg may be shorthand form of config
-		// the first argument contains irods://HOST:PORT/ZONE/inputPath...
-		err := updateConfigFromIrodsUrl(args[0], config)
+	if len(irodsURLs) > 0 {
+		// preceding args may be shorthand form of config
+		// each contains irods://HOST:PORT/ZONE/inputPath...
+		err := updateConfigFromIrodsUrls(irodsURLs, config)
 		if err != nil {
 			logger.Errorf("%+v", err)
 			return nil, logWriter, false, err // stop here
 		}
 	}
 
-	if !stdinClosed {
-		err = inputMissingParams(config)
+	mountSpecs, _ := command.Flags().GetStringArray("mount")
+	for _, mountSpec := range mountSpecs {
+		pathMapping, err := parseMountSpec(mountSpec, config)
 		if err != nil {
 			logger.Errorf("%+v", err)
 			return nil, logWriter, false, err // stop here
 		}
+
+		config.PathMappings = append(config.PathMappings, pathMapping)
 	}
 
-	// the second argument is local directory that irodsfs will be mounted
-	mountpoint, err := filepath.Abs(mountPath)
+	err = checkPathMappingCollisions(config.PathMappings, config.OverlayMappings)
 	if err != nil {
-		absErr := xerrors.Errorf("failed to get abs path for %q: %w", mountPath, err)
-		logger.Errorf("%+v", absErr)
-		return nil, logWriter, false, absErr // stop here
+		logger.Errorf("%+v", err)
+		return nil, logWriter, false, err // stop here
+	}
+
+	// environment variables take precedence over the config file and flags
+	config.OverrideFromEnvironment()
+
+	// password file is read only if password is not given otherwise
+	if len(config.PasswordFile) > 0 && len(config.Password) == 0 {
+		password, err := readPasswordFile(config.PasswordFile, stdinClosed)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return nil, logWriter, false, err // stop here
+		}
+
+		config.Password = password
+		if config.PasswordFile == "-" {
+			stdinClosed = true
+		}
 	}
 
-	config.MountPath = mountpoint
+	if !stdinClosed {
+		err = inputMissingParams(config)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return nil, logWriter, false, err // stop here
+		}
+	}
+
+	if len(mountPath) > 0 {
+		// the second argument is local directory that irodsfs will be mounted
+		mountpoint, err := filepath.Abs(mountPath)
+		if err != nil {
+			absErr := xerrors.Errorf("failed to get abs path for %q: %w", mountPath, err)
+			logger.Errorf("%+v", absErr)
+			return nil, logWriter, false, absErr // stop here
+		}
+
+		config.MountPath = mountpoint
+	}
 
 	err = config.CorrectSystemUser()
 	if err != nil {
@@ -617,7 +680,13 @@ func ProcessCommonFlags(command *cobra.Command, args []string) (*commons.Config,
 		return nil, logWriter, false, err // stop here
 	}
 
-	err = config.Validate()
+	config.CorrectPathMappings()
+
+	if validate && len(config.MountPath) == 0 {
+		err = config.ValidateSettings()
+	} else {
+		err = config.Validate()
+	}
 	if err != nil {
 		logger.Errorf("%+v", err)
 		return nil, logWriter, false, err // stop here
@@ -626,6 +695,44 @@ func ProcessCommonFlags(command *cobra.Command, args []string) (*commons.Config,
 	return config, logWriter, true, nil // continue
 }
 
+// IsValidateMode returns true if the command validates configuration without mounting
+func IsValidateMode(command *cobra.Command) bool {
+	validateFlag := command.Flags().Lookup("validate")
+	if validateFlag == nil {
+		return false
+	}
+
+	validate, _ := strconv.ParseBool(validateFlag.Value.String())
+	return validate
+}
+
+// IsPrintConfigMode returns true if the command prints effective configuration without mounting
+func IsPrintConfigMode(command *cobra.Command) bool {
+	printConfigFlag := command.Flags().Lookup("print_config")
+	if printConfigFlag == nil {
+		return false
+	}
+
+	printConfig, _ := strconv.ParseBool(printConfigFlag.Value.String())
+	return printConfig
+}
+
+// PrintConfig prints the configuration in YAML, the password is redacted
+func PrintConfig(config *commons.Config) error {
+	redactedConfig := *config
+	if len(redactedConfig.Password) > 0 {
+		redactedConfig.Password = "<redacted>"
+	}
+
+	configBytes, err := yaml.Marshal(&redactedConfig)
+	if err != nil {
+		return xerrors.Errorf("failed to marshal configuration to yaml: %w", err)
+	}
+
+	fmt.Print(string(configBytes))
+	return nil
+}
+
 func PrintVersion(command *cobra.Command) error {
 	info, err := commons.GetVersionJSON()
 	if err != nil {
@@ -662,6 +769,25 @@ func getLogWriterForChildProcess(logPath string) (io.WriteCloser, string) {
 	}, logFilePath
 }
 
+// readPasswordFile reads the password from the file, or from stdin if the path is "-"
+func readPasswordFile(passwordFilePath string, stdinClosed bool) (string, error) {
+	if passwordFilePath != "-" {
+		return commons.ReadPasswordFile(passwordFilePath)
+	}
+
+	if stdinClosed {
+		return "", xerrors.Errorf("failed to read password from stdin, stdin is used to read config")
+	}
+
+	stdinReader := bufio.NewReader(os.Stdin)
+	passwordLine, err := stdinReader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", xerrors.Errorf("failed to read password from stdin: %w", err)
+	}
+
+	return commons.GetPasswordLine(passwordLine), nil
+}
+
 // inputMissingParams gets user inputs for parameters missing, such as username and password
 func inputMissingParams(config *commons.Config) error {
 	if len(config.ProxyUser) == 0 {
@@ -22,6 +22,52 @@ type IRODSAccessURL struct {
 	Path     string
 }
 
+// splitIrodsUrlUserInfo splits user info from the rest of iRODS Access URL following the scheme
+// '@' and '/' in credentials should be percent-encoded, but raw ones are accepted as hosts do not have them
+// the host follows the first '@' that is not followed by another '@' before the path, so passwords having both must be percent-encoded
+func splitIrodsUrlUserInfo(rest string) (string, string) {
+	authority := rest
+	if pos := strings.Index(rest, "/"); pos >= 0 {
+		authority = rest[:pos]
+	}
+
+	if !strings.Contains(authority, "@") {
+		// no credentials, unless the password has '/', e.g., user:pass/word@host
+		_, port, ok := strings.Cut(authority, ":")
+		if !ok || isDigits(port) {
+			return "", rest
+		}
+	}
+
+	pos := strings.Index(rest, "@")
+	for pos >= 0 {
+		hostAndPath := rest[pos+1:]
+		host := hostAndPath
+		if slashPos := strings.Index(hostAndPath, "/"); slashPos >= 0 {
+			host = hostAndPath[:slashPos]
+		}
+
+		next := strings.Index(host, "@")
+		if next < 0 {
+			return rest[:pos], hostAndPath
+		}
+
+		pos += next + 1
+	}
+
+	return "", rest
+}
+
+// isDigits checks if the string has only decimal digits, empty string has no non-digits
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // parseIrodsUrl parses iRODS Access URL string and returns IRODSAccessURL struct
 func parseIrodsUrl(inputURL string) (*IRODSAccessURL, error) {
 	logger := log.WithFields(log.Fields{
@@ -35,25 +81,29 @@ func parseIrodsUrl(inputURL string) (*IRODSAccessURL, error) {
 		return nil, urlErr
 	}
 
-	u, err := url.Parse(inputURL)
+	// credentials are split before parsing, as they may have raw '@' and '/' which url.Parse does not accept
+	userInfo, hostAndPath := splitIrodsUrlUserInfo(strings.TrimPrefix(inputURL, "irods://"))
+
+	u, err := url.Parse("irods://" + hostAndPath)
 	if err != nil {
 		urlErr := xerrors.Errorf("failed to parse source URL %q: %w", inputURL, err)
 		logger.Errorf("%+v", urlErr)
 		return nil, urlErr
 	}
 
-	user := ""
-	password := ""
-
-	if u.User != nil {
-		uname := u.User.Username()
-		if len(uname) > 0 {
-			user = uname
-		}
+	escapedUser, escapedPassword, _ := strings.Cut(userInfo, ":")
+	user, err := url.PathUnescape(escapedUser)
+	if err != nil {
+		urlErr := xerrors.Errorf("failed to unescape user of source URL %q: %w", inputURL, err)
+		logger.Errorf("%+v", urlErr)
+		return nil, urlErr
+	}
 
-		if pwd, ok := u.User.Password(); ok {
-			password = pwd
-		}
+	password, err := url.PathUnescape(escapedPassword)
+	if err != nil {
+		urlErr := xerrors.Errorf("failed to unescape password of source URL %q: %w", inputURL, err)
+		logger.Errorf("%+v", urlErr)
+		return nil, urlErr
 	}
 
 	host := ""
@@ -70,31 +120,46 @@ func parseIrodsUrl(inputURL string) (*IRODSAccessURL, error) {
 		port = int(port64)
 	}
 
-	fullpath := path.Clean(u.Path)
-	zone := ""
-	irodsPath := "/"
-	if len(fullpath) == 0 || fullpath[0] != '/' {
+	escapedPath := u.EscapedPath()
+	if len(escapedPath) == 0 || escapedPath[0] != '/' {
 		pathErr := xerrors.Errorf("path %q must contain an absolute path", u.Path)
 		logger.Errorf("%+v", pathErr)
 		return nil, pathErr
 	}
 
-	pos := strings.Index(fullpath[1:], "/")
-	if pos > 0 {
-		zone = strings.Trim(fullpath[1:pos+1], "/")
-		irodsPath = fullpath // starts with zone
-	} else if pos == -1 {
-		// no path
-		zone = strings.Trim(fullpath[1:], "/")
-		irodsPath = fullpath
+	// unescape each segment, so escaped characters do not split segments
+	segments := []string{}
+	for _, escapedSegment := range strings.Split(escapedPath, "/") {
+		if len(escapedSegment) == 0 || escapedSegment == "." {
+			continue
+		}
+
+		segment, err := url.PathUnescape(escapedSegment)
+		if err != nil {
+			pathErr := xerrors.Errorf("failed to unescape path segment %q: %w", escapedSegment, err)
+			logger.Errorf("%+v", pathErr)
+			return nil, pathErr
+		}
+
+		segments = append(segments, segment)
 	}
 
-	if len(zone) == 0 || len(irodsPath) == 0 {
+	if len(segments) == 0 {
 		pathErr := xerrors.Errorf("path %q must contain an absolute path", inputURL)
 		logger.Errorf("%+v", pathErr)
 		return nil, pathErr
 	}
 
+	// the first segment is zone, the path starts with zone
+	zone := segments[0]
+	irodsPath := path.Clean("/" + strings.Join(segments, "/"))
+
+	if zone == ".." || (irodsPath != "/"+zone && !strings.HasPrefix(irodsPath, "/"+zone+"/")) {
+		pathErr := xerrors.Errorf("path %q must start with a zone", inputURL)
+		logger.Errorf("%+v", pathErr)
+		return nil, pathErr
+	}
+
 	return &IRODSAccessURL{
 		User:     user,
 		Password: password,
@@ -119,6 +184,56 @@ func updateConfigFromIrodsUrl(inputURL string, config *commons.Config) error {
 		return err
 	}
 
+	updateConfigFromIrodsAccessUrl(access, config)
+
+	if len(access.Path) > 0 {
+		config.PathMappings = []irodsfs_common_vpath.VPathMapping{
+			newPathMappingForDir(access.Path, "/"),
+		}
+	}
+
+	return nil
+}
+
+// updateConfigFromIrodsUrls reads info from inputURLs and updates config
+// if multiple URLs are given, each collection is mapped to a dir with the same name under the mount root
+func updateConfigFromIrodsUrls(inputURLs []string, config *commons.Config) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "commons",
+		"function": "updateConfigFromIrodsUrls",
+	})
+
+	if len(inputURLs) == 1 {
+		return updateConfigFromIrodsUrl(inputURLs[0], config)
+	}
+
+	var firstAccess *IRODSAccessURL
+	pathMappings := []irodsfs_common_vpath.VPathMapping{}
+	for _, inputURL := range inputURLs {
+		access, err := parseIrodsUrl(inputURL)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return err
+		}
+
+		if firstAccess == nil {
+			firstAccess = access
+			updateConfigFromIrodsAccessUrl(access, config)
+		} else if access.Host != firstAccess.Host || access.Port != firstAccess.Port || access.Zone != firstAccess.Zone {
+			urlErr := xerrors.Errorf("iRODS URL %q must point to the same host, port, and zone as %q", inputURL, inputURLs[0])
+			logger.Errorf("%+v", urlErr)
+			return urlErr
+		}
+
+		pathMappings = append(pathMappings, newPathMappingForDir(access.Path, path.Join("/", path.Base(access.Path))))
+	}
+
+	config.PathMappings = pathMappings
+	return nil
+}
+
+// updateConfigFromIrodsAccessUrl updates iRODS access info in config
+func updateConfigFromIrodsAccessUrl(access *IRODSAccessURL, config *commons.Config) {
 	if len(access.Host) > 0 {
 		config.Host = access.Host
 	}
@@ -139,22 +254,84 @@ func updateConfigFromIrodsUrl(inputURL string, config *commons.Config) error {
 		config.Zone = access.Zone
 	}
 
-	if len(access.Path) > 0 {
-		config.PathMappings = []irodsfs_common_vpath.VPathMapping{
-			{
-				IRODSPath:           access.Path,
-				MappingPath:         "/",
-				ResourceType:        irodsfs_common_vpath.VPathMappingDirectory,
-				ReadOnly:            false,
-				CreateDir:           false,
-				IgnoreNotExistError: false,
-			},
+	if len(config.ClientUser) == 0 {
+		config.ClientUser = config.ProxyUser
+	}
+}
+
+// parseMountSpec parses SRC=DST given to --mount, SRC is an iRODS URL or an absolute iRODS path, DST is a path under the mount root
+func parseMountSpec(spec string, config *commons.Config) (irodsfs_common_vpath.VPathMapping, error) {
+	pos := strings.LastIndex(spec, "=")
+	if pos <= 0 || pos == len(spec)-1 {
+		return irodsfs_common_vpath.VPathMapping{}, xerrors.Errorf("mount %q must be in SRC=DST form", spec)
+	}
+
+	source := spec[:pos]
+	destination := path.Join("/", spec[pos+1:])
+
+	if strings.HasPrefix(source, "irods://") {
+		access, err := parseIrodsUrl(source)
+		if err != nil {
+			return irodsfs_common_vpath.VPathMapping{}, err
+		}
+
+		if len(config.Host) > 0 && (access.Host != config.Host || access.Zone != config.Zone) {
+			return irodsfs_common_vpath.VPathMapping{}, xerrors.Errorf("mount source %q must point to host %q and zone %q", source, config.Host, config.Zone)
 		}
+
+		updateConfigFromIrodsAccessUrl(access, config)
+		source = access.Path
 	}
 
-	if len(config.ClientUser) == 0 {
-		config.ClientUser = config.ProxyUser
+	if !strings.HasPrefix(source, "/") {
+		return irodsfs_common_vpath.VPathMapping{}, xerrors.Errorf("mount source %q must be an iRODS URL or an absolute iRODS path", source)
+	}
+
+	return newPathMappingForDir(path.Clean(source), destination), nil
+}
+
+// checkPathMappingCollisions returns an error if multiple path mappings are mapped to the same path, or to paths nested in others
+// nested paths are allowed with overlay, as listings of the outer path are merged with the nested mapping
+func checkPathMappingCollisions(pathMappings []irodsfs_common_vpath.VPathMapping, overlay bool) error {
+	for i, pathMapping := range pathMappings {
+		mappingPath := path.Clean(pathMapping.MappingPath)
+
+		for _, otherPathMapping := range pathMappings[:i] {
+			otherMappingPath := path.Clean(otherPathMapping.MappingPath)
+			if otherMappingPath == mappingPath {
+				return xerrors.Errorf("%q and %q are both mapped to %q", otherPathMapping.IRODSPath, pathMapping.IRODSPath, mappingPath)
+			}
+
+			if overlay {
+				continue
+			}
+
+			if isSubPath(otherMappingPath, mappingPath) {
+				return xerrors.Errorf("%q mapped to %q is inside %q mapped to %q, set overlay_mappings to mount nested paths", pathMapping.IRODSPath, mappingPath, otherPathMapping.IRODSPath, otherMappingPath)
+			}
+
+			if isSubPath(mappingPath, otherMappingPath) {
+				return xerrors.Errorf("%q mapped to %q is inside %q mapped to %q, set overlay_mappings to mount nested paths", otherPathMapping.IRODSPath, otherMappingPath, pathMapping.IRODSPath, mappingPath)
+			}
+		}
 	}
 
 	return nil
 }
+
+// isSubPath checks if the path is under the parent path, paths must be clean
+func isSubPath(parentPath string, childPath string) bool {
+	return strings.HasPrefix(childPath, strings.TrimSuffix(parentPath, "/")+"/")
+}
+
+// newPathMappingForDir returns a path mapping for a collection
+func newPathMappingForDir(irodsPath string, mappingPath string) irodsfs_common_vpath.VPathMapping {
+	return irodsfs_common_vpath.VPathMapping{
+		IRODSPath:           irodsPath,
+		MappingPath:         mappingPath,
+		ResourceType:        irodsfs_common_vpath.VPathMappingDirectory,
+		ReadOnly:            false,
+		CreateDir:           false,
+		IgnoreNotExistError: false,
+	}
+}
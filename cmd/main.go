@@ -6,6 +6,8 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 
 	cmd_commons "github.com/cyverse/irodsfs/cmd/commons"
 	"github.com/cyverse/irodsfs/commons"
@@ -20,7 +22,7 @@ import (
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "irodsfs [iRODS URL] mount_point",
+	Use:   "irodsfs [iRODS URL...] mount_point",
 	Short: "Run iRODS FUSE Lite",
 	Long:  "Run iRODS FUSE Lite that mounts iRODS collections on the directory hierarchy.",
 	RunE:  processCommand,
@@ -91,7 +93,13 @@ func parentMain(command *cobra.Command, args []string) {
 		defer logWriter.Close()
 	}
 
+	validateOnly := cmd_commons.IsValidateMode(command)
+
 	if err != nil {
+		if validateOnly {
+			printCheckResult(irodsfs.CheckResult{Name: "configuration", Err: err})
+		}
+
 		logger.Errorf("%+v", err)
 		os.Exit(1)
 	}
@@ -100,6 +108,24 @@ func parentMain(command *cobra.Command, args []string) {
 		os.Exit(0)
 	}
 
+	if cmd_commons.IsPrintConfigMode(command) {
+		// do not mount
+		err = cmd_commons.PrintConfig(config)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if validateOnly {
+		// do not mount
+		if !validate(config) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// check fuse
 	fuseCheckResult := utils.CheckFuse()
 	switch fuseCheckResult {
@@ -143,6 +169,31 @@ func parentMain(command *cobra.Command, args []string) {
 	}
 }
 
+// validate checks credentials and path mappings without mounting and prints a report, returns false if any check fails
+func validate(config *commons.Config) bool {
+	printCheckResult(irodsfs.CheckResult{Name: "configuration", Message: "valid"})
+
+	passed := true
+	for _, result := range irodsfs.CheckIRODS(config) {
+		printCheckResult(result)
+		if result.Err != nil {
+			passed = false
+		}
+	}
+
+	return passed
+}
+
+// printCheckResult prints a result of a check run without mounting
+func printCheckResult(result irodsfs.CheckResult) {
+	if result.Err != nil {
+		fmt.Printf("[FAIL] %s: %v\n", result.Name, result.Err)
+		return
+	}
+
+	fmt.Printf("[ OK ] %s: %s\n", result.Name, result.Message)
+}
+
 // childMain runs child process
 func childMain(command *cobra.Command, args []string) {
 	logger := log.WithFields(log.Fields{
@@ -261,13 +312,36 @@ func run(config *commons.Config, isChildProcess bool) error {
 		os.Exit(0)
 	}()
 
-	// handle ctrl + C
+	// handle ctrl + C and termination by service managers
 	signalChannel := make(chan os.Signal, 1)
-	signal.Notify(signalChannel, os.Interrupt)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		<-signalChannel
-		logger.Info("received intrrupt")
-		fs.Stop() // this unmounts fuse
+		receivedSignal := <-signalChannel
+		if receivedSignal != syscall.SIGTERM {
+			logger.Info("received intrrupt")
+			fs.Stop() // this unmounts fuse
+			logger.Info("stopped the filesystem, unmounting FUSE")
+			return
+		}
+
+		logger.Info("received SIGTERM")
+
+		// draining, flushing and exiting share a deadline
+		shutdownTimeout := time.Duration(config.ShutdownTimeout)
+		shutdownDeadline := time.Time{}
+		if shutdownTimeout > 0 {
+			shutdownDeadline = time.Now().Add(shutdownTimeout)
+
+			// FUSE may not exit while files are still in use
+			time.AfterFunc(shutdownTimeout, func() {
+				logger.Error("failed to exit in time, unmounting lazily and exiting forcefully")
+				fs.Stop() // no-op if already unmounted lazily
+				fs.Release()
+				os.Exit(1)
+			})
+		}
+
+		fs.Shutdown(shutdownDeadline) // this flushes and unmounts fuse lazily
 		logger.Info("stopped the filesystem, unmounting FUSE")
 	}()
 
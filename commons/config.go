@@ -2,11 +2,14 @@ package commons
 
 import (
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
@@ -16,6 +19,7 @@ import (
 
 	"github.com/cyverse/irodsfs/utils"
 	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -24,12 +28,26 @@ const (
 	ReadAheadMaxDefault             int           = 1024 * 128 // 128KB
 	ConnectionMaxDefault            int           = 10
 	TCPBufferSizeDefault            int           = 4 * 1024 * 1024 // 4MB
+	XattrValueMaxDefault            int           = 2700            // size of AVU value column in iCAT
 	ConnectionErrorTimeout          time.Duration = 1 * time.Minute
 	OperationTimeoutDefault         time.Duration = 5 * time.Minute
 	ConnectionLifespanDefault       time.Duration = 1 * time.Hour
 	ConnectionIdleTimeoutDefault    time.Duration = 5 * time.Minute
 	MetadataCacheTimeoutDefault     time.Duration = 5 * time.Minute
 	MetadataCacheCleanupTimeDefault time.Duration = 5 * time.Minute
+	MetadataOpsWaitMaxDefault       time.Duration = 1 * time.Second
+	DistributedLockTimeoutDefault   time.Duration = 5 * time.Minute
+	ShutdownTimeoutDefault          time.Duration = 20 * time.Second // within grace periods of systemd and k8s
+	DirAttrCacheTimeoutDefault      time.Duration = 0                // off, attrs listed may be stale for the window
+	ClockSkewCheckIntervalDefault   time.Duration = 1 * time.Hour
+	ClockSkewThresholdDefault       time.Duration = 1 * time.Minute
+	PoolHealthCheckIntervalDefault  time.Duration = 10 * time.Second
+	PoolReconnectBackoffMaxDefault  time.Duration = 1 * time.Minute
+	WriteBackMaxDirtyDefault        int           = 16 * 1024 * 1024 // 16MB
+	IOBlockSizeDefault              int           = 16 * 1024 * 1024 // 16MB
+	IOBlockSizeMin                  int           = 128 * 1024       // 128KB
+	ReadWriteSizeDefault            int           = 128 * 1024       // 128KB
+	ReadWriteSizeMax                int           = 1024 * 1024      // 1MB, max of FUSE
 
 	AuthSchemeDefault          string = string(irodsclient_types.AuthSchemeNative)
 	CSNegotiationDefault       string = string(irodsclient_types.CSNegotiationRequireTCP)
@@ -39,12 +57,70 @@ const (
 	HashRoundsDefault          int    = 16
 
 	ProfileServicePortDefault int = 11021
+
+	MemoryAvailableMinDefault int = 256 * 1024 * 1024 // 256MB
+	AlignedReadBlockSizeMin   int = 4 * 1024          // 4KB
+	PrefetchWindowLimit       int = 128 * 1024 * 1024 // 128MB, held in memory per file handle
+
+	DirAttrPrefetchBatchSizeDefault int = 1000
+
+	BulkSmallFileMaxSizeDefault       int64 = 64 * 1024 // 64KB
+	BulkSmallFileMinReadsDefault      int   = 32
+	BulkSmallFileBundleMaxSizeDefault int64 = 64 * 1024 * 1024 // 64MB
+
+	TerminatedErrnoDefault string = "ECONNABORTED"
+
+	IOHintSequential string = "sequential"
+	IOHintRandom     string = "random"
+
+	MTimeSourceModify  string = "modify"
+	MTimeSourceCreate  string = "create"
+	MTimeSourceReplica string = "replica" // the newest good replica, as replication does not count as modification
+
+	// environment variables overriding sensitive config fields
+	PasswordEnvName   string = "IRODSFS_PASSWORD"
+	ProxyUserEnvName  string = "IRODSFS_PROXY_USER"
+	ClientUserEnvName string = "IRODSFS_CLIENT_USER"
+	HostEnvName       string = "IRODSFS_HOST"
+)
+
+var (
+	// CS negotiation policies of iRODS
+	csNegotiationPolicies = []string{
+		string(irodsclient_types.CSNegotiationRequireTCP),
+		string(irodsclient_types.CSNegotiationRequireSSL),
+		string(irodsclient_types.CSNegotiationDontCare),
+	}
+
+	// SSL encryption algorithms supported by go-irodsclient
+	encryptionAlgorithms = []string{
+		EncryptionAlgorithmDefault,
+	}
 )
 
 func GetDefaultInstanceID() string {
 	return xid.New().String()
 }
 
+// GetDefaultIOHints returns I/O hints for well-known file extensions
+func GetDefaultIOHints() map[string]string {
+	return map[string]string{
+		".mp4":    IOHintSequential,
+		".mkv":    IOHintSequential,
+		".mov":    IOHintSequential,
+		".tar":    IOHintSequential,
+		".gz":     IOHintSequential,
+		".bz2":    IOHintSequential,
+		".xz":     IOHintSequential,
+		".fastq":  IOHintSequential,
+		".sqlite": IOHintRandom,
+		".db":     IOHintRandom,
+		".zip":    IOHintRandom,
+		".h5":     IOHintRandom,
+		".hdf5":   IOHintRandom,
+	}
+}
+
 func GetDefaultDataRootDirPath() string {
 	dirPath, err := os.Getwd()
 	if err != nil {
@@ -60,6 +136,22 @@ type MetadataCacheTimeoutSetting struct {
 	Inherit bool                          `yaml:"inherit,omitempty" json:"inherit,omitempty"`
 }
 
+// UserMapping maps an iRODS user to a local user, files owned by the iRODS user are reported as owned by the local user
+// if SystemUser is given, UID and GID are looked up
+type UserMapping struct {
+	IRODSUser  string `yaml:"irods_user" json:"irods_user"`
+	SystemUser string `yaml:"system_user,omitempty" json:"system_user,omitempty"`
+	UID        int    `yaml:"uid" json:"uid"`
+	GID        int    `yaml:"gid" json:"gid"`
+}
+
+// ReadAheadSetting defines size of data prefetched ahead of reads for files under path
+// 0 disables prefetching
+type ReadAheadSetting struct {
+	Path      string `yaml:"path" json:"path"`
+	ReadAhead int    `yaml:"read_ahead" json:"read_ahead"`
+}
+
 // Config holds the parameters list which can be configured
 type Config struct {
 	Host              string                              `yaml:"host"`
@@ -68,13 +160,16 @@ type Config struct {
 	ClientUser        string                              `yaml:"client_user"`
 	Zone              string                              `yaml:"zone"`
 	Password          string                              `yaml:"password,omitempty"`
+	PasswordFile      string                              `yaml:"password_file,omitempty"`
 	Resource          string                              `yaml:"resource,omitempty"`
+	PreferredResource string                              `yaml:"preferred_resource,omitempty"`
 	PathMappings      []irodsfs_common_vpath.VPathMapping `yaml:"path_mappings"`
 	NoPermissionCheck bool                                `yaml:"no_permission_check"`
 	NoSetXattr        bool                                `yaml:"no_set_xattr"`
 	UID               int                                 `yaml:"uid"`
 	GID               int                                 `yaml:"gid"`
 	SystemUser        string                              `yaml:"system_user"`
+	UserMappings      []UserMapping                       `yaml:"user_mappings"`
 	MountPath         string                              `yaml:"mount_path,omitempty"`
 
 	DataRootPath string `yaml:"data_root_path,omitempty"`
@@ -86,25 +181,116 @@ type Config struct {
 	AuthScheme              string `yaml:"auth_scheme"`
 	ClientServerNegotiation bool   `yaml:"cs_negotiation"`
 	CSNegotiationPolicy     string `yaml:"cs_negotiation_policy"`
-	CACertificateFile       string `yaml:"ssl_ca_cert_file"`
+	CACertificateFile       string `yaml:"ssl_ca_cert_file"` // go-irodsclient always verifies server certificates, give the certificate of self-signed servers
 	CACertificatePath       string `yaml:"ssl_ca_sert_path"`
 	EncryptionKeySize       int    `yaml:"ssl_encryption_key_size"`
 	EncryptionAlgorithm     string `yaml:"ssl_encryption_algorithm"`
 	SaltSize                int    `yaml:"ssl_encryption_salt_size"`
 	HashRounds              int    `yaml:"ssl_encryption_hash_rounds"`
 
+	PamTokenTTL irodsfs_common_utils.Duration `yaml:"pam_token_ttl,omitempty"` // PAM tokens are cached under data root dir, 0 does not cache
+
 	ReadAheadMax                          int                           `yaml:"read_ahead_max"`
+	XattrValueMax                         int                           `yaml:"xattr_value_max"`
+	IOBlockSize                           int                           `yaml:"io_block_size"`
+	ReadWriteSize                         int                           `yaml:"read_write_size"`
 	OperationTimeout                      irodsfs_common_utils.Duration `yaml:"operation_timeout"`
+	ListTimeout                           irodsfs_common_utils.Duration `yaml:"list_timeout"`
+	ListTimeoutPartialResults             bool                          `yaml:"list_timeout_partial_results"` // present entries known before ETIMEDOUT, rather than ETIMEDOUT alone
+	ProtocolErrorRetry                    int                           `yaml:"protocol_error_retry"`
+	ReconnectMaxRetries                   int                           `yaml:"reconnect_max_retries"`
+	TransientErrorRetry                   int                           `yaml:"transient_error_retry"`
+	MaxMetadataOpsPerSec                  int                           `yaml:"max_metadata_ops_per_sec"`
+	MetadataOpsWaitMax                    irodsfs_common_utils.Duration `yaml:"metadata_ops_wait_max"`
+	MaxReadBandwidth                      int                           `yaml:"max_read_bandwidth"`
+	MaxWriteBandwidth                     int                           `yaml:"max_write_bandwidth"`
+	RetryBudget                           irodsfs_common_utils.Duration `yaml:"retry_budget"`
+	MountReadyTimeout                     irodsfs_common_utils.Duration `yaml:"mount_ready_timeout"`
+	DistributedLockTimeout                irodsfs_common_utils.Duration `yaml:"distributed_lock_timeout"`
+	ShutdownTimeout                       irodsfs_common_utils.Duration `yaml:"shutdown_timeout"`
+	DrainTimeout                          irodsfs_common_utils.Duration `yaml:"drain_timeout"`
+	ClockSkewCheckInterval                irodsfs_common_utils.Duration `yaml:"clock_skew_check_interval"`
+	ClockSkewThreshold                    irodsfs_common_utils.Duration `yaml:"clock_skew_threshold"`
+	PoolHealthCheckInterval               irodsfs_common_utils.Duration `yaml:"pool_health_check_interval"`
+	PoolReconnectBackoffMax               irodsfs_common_utils.Duration `yaml:"pool_reconnect_backoff_max"`
+	WriteBackFlushInterval                irodsfs_common_utils.Duration `yaml:"write_back_flush_interval"`
+	WriteBackMaxDirty                     int                           `yaml:"write_back_max_dirty"`
+	MemoryPressureCheckInterval           irodsfs_common_utils.Duration `yaml:"memory_pressure_check_interval"`
+	MemoryAvailableMin                    int                           `yaml:"memory_available_min"`
+	IOWorkersMax                          int                           `yaml:"io_workers_max"`
+	PrefetchWindowInitial                 int                           `yaml:"prefetch_window_initial"`
+	PrefetchWindowMax                     int                           `yaml:"prefetch_window_max"`
+	AlignedReadBlockSize                  int                           `yaml:"aligned_read_block_size"`
 	ConnectionLifespan                    irodsfs_common_utils.Duration `yaml:"connection_lifespan"`
 	ConnectionIdleTimeout                 irodsfs_common_utils.Duration `yaml:"connection_idle_timeout"`
+	ConnectionKeepaliveInterval           irodsfs_common_utils.Duration `yaml:"connection_keepalive_interval"`
 	ConnectionMax                         int                           `yaml:"connection_max"`
+	DataConnectionMax                     int                           `yaml:"data_connection_max"`
+	OpenFileMaxPerUser                    int                           `yaml:"open_file_max_per_user"`
+	MaxBandwidthPerUser                   int                           `yaml:"max_bandwidth_per_user"`
 	MetadataCacheTimeout                  irodsfs_common_utils.Duration `yaml:"metadata_cache_timeout"`
 	MetadataCacheCleanupTime              irodsfs_common_utils.Duration `yaml:"metadata_cache_cleanup_time"`
 	MetadataCacheTimeoutSettings          []MetadataCacheTimeoutSetting `yaml:"metadata_cache_timeout_settings"`
+	DirAttrCacheTimeout                   irodsfs_common_utils.Duration `yaml:"dir_attr_cache_timeout"`
+	DirAttrPrefetch                       bool                          `yaml:"dir_attr_prefetch"`
+	DirAttrPrefetchBatchSize              int                           `yaml:"dir_attr_prefetch_batch_size"`
+	ReaddirPlus                           bool                          `yaml:"readdir_plus"`
+	BulkSmallFileMode                     bool                          `yaml:"bulk_small_file_mode"`               // serve small files read en masse from a bundle of their collection
+	BulkSmallFileMaxSize                  int64                         `yaml:"bulk_small_file_max_size"`           // files larger than this are read individually
+	BulkSmallFileMinReads                 int                           `yaml:"bulk_small_file_min_reads"`          // small files read in a collection before bundling it
+	BulkSmallFileBundleMaxSize            int64                         `yaml:"bulk_small_file_bundle_max_size"`    // collections larger than this in total are not bundled
+	BulkSmallFileStagingCollection        string                        `yaml:"bulk_small_file_staging_collection"` // iRODS collection bundles are created in, the user must be able to write to it
+	InodeFromPath                         bool                          `yaml:"inode_from_path"`
+	ChangePollInterval                    irodsfs_common_utils.Duration `yaml:"change_poll_interval"`
+	ChangePollPaths                       []string                      `yaml:"change_poll_paths"` // iRODS paths of files polled once accessed, besides files open
+	IOHints                               map[string]string             `yaml:"io_hints"`
+	ReadAheadSettings                     []ReadAheadSetting            `yaml:"read_ahead_settings"`
 	StartNewTransaction                   bool                          `yaml:"start_new_transaction"`
 	InvalidateParentEntryCacheImmediately bool                          `yaml:"invalidate_parent_entry_cache_immediately"`
+	InaccessibleDirAsEmpty                bool                          `yaml:"inaccessible_dir_as_empty"`
+	SharedReadHandle                      bool                          `yaml:"shared_read_handle"`
+	TrackLastModifiedBy                   bool                          `yaml:"track_last_modified_by"`
+	UpgradeReadOnlyHandleOnWrite          bool                          `yaml:"upgrade_readonly_handle_on_write"`
+	FsyncDurable                          bool                          `yaml:"fsync_durable"`
+	CollectionDefaultResource             bool                          `yaml:"collection_default_resource"`
+	DirModifyTimeFromChildren             bool                          `yaml:"dir_modify_time_from_children"`
+	ExposeOpenHandles                     bool                          `yaml:"expose_open_handles"`
+	ExposeDataType                        bool                          `yaml:"expose_data_type"`
+	EnableSymlink                         bool                          `yaml:"enable_symlink"`
+	ResolveSoftlinks                      bool                          `yaml:"resolve_softlinks"`
+	OverlayMappings                       bool                          `yaml:"overlay_mappings"`
+	TerminatedErrno                       string                        `yaml:"terminated_errno"`
+	MTimeSource                           string                        `yaml:"mtime_source"`
+	PersistTimestamps                     bool                          `yaml:"persist_timestamps"`
+	DefaultFileMode                       string                        `yaml:"default_file_mode"`
+	DefaultDirMode                        string                        `yaml:"default_dir_mode"`
+	CheckClockSkew                        bool                          `yaml:"check_clock_skew"`
+	ExposeZone                            bool                          `yaml:"expose_zone"`
+	ExposeEntryInfo                       bool                          `yaml:"expose_entry_info"`
+	ExposeReplicaChecksums                bool                          `yaml:"expose_replica_checksums"` // present checksums of replicas to detect replicas diverged
+	ExposeXattrUnits                      bool                          `yaml:"expose_xattr_units"`
+	ExposeMountInfo                       bool                          `yaml:"expose_mount_info"`
+	AdjustClockSkew                       bool                          `yaml:"adjust_clock_skew"`
+	DistributedLocks                      bool                          `yaml:"distributed_locks"`
+	PosixACL                              bool                          `yaml:"posix_acl"`
+	ChmodACL                              bool                          `yaml:"chmod_acl"`
+	EnableReplication                     bool                          `yaml:"enable_replication"`   // replicate data objects on setting the replicate xattr, costly writes
+	AllowRuleExecution                    bool                          `yaml:"allow_rule_execution"` // run rules written to /.irodsfs/rule, for the mounting user only
+	AuditClientProcess                    bool                          `yaml:"audit_client_process"`
+	ReadOnly                              bool                          `yaml:"read_only"`
+	CancelPrefetchOnSeek                  bool                          `yaml:"cancel_prefetch_on_seek"`
+	VerifyChecksum                        bool                          `yaml:"verify_checksum"`
+	ChecksumOnWrite                       bool                          `yaml:"checksum_on_write"`
+	ChecksumOnWriteStrict                 bool                          `yaml:"checksum_on_write_strict"` // fail closing files with EIO if checksum computation fails
+	ParallelRead                          bool                          `yaml:"parallel_read"`
+	AdaptivePrefetch                      bool                          `yaml:"adaptive_prefetch"`
+	DeferPrefetch                         bool                          `yaml:"defer_prefetch"`
 
 	MonitorURL string `yaml:"monitor_url,omitempty"`
+	NoAtime    bool   `yaml:"noatime,omitempty"` // read-only accesses are not reported to the monitor
+
+	MetricsEndpoint string `yaml:"metrics_endpoint,omitempty"` // e.g., ":9100", exports Prometheus metrics on /metrics
+	AdminSocket     string `yaml:"admin_socket,omitempty"`     // unix socket path, serves open file handles and locks in JSON
 
 	Profile            bool `yaml:"profile,omitempty"`
 	ProfileServicePort int  `yaml:"profile_service_port,omitempty"`
@@ -116,6 +302,7 @@ type Config struct {
 	ChildProcess bool   `yaml:"childprocess,omitempty"`
 
 	InstanceID  string   `yaml:"instanceid,omitempty"`
+	ConfigPath  string   `yaml:"config_path,omitempty"` // config file given, passed to the child process
 	FuseOptions []string `yaml:"fuse_options,omitempty"`
 }
 
@@ -130,13 +317,16 @@ func NewDefaultConfig() *Config {
 		ClientUser:        "",
 		Zone:              "",
 		Password:          "",
+		PasswordFile:      "",
 		Resource:          "",
+		PreferredResource: "",
 		PathMappings:      []irodsfs_common_vpath.VPathMapping{},
 		NoPermissionCheck: false,
 		NoSetXattr:        false,
 		UID:               uid,
 		GID:               gid,
 		SystemUser:        systemUser,
+		UserMappings:      []UserMapping{},
 
 		DataRootPath: GetDefaultDataRootDirPath(),
 
@@ -154,18 +344,109 @@ func NewDefaultConfig() *Config {
 		SaltSize:                SaltSizeDefault,
 		HashRounds:              HashRoundsDefault,
 
+		PamTokenTTL: 0,
+
 		ReadAheadMax:                          ReadAheadMaxDefault,
+		XattrValueMax:                         XattrValueMaxDefault,
+		IOBlockSize:                           IOBlockSizeDefault,
+		ReadWriteSize:                         ReadWriteSizeDefault,
 		OperationTimeout:                      irodsfs_common_utils.Duration(OperationTimeoutDefault),
+		ListTimeout:                           0, // no timeout
+		ListTimeoutPartialResults:             false,
+		ProtocolErrorRetry:                    0, // do not retry
+		ReconnectMaxRetries:                   0, // do not reconnect
+		TransientErrorRetry:                   0, // do not retry
+		MaxMetadataOpsPerSec:                  0, // unlimited
+		MetadataOpsWaitMax:                    irodsfs_common_utils.Duration(MetadataOpsWaitMaxDefault),
+		MaxReadBandwidth:                      0, // unlimited
+		MaxWriteBandwidth:                     0, // unlimited
+		RetryBudget:                           0, // no limit
+		MountReadyTimeout:                     0, // do not check
+		DistributedLockTimeout:                irodsfs_common_utils.Duration(DistributedLockTimeoutDefault),
+		ShutdownTimeout:                       irodsfs_common_utils.Duration(ShutdownTimeoutDefault),
+		DrainTimeout:                          0, // do not wait for files to be closed
+		ClockSkewCheckInterval:                irodsfs_common_utils.Duration(ClockSkewCheckIntervalDefault),
+		ClockSkewThreshold:                    irodsfs_common_utils.Duration(ClockSkewThresholdDefault),
+		PoolHealthCheckInterval:               irodsfs_common_utils.Duration(PoolHealthCheckIntervalDefault),
+		PoolReconnectBackoffMax:               irodsfs_common_utils.Duration(PoolReconnectBackoffMaxDefault),
+		WriteBackFlushInterval:                0, // no write-back cache
+		WriteBackMaxDirty:                     WriteBackMaxDirtyDefault,
+		MemoryPressureCheckInterval:           0, // do not check
+		MemoryAvailableMin:                    MemoryAvailableMinDefault,
+		IOWorkersMax:                          0, // a goroutine per background task
+		PrefetchWindowInitial:                 0, // io block size
+		PrefetchWindowMax:                     0, // do not grow
+		AlignedReadBlockSize:                  0, // do not align
 		ConnectionLifespan:                    irodsfs_common_utils.Duration(ConnectionLifespanDefault),
 		ConnectionIdleTimeout:                 irodsfs_common_utils.Duration(ConnectionIdleTimeoutDefault),
+		ConnectionKeepaliveInterval:           0, // no keep-alive
 		ConnectionMax:                         ConnectionMaxDefault,
+		DataConnectionMax:                     0, // share connections with metadata operations
+		OpenFileMaxPerUser:                    0, // unlimited
+		MaxBandwidthPerUser:                   0, // unlimited
 		MetadataCacheTimeout:                  irodsfs_common_utils.Duration(MetadataCacheTimeoutDefault),
 		MetadataCacheCleanupTime:              irodsfs_common_utils.Duration(MetadataCacheCleanupTimeDefault),
 		MetadataCacheTimeoutSettings:          []MetadataCacheTimeoutSetting{},
+		DirAttrCacheTimeout:                   irodsfs_common_utils.Duration(DirAttrCacheTimeoutDefault),
+		DirAttrPrefetch:                       false,
+		DirAttrPrefetchBatchSize:              DirAttrPrefetchBatchSizeDefault,
+		ReaddirPlus:                           false,
+		BulkSmallFileMode:                     false,
+		BulkSmallFileMaxSize:                  BulkSmallFileMaxSizeDefault,
+		BulkSmallFileMinReads:                 BulkSmallFileMinReadsDefault,
+		BulkSmallFileBundleMaxSize:            BulkSmallFileBundleMaxSizeDefault,
+		BulkSmallFileStagingCollection:        "",
+		InodeFromPath:                         false,
+		ChangePollInterval:                    0, // do not poll
+		ChangePollPaths:                       []string{},
+		IOHints:                               GetDefaultIOHints(),
+		ReadAheadSettings:                     []ReadAheadSetting{},
 		StartNewTransaction:                   true,
 		InvalidateParentEntryCacheImmediately: false,
+		InaccessibleDirAsEmpty:                false,
+		SharedReadHandle:                      false,
+		TrackLastModifiedBy:                   false,
+		UpgradeReadOnlyHandleOnWrite:          false,
+		FsyncDurable:                          false,
+		CollectionDefaultResource:             false,
+		DirModifyTimeFromChildren:             false,
+		ExposeOpenHandles:                     false,
+		ExposeDataType:                        false,
+		EnableSymlink:                         false,
+		ResolveSoftlinks:                      false,
+		OverlayMappings:                       false,
+		TerminatedErrno:                       TerminatedErrnoDefault,
+		MTimeSource:                           MTimeSourceModify,
+		PersistTimestamps:                     false,
+		DefaultFileMode:                       "", // modes from ACLs
+		DefaultDirMode:                        "", // modes from ACLs
+		CheckClockSkew:                        false,
+		ExposeZone:                            false,
+		ExposeEntryInfo:                       false,
+		ExposeReplicaChecksums:                false,
+		ExposeXattrUnits:                      false,
+		ExposeMountInfo:                       false,
+		AdjustClockSkew:                       false,
+		DistributedLocks:                      false,
+		PosixACL:                              false,
+		ChmodACL:                              false,
+		EnableReplication:                     false,
+		AllowRuleExecution:                    false,
+		AuditClientProcess:                    false,
+		ReadOnly:                              false,
+		CancelPrefetchOnSeek:                  false,
+		VerifyChecksum:                        false,
+		ChecksumOnWrite:                       false,
+		ChecksumOnWriteStrict:                 false,
+		ParallelRead:                          false,
+		AdaptivePrefetch:                      false,
+		DeferPrefetch:                         false,
 
 		MonitorURL: "",
+		NoAtime:    false,
+
+		MetricsEndpoint: "",
+		AdminSocket:     "",
 
 		Profile:            false,
 		ProfileServicePort: ProfileServicePortDefault,
@@ -177,6 +458,7 @@ func NewDefaultConfig() *Config {
 		ChildProcess: false,
 
 		InstanceID:  GetDefaultInstanceID(),
+		ConfigPath:  "",
 		FuseOptions: []string{},
 	}
 }
@@ -190,6 +472,8 @@ func NewConfigFromYAML(yamlBytes []byte) (*Config, error) {
 		return nil, xerrors.Errorf("failed to unmarshal YAML: %w", err)
 	}
 
+	config.OverrideFromEnvironment()
+
 	err = config.CorrectSystemUser()
 	if err != nil {
 		return nil, err
@@ -213,6 +497,25 @@ func NewConfigFromICommandsEnvironment(configPath string) (*Config, error) {
 	return config, nil
 }
 
+// OverrideFromEnvironment overrides sensitive fields with environment variables, empty variables are ignored
+func (config *Config) OverrideFromEnvironment() {
+	if host := os.Getenv(HostEnvName); len(host) > 0 {
+		config.Host = host
+	}
+
+	if proxyUser := os.Getenv(ProxyUserEnvName); len(proxyUser) > 0 {
+		config.ProxyUser = proxyUser
+	}
+
+	if clientUser := os.Getenv(ClientUserEnvName); len(clientUser) > 0 {
+		config.ClientUser = clientUser
+	}
+
+	if password := os.Getenv(PasswordEnvName); len(password) > 0 {
+		config.Password = password
+	}
+}
+
 // CorrectSystemUser corrects system user configuration
 func (config *Config) CorrectSystemUser() error {
 	systemUser, uid, gid, err := utils.CorrectSystemUser(config.SystemUser, config.UID, config.GID)
@@ -223,9 +526,163 @@ func (config *Config) CorrectSystemUser() error {
 	config.SystemUser = systemUser
 	config.UID = uid
 	config.GID = gid
+
+	for idx := range config.UserMappings {
+		mapping := &config.UserMappings[idx]
+		if len(mapping.SystemUser) == 0 {
+			continue
+		}
+
+		_, mappedUID, mappedGID, err := utils.CorrectSystemUser(mapping.SystemUser, -1, -1)
+		if err != nil {
+			return xerrors.Errorf("failed to map iRODS user %q: %w", mapping.IRODSUser, err)
+		}
+
+		mapping.UID = mappedUID
+		mapping.GID = mappedGID
+	}
 	return nil
 }
 
+// CorrectPathMappings normalizes paths in path mappings
+// equivalent paths, e.g., "/a//b/./c/" and "/a/b/c", must resolve to the same iRODS path
+func (config *Config) CorrectPathMappings() {
+	for idx := range config.PathMappings {
+		mapping := &config.PathMappings[idx]
+		if len(mapping.IRODSPath) > 0 {
+			mapping.IRODSPath = path.Clean(mapping.IRODSPath)
+		}
+
+		if len(mapping.MappingPath) > 0 {
+			mapping.MappingPath = path.Clean(mapping.MappingPath)
+		}
+	}
+}
+
+// GetOverlappingPathMappings returns pairs of mapping paths, the second is placed inside of the first
+func (config *Config) GetOverlappingPathMappings() [][2]string {
+	overlaps := [][2]string{}
+	for _, parentMapping := range config.PathMappings {
+		if parentMapping.ResourceType != irodsfs_common_vpath.VPathMappingDirectory {
+			continue
+		}
+
+		for _, mapping := range config.PathMappings {
+			if mapping.MappingPath == parentMapping.MappingPath {
+				continue
+			}
+
+			if strings.HasPrefix(mapping.MappingPath, strings.TrimSuffix(parentMapping.MappingPath, "/")+"/") {
+				overlaps = append(overlaps, [2]string{parentMapping.MappingPath, mapping.MappingPath})
+			}
+		}
+	}
+	return overlaps
+}
+
+// GetTerminatedErrno returns errno returned for operations on a terminated filesystem
+func (config *Config) GetTerminatedErrno() (syscall.Errno, error) {
+	switch strings.ToUpper(config.TerminatedErrno) {
+	case "", "ECONNABORTED":
+		return syscall.ECONNABORTED, nil
+	case "ESHUTDOWN":
+		return syscall.ESHUTDOWN, nil
+	case "ENOTCONN":
+		return syscall.ENOTCONN, nil
+	case "EIO":
+		return syscall.EIO, nil
+	default:
+		return 0, xerrors.Errorf("unknown terminated errno %q", config.TerminatedErrno)
+	}
+}
+
+// GetFileModeMask returns the mask applied to modes of files derived from ACLs
+func (config *Config) GetFileModeMask() (os.FileMode, error) {
+	return parseModeMask(config.DefaultFileMode)
+}
+
+// GetDirModeMask returns the mask applied to modes of dirs derived from ACLs
+func (config *Config) GetDirModeMask() (os.FileMode, error) {
+	return parseModeMask(config.DefaultDirMode)
+}
+
+// parseModeMask parses the octal mode string, returns a mask passing all permissions if it is empty
+func parseModeMask(mode string) (os.FileMode, error) {
+	if len(mode) == 0 {
+		return 0o777, nil
+	}
+
+	modeMask, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || modeMask > 0o777 {
+		return 0, xerrors.Errorf("invalid mode %q, must be octal between 0 and 0777", mode)
+	}
+
+	return os.FileMode(modeMask), nil
+}
+
+// GetIOHint returns I/O hint for the file extension of the path, returns sequential if not given
+func (config *Config) GetIOHint(p string) string {
+	ext := strings.ToLower(path.Ext(p))
+	if hint, ok := config.IOHints[ext]; ok {
+		return hint
+	}
+	return IOHintSequential
+}
+
+// GetPrefetchWindowInitial returns the size of data prefetched ahead of reads when a file is opened
+func (config *Config) GetPrefetchWindowInitial() int {
+	if config.PrefetchWindowInitial > 0 {
+		return config.PrefetchWindowInitial
+	}
+	return config.IOBlockSize
+}
+
+// GetReadAheadSetting returns the read-ahead setting of the closest parent path of p, returns nil if not given
+func (config *Config) GetReadAheadSetting(p string) *ReadAheadSetting {
+	var closest *ReadAheadSetting
+	for idx := range config.ReadAheadSettings {
+		setting := &config.ReadAheadSettings[idx]
+		settingPath := path.Clean(setting.Path)
+
+		if p != settingPath && settingPath != "/" && !strings.HasPrefix(p, settingPath+"/") {
+			continue
+		}
+
+		if closest == nil || len(settingPath) > len(path.Clean(closest.Path)) {
+			closest = setting
+		}
+	}
+	return closest
+}
+
+// GetReadAhead returns the size of data prefetched ahead of reads when the file at p is opened, 0 if not prefetched
+func (config *Config) GetReadAhead(p string) int {
+	setting := config.GetReadAheadSetting(p)
+	if setting != nil {
+		return setting.ReadAhead
+	}
+	return config.GetPrefetchWindowInitial()
+}
+
+// GetPrefetchWindowMax returns the size the prefetch window grows up to on sequential reads
+func (config *Config) GetPrefetchWindowMax() int {
+	if config.PrefetchWindowMax > 0 {
+		return config.PrefetchWindowMax
+	}
+	return config.GetPrefetchWindowInitial()
+}
+
+// IsChangePollPath checks if files at p are polled for changes by other clients once accessed, p is an iRODS path
+func (config *Config) IsChangePollPath(p string) bool {
+	for _, changePollPath := range config.ChangePollPaths {
+		changePollPath = path.Clean(changePollPath)
+		if p == changePollPath || changePollPath == "/" || strings.HasPrefix(p, changePollPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // GetLogFilePath returns log file path
 func (config *Config) GetLogFilePath() string {
 	if len(config.LogPath) > 0 {
@@ -293,8 +750,47 @@ func (config *Config) makeDir(path string) error {
 
 // Validate validates configuration
 func (config *Config) Validate() error {
+	err := config.ValidateSettings()
+	if err != nil {
+		return err
+	}
+
+	return config.ValidateMountPath()
+}
+
+// ValidateMountPath validates the mount point
+func (config *Config) ValidateMountPath() error {
+	if len(config.MountPath) == 0 {
+		return xerrors.Errorf("mount path must be given")
+	}
+
+	mountDirInfo, err := os.Stat(config.MountPath)
+	if err != nil {
+		return xerrors.Errorf("mountpoint %q error: %w", config.MountPath, err)
+	}
+
+	if !mountDirInfo.IsDir() {
+		return xerrors.Errorf("mountpoint %q must be a directory", config.MountPath)
+	}
+
+	mountDirPerm := mountDirInfo.Mode().Perm()
+	if mountDirPerm&0200 != 0200 {
+		return xerrors.Errorf("mountpoint %q must have write permission", config.MountPath)
+	}
+
+	return nil
+}
+
+// ValidateSettings validates configuration other than the mount point
+func (config *Config) ValidateSettings() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "commons",
+		"struct":   "Config",
+		"function": "ValidateSettings",
+	})
+
 	if len(config.Host) == 0 {
-		return xerrors.Errorf("hostname must be given")
+		return xerrors.Errorf("hostname must be given (or set %s)", HostEnvName)
 	}
 
 	if config.Port <= 0 {
@@ -306,11 +802,11 @@ func (config *Config) Validate() error {
 	}
 
 	if len(config.ProxyUser) == 0 {
-		return xerrors.Errorf("proxyUser must be given")
+		return xerrors.Errorf("proxyUser must be given (or set %s)", ProxyUserEnvName)
 	}
 
 	if len(config.ClientUser) == 0 {
-		return xerrors.Errorf("clientUser must be given")
+		return xerrors.Errorf("clientUser must be given (or set %s)", ClientUserEnvName)
 	}
 
 	if len(config.Zone) == 0 {
@@ -318,7 +814,7 @@ func (config *Config) Validate() error {
 	}
 
 	if len(config.Password) == 0 {
-		return xerrors.Errorf("password must be given")
+		return xerrors.Errorf("password must be given (or set %s)", PasswordEnvName)
 	}
 
 	if len(config.PathMappings) == 0 {
@@ -330,30 +826,53 @@ func (config *Config) Validate() error {
 		return xerrors.Errorf("invalid path mappings: %w", err)
 	}
 
-	if config.UID < 0 {
-		return xerrors.Errorf("invalid UID: %w", err)
+	for _, overlap := range config.GetOverlappingPathMappings() {
+		if config.OverlayMappings {
+			logger.Warnf("path mapping %q overlaps %q, listing of %q is merged with the mapping", overlap[1], overlap[0], overlap[0])
+		} else {
+			logger.Warnf("path mapping %q overlaps %q, the mapping is not listed in %q, set overlay_mappings to list it", overlap[1], overlap[0], overlap[0])
+		}
 	}
 
-	if config.GID < 0 {
-		return xerrors.Errorf("invalid GID: %w", err)
+	unknownFuseOptions, err := ValidateFuseOptions(config.FuseOptions)
+	if err != nil {
+		return xerrors.Errorf("invalid fuse options: %w", err)
 	}
 
-	if len(config.MountPath) == 0 {
-		return xerrors.Errorf("mount path must be given")
+	for _, unknownFuseOption := range unknownFuseOptions {
+		logger.Warnf("unknown fuse option %q, passing it to fusermount as given", unknownFuseOption)
 	}
 
-	mountDirInfo, err := os.Stat(config.MountPath)
-	if err != nil {
-		return xerrors.Errorf("mountpoint %q error: %w", config.MountPath, err)
+	if config.ReadOnly && HasFuseOption(config.FuseOptions, "rw") {
+		return xerrors.Errorf("fuse option %q conflicts with readonly", "rw")
 	}
 
-	if !mountDirInfo.IsDir() {
-		return xerrors.Errorf("mountpoint %q must be a directory", config.MountPath)
+	if config.AllowOther && HasFuseOption(config.FuseOptions, "allow_root") {
+		return xerrors.Errorf("fuse option %q conflicts with allow_other", "allow_root")
 	}
 
-	mountDirPerm := mountDirInfo.Mode().Perm()
-	if mountDirPerm&0200 != 0200 {
-		return xerrors.Errorf("mountpoint %q must have write permission", config.MountPath)
+	if config.UID < 0 {
+		return xerrors.Errorf("invalid UID: %w", err)
+	}
+
+	if config.GID < 0 {
+		return xerrors.Errorf("invalid GID: %w", err)
+	}
+
+	mappedIRODSUsers := map[string]bool{}
+	for _, mapping := range config.UserMappings {
+		if len(mapping.IRODSUser) == 0 {
+			return xerrors.Errorf("iRODS user of user mapping must be given")
+		}
+
+		if mappedIRODSUsers[mapping.IRODSUser] {
+			return xerrors.Errorf("iRODS user %q is mapped more than once", mapping.IRODSUser)
+		}
+		mappedIRODSUsers[mapping.IRODSUser] = true
+
+		if mapping.UID < 0 || mapping.GID < 0 {
+			return xerrors.Errorf("invalid UID or GID for iRODS user %q", mapping.IRODSUser)
+		}
 	}
 
 	if len(config.DataRootPath) == 0 {
@@ -364,23 +883,280 @@ func (config *Config) Validate() error {
 		return xerrors.Errorf("readahead max must be equal or greater than 0")
 	}
 
+	if config.XattrValueMax < 0 {
+		return xerrors.Errorf("xattr value max must be equal or greater than 0")
+	}
+
+	if config.IOBlockSize < IOBlockSizeMin || config.IOBlockSize&(config.IOBlockSize-1) != 0 {
+		return xerrors.Errorf("io block size must be a power of two equal or greater than %d", IOBlockSizeMin)
+	}
+
+	if config.ReadWriteSize <= 0 || config.ReadWriteSize > ReadWriteSizeMax {
+		return xerrors.Errorf("read write size must be greater than 0 and equal or less than %d", ReadWriteSizeMax)
+	}
+
 	if config.ConnectionMax < 1 {
 		return xerrors.Errorf("connection max must be equal or greater than 1")
 	}
 
+	if config.DataConnectionMax < 0 {
+		return xerrors.Errorf("data connection max must be equal or greater than 0")
+	}
+
+	if config.ListTimeout < 0 {
+		return xerrors.Errorf("list timeout must be equal or greater than 0")
+	}
+
+	if config.ListTimeoutPartialResults && (config.ListTimeout == 0 || config.DirAttrCacheTimeout == 0) {
+		// entries known are those in the dir attr cache
+		return xerrors.Errorf("list timeout partial results requires list timeout and dir attr cache timeout")
+	}
+
+	if config.OpenFileMaxPerUser < 0 {
+		return xerrors.Errorf("open file max per user must be equal or greater than 0")
+	}
+
+	if config.MaxBandwidthPerUser < 0 {
+		return xerrors.Errorf("max bandwidth per user must be equal or greater than 0")
+	}
+
+	if config.ProtocolErrorRetry < 0 {
+		return xerrors.Errorf("protocol error retry must be equal or greater than 0")
+	}
+
+	if config.MaxMetadataOpsPerSec < 0 {
+		return xerrors.Errorf("max metadata ops per sec must be equal or greater than 0")
+	}
+
+	if config.MetadataOpsWaitMax < 0 {
+		return xerrors.Errorf("metadata ops wait max must be equal or greater than 0")
+	}
+
+	if config.RetryBudget < 0 {
+		return xerrors.Errorf("retry budget must be equal or greater than 0")
+	}
+
+	if config.MountReadyTimeout < 0 {
+		return xerrors.Errorf("mount ready timeout must be equal or greater than 0")
+	}
+
+	if config.MaxReadBandwidth < 0 {
+		return xerrors.Errorf("max read bandwidth must be equal or greater than 0")
+	}
+
+	if config.MaxWriteBandwidth < 0 {
+		return xerrors.Errorf("max write bandwidth must be equal or greater than 0")
+	}
+
+	if config.DistributedLockTimeout < 0 {
+		return xerrors.Errorf("distributed lock timeout must be equal or greater than 0")
+	}
+
+	if config.DirAttrCacheTimeout < 0 {
+		return xerrors.Errorf("dir attr cache timeout must be equal or greater than 0")
+	}
+
+	if config.DirAttrPrefetchBatchSize < 0 {
+		return xerrors.Errorf("dir attr prefetch batch size must be equal or greater than 0")
+	}
+
+	if config.ChangePollInterval < 0 {
+		return xerrors.Errorf("change poll interval must be equal or greater than 0")
+	}
+
+	if config.BulkSmallFileMaxSize < 0 {
+		return xerrors.Errorf("bulk small file max size must be equal or greater than 0")
+	}
+
+	if config.BulkSmallFileMinReads < 0 {
+		return xerrors.Errorf("bulk small file min reads must be equal or greater than 0")
+	}
+
+	if config.BulkSmallFileBundleMaxSize < 0 {
+		return xerrors.Errorf("bulk small file bundle max size must be equal or greater than 0")
+	}
+
+	if config.BulkSmallFileMode {
+		if len(config.BulkSmallFileStagingCollection) == 0 {
+			return xerrors.Errorf("bulk small file staging collection must be given for bulk small file mode")
+		}
+
+		if !path.IsAbs(config.BulkSmallFileStagingCollection) {
+			return xerrors.Errorf("bulk small file staging collection %q must be an absolute iRODS path", config.BulkSmallFileStagingCollection)
+		}
+	}
+
+	for _, changePollPath := range config.ChangePollPaths {
+		if !path.IsAbs(changePollPath) {
+			return xerrors.Errorf("change poll path %q must be an absolute iRODS path", changePollPath)
+		}
+	}
+
+	if config.DirAttrPrefetch && config.DirAttrCacheTimeout == 0 {
+		return xerrors.Errorf("dir attr prefetch requires dir attr cache timeout")
+	}
+
+	if config.ReaddirPlus && config.DirAttrCacheTimeout == 0 {
+		// lookups of entries listed are served from the listing
+		return xerrors.Errorf("readdir plus requires dir attr cache timeout")
+	}
+
+	if config.DirModifyTimeFromChildren && config.DirAttrCacheTimeout == 0 {
+		// modify times of children are taken from the listing, not to list the dir on every stat
+		return xerrors.Errorf("dir modify time from children requires dir attr cache timeout")
+	}
+
+	if config.ShutdownTimeout < 0 {
+		return xerrors.Errorf("shutdown timeout must be equal or greater than 0")
+	}
+
+	if config.DrainTimeout < 0 {
+		return xerrors.Errorf("drain timeout must be equal or greater than 0")
+	}
+
+	if config.ClockSkewCheckInterval < 0 {
+		return xerrors.Errorf("clock skew check interval must be equal or greater than 0")
+	}
+
+	if config.ClockSkewThreshold < 0 {
+		return xerrors.Errorf("clock skew threshold must be equal or greater than 0")
+	}
+
+	if config.PoolHealthCheckInterval < 0 {
+		return xerrors.Errorf("pool health check interval must be equal or greater than 0")
+	}
+
+	if config.PoolReconnectBackoffMax < 0 {
+		return xerrors.Errorf("pool reconnect backoff max must be equal or greater than 0")
+	}
+
+	for ext, hint := range config.IOHints {
+		if hint != IOHintSequential && hint != IOHintRandom {
+			return xerrors.Errorf("unknown I/O hint %q for extension %q", hint, ext)
+		}
+	}
+
+	if config.WriteBackFlushInterval < 0 {
+		return xerrors.Errorf("write back flush interval must be equal or greater than 0")
+	}
+
+	if config.WriteBackFlushInterval > 0 && config.WriteBackMaxDirty <= 0 {
+		return xerrors.Errorf("write back max dirty must be greater than 0")
+	}
+
+	if config.MemoryPressureCheckInterval < 0 {
+		return xerrors.Errorf("memory pressure check interval must be equal or greater than 0")
+	}
+
+	if config.MemoryPressureCheckInterval > 0 && config.MemoryAvailableMin <= 0 {
+		return xerrors.Errorf("memory available min must be greater than 0")
+	}
+
+	for _, window := range []int{config.PrefetchWindowInitial, config.PrefetchWindowMax} {
+		if window != 0 && (window < IOBlockSizeMin || window&(window-1) != 0) {
+			return xerrors.Errorf("prefetch window must be 0 or a power of two equal or greater than %d", IOBlockSizeMin)
+		}
+
+		if window > PrefetchWindowLimit {
+			return xerrors.Errorf("prefetch window must be equal or less than %d", PrefetchWindowLimit)
+		}
+	}
+
+	if config.PrefetchWindowMax > 0 && config.PrefetchWindowMax < config.GetPrefetchWindowInitial() {
+		return xerrors.Errorf("prefetch window max must be equal or greater than prefetch window initial")
+	}
+
+	readAheadPaths := map[string]bool{}
+	for _, setting := range config.ReadAheadSettings {
+		if !path.IsAbs(setting.Path) {
+			return xerrors.Errorf("read-ahead setting path %q must be an absolute path", setting.Path)
+		}
+
+		settingPath := path.Clean(setting.Path)
+		if readAheadPaths[settingPath] {
+			return xerrors.Errorf("read-ahead setting path %q is given more than once", setting.Path)
+		}
+		readAheadPaths[settingPath] = true
+
+		if setting.ReadAhead != 0 && (setting.ReadAhead < IOBlockSizeMin || setting.ReadAhead&(setting.ReadAhead-1) != 0) {
+			return xerrors.Errorf("read-ahead of path %q must be 0 or a power of two equal or greater than %d", setting.Path, IOBlockSizeMin)
+		}
+	}
+
+	if config.AlignedReadBlockSize != 0 && (config.AlignedReadBlockSize < AlignedReadBlockSizeMin || config.AlignedReadBlockSize&(config.AlignedReadBlockSize-1) != 0) {
+		return xerrors.Errorf("aligned read block size must be 0 or a power of two equal or greater than %d", AlignedReadBlockSizeMin)
+	}
+
+	if config.ReconnectMaxRetries < 0 {
+		return xerrors.Errorf("reconnect max retries must be equal or greater than 0")
+	}
+
+	if config.PamTokenTTL < 0 {
+		return xerrors.Errorf("PAM token TTL must be equal or greater than 0")
+	}
+
+	if config.ConnectionKeepaliveInterval < 0 {
+		return xerrors.Errorf("connection keep-alive interval must be equal or greater than 0")
+	}
+
+	if config.ConnectionKeepaliveInterval > 0 && config.ConnectionIdleTimeout > 0 && config.ConnectionKeepaliveInterval >= config.ConnectionIdleTimeout {
+		return xerrors.Errorf("connection keep-alive interval must be less than connection idle timeout")
+	}
+
+	if config.TransientErrorRetry < 0 {
+		return xerrors.Errorf("transient error retry must be equal or greater than 0")
+	}
+
+	if config.IOWorkersMax < 0 {
+		return xerrors.Errorf("I/O workers max must be equal or greater than 0")
+	}
+
+	if config.ReadOnly && config.UpgradeReadOnlyHandleOnWrite {
+		return xerrors.Errorf("read only mount cannot upgrade read-only handles on write")
+	}
+
+	switch config.MTimeSource {
+	case MTimeSourceModify, MTimeSourceCreate, MTimeSourceReplica:
+	default:
+		return xerrors.Errorf("unknown mtime source %q", config.MTimeSource)
+	}
+
+	_, err = config.GetTerminatedErrno()
+	if err != nil {
+		return err
+	}
+
+	_, err = config.GetFileModeMask()
+	if err != nil {
+		return xerrors.Errorf("invalid default file mode: %w", err)
+	}
+
+	_, err = config.GetDirModeMask()
+	if err != nil {
+		return xerrors.Errorf("invalid default dir mode: %w", err)
+	}
+
 	authScheme := irodsclient_types.GetAuthScheme(config.AuthScheme)
 	if config.ClientServerNegotiation {
 		if len(config.CSNegotiationPolicy) == 0 {
 			return xerrors.Errorf("CS negotiation policy must be given")
 		}
+
+		if !containsFold(csNegotiationPolicies, config.CSNegotiationPolicy) {
+			return xerrors.Errorf("unknown CS negotiation policy %q, must be one of %s", config.CSNegotiationPolicy, strings.Join(csNegotiationPolicies, ", "))
+		}
 	}
 
-	policy, err := irodsclient_types.GetCSNegotiationPolicy(config.CSNegotiationPolicy)
-	if err != nil {
-		policy = irodsclient_types.CSNegotiationUseTCP
+	csNegotiationRequire := irodsclient_types.CSNegotiationRequireTCP
+	if config.ClientServerNegotiation {
+		csNegotiationRequire = irodsclient_types.CSNegotiationRequire(strings.ToUpper(config.CSNegotiationPolicy))
 	}
 
-	if authScheme == irodsclient_types.AuthSchemePAM || policy == irodsclient_types.CSNegotiationUseSSL {
+	// PAM always uses SSL, native auth uses SSL if the client requires it, or if the client doesn't care and the server requires it
+	sslRequired := authScheme == irodsclient_types.AuthSchemePAM || csNegotiationRequire == irodsclient_types.CSNegotiationRequireSSL
+	sslNegotiable := sslRequired || csNegotiationRequire == irodsclient_types.CSNegotiationDontCare
+
+	if sslRequired {
 		if config.EncryptionKeySize <= 0 {
 			return xerrors.Errorf("SSL encryption key size must be given")
 		}
@@ -389,6 +1165,10 @@ func (config *Config) Validate() error {
 			return xerrors.Errorf("SSL encryption algorithm must be given")
 		}
 
+		if !containsFold(encryptionAlgorithms, config.EncryptionAlgorithm) {
+			return xerrors.Errorf("unsupported SSL encryption algorithm %q, must be one of %s", config.EncryptionAlgorithm, strings.Join(encryptionAlgorithms, ", "))
+		}
+
 		if config.SaltSize <= 0 {
 			return xerrors.Errorf("SSL salt size must be given")
 		}
@@ -398,16 +1178,71 @@ func (config *Config) Validate() error {
 		}
 	}
 
+	if sslNegotiable {
+		if len(config.CACertificateFile) > 0 {
+			caCertFileStat, err := os.Stat(config.CACertificateFile)
+			if err != nil {
+				return xerrors.Errorf("failed to stat SSL CA certificate file %q: %w", config.CACertificateFile, err)
+			}
+
+			if caCertFileStat.IsDir() {
+				return xerrors.Errorf("SSL CA certificate file %q is a directory", config.CACertificateFile)
+			}
+		}
+
+		if len(config.CACertificatePath) > 0 {
+			caCertPathStat, err := os.Stat(config.CACertificatePath)
+			if err != nil {
+				return xerrors.Errorf("failed to stat SSL CA certificate path %q: %w", config.CACertificatePath, err)
+			}
+
+			if !caCertPathStat.IsDir() {
+				return xerrors.Errorf("SSL CA certificate path %q is not a directory", config.CACertificatePath)
+			}
+		}
+	}
+
 	if len(config.PoolEndpoint) > 0 {
 		_, _, err := ParsePoolServiceEndpoint(config.PoolEndpoint)
 		if err != nil {
 			return err
 		}
+
+		// these run through go-irodsclient with the direct fs client, irodsfs-pool clients cannot do them
+		// expose_data_type and expose_xattr_units still present data types and units, but cannot set them
+		poolUnsupportedOptions := []struct {
+			name    string
+			enabled bool
+		}{
+			{"chmod_acl", config.ChmodACL},
+			{"enable_replication", config.EnableReplication},
+			{"allow_rule_execution", config.AllowRuleExecution},
+			{"bulk_small_file_mode", config.BulkSmallFileMode},
+			{"checksum_on_write", config.ChecksumOnWrite},
+			{"expose_replica_checksums", config.ExposeReplicaChecksums},
+			{"mtime_source replica", config.MTimeSource == MTimeSourceReplica},
+		}
+
+		for _, option := range poolUnsupportedOptions {
+			if option.enabled {
+				return xerrors.Errorf("%s is not supported with pool endpoint %q", option.name, config.PoolEndpoint)
+			}
+		}
 	}
 
 	return nil
 }
 
+// containsFold checks if the values contain the value, case-insensitively
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
 // ParsePoolServiceEndpoint parses endpoint string
 func ParsePoolServiceEndpoint(endpoint string) (string, string, error) {
 	u, err := url.Parse(endpoint)
@@ -432,6 +1267,45 @@ func ParsePoolServiceEndpoint(endpoint string) (string, string, error) {
 	}
 }
 
+// ReadPasswordFile reads the password from the file, the file must not be accessible by group or others
+// the first line is the password, trailing newline is trimmed
+func ReadPasswordFile(passwordFilePath string) (string, error) {
+	// check and read the same file, opened without blocking on FIFOs
+	passwordFile, err := os.OpenFile(passwordFilePath, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return "", xerrors.Errorf("failed to open password file %q: %w", passwordFilePath, err)
+	}
+	defer passwordFile.Close()
+
+	st, err := passwordFile.Stat()
+	if err != nil {
+		return "", xerrors.Errorf("failed to stat password file %q: %w", passwordFilePath, err)
+	}
+
+	if !st.Mode().IsRegular() {
+		return "", xerrors.Errorf("password file %q is not a regular file", passwordFilePath)
+	}
+
+	if st.Mode().Perm()&0o077 != 0 {
+		return "", xerrors.Errorf("password file %q must not be accessible by group or others, mode is %o", passwordFilePath, st.Mode().Perm())
+	}
+
+	passwordBytes, err := io.ReadAll(passwordFile)
+	if err != nil {
+		return "", xerrors.Errorf("failed to read password file %q: %w", passwordFilePath, err)
+	}
+
+	return GetPasswordLine(string(passwordBytes)), nil
+}
+
+// GetPasswordLine returns the first line of the text, without trailing newline
+func GetPasswordLine(text string) string {
+	if idx := strings.IndexAny(text, "\r\n"); idx >= 0 {
+		return text[:idx]
+	}
+	return text
+}
+
 func IsYAMLFile(filePath string) bool {
 	st, err := os.Stat(filePath)
 	if err != nil {
@@ -0,0 +1,576 @@
+package commons
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
+	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
+)
+
+func TestIsChangePollPath(t *testing.T) {
+	config := NewDefaultConfig()
+	config.ChangePollPaths = []string{"/zone/home/user/shared/"}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/zone/home/user/shared", true},
+		{"/zone/home/user/shared/file.txt", true},
+		{"/zone/home/user/shared/dir/file.txt", true},
+		{"/zone/home/user/shared2/file.txt", false},
+		{"/zone/home/user/file.txt", false},
+	}
+
+	for _, test := range tests {
+		if polled := config.IsChangePollPath(test.path); polled != test.expected {
+			t.Errorf("path %q: expected %t, got %t", test.path, test.expected, polled)
+		}
+	}
+
+	config.ChangePollPaths = []string{}
+	if config.IsChangePollPath("/zone/home/user/shared/file.txt") {
+		t.Errorf("expected no path polled by default")
+	}
+}
+
+func TestGetReadAhead(t *testing.T) {
+	config := NewDefaultConfig()
+	config.PrefetchWindowInitial = 1024
+	config.ReadAheadSettings = []ReadAheadSetting{
+		{Path: "/zone/home/user/data", ReadAhead: 4096},
+		{Path: "/zone/home/user/data/streams/", ReadAhead: 65536},
+		{Path: "/zone/home/user/random", ReadAhead: 0},
+	}
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/zone/home/user/data", 4096},
+		{"/zone/home/user/data/file.txt", 4096},
+		// the closest parent wins, trailing slashes are ignored
+		{"/zone/home/user/data/streams/video.mp4", 65536},
+		{"/zone/home/user/data/streams", 65536},
+		// matched by path components, not by string prefixes
+		{"/zone/home/user/data2/file.txt", 1024},
+		{"/zone/home/user/data/streams2/video.mp4", 4096},
+		// 0 disables prefetching under the path
+		{"/zone/home/user/random/file.db", 0},
+		{"/zone/home/user/file.txt", 1024},
+	}
+
+	for _, test := range tests {
+		if readAhead := config.GetReadAhead(test.path); readAhead != test.expected {
+			t.Errorf("path %q: expected read-ahead %d, got %d", test.path, test.expected, readAhead)
+		}
+	}
+
+	// the root matches all paths
+	config.ReadAheadSettings = append(config.ReadAheadSettings, ReadAheadSetting{Path: "/", ReadAhead: 2048})
+	if readAhead := config.GetReadAhead("/zone/home/user/file.txt"); readAhead != 2048 {
+		t.Errorf("expected read-ahead %d of the root, got %d", 2048, readAhead)
+	}
+
+	if readAhead := config.GetReadAhead("/zone/home/user/data/file.txt"); readAhead != 4096 {
+		t.Errorf("expected read-ahead %d of the closest parent over the root, got %d", 4096, readAhead)
+	}
+}
+
+// newValidConfig returns a config passing validation, for tests changing a setting
+func newValidConfig() *Config {
+	config := NewDefaultConfig()
+	config.Host = "irods.example.org"
+	config.Port = 1247
+	config.ProxyUser = "user"
+	config.ClientUser = "user"
+	config.Zone = "zone"
+	config.Password = "password"
+	config.PathMappings = []irodsfs_common_vpath.VPathMapping{
+		{
+			IRODSPath:    "/zone/home/user",
+			MappingPath:  "/",
+			ResourceType: irodsfs_common_vpath.VPathMappingDirectory,
+		},
+	}
+	return config
+}
+
+func TestDefaultConfigDirAttrCacheOff(t *testing.T) {
+	config := NewDefaultConfig()
+	if config.DirAttrCacheTimeout != 0 {
+		t.Errorf("expected dir attr cache off by default, got timeout %v", config.DirAttrCacheTimeout)
+	}
+}
+
+func TestValidateSettingsReaddirPlus(t *testing.T) {
+	config := newValidConfig()
+	config.ReaddirPlus = true
+	config.DirAttrCacheTimeout = irodsfs_common_utils.Duration(3 * time.Second)
+
+	err := config.ValidateSettings()
+	if err != nil {
+		t.Fatalf("expected readdir plus with dir attr cache valid, got %v", err)
+	}
+
+	config.DirAttrCacheTimeout = 0
+
+	err = config.ValidateSettings()
+	if err == nil {
+		t.Errorf("expected readdir plus without dir attr cache invalid")
+	}
+}
+
+func TestValidateSettingsPrefetchWindow(t *testing.T) {
+	testCases := []struct {
+		initial int
+		max     int
+		valid   bool
+	}{
+		{0, 0, true},
+		{IOBlockSizeMin, PrefetchWindowLimit, true},
+		{IOBlockSizeMin, PrefetchWindowLimit * 2, false},
+		{PrefetchWindowLimit * 2, 0, false},
+		{IOBlockSizeMin + 1, 0, false},
+		{IOBlockSizeMin * 4, IOBlockSizeMin * 2, false},
+	}
+
+	for _, testCase := range testCases {
+		config := newValidConfig()
+		config.PrefetchWindowInitial = testCase.initial
+		config.PrefetchWindowMax = testCase.max
+
+		err := config.ValidateSettings()
+		if testCase.valid && err != nil {
+			t.Errorf("expected prefetch window %d to %d valid, got %v", testCase.initial, testCase.max, err)
+		} else if !testCase.valid && err == nil {
+			t.Errorf("expected prefetch window %d to %d invalid", testCase.initial, testCase.max)
+		}
+	}
+}
+
+func TestValidateSettingsSSL(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(config *Config)
+		valid  bool
+	}{
+		{"no CS negotiation", func(config *Config) {}, true},
+		{"CS negotiation require SSL", func(config *Config) {
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REQUIRE"
+		}, true},
+		{"CS negotiation policy in lower case", func(config *Config) {
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "cs_neg_dont_care"
+		}, true},
+		{"CS negotiation without policy", func(config *Config) {
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = ""
+		}, false},
+		{"unknown CS negotiation policy", func(config *Config) {
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_USE_SSL"
+		}, false},
+		{"SSL without encryption algorithm", func(config *Config) {
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REQUIRE"
+			config.EncryptionAlgorithm = ""
+		}, false},
+		{"SSL with unsupported encryption algorithm", func(config *Config) {
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REQUIRE"
+			config.EncryptionAlgorithm = "DES-CBC"
+		}, false},
+		{"PAM", func(config *Config) {
+			config.AuthScheme = "pam"
+		}, true},
+		{"PAM with unsupported encryption algorithm", func(config *Config) {
+			config.AuthScheme = "pam"
+			config.EncryptionAlgorithm = "DES-CBC"
+		}, false},
+		{"unsupported encryption algorithm without SSL", func(config *Config) {
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REFUSE"
+			config.EncryptionAlgorithm = "DES-CBC"
+		}, true},
+		{"SSL without encryption key size", func(config *Config) {
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REQUIRE"
+			config.EncryptionKeySize = 0
+		}, false},
+		{"native auth requiring SSL", func(config *Config) {
+			config.AuthScheme = "native"
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REQUIRE"
+		}, true},
+		{"native auth requiring SSL without salt size", func(config *Config) {
+			config.AuthScheme = "native"
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REQUIRE"
+			config.SaltSize = 0
+		}, false},
+		{"native auth requiring SSL without hash rounds", func(config *Config) {
+			config.AuthScheme = "native"
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REQUIRE"
+			config.HashRounds = 0
+		}, false},
+		{"native auth requiring SSL with CA certificate path not a dir", func(config *Config) {
+			config.AuthScheme = "native"
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REQUIRE"
+			config.CACertificatePath = os.Args[0]
+		}, false},
+		{"native auth refusing SSL with missing CA certificate file", func(config *Config) {
+			config.AuthScheme = "native"
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_REFUSE"
+			config.CACertificateFile = "/nonexistent/ca.pem"
+		}, true},
+		{"SSL with missing CA certificate file", func(config *Config) {
+			config.ClientServerNegotiation = true
+			config.CSNegotiationPolicy = "CS_NEG_DONT_CARE"
+			config.CACertificateFile = "/nonexistent/ca.pem"
+		}, false},
+	}
+
+	for _, testCase := range testCases {
+		config := newValidConfig()
+		testCase.modify(config)
+
+		err := config.ValidateSettings()
+		if testCase.valid && err != nil {
+			t.Errorf("%s: expected valid, got %v", testCase.name, err)
+		} else if !testCase.valid && err == nil {
+			t.Errorf("%s: expected invalid", testCase.name)
+		}
+	}
+}
+
+func TestCorrectPathMappings(t *testing.T) {
+	tests := []struct {
+		irodsPath           string
+		mappingPath         string
+		expectedIRODSPath   string
+		expectedMappingPath string
+	}{
+		{"/zone/home/user", "/", "/zone/home/user", "/"},
+		{"/zone/home/user/", "/data/", "/zone/home/user", "/data"},
+		{"/zone//home/./user", "//data//dir", "/zone/home/user", "/data/dir"},
+		{"/zone/home/user/../shared", "/data/./shared/", "/zone/home/shared", "/data/shared"},
+		// empty paths are left for validation
+		{"", "", "", ""},
+	}
+
+	for _, test := range tests {
+		config := NewDefaultConfig()
+		config.PathMappings = []irodsfs_common_vpath.VPathMapping{
+			{
+				IRODSPath:    test.irodsPath,
+				MappingPath:  test.mappingPath,
+				ResourceType: irodsfs_common_vpath.VPathMappingDirectory,
+			},
+		}
+
+		config.CorrectPathMappings()
+
+		mapping := config.PathMappings[0]
+		if mapping.IRODSPath != test.expectedIRODSPath {
+			t.Errorf("iRODS path %q: expected %q, got %q", test.irodsPath, test.expectedIRODSPath, mapping.IRODSPath)
+		}
+
+		if mapping.MappingPath != test.expectedMappingPath {
+			t.Errorf("mapping path %q: expected %q, got %q", test.mappingPath, test.expectedMappingPath, mapping.MappingPath)
+		}
+	}
+}
+
+func TestCorrectPathMappingsEquivalentPaths(t *testing.T) {
+	config := NewDefaultConfig()
+	config.PathMappings = []irodsfs_common_vpath.VPathMapping{
+		{IRODSPath: "/zone/home/user/", MappingPath: "/data/"},
+		{IRODSPath: "/zone//home/user", MappingPath: "/data/."},
+	}
+
+	config.CorrectPathMappings()
+
+	if config.PathMappings[0] != config.PathMappings[1] {
+		t.Errorf("expected equivalent mappings normalized the same, got %+v and %+v", config.PathMappings[0], config.PathMappings[1])
+	}
+}
+
+func TestGetOverlappingPathMappings(t *testing.T) {
+	config := NewDefaultConfig()
+	config.PathMappings = []irodsfs_common_vpath.VPathMapping{
+		{IRODSPath: "/zone/home/user", MappingPath: "/data", ResourceType: irodsfs_common_vpath.VPathMappingDirectory},
+		{IRODSPath: "/zone/home/shared", MappingPath: "/data/shared", ResourceType: irodsfs_common_vpath.VPathMappingDirectory},
+		// matched by path components, not by string prefixes
+		{IRODSPath: "/zone/home/other", MappingPath: "/data2", ResourceType: irodsfs_common_vpath.VPathMappingDirectory},
+		// files do not contain other mappings
+		{IRODSPath: "/zone/home/user/file.txt", MappingPath: "/file.txt", ResourceType: irodsfs_common_vpath.VPathMappingFile},
+	}
+
+	overlaps := config.GetOverlappingPathMappings()
+	if len(overlaps) != 1 || overlaps[0] != [2]string{"/data", "/data/shared"} {
+		t.Errorf("expected /data/shared overlapping /data, got %v", overlaps)
+	}
+
+	// the root contains all other mappings
+	config.PathMappings = append(config.PathMappings, irodsfs_common_vpath.VPathMapping{IRODSPath: "/zone/home", MappingPath: "/", ResourceType: irodsfs_common_vpath.VPathMappingDirectory})
+	if overlaps := config.GetOverlappingPathMappings(); len(overlaps) != 5 {
+		t.Errorf("expected 5 overlaps with the root mapped, got %v", overlaps)
+	}
+}
+
+func TestReadPasswordFile(t *testing.T) {
+	dir := t.TempDir()
+
+	passwordFilePath := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFilePath, []byte("secret\nignored\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	password, err := ReadPasswordFile(passwordFilePath)
+	if err != nil {
+		t.Fatalf("failed to read password file - %v", err)
+	}
+
+	if password != "secret" {
+		t.Errorf("expected password %q, got %q", "secret", password)
+	}
+
+	openFilePath := filepath.Join(dir, "open_password")
+	if err := os.WriteFile(openFilePath, []byte("secret\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fifoPath := filepath.Join(dir, "fifo")
+	if err := syscall.Mkfifo(fifoPath, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// a FIFO is rejected without waiting for a writer
+	for _, invalidPath := range []string{openFilePath, dir, fifoPath, filepath.Join(dir, "missing")} {
+		if _, err := ReadPasswordFile(invalidPath); err == nil {
+			t.Errorf("%q: expected rejected", invalidPath)
+		}
+	}
+}
+
+func TestGetTerminatedErrno(t *testing.T) {
+	testCases := []struct {
+		terminatedErrno string
+		expected        syscall.Errno
+		valid           bool
+	}{
+		{"", syscall.ECONNABORTED, true},
+		{TerminatedErrnoDefault, syscall.ECONNABORTED, true},
+		{"ESHUTDOWN", syscall.ESHUTDOWN, true},
+		{"enotconn", syscall.ENOTCONN, true},
+		{"EIO", syscall.EIO, true},
+		{"ENOENT", 0, false},
+	}
+
+	for _, testCase := range testCases {
+		config := newValidConfig()
+		config.TerminatedErrno = testCase.terminatedErrno
+
+		errno, err := config.GetTerminatedErrno()
+		if !testCase.valid {
+			if err == nil {
+				t.Errorf("expected terminated errno %q invalid", testCase.terminatedErrno)
+			}
+
+			if config.ValidateSettings() == nil {
+				t.Errorf("expected config with terminated errno %q invalid", testCase.terminatedErrno)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected terminated errno %q valid, got %v", testCase.terminatedErrno, err)
+			continue
+		}
+
+		if errno != testCase.expected {
+			t.Errorf("terminated errno %q: expected %v, got %v", testCase.terminatedErrno, testCase.expected, errno)
+		}
+	}
+}
+
+func TestGetIOHint(t *testing.T) {
+	config := NewDefaultConfig()
+	config.IOHints[".log"] = IOHintRandom
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/zone/home/user/app.sqlite", IOHintRandom},
+		{"/zone/home/user/archive.zip", IOHintRandom},
+		{"/zone/home/user/video.mp4", IOHintSequential},
+		// extensions are compared case-insensitively
+		{"/zone/home/user/VIDEO.MP4", IOHintSequential},
+		{"/zone/home/user/APP.SQLITE", IOHintRandom},
+		// hints given override defaults
+		{"/zone/home/user/server.log", IOHintRandom},
+		// no hint, sequential
+		{"/zone/home/user/notes.txt", IOHintSequential},
+		{"/zone/home/user/noext", IOHintSequential},
+	}
+
+	for _, test := range tests {
+		if hint := config.GetIOHint(test.path); hint != test.expected {
+			t.Errorf("path %q: expected hint %q, got %q", test.path, test.expected, hint)
+		}
+	}
+}
+
+func TestValidateSettingsIOHints(t *testing.T) {
+	config := newValidConfig()
+	config.IOHints[".parquet"] = IOHintRandom
+
+	err := config.ValidateSettings()
+	if err != nil {
+		t.Fatalf("expected I/O hints valid, got %v", err)
+	}
+
+	config.IOHints[".parquet"] = "columnar"
+
+	err = config.ValidateSettings()
+	if err == nil {
+		t.Errorf("expected unknown I/O hint invalid")
+	}
+}
+
+func TestValidateSettingsReadOnly(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(config *Config)
+		valid  bool
+	}{
+		{"read only", func(config *Config) {}, true},
+		{"with allow_other", func(config *Config) { config.AllowOther = true }, true},
+		{"with ro fuse option", func(config *Config) { config.FuseOptions = []string{"ro"} }, true},
+		{"with rw fuse option", func(config *Config) { config.FuseOptions = []string{"rw"} }, false},
+		{"with upgrade on write", func(config *Config) { config.UpgradeReadOnlyHandleOnWrite = true }, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := newValidConfig()
+			config.ReadOnly = true
+			testCase.modify(config)
+
+			err := config.ValidateSettings()
+			if testCase.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			} else if !testCase.valid && err == nil {
+				t.Errorf("expected invalid")
+			}
+		})
+	}
+}
+
+func TestValidateSettingsPoolEndpoint(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(config *Config)
+		valid  bool
+	}{
+		{"pool endpoint", func(config *Config) {}, true},
+		{"with expose_data_type", func(config *Config) { config.ExposeDataType = true }, true},
+		{"with chmod_acl", func(config *Config) { config.ChmodACL = true }, false},
+		{"with enable_replication", func(config *Config) { config.EnableReplication = true }, false},
+		{"with allow_rule_execution", func(config *Config) { config.AllowRuleExecution = true }, false},
+		{"with bulk_small_file_mode", func(config *Config) {
+			config.BulkSmallFileMode = true
+			config.BulkSmallFileStagingCollection = "/example/home/irodsfs/staging"
+		}, false},
+		{"with checksum_on_write", func(config *Config) { config.ChecksumOnWrite = true }, false},
+		{"with replica mtime source", func(config *Config) { config.MTimeSource = MTimeSourceReplica }, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := newValidConfig()
+			config.PoolEndpoint = "unix:///tmp/irodsfs-pool.sock"
+			testCase.modify(config)
+
+			err := config.ValidateSettings()
+			if testCase.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			} else if !testCase.valid && err == nil {
+				t.Errorf("expected invalid")
+			}
+
+			// the same options are valid with the direct fs client
+			config.PoolEndpoint = ""
+
+			err = config.ValidateSettings()
+			if err != nil {
+				t.Errorf("expected valid without pool endpoint, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateSettingsMTimeSource(t *testing.T) {
+	for _, mtimeSource := range []string{MTimeSourceModify, MTimeSourceCreate, MTimeSourceReplica} {
+		config := newValidConfig()
+		config.MTimeSource = mtimeSource
+
+		err := config.ValidateSettings()
+		if err != nil {
+			t.Errorf("expected mtime source %q valid, got %v", mtimeSource, err)
+		}
+	}
+
+	config := newValidConfig()
+	config.MTimeSource = "access"
+
+	err := config.ValidateSettings()
+	if err == nil {
+		t.Errorf("expected unknown mtime source invalid")
+	}
+}
+
+func TestValidateSettingsListTimeoutPartialResults(t *testing.T) {
+	config := newValidConfig()
+	config.ListTimeoutPartialResults = true
+
+	err := config.ValidateSettings()
+	if err == nil {
+		t.Errorf("expected partial results without list timeout invalid")
+	}
+
+	config.ListTimeout = irodsfs_common_utils.Duration(10 * time.Second)
+	config.DirAttrCacheTimeout = irodsfs_common_utils.Duration(3 * time.Second)
+
+	err = config.ValidateSettings()
+	if err != nil {
+		t.Errorf("expected partial results with list timeout and dir attr cache valid, got %v", err)
+	}
+}
+
+func TestValidateSettingsDirModifyTimeFromChildren(t *testing.T) {
+	config := newValidConfig()
+	config.DirModifyTimeFromChildren = true
+
+	err := config.ValidateSettings()
+	if err == nil {
+		t.Errorf("expected dir modify time from children without dir attr cache invalid")
+	}
+
+	config.DirAttrCacheTimeout = irodsfs_common_utils.Duration(3 * time.Second)
+
+	err = config.ValidateSettings()
+	if err != nil {
+		t.Errorf("expected dir modify time from children with dir attr cache valid, got %v", err)
+	}
+}
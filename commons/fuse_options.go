@@ -0,0 +1,191 @@
+package commons
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// fuse options taking no value
+var fuseFlagOptions = map[string]bool{
+	"ro":                  true,
+	"rw":                  true,
+	"allow_other":         true,
+	"allow_root":          true,
+	"auto_unmount":        true,
+	"default_permissions": true,
+	"nonempty":            true,
+	"dev":                 true,
+	"nodev":               true,
+	"suid":                true,
+	"nosuid":              true,
+	"exec":                true,
+	"noexec":              true,
+	"atime":               true,
+	"noatime":             true,
+	"relatime":            true,
+	"norelatime":          true,
+	"strictatime":         true,
+	"nostrictatime":       true,
+	"sync":                true,
+	"async":               true,
+	"dirsync":             true,
+	"kernel_cache":        true,
+	"auto_cache":          true,
+	"noauto_cache":        true,
+	"direct_io":           true,
+	"hard_remove":         true,
+	"use_ino":             true,
+	"readdir_ino":         true,
+}
+
+// fuse options taking a value, true if the value must be a number
+var fuseValueOptions = map[string]bool{
+	"max_read":    true,
+	"blksize":     true,
+	"context":     false,
+	"fscontext":   false,
+	"defcontext":  false,
+	"rootcontext": false,
+}
+
+// fuse options set by irodsfs, must not be given
+var fuseManagedOptions = map[string]bool{
+	"fsname":  true,
+	"subtype": true,
+}
+
+// fuse options that cannot be given together
+var fuseConflictingOptions = [][2]string{
+	{"ro", "rw"},
+	{"allow_other", "allow_root"},
+	{"dev", "nodev"},
+	{"suid", "nosuid"},
+	{"exec", "noexec"},
+	{"atime", "noatime"},
+	{"relatime", "norelatime"},
+	{"strictatime", "nostrictatime"},
+	{"sync", "async"},
+	{"auto_cache", "noauto_cache"},
+}
+
+// parseFuseOption splits a fuse option into name and value
+func parseFuseOption(option string) (string, string, bool, error) {
+	if len(option) == 0 {
+		return "", "", false, xerrors.Errorf("fuse option must not be empty")
+	}
+
+	if strings.ContainsAny(option, " \t,") {
+		return "", "", false, xerrors.Errorf("malformed fuse option %q, must not contain spaces or commas", option)
+	}
+
+	name := option
+	value := ""
+	hasValue := false
+	if idx := strings.Index(option, "="); idx >= 0 {
+		name = option[:idx]
+		value = option[idx+1:]
+		hasValue = true
+	}
+
+	if len(name) == 0 {
+		return "", "", false, xerrors.Errorf("malformed fuse option %q, option name is empty", option)
+	}
+
+	return name, value, hasValue, nil
+}
+
+// ValidateFuseOptions validates fuse options, and returns unknown options, they are passed to fusermount as given
+// options must not have spaces around, duplicates are allowed if they have the same value
+func ValidateFuseOptions(options []string) ([]string, error) {
+	unknown := []string{}
+	values := map[string]string{} // key is option name
+
+	for _, option := range options {
+		name, value, hasValue, err := parseFuseOption(option)
+		if err != nil {
+			return nil, err
+		}
+
+		if fuseManagedOptions[name] {
+			return nil, xerrors.Errorf("fuse option %q is set by irodsfs, must not be given", name)
+		}
+
+		if fuseFlagOptions[name] {
+			if hasValue {
+				return nil, xerrors.Errorf("malformed fuse option %q, %q takes no value", option, name)
+			}
+		} else if numeric, ok := fuseValueOptions[name]; ok {
+			if len(value) == 0 {
+				return nil, xerrors.Errorf("malformed fuse option %q, %q requires a value", option, name)
+			}
+
+			if numeric {
+				if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+					return nil, xerrors.Errorf("malformed fuse option %q, %q requires a number", option, name)
+				}
+			}
+		}
+
+		if existingValue, ok := values[name]; ok {
+			if existingValue != value {
+				return nil, xerrors.Errorf("fuse option %q is given with different values %q and %q", name, existingValue, value)
+			}
+
+			// duplicate
+			continue
+		}
+
+		values[name] = value
+
+		if !fuseFlagOptions[name] {
+			if _, ok := fuseValueOptions[name]; !ok {
+				unknown = append(unknown, option)
+			}
+		}
+	}
+
+	for _, conflict := range fuseConflictingOptions {
+		_, ok1 := values[conflict[0]]
+		_, ok2 := values[conflict[1]]
+		if ok1 && ok2 {
+			return nil, xerrors.Errorf("fuse options %q and %q conflict", conflict[0], conflict[1])
+		}
+	}
+
+	return unknown, nil
+}
+
+// DedupFuseOptions returns fuse options without duplicates in the order given, the options given are not modified
+func DedupFuseOptions(options []string) []string {
+	deduped := []string{}
+	seen := map[string]bool{}
+
+	for _, option := range options {
+		if seen[option] {
+			continue
+		}
+
+		seen[option] = true
+		deduped = append(deduped, option)
+	}
+
+	return deduped
+}
+
+// HasFuseOption checks if the fuse option is given, name is compared without value
+func HasFuseOption(options []string, name string) bool {
+	for _, option := range options {
+		optionName := option
+		if idx := strings.Index(option, "="); idx >= 0 {
+			optionName = option[:idx]
+		}
+
+		if optionName == name {
+			return true
+		}
+	}
+
+	return false
+}
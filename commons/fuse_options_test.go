@@ -0,0 +1,89 @@
+package commons
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateFuseOptions(t *testing.T) {
+	testCases := []struct {
+		options []string
+		unknown []string
+		valid   bool
+	}{
+		{[]string{}, []string{}, true},
+		{[]string{"ro", "allow_other", "max_read=131072", "context=system_u:object_r:fusefs_t:s0"}, []string{}, true},
+		{[]string{"ro", "ro", "max_read=4096", "max_read=4096"}, []string{}, true},
+		{[]string{"x-gvfs-hide", "x-gvfs-hide"}, []string{"x-gvfs-hide"}, true},
+		{[]string{""}, nil, false},
+		{[]string{" ro"}, nil, false},
+		{[]string{"ro,rw"}, nil, false},
+		{[]string{"=ro"}, nil, false},
+		{[]string{"ro=1"}, nil, false},
+		{[]string{"max_read"}, nil, false},
+		{[]string{"max_read=large"}, nil, false},
+		{[]string{"max_read=4096", "max_read=8192"}, nil, false},
+		{[]string{"fsname=irods"}, nil, false},
+		{[]string{"ro", "rw"}, nil, false},
+		{[]string{"allow_other", "allow_root"}, nil, false},
+	}
+
+	for _, testCase := range testCases {
+		unknown, err := ValidateFuseOptions(testCase.options)
+		if !testCase.valid {
+			if err == nil {
+				t.Errorf("expected fuse options %q invalid", testCase.options)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected fuse options %q valid, got %v", testCase.options, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(unknown, testCase.unknown) {
+			t.Errorf("fuse options %q: expected unknown %q, got %q", testCase.options, testCase.unknown, unknown)
+		}
+	}
+}
+
+func TestDedupFuseOptions(t *testing.T) {
+	options := []string{"ro", "max_read=4096", "ro", "x-gvfs-hide", "max_read=4096"}
+	given := append([]string{}, options...)
+
+	deduped := DedupFuseOptions(options)
+
+	expected := []string{"ro", "max_read=4096", "x-gvfs-hide"}
+	if !reflect.DeepEqual(deduped, expected) {
+		t.Errorf("expected %q, got %q", expected, deduped)
+	}
+
+	if !reflect.DeepEqual(options, given) {
+		t.Errorf("expected options given not modified, got %q", options)
+	}
+}
+
+func TestValidateSettingsKeepsFuseOptions(t *testing.T) {
+	config := newValidConfig()
+	config.FuseOptions = []string{"ro", "x-gvfs-hide", "ro"}
+	given := append([]string{}, config.FuseOptions...)
+
+	err := config.ValidateSettings()
+	if err != nil {
+		t.Fatalf("expected fuse options valid, got %v", err)
+	}
+
+	// validation has no side effects
+	if !reflect.DeepEqual(config.FuseOptions, given) {
+		t.Errorf("expected fuse options %q kept, got %q", given, config.FuseOptions)
+	}
+
+	config.ReadOnly = true
+	config.FuseOptions = []string{"rw"}
+
+	err = config.ValidateSettings()
+	if err == nil {
+		t.Errorf("expected fuse option rw with readonly invalid")
+	}
+}
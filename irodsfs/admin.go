@@ -0,0 +1,214 @@
+package irodsfs
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// AdminFileHandle describes an open file handle, returned by the admin socket
+type AdminFileHandle struct {
+	ID           string `json:"id"`
+	Path         string `json:"path"`
+	OpenMode     string `json:"open_mode"`
+	UID          uint32 `json:"uid"`
+	BytesRead    uint64 `json:"bytes_read"`
+	BytesWritten uint64 `json:"bytes_written"`
+}
+
+// AdminFileLock describes a lock held locally on an open file handle, returned by the admin socket
+type AdminFileLock struct {
+	HandleID string `json:"handle_id"`
+	Path     string `json:"path"`
+	LockType string `json:"lock_type"` // "read" or "write"
+	Pid      uint32 `json:"pid"`
+	Start    uint64 `json:"start"`
+	End      uint64 `json:"end"`
+}
+
+// AdminStatus describes the state of the mount, returned by the admin socket
+type AdminStatus struct {
+	InstanceID         string  `json:"instance_id"`
+	ClockSkewChecked   bool    `json:"clock_skew_checked"`
+	ClockSkewSeconds   float64 `json:"clock_skew_seconds"`  // local time - server time
+	ClockSkewExceeded  bool    `json:"clock_skew_exceeded"` // the skew exceeds clock_skew_threshold
+	ClockSkewThreshold float64 `json:"clock_skew_threshold_seconds"`
+}
+
+// AdminServer serves state of the filesystem in JSON over a unix socket, for debugging stuck mounts
+// GET /status returns the state of the mount, GET /handles lists open file handles, GET /locks lists locks held locally
+type AdminServer struct {
+	fs         *IRODSFS
+	socketPath string
+	server     *http.Server
+}
+
+// NewAdminServer creates a new AdminServer
+func NewAdminServer(fs *IRODSFS, socketPath string) *AdminServer {
+	return &AdminServer{
+		fs:         fs,
+		socketPath: socketPath,
+		server:     nil,
+	}
+}
+
+// Start listens on the unix socket, a stale socket file left is replaced
+func (admin *AdminServer) Start() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "AdminServer",
+		"function": "Start",
+	})
+
+	stat, err := os.Lstat(admin.socketPath)
+	if err == nil {
+		// do not remove other files given by mistake
+		if stat.Mode()&os.ModeSocket == 0 {
+			return xerrors.Errorf("failed to replace admin socket %q, not a socket", admin.socketPath)
+		}
+
+		err = os.Remove(admin.socketPath)
+		if err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("failed to remove stale admin socket %q: %w", admin.socketPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return xerrors.Errorf("failed to stat admin socket %q: %w", admin.socketPath, err)
+	}
+
+	listener, err := net.Listen("unix", admin.socketPath)
+	if err != nil {
+		return xerrors.Errorf("failed to listen on admin socket %q: %w", admin.socketPath, err)
+	}
+
+	// only the user running irodsfs can connect
+	// the process-wide umask is not changed, as it would apply to files created concurrently
+	err = os.Chmod(admin.socketPath, 0o600)
+	if err != nil {
+		listener.Close()
+		return xerrors.Errorf("failed to change mode of admin socket %q: %w", admin.socketPath, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", admin.serveStatus)
+	mux.HandleFunc("/handles", admin.serveHandles)
+	mux.HandleFunc("/locks", admin.serveLocks)
+
+	admin.server = &http.Server{
+		Handler: mux,
+	}
+
+	server := admin.server
+	go func() {
+		logger.Infof("Starting admin service at %q", admin.socketPath)
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Errorf("%+v", err)
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops serving and removes the socket file
+func (admin *AdminServer) Stop() {
+	if admin.server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	admin.server.Shutdown(ctx)
+	admin.server = nil
+
+	os.Remove(admin.socketPath)
+}
+
+func (admin *AdminServer) serveStatus(w http.ResponseWriter, r *http.Request) {
+	status := AdminStatus{
+		InstanceID:         admin.fs.config.InstanceID,
+		ClockSkewChecked:   false,
+		ClockSkewSeconds:   0,
+		ClockSkewExceeded:  false,
+		ClockSkewThreshold: 0,
+	}
+
+	if admin.fs.clockSkewChecker != nil {
+		status.ClockSkewChecked = true
+		status.ClockSkewSeconds = admin.fs.clockSkewChecker.GetSkew().Seconds()
+		status.ClockSkewExceeded = admin.fs.clockSkewChecker.IsSkewExceeded()
+		status.ClockSkewThreshold = time.Duration(admin.fs.config.ClockSkewThreshold).Seconds()
+	}
+
+	admin.writeJSON(w, status)
+}
+
+func (admin *AdminServer) serveHandles(w http.ResponseWriter, r *http.Request) {
+	handles := []AdminFileHandle{}
+
+	fileHandleMap := admin.fs.fileHandleMap
+	if fileHandleMap != nil {
+		// List copies handles under the map lock
+		for _, handle := range fileHandleMap.List() {
+			handles = append(handles, AdminFileHandle{
+				ID:           handle.GetID(),
+				Path:         handle.GetPath(),
+				OpenMode:     string(handle.openMode),
+				UID:          handle.GetUID(),
+				BytesRead:    atomic.LoadUint64(&handle.bytesRead),
+				BytesWritten: atomic.LoadUint64(&handle.bytesWritten),
+			})
+		}
+	}
+
+	admin.writeJSON(w, handles)
+}
+
+func (admin *AdminServer) serveLocks(w http.ResponseWriter, r *http.Request) {
+	locks := []AdminFileLock{}
+
+	localLockManagers := admin.fs.localLockManagers
+	if localLockManagers != nil {
+		for path, pathLocks := range localLockManagers.List() {
+			for _, lock := range pathLocks {
+				lockType := "read"
+				if lock.LockType == syscall.F_WRLCK {
+					lockType = "write"
+				}
+
+				locks = append(locks, AdminFileLock{
+					HandleID: lock.HandleID,
+					Path:     path,
+					LockType: lockType,
+					Pid:      lock.Pid,
+					Start:    lock.Start,
+					End:      lock.End,
+				})
+			}
+		}
+	}
+
+	admin.writeJSON(w, locks)
+}
+
+func (admin *AdminServer) writeJSON(w http.ResponseWriter, value interface{}) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "AdminServer",
+		"function": "writeJSON",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		logger.Errorf("%+v", err)
+	}
+}
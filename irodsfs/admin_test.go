@@ -0,0 +1,93 @@
+package irodsfs
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
+)
+
+func TestAdminServeStatusReportsClockSkew(t *testing.T) {
+	client := &skewedFSClient{fakeFSClient: newFakeFSClient(), skew: 10 * time.Minute}
+	fs := newTestFS(client.fakeFSClient)
+	fs.config.ClockSkewThreshold = irodsfs_common_utils.Duration(time.Minute)
+	fs.clockSkewChecker = NewClockSkewChecker(client, "/"+testZone+"/home/"+testUser, time.Minute)
+
+	_, err := fs.clockSkewChecker.Check()
+	if err != nil {
+		t.Fatalf("failed to check - %v", err)
+	}
+
+	admin := NewAdminServer(fs, "")
+
+	recorder := httptest.NewRecorder()
+	admin.serveStatus(recorder, httptest.NewRequest("GET", "/status", nil))
+
+	status := AdminStatus{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatalf("failed to parse status %q - %v", recorder.Body.String(), err)
+	}
+
+	if !status.ClockSkewChecked || !status.ClockSkewExceeded {
+		t.Errorf("expected the clock skew reported exceeded, got %+v", status)
+	}
+
+	if status.ClockSkewSeconds < 599 || status.ClockSkewSeconds > 601 {
+		t.Errorf("expected clock skew of 600 seconds, got %f", status.ClockSkewSeconds)
+	}
+}
+
+func TestAdminServerStartReplacesStaleSocketOnly(t *testing.T) {
+	fs := newTestFS(newFakeFSClient())
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+
+	// left by a crashed instance
+	staleListener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen - %v", err)
+	}
+	staleListener.(*net.UnixListener).SetUnlinkOnClose(false)
+	staleListener.Close()
+
+	admin := NewAdminServer(fs, socketPath)
+	err = admin.Start()
+	if err != nil {
+		t.Fatalf("expected the stale socket replaced, got %v", err)
+	}
+
+	stat, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("failed to stat - %v", err)
+	}
+
+	if stat.Mode().Perm() != 0o600 {
+		t.Errorf("expected socket mode %o, got %o", 0o600, stat.Mode().Perm())
+	}
+
+	admin.Stop()
+
+	// a regular file given by mistake
+	filePath := filepath.Join(t.TempDir(), "admin.sock")
+	err = os.WriteFile(filePath, []byte("data"), 0o644)
+	if err != nil {
+		t.Fatalf("failed to write - %v", err)
+	}
+
+	admin = NewAdminServer(fs, filePath)
+	err = admin.Start()
+	if err == nil {
+		admin.Stop()
+		t.Fatalf("expected a regular file not replaced")
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil || string(data) != "data" {
+		t.Errorf("expected the file kept, got %q, %v", data, err)
+	}
+}
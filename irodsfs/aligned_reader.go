@@ -0,0 +1,182 @@
+package irodsfs
+
+import (
+	"io"
+	"sync"
+
+	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// number of blocks cached per reader
+	alignedReaderCacheBlocks int = 8
+)
+
+// AlignedReader reads whole blocks aligned to the block size from the underlying reader, and returns exactly the bytes requested
+// recently read blocks are cached, so overlapping or adjacent misaligned reads do not fetch the same data again
+// file content must not change while reading
+type AlignedReader struct {
+	irodsfscommon_io.Reader
+
+	blockSize  int
+	size       int64
+	blocks     map[int64][]byte // block index to block data
+	blockOrder []int64          // block indices in the order of use, least recently used first
+	hits       uint64
+	misses     uint64
+	mutex      sync.Mutex
+}
+
+// NewAlignedReader creates a new AlignedReader over the reader of a file of the given size
+func NewAlignedReader(reader irodsfscommon_io.Reader, blockSize int, size int64) *AlignedReader {
+	return &AlignedReader{
+		Reader: reader,
+
+		blockSize:  blockSize,
+		size:       size,
+		blocks:     map[int64][]byte{},
+		blockOrder: []int64{},
+		hits:       0,
+		misses:     0,
+		mutex:      sync.Mutex{},
+	}
+}
+
+// ReadAt reads data at the offset
+func (reader *AlignedReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset >= reader.size {
+		return 0, io.EOF
+	}
+
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	readLen := 0
+	for readLen < len(buffer) {
+		current := offset + int64(readLen)
+		if current >= reader.size {
+			break
+		}
+
+		blockIndex := current / int64(reader.blockSize)
+		block, err := reader.getBlock(blockIndex)
+		if err != nil {
+			return readLen, err
+		}
+
+		blockOffset := int(current - blockIndex*int64(reader.blockSize))
+		if blockOffset >= len(block) {
+			break
+		}
+
+		readLen += copy(buffer[readLen:], block[blockOffset:])
+	}
+
+	if readLen < len(buffer) {
+		return readLen, io.EOF
+	}
+	return readLen, nil
+}
+
+// getBlock returns data of the block, caller must hold the mutex
+func (reader *AlignedReader) getBlock(blockIndex int64) ([]byte, error) {
+	if block, ok := reader.blocks[blockIndex]; ok {
+		reader.hits++
+		reader.touchBlock(blockIndex)
+		return block, nil
+	}
+
+	reader.misses++
+
+	blockStart := blockIndex * int64(reader.blockSize)
+	blockLen := int64(reader.blockSize)
+	if blockStart+blockLen > reader.size {
+		blockLen = reader.size - blockStart
+	}
+
+	block := make([]byte, blockLen)
+	readLen, err := reader.Reader.ReadAt(block, blockStart)
+	if err != nil && err != io.EOF {
+		return nil, xerrors.Errorf("failed to read block %d of %q: %w", blockIndex, reader.GetPath(), err)
+	}
+	block = block[:readLen]
+
+	if len(reader.blockOrder) >= alignedReaderCacheBlocks {
+		evict := reader.blockOrder[0]
+		reader.blockOrder = reader.blockOrder[1:]
+		delete(reader.blocks, evict)
+	}
+
+	reader.blocks[blockIndex] = block
+	reader.blockOrder = append(reader.blockOrder, blockIndex)
+	return block, nil
+}
+
+// touchBlock marks the block as the most recently used, caller must hold the mutex
+func (reader *AlignedReader) touchBlock(blockIndex int64) {
+	for i, index := range reader.blockOrder {
+		if index == blockIndex {
+			reader.blockOrder = append(reader.blockOrder[:i], reader.blockOrder[i+1:]...)
+			break
+		}
+	}
+
+	reader.blockOrder = append(reader.blockOrder, blockIndex)
+}
+
+// GetAvailable returns the number of bytes available at the offset without fetching
+func (reader *AlignedReader) GetAvailable(offset int64) int64 {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	blockIndex := offset / int64(reader.blockSize)
+	if block, ok := reader.blocks[blockIndex]; ok {
+		blockOffset := offset - blockIndex*int64(reader.blockSize)
+		if blockOffset < int64(len(block)) {
+			return int64(len(block)) - blockOffset
+		}
+	}
+
+	return reader.Reader.GetAvailable(offset)
+}
+
+// GetCachedSize returns the size of blocks cached
+func (reader *AlignedReader) GetCachedSize() int64 {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	cachedSize := int64(0)
+	for _, block := range reader.blocks {
+		cachedSize += int64(len(block))
+	}
+	return cachedSize
+}
+
+// DropBlocks drops cached blocks, following reads fetch them again
+func (reader *AlignedReader) DropBlocks() {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	reader.blocks = map[int64][]byte{}
+	reader.blockOrder = []int64{}
+}
+
+// Release releases cached blocks and the underlying reader
+func (reader *AlignedReader) Release() {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "AlignedReader",
+		"function": "Release",
+	})
+
+	reader.mutex.Lock()
+	logger.Debugf("aligned reads of %q, %d block cache hits, %d misses", reader.GetPath(), reader.hits, reader.misses)
+
+	reader.blocks = map[int64][]byte{}
+	reader.blockOrder = []int64{}
+	reader.mutex.Unlock()
+
+	reader.Reader.Release()
+}
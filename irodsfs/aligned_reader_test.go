@@ -0,0 +1,118 @@
+package irodsfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
+)
+
+func TestAlignedReaderReturnsBytesRequested(t *testing.T) {
+	client := newFakeFSClient()
+
+	filePath := "/testzone/home/testuser/aligned.bin"
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	client.addFile(filePath, data)
+
+	irodsHandle, err := client.OpenFile(filePath, "", string(irodsclient_types.FileOpenModeReadOnly))
+	if err != nil {
+		t.Fatalf("failed to open - %v", err)
+	}
+
+	reader := NewAlignedReader(&fakeReader{handle: irodsHandle}, 8, int64(len(data)))
+
+	testCases := []struct {
+		offset int64
+		size   int
+		eof    bool
+	}{
+		{0, 8, false},
+		{3, 4, false},
+		{6, 12, false},
+		{30, 10, true},
+		{35, 1, false},
+	}
+
+	for _, testCase := range testCases {
+		buffer := make([]byte, testCase.size)
+		readLen, err := reader.ReadAt(buffer, testCase.offset)
+
+		expected := data[testCase.offset:]
+		if len(expected) > testCase.size {
+			expected = expected[:testCase.size]
+		}
+
+		if !bytes.Equal(buffer[:readLen], expected) {
+			t.Errorf("offset %d: expected %q, got %q", testCase.offset, expected, buffer[:readLen])
+		}
+
+		if (err == io.EOF) != testCase.eof {
+			t.Errorf("offset %d: expected eof %t, got %v", testCase.offset, testCase.eof, err)
+		}
+	}
+
+	if _, err := reader.ReadAt(make([]byte, 4), int64(len(data))); err != io.EOF {
+		t.Errorf("expected eof at the end of the file, got %v", err)
+	}
+
+	// blocks overlapping were fetched once
+	if calls := client.getCalls("ReadAt"); calls != 5 {
+		t.Errorf("expected 5 blocks fetched, got %d", calls)
+	}
+}
+
+// BenchmarkOverlappingReads reads 3000 bytes every 1000 bytes, each read overlapping the previous ones and misaligned to blocks
+// with alignment, blocks fetched are reused by the following reads
+func BenchmarkOverlappingReads(b *testing.B) {
+	const blockSize = 4096
+	const readSize = 3000
+	const readStep = 1000
+
+	for _, aligned := range []bool{false, true} {
+		b.Run(fmt.Sprintf("aligned=%t", aligned), func(b *testing.B) {
+			client := newFakeFSClient()
+
+			filePath := "/testzone/home/testuser/overlapping.bin"
+			data := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+			client.addFile(filePath, data)
+
+			irodsHandle, err := client.OpenFile(filePath, "", string(irodsclient_types.FileOpenModeReadOnly))
+			if err != nil {
+				b.Fatalf("failed to open - %v", err)
+			}
+
+			var reader irodsfscommon_io.Reader = &fakeReader{handle: irodsHandle}
+
+			var alignedReader *AlignedReader
+			if aligned {
+				alignedReader = NewAlignedReader(&fakeReader{handle: irodsHandle}, blockSize, int64(len(data)))
+				reader = alignedReader
+			}
+
+			buffer := make([]byte, readSize)
+			b.SetBytes(readSize)
+			b.ResetTimer()
+			fetches := client.getCalls("ReadAt")
+			for i := 0; i < b.N; i++ {
+				offset := int64(i*readStep) % int64(len(data)-readSize)
+				if _, err := reader.ReadAt(buffer, offset); err != nil {
+					b.Fatalf("failed to read at %d - %v", offset, err)
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(client.getCalls("ReadAt")-fetches)/float64(b.N), "fetches/op")
+
+			hitRate := 0.0
+			if alignedReader != nil {
+				alignedReader.mutex.Lock()
+				hitRate = float64(alignedReader.hits) / float64(alignedReader.hits+alignedReader.misses)
+				alignedReader.mutex.Unlock()
+			}
+			b.ReportMetric(hitRate, "hit-rate")
+		})
+	}
+}
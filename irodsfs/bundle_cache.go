@@ -0,0 +1,395 @@
+package irodsfs
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// errBundleNotSupported is returned when the fs client cannot bundle collections on the server
+	errBundleNotSupported = xerrors.New("bundling collections is not supported by the fs client")
+)
+
+// BundleCreator is implemented by fs clients that can bundle data objects of a collection into a tar data object on the server
+type BundleCreator interface {
+	CreateBundle(bundlePath string, collPath string) error
+}
+
+// createBundle bundles data objects of the collection into a tar data object at the bundle path
+func createBundle(fsClient irodsfs_common_irods.IRODSFSClient, bundlePath string, collPath string) error {
+	if client, ok := extendFSClient(fsClient).(BundleCreator); ok {
+		return client.CreateBundle(bundlePath, collPath)
+	}
+
+	return errBundleNotSupported
+}
+
+// BundleCache serves small files read en masse from a bundle of their collection, extracted locally
+// once small files of a collection are read individually bulk_small_file_min_reads times within a metadata cache timeout,
+// the collection is bundled on the server in background, downloaded as a single tar, and extracted
+// files are read from iRODS while the collection is being bundled, and if they are modified after bundling or not in the bundle
+// collections having sub-collections or data objects larger than bulk_small_file_bundle_max_size in total are not bundled,
+// as the bundle holds all of them
+type BundleCache struct {
+	fs            *IRODSFS
+	rootPath      string // local dir bundles are extracted to
+	stagingPath   string // iRODS collection bundles are created in
+	maxFileSize   int64
+	maxBundleSize int64
+	minReads      int
+	timeout       time.Duration
+	ctx           context.Context // cancelled on release to stop bundling
+	cancel        context.CancelFunc
+	bundleWaiter  sync.WaitGroup
+	mutex         sync.Mutex
+	reads         map[string]int     // collection path - number of small files read individually
+	bundles       map[string]*bundle // collection path - bundle
+	lastCleanup   time.Time
+}
+
+// bundle is a bundle of a collection extracted locally, fields other than ready and dropped are set before ready is closed
+type bundle struct {
+	localPath  string           // local dir files are extracted to
+	files      map[string]int64 // file name - size
+	createTime time.Time        // files modified after this are not served from the bundle
+	expireTime time.Time
+	ready      chan struct{} // closed when the bundle is extracted or fails, with the mutex of the cache held
+	dropped    bool          // files extracted are removed once ready, protected by the mutex of the cache
+	err        error
+}
+
+// NewBundleCache creates a new BundleCache extracting bundles under the root path
+func NewBundleCache(fs *IRODSFS, rootPath string) *BundleCache {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &BundleCache{
+		fs:            fs,
+		rootPath:      rootPath,
+		stagingPath:   fs.config.BulkSmallFileStagingCollection,
+		maxFileSize:   fs.config.BulkSmallFileMaxSize,
+		maxBundleSize: fs.config.BulkSmallFileBundleMaxSize,
+		minReads:      fs.config.BulkSmallFileMinReads,
+		timeout:       time.Duration(fs.config.MetadataCacheTimeout),
+		ctx:           ctx,
+		cancel:        cancel,
+		bundleWaiter:  sync.WaitGroup{},
+		mutex:         sync.Mutex{},
+		reads:         map[string]int{},
+		bundles:       map[string]*bundle{},
+		lastCleanup:   time.Now(),
+	}
+}
+
+// GetFile returns the local path of the file extracted from the bundle of its collection
+// returns false if the file is to be read from iRODS, it starts bundling the collection if it is read en masse
+// it never waits for bundling
+func (cache *BundleCache) GetFile(ctx context.Context, irodsPath string) (string, bool) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "BundleCache",
+		"function": "GetFile",
+	})
+
+	entry, err := IRODSStat(ctx, cache.fs, irodsPath)
+	if err != nil {
+		logger.Debugf("failed to stat %q, reading it individually - %v", irodsPath, err)
+		return "", false
+	}
+
+	if entry.IsDir() || entry.Size > cache.maxFileSize {
+		return "", false
+	}
+
+	fileBundle := cache.acquireBundle(irodsfs_common_utils.GetDirname(irodsPath))
+	if fileBundle == nil {
+		return "", false
+	}
+
+	select {
+	case <-fileBundle.ready:
+	default:
+		// being bundled
+		return "", false
+	}
+
+	if fileBundle.err != nil {
+		return "", false
+	}
+
+	name := irodsfs_common_utils.GetFileName(irodsPath)
+	size, ok := fileBundle.files[name]
+	if !ok || size != entry.Size {
+		return "", false
+	}
+
+	// modify times of iRODS are in seconds, files modified in the second of bundling may not be in the bundle
+	if !entry.ModifyTime.Before(fileBundle.createTime.Truncate(time.Second)) {
+		return "", false
+	}
+
+	return filepath.Join(fileBundle.localPath, name), true
+}
+
+// acquireBundle returns the bundle of the collection, it starts bundling the collection in background once it is read en masse
+// returns nil if the collection is not bundled
+func (cache *BundleCache) acquireBundle(collPath string) *bundle {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+
+	// clean up once in a timeout, reads are counted within a timeout
+	if cache.timeout > 0 && now.Sub(cache.lastCleanup) > cache.timeout {
+		cache.reads = map[string]int{}
+		for bundleCollPath, cachedBundle := range cache.bundles {
+			if now.After(cachedBundle.expireTime) {
+				delete(cache.bundles, bundleCollPath)
+				cache.dropBundle(cachedBundle)
+			}
+		}
+		cache.lastCleanup = now
+	}
+
+	if cachedBundle, ok := cache.bundles[collPath]; ok {
+		if cache.timeout <= 0 || now.Before(cachedBundle.expireTime) {
+			return cachedBundle
+		}
+
+		delete(cache.bundles, collPath)
+		cache.dropBundle(cachedBundle)
+	}
+
+	if cache.ctx.Err() != nil {
+		// released
+		return nil
+	}
+
+	cache.reads[collPath]++
+	if cache.reads[collPath] < cache.minReads {
+		return nil
+	}
+
+	delete(cache.reads, collPath)
+
+	newBundle := &bundle{
+		localPath:  filepath.Join(cache.rootPath, xid.New().String()),
+		files:      map[string]int64{},
+		createTime: now,
+		expireTime: now.Add(cache.timeout),
+		ready:      make(chan struct{}),
+		dropped:    false,
+		err:        nil,
+	}
+
+	// the task runs after the mutex is released
+	cache.bundleWaiter.Add(1)
+	submitted := cache.fs.submitAsync(func() {
+		defer cache.bundleWaiter.Done()
+
+		err := cache.fetchBundle(collPath, newBundle)
+
+		cache.mutex.Lock()
+		newBundle.err = err
+		close(newBundle.ready)
+		dropped := newBundle.dropped
+		cache.mutex.Unlock()
+
+		if dropped {
+			os.RemoveAll(newBundle.localPath)
+		}
+	})
+	if !submitted {
+		// the I/O worker pool is busy, bundling is not run in the read, reads are counted again
+		cache.bundleWaiter.Done()
+		return nil
+	}
+
+	cache.bundles[collPath] = newBundle
+	return newBundle
+}
+
+// dropBundle removes files of the bundle extracted, or lets the task bundling it remove them once ready
+// caller must hold the mutex
+func (cache *BundleCache) dropBundle(fileBundle *bundle) {
+	fileBundle.dropped = true
+
+	select {
+	case <-fileBundle.ready:
+		// files opened from the bundle remain readable until closed
+		os.RemoveAll(fileBundle.localPath)
+	default:
+	}
+}
+
+// fetchBundle bundles the collection on the server, and extracts the bundle downloaded
+// a failed bundle is kept until it expires, files are read individually meanwhile
+func (cache *BundleCache) fetchBundle(collPath string, fileBundle *bundle) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "BundleCache",
+		"function": "fetchBundle",
+	})
+
+	err := cache.checkBundleSize(collPath)
+	if err != nil {
+		logger.Debugf("%+v", err)
+		return err
+	}
+
+	fsClient, done := cache.fs.acquireFSClient()
+	defer done()
+
+	bundlePath := path.Join(cache.stagingPath, fmt.Sprintf(".irodsfs_bundle_%s.tar", xid.New().String()))
+
+	logger.Infof("Bundling collection %q to %q", collPath, bundlePath)
+
+	err = createBundle(fsClient, bundlePath, collPath)
+	if err != nil {
+		if xerrors.Is(err, errBundleNotSupported) {
+			logger.Debugf("%+v", err)
+		} else {
+			logger.Errorf("%+v", err)
+		}
+		return err
+	}
+
+	defer func() {
+		removeErr := fsClient.RemoveFile(bundlePath, true)
+		if removeErr != nil {
+			logger.Warnf("failed to remove bundle %q - %v", bundlePath, removeErr)
+		}
+	}()
+
+	err = cache.extractBundle(fsClient, bundlePath, collPath, fileBundle)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		os.RemoveAll(fileBundle.localPath)
+		return err
+	}
+
+	return nil
+}
+
+// checkBundleSize returns an error if the bundle of the collection would hold more than small files read
+// bundles hold data objects of all sizes and of sub-collections, which are not listed here
+func (cache *BundleCache) checkBundleSize(collPath string) error {
+	entries, err := IRODSList(cache.ctx, cache.fs, collPath)
+	if err != nil {
+		return xerrors.Errorf("failed to list collection %q to bundle: %w", collPath, err)
+	}
+
+	totalSize := int64(0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return xerrors.Errorf("failed to bundle collection %q having sub-collection %q", collPath, entry.Name)
+		}
+
+		totalSize += entry.Size
+	}
+
+	if totalSize > cache.maxBundleSize {
+		return xerrors.Errorf("failed to bundle collection %q of %d bytes, larger than %d bytes", collPath, totalSize, cache.maxBundleSize)
+	}
+
+	return nil
+}
+
+// extractBundle reads the bundle data object and extracts small files of the collection in it
+func (cache *BundleCache) extractBundle(fsClient irodsfs_common_irods.IRODSFSClient, bundlePath string, collPath string, fileBundle *bundle) error {
+	err := os.MkdirAll(fileBundle.localPath, 0o700)
+	if err != nil {
+		return xerrors.Errorf("failed to make dir %q: %w", fileBundle.localPath, err)
+	}
+
+	handle, err := fsClient.OpenFile(bundlePath, "", string(irodsclient_types.FileOpenModeReadOnly))
+	if err != nil {
+		return xerrors.Errorf("failed to open bundle %q: %w", bundlePath, err)
+	}
+	defer handle.Close()
+
+	// members are relative to the collection, some servers prefix them with the collection name
+	collPrefix := irodsfs_common_utils.GetFileName(collPath) + "/"
+
+	tarReader := tar.NewReader(io.NewSectionReader(handle, 0, handle.GetEntry().Size))
+	for {
+		if cache.ctx.Err() != nil {
+			return xerrors.Errorf("failed to extract bundle %q: %w", bundlePath, cache.ctx.Err())
+		}
+
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return xerrors.Errorf("failed to read bundle %q: %w", bundlePath, err)
+		}
+
+		name := strings.TrimPrefix(header.Name, "./")
+		name = strings.TrimPrefix(name, collPrefix)
+
+		// data objects of sub-collections are not served, nor names escaping the dir
+		if header.Typeflag != tar.TypeReg || strings.Contains(name, "/") || name == "" || name == "." || name == ".." {
+			continue
+		}
+
+		if header.Size > cache.maxFileSize {
+			continue
+		}
+
+		err = extractBundleFile(tarReader, filepath.Join(fileBundle.localPath, name))
+		if err != nil {
+			return err
+		}
+
+		fileBundle.files[name] = header.Size
+	}
+}
+
+// extractBundleFile writes the current member of the tar reader to the local path
+func extractBundleFile(tarReader *tar.Reader, localPath string) error {
+	file, err := os.OpenFile(localPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return xerrors.Errorf("failed to create file %q: %w", localPath, err)
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, tarReader)
+	if err != nil {
+		return xerrors.Errorf("failed to extract file %q: %w", localPath, err)
+	}
+
+	return nil
+}
+
+// Release stops bundling and removes all bundles extracted
+func (cache *BundleCache) Release() {
+	cache.cancel()
+
+	cache.mutex.Lock()
+	for _, cachedBundle := range cache.bundles {
+		cache.dropBundle(cachedBundle)
+	}
+	cache.bundles = map[string]*bundle{}
+	cache.reads = map[string]int{}
+	cache.mutex.Unlock()
+
+	cache.bundleWaiter.Wait()
+
+	os.RemoveAll(cache.rootPath)
+}
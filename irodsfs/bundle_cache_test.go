@@ -0,0 +1,195 @@
+package irodsfs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+)
+
+// readTestFile reads the file through a new read-only file handle, as cat does
+func readTestFile(t *testing.T, fs *IRODSFS, filePath string) string {
+	handle, err := NewFileHandleLazy(fs, filePath, irodsclient_types.FileOpenModeReadOnly)
+	if err != nil {
+		t.Fatalf("failed to create a file handle - %v", err)
+	}
+	handle.SetFile(NewFile(fs, 0, filePath))
+	fs.fileHandleMap.Add(handle)
+
+	result, errno := handle.Read(context.Background(), make([]byte, 1024), 0)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to read %q, errno %v", filePath, errno)
+	}
+
+	data, _ := result.Bytes(nil)
+
+	if errno := handle.Release(context.Background()); errno != fusefs.OK {
+		t.Errorf("failed to release %q, errno %v", filePath, errno)
+	}
+	return string(data)
+}
+
+// waitTestBundle waits for the collection bundled in background
+func waitTestBundle(t *testing.T, cache *BundleCache, collPath string) {
+	cache.mutex.Lock()
+	fileBundle, ok := cache.bundles[collPath]
+	cache.mutex.Unlock()
+
+	if !ok {
+		t.Fatalf("expected collection %q being bundled", collPath)
+	}
+
+	select {
+	case <-fileBundle.ready:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for collection %q bundled", collPath)
+	}
+}
+
+// newTestBundleCache creates a bundle cache on the test file system, staging bundles in a collection outside the home
+func newTestBundleCache(t *testing.T, fs *IRODSFS, client *fakeFSClient) {
+	client.addDir("/testzone/staging")
+
+	fs.config.DeferPrefetch = true
+	fs.config.BulkSmallFileMode = true
+	fs.config.BulkSmallFileStagingCollection = "/testzone/staging"
+	fs.bundleCache = NewBundleCache(fs, t.TempDir())
+}
+
+func TestBundleCacheServesSmallFilesReadEnMasse(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.BulkSmallFileMaxSize = 16
+	fs.config.BulkSmallFileMinReads = 2
+	newTestBundleCache(t, fs, client)
+	defer fs.bundleCache.Release()
+
+	filePaths := []string{}
+	for i := 0; i < 5; i++ {
+		filePath := fmt.Sprintf("/testzone/home/testuser/small%d.txt", i)
+		entry := client.addFile(filePath, []byte(fmt.Sprintf("content %d", i)))
+		entry.ModifyTime = time.Now().Add(-time.Minute)
+		filePaths = append(filePaths, filePath)
+	}
+
+	largePath := "/testzone/home/testuser/large.txt"
+	entry := client.addFile(largePath, []byte("content larger than the max size"))
+	entry.ModifyTime = time.Now().Add(-time.Minute)
+
+	for i, filePath := range filePaths {
+		if data := readTestFile(t, fs, filePath); data != fmt.Sprintf("content %d", i) {
+			t.Errorf("expected content %d of %q, got %q", i, filePath, data)
+		}
+
+		if i == 1 {
+			// the second read starts bundling without waiting for it
+			waitTestBundle(t, fs.bundleCache, "/testzone/home/testuser")
+		}
+	}
+
+	// the first two files are read individually, the others are served from the bundle
+	if calls := client.getCalls("CreateBundle"); calls != 1 {
+		t.Errorf("expected the collection bundled once, got %d", calls)
+	}
+
+	if calls := client.getCalls("OpenFile"); calls != 3 {
+		t.Errorf("expected the first two files and the bundle opened, got %d opens", calls)
+	}
+
+	entries, _ := client.List("/testzone/staging")
+	if len(entries) != 0 {
+		t.Errorf("expected the bundle removed from the staging collection, got %d entries", len(entries))
+	}
+
+	// large files and files modified after bundling are read from iRODS
+	if data := readTestFile(t, fs, largePath); data != "content larger than the max size" {
+		t.Errorf("expected content of %q, got %q", largePath, data)
+	}
+
+	client.addFile(filePaths[0], []byte("modified"))
+	if data := readTestFile(t, fs, filePaths[0]); data != "modified" {
+		t.Errorf("expected modified content of %q, got %q", filePaths[0], data)
+	}
+
+	if calls := client.getCalls("OpenFile"); calls != 5 {
+		t.Errorf("expected the large and modified files opened, got %d opens", calls)
+	}
+}
+
+func TestBundleCacheSkipsCollectionsNotSmall(t *testing.T) {
+	testCases := []struct {
+		name  string
+		setup func(client *fakeFSClient, collPath string)
+	}{
+		{"large data object", func(client *fakeFSClient, collPath string) {
+			client.addFile(collPath+"/large.bin", make([]byte, 64))
+		}},
+		{"sub-collection", func(client *fakeFSClient, collPath string) {
+			client.addDir(collPath + "/sub")
+		}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+			fs.config.BulkSmallFileMaxSize = 16
+			fs.config.BulkSmallFileBundleMaxSize = 32
+			fs.config.BulkSmallFileMinReads = 1
+			newTestBundleCache(t, fs, client)
+			defer fs.bundleCache.Release()
+
+			collPath := "/testzone/home/testuser"
+			filePath := collPath + "/small.txt"
+			entry := client.addFile(filePath, []byte("content"))
+			entry.ModifyTime = time.Now().Add(-time.Minute)
+			testCase.setup(client, collPath)
+
+			readTestFile(t, fs, filePath)
+			waitTestBundle(t, fs.bundleCache, collPath)
+
+			if data := readTestFile(t, fs, filePath); data != "content" {
+				t.Errorf("expected content of %q, got %q", filePath, data)
+			}
+
+			// the bundle would hold more than the small files read
+			if calls := client.getCalls("CreateBundle"); calls != 0 {
+				t.Errorf("expected the collection not bundled, got %d", calls)
+			}
+
+			if calls := client.getCalls("OpenFile"); calls != 2 {
+				t.Errorf("expected the file opened individually twice, got %d opens", calls)
+			}
+		})
+	}
+}
+
+func TestBundleCacheWithoutBundleSupport(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.BulkSmallFileMinReads = 1
+	newTestBundleCache(t, fs, client)
+	defer fs.bundleCache.Release()
+
+	// clients which cannot bundle collections, e.g., irodsfs-pool clients, read files individually
+	fs.session = newFSSession(&unitlessFSClient{IRODSFSClient: client}, nil)
+
+	filePath := "/testzone/home/testuser/small.txt"
+	client.addFile(filePath, []byte("content"))
+
+	if data := readTestFile(t, fs, filePath); data != "content" {
+		t.Errorf("expected content of %q, got %q", filePath, data)
+	}
+	waitTestBundle(t, fs.bundleCache, "/testzone/home/testuser")
+
+	if data := readTestFile(t, fs, filePath); data != "content" {
+		t.Errorf("expected content of %q, got %q", filePath, data)
+	}
+
+	if calls := client.getCalls("OpenFile"); calls != 2 {
+		t.Errorf("expected the file opened individually twice, got %d opens", calls)
+	}
+}
@@ -0,0 +1,225 @@
+package irodsfs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// files not accessed for this many poll intervals and not open are not polled anymore
+	changePollerIdleIntervals int = 10
+)
+
+// ChangePoller periodically stats files open, or accessed recently under change poll paths, and invalidates kernel caches of the files changed by other clients
+// stats bypass go-irodsclient metadata cache, so changes are found before the cache times out
+type ChangePoller struct {
+	fs            *IRODSFS
+	files         map[string]*changePollerEntry // key is iRODS path
+	mutex         sync.Mutex
+	terminateChan chan bool
+}
+
+type changePollerEntry struct {
+	file       *File
+	lastAccess time.Time
+	polled     bool // size and modifyTime are set
+	size       int64
+	modifyTime time.Time
+}
+
+// NewChangePoller creates a new ChangePoller
+func NewChangePoller(fs *IRODSFS) *ChangePoller {
+	return &ChangePoller{
+		fs:            fs,
+		files:         map[string]*changePollerEntry{},
+		mutex:         sync.Mutex{},
+		terminateChan: nil,
+	}
+}
+
+// Touch marks the file as accessed, so it is polled for a while
+func (poller *ChangePoller) Touch(file *File, path string) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+
+	if entry, ok := poller.files[path]; ok {
+		entry.file = file
+		entry.lastAccess = time.Now()
+		return
+	}
+
+	poller.files[path] = &changePollerEntry{
+		file:       file,
+		lastAccess: time.Now(),
+	}
+}
+
+// Forget stops polling the file, e.g., it is removed or renamed through this mount
+func (poller *ChangePoller) Forget(path string) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+
+	delete(poller.files, path)
+}
+
+// ResetBaseline takes the next stat of the file as unchanged, e.g., after the file is written through this mount
+func (poller *ChangePoller) ResetBaseline(path string) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+
+	if entry, ok := poller.files[path]; ok {
+		entry.polled = false
+	}
+}
+
+// Start polls files periodically
+func (poller *ChangePoller) Start(interval time.Duration) {
+	if interval <= 0 || poller.terminateChan != nil {
+		return
+	}
+
+	terminateChan := make(chan bool)
+	poller.terminateChan = terminateChan
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-terminateChan:
+				return
+			case <-ticker.C:
+				poller.poll(interval)
+			}
+		}
+	}()
+}
+
+// Stop stops polling
+func (poller *ChangePoller) Stop() {
+	if poller.terminateChan != nil {
+		close(poller.terminateChan)
+		poller.terminateChan = nil
+	}
+}
+
+// poll stats files open or accessed within idle intervals, and forgets others
+func (poller *ChangePoller) poll(interval time.Duration) {
+	idleTime := time.Now().Add(-interval * time.Duration(changePollerIdleIntervals))
+
+	poller.mutex.Lock()
+	paths := []string{}
+	for path, entry := range poller.files {
+		if entry.lastAccess.Before(idleTime) && len(poller.fs.fileHandleMap.ListByPath(path)) == 0 {
+			delete(poller.files, path)
+			continue
+		}
+
+		paths = append(paths, path)
+	}
+	poller.mutex.Unlock()
+
+	for _, path := range paths {
+		poller.pollFile(path)
+	}
+}
+
+// pollFile stats the file, and invalidates kernel caches if it is changed
+func (poller *ChangePoller) pollFile(path string) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "ChangePoller",
+		"function": "pollFile",
+	})
+
+	if poller.fs.terminated {
+		return
+	}
+
+	irodsEntry, err := irodsStatUncached(context.Background(), poller.fs, path)
+
+	poller.mutex.Lock()
+	entry, ok := poller.files[path]
+	if !ok {
+		// forgotten meanwhile
+		poller.mutex.Unlock()
+		return
+	}
+
+	file := entry.file
+	removed := false
+	changed := false
+	if err != nil {
+		if !irodsclient_types.IsFileNotFoundError(err) {
+			poller.mutex.Unlock()
+			logger.Debugf("failed to poll file %q - %v", path, err)
+			return
+		}
+
+		removed = true
+		delete(poller.files, path)
+	} else {
+		changed = entry.polled && (entry.size != irodsEntry.Size || !entry.modifyTime.Equal(irodsEntry.ModifyTime))
+		entry.polled = true
+		entry.size = irodsEntry.Size
+		entry.modifyTime = irodsEntry.ModifyTime
+	}
+	poller.mutex.Unlock()
+
+	if !removed && !changed {
+		return
+	}
+
+	if !removed && poller.isWrittenLocally(path) {
+		// changed by ourselves
+		return
+	}
+
+	poller.fs.invalidateDirAttrCache(path)
+
+	if poller.fs.fuseServer == nil {
+		// not mounted, no kernel caches to invalidate
+		return
+	}
+
+	if removed {
+		logger.Debugf("file %q is removed by other client, invalidating kernel entry cache", path)
+	} else {
+		logger.Debugf("file %q is changed by other client, invalidating kernel caches", path)
+
+		// attributes and content
+		errno := file.NotifyContent(0, 0)
+		if errno != 0 {
+			logger.Debugf("failed to invalidate kernel content cache of file %q - %v", path, errno)
+		}
+
+		if !poller.fs.config.InvalidateParentEntryCacheImmediately {
+			return
+		}
+	}
+
+	name, parent := file.Parent()
+	if parent == nil {
+		return
+	}
+
+	errno := parent.NotifyEntry(name)
+	if errno != 0 {
+		logger.Debugf("failed to invalidate kernel entry cache of file %q - %v", path, errno)
+	}
+}
+
+// isWrittenLocally checks if the file is open for write in this mount
+func (poller *ChangePoller) isWrittenLocally(path string) bool {
+	for _, handle := range poller.fs.fileHandleMap.ListByPath(path) {
+		if handle.openMode.IsWrite() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package irodsfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChangePollerStatsUncached(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/polled.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	// other clients change the file, the metadata cache of the client is stale
+	uncachedClient := newFakeFSClient()
+	uncachedClient.addFile(filePath, []byte("0123"))
+	fs.uncachedFSClient = uncachedClient
+
+	// stats of setting up the fs
+	statCalls := client.getCalls("Stat")
+
+	poller := NewChangePoller(fs)
+	poller.Touch(NewFile(fs, 0, filePath), filePath)
+
+	poller.poll(time.Second)
+
+	uncachedClient.addFile(filePath, []byte("012345"))
+
+	poller.poll(time.Second)
+
+	poller.mutex.Lock()
+	entry := poller.files[filePath]
+	poller.mutex.Unlock()
+
+	if entry == nil || entry.size != 6 {
+		t.Errorf("expected the change found")
+	}
+
+	if calls := client.getCalls("Stat") - statCalls; calls != 0 {
+		t.Errorf("expected no stat through the metadata cache, got %d", calls)
+	}
+	if calls := uncachedClient.getCalls("Stat"); calls != 2 {
+		t.Errorf("expected 2 stats bypassing the metadata cache, got %d", calls)
+	}
+}
+
+func TestChangePollerForgetsIdleFiles(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	closedPath := "/testzone/home/testuser/closed.txt"
+	client.addFile(closedPath, []byte("0123"))
+
+	openPath := "/testzone/home/testuser/open.txt"
+	client.addFile(openPath, []byte("0123"))
+	newTestFileHandle(fs, client, openPath, "r")
+
+	poller := NewChangePoller(fs)
+	poller.Touch(NewFile(fs, 0, closedPath), closedPath)
+	poller.Touch(NewFile(fs, 0, openPath), openPath)
+
+	poller.mutex.Lock()
+	for _, entry := range poller.files {
+		entry.lastAccess = time.Now().Add(-time.Hour)
+	}
+	poller.mutex.Unlock()
+
+	poller.poll(time.Second)
+
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+
+	if _, ok := poller.files[closedPath]; ok {
+		t.Errorf("expected idle file %q not polled", closedPath)
+	}
+
+	if _, ok := poller.files[openPath]; !ok {
+		t.Errorf("expected open file %q polled", openPath)
+	}
+}
@@ -0,0 +1,104 @@
+package irodsfs
+
+import (
+	"fmt"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
+	"github.com/cyverse/irodsfs/commons"
+	"golang.org/x/xerrors"
+)
+
+// CheckResult is a result of a check run without mounting
+type CheckResult struct {
+	Name    string
+	Message string // describes the result when the check passes
+	Err     error  // nil if the check passes
+}
+
+// CheckIRODS logs in to iRODS and stats source paths of path mappings without mounting
+// it does not create collections of path mappings, nor connect to irodsfs-pool
+func CheckIRODS(config *commons.Config) []CheckResult {
+	results := []CheckResult{}
+
+	loginName := fmt.Sprintf("login to %s:%d as %q", config.Host, config.Port, config.ProxyUser)
+
+	account, err := newIRODSAccount(config)
+	if err != nil {
+		return append(results, CheckResult{Name: loginName, Err: err})
+	}
+
+	fsConfig := irodsclient_fs.NewFileSystemConfig(
+		FSName,
+		commons.ConnectionErrorTimeout,
+		0,
+		time.Duration(config.ConnectionLifespan),
+		time.Duration(config.OperationTimeout), time.Duration(config.ConnectionIdleTimeout),
+		1, commons.TCPBufferSizeDefault,
+		0, 0,
+		[]irodsclient_fs.MetadataCacheTimeoutSetting{},
+		config.StartNewTransaction,
+		config.InvalidateParentEntryCacheImmediately,
+	)
+
+	fsClient, err := irodsfs_common_irods.NewIRODSFSClientDirect(account, fsConfig)
+	if err != nil {
+		return append(results, CheckResult{Name: loginName, Err: xerrors.Errorf("failed to create a new go-irodsclient fs client: %w", err)})
+	}
+	defer fsClient.Release()
+
+	// authenticated by the first request
+	_, err = fsClient.ListUserGroups(account.ClientUser)
+	if err != nil {
+		return append(results, CheckResult{Name: loginName, Err: xerrors.Errorf("failed to list groups for a user %q: %w", account.ClientUser, err)})
+	}
+
+	results = append(results, CheckResult{Name: loginName, Message: fmt.Sprintf("authenticated with %q auth scheme", string(account.AuthenticationScheme))})
+
+	for _, mapping := range config.PathMappings {
+		resolvedMapping, err := resolveDataObjectPathMapping(fsClient, mapping)
+		if err != nil {
+			results = append(results, CheckResult{Name: fmt.Sprintf("path mapping %q -> %q", mapping.IRODSPath, mapping.MappingPath), Err: err})
+			continue
+		}
+
+		results = append(results, checkPathMapping(fsClient, resolvedMapping))
+	}
+
+	return results
+}
+
+// checkPathMapping stats the source path of the path mapping
+func checkPathMapping(fsClient irodsfs_common_irods.IRODSFSClient, mapping irodsfs_common_vpath.VPathMapping) CheckResult {
+	name := fmt.Sprintf("path mapping %q -> %q", mapping.IRODSPath, mapping.MappingPath)
+
+	entry, err := fsClient.Stat(mapping.IRODSPath)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			if mapping.CreateDir && mapping.ResourceType == irodsfs_common_vpath.VPathMappingDirectory {
+				return CheckResult{Name: name, Message: "not found, will be created on mount"}
+			}
+
+			if mapping.IgnoreNotExistError {
+				return CheckResult{Name: name, Message: "not found, ignored"}
+			}
+
+			return CheckResult{Name: name, Err: xerrors.Errorf("failed to find %q", mapping.IRODSPath)}
+		}
+
+		return CheckResult{Name: name, Err: xerrors.Errorf("failed to stat %q: %w", mapping.IRODSPath, err)}
+	}
+
+	if mapping.ResourceType == irodsfs_common_vpath.VPathMappingDirectory && !entry.IsDir() {
+		return CheckResult{Name: name, Err: xerrors.Errorf("%q is not a collection", mapping.IRODSPath)}
+	}
+
+	if mapping.ResourceType == irodsfs_common_vpath.VPathMappingFile && entry.IsDir() {
+		return CheckResult{Name: name, Err: xerrors.Errorf("%q is not a data object", mapping.IRODSPath)}
+	}
+
+	return CheckResult{Name: name, Message: "found"}
+}
@@ -0,0 +1,93 @@
+package irodsfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"hash/adler32"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"golang.org/x/xerrors"
+)
+
+// ChecksumVerifier computes a checksum of data read sequentially from the beginning of a file,
+// and compares it with the checksum registered in iRODS when the read reaches the end of the file
+// verification is given up if the file is not read sequentially
+type ChecksumVerifier struct {
+	path     string
+	size     int64
+	expected []byte
+	hash     hash.Hash
+	offset   int64 // offset of data to be hashed next
+	disabled bool
+}
+
+// NewChecksumVerifier creates a new ChecksumVerifier, it is disabled if the entry has no checksum of supported algorithm
+func NewChecksumVerifier(entry *irodsclient_fs.Entry) *ChecksumVerifier {
+	verifier := &ChecksumVerifier{
+		path:     entry.Path,
+		size:     entry.Size,
+		expected: entry.CheckSum,
+		hash:     newChecksumHash(entry.CheckSumAlgorithm),
+		offset:   0,
+		disabled: false,
+	}
+
+	if verifier.hash == nil || len(verifier.expected) == 0 {
+		verifier.disabled = true
+	}
+
+	return verifier
+}
+
+// newChecksumHash returns a hash of the algorithm, returns nil if not supported
+func newChecksumHash(algorithm irodsclient_types.ChecksumAlgorithm) hash.Hash {
+	switch algorithm {
+	case irodsclient_types.ChecksumAlgorithmMD5:
+		return md5.New()
+	case irodsclient_types.ChecksumAlgorithmSHA1:
+		return sha1.New()
+	case irodsclient_types.ChecksumAlgorithmSHA256:
+		return sha256.New()
+	case irodsclient_types.ChecksumAlgorithmSHA512:
+		return sha512.New()
+	case irodsclient_types.ChecksumAlgorithmADLER32:
+		return adler32.New()
+	default:
+		return nil
+	}
+}
+
+// Update hashes data read at the offset, returns an error if the checksum mismatches at the end of the file
+func (verifier *ChecksumVerifier) Update(data []byte, offset int64) error {
+	if verifier.disabled {
+		return nil
+	}
+
+	if offset != verifier.offset {
+		// not sequential
+		verifier.disabled = true
+		return nil
+	}
+
+	verifier.hash.Write(data)
+	verifier.offset += int64(len(data))
+
+	if verifier.offset < verifier.size {
+		return nil
+	}
+
+	// verified once
+	verifier.disabled = true
+
+	actual := verifier.hash.Sum(nil)
+	if !bytes.Equal(actual, verifier.expected) {
+		return xerrors.Errorf("checksum mismatch for %q, expected %s, got %s", verifier.path, hex.EncodeToString(verifier.expected), hex.EncodeToString(actual))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package irodsfs
+
+import (
+	"path"
+	"sync"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	clockSkewProbePrefix string = ".irodsfs_clock_skew_probe."
+)
+
+// ClockSkewChecker measures clock skew between the client and the iRODS server
+// iRODS has no API returning server time, so it reads the time the server recorded for creating a temporary probe data object
+// the probe is removed right after, no metadata of existing collections or data objects is changed
+type ClockSkewChecker struct {
+	fsClient      irodsfs_common_irods.IRODSFSClient
+	probeDirPath  string // collection the probe is created in
+	threshold     time.Duration
+	mutex         sync.RWMutex
+	skew          time.Duration // local time - server time
+	terminateChan chan bool
+}
+
+// NewClockSkewChecker creates a new ClockSkewChecker
+func NewClockSkewChecker(fsClient irodsfs_common_irods.IRODSFSClient, probeDirPath string, threshold time.Duration) *ClockSkewChecker {
+	return &ClockSkewChecker{
+		fsClient:      fsClient,
+		probeDirPath:  probeDirPath,
+		threshold:     threshold,
+		mutex:         sync.RWMutex{},
+		skew:          0,
+		terminateChan: nil,
+	}
+}
+
+// Check measures clock skew, warns if it exceeds the threshold
+func (checker *ClockSkewChecker) Check() (time.Duration, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "ClockSkewChecker",
+		"function": "Check",
+	})
+
+	checker.mutex.RLock()
+	fsClient := checker.fsClient
+	checker.mutex.RUnlock()
+
+	// a unique name, so concurrent checks of other mounts do not collide
+	probePath := path.Join(checker.probeDirPath, clockSkewProbePrefix+xid.New().String())
+
+	before := time.Now()
+	probeHandle, err := fsClient.CreateFile(probePath, "", string(irodsclient_types.FileOpenModeWriteOnly))
+	if err != nil {
+		return 0, xerrors.Errorf("failed to create clock skew probe %q: %w", probePath, err)
+	}
+	after := time.Now()
+
+	defer func() {
+		err := fsClient.RemoveFile(probePath, true)
+		if err != nil {
+			logger.Warnf("%+v", err)
+		}
+	}()
+
+	err = probeHandle.Close()
+	if err != nil {
+		return 0, xerrors.Errorf("failed to close clock skew probe %q: %w", probePath, err)
+	}
+
+	probe, err := fsClient.Stat(probePath)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to stat clock skew probe %q: %w", probePath, err)
+	}
+
+	if probe.CreateTime.IsZero() {
+		return 0, xerrors.Errorf("failed to get server time from clock skew probe %q", probePath)
+	}
+
+	// server time has a resolution of a second
+	localTime := before.Add(after.Sub(before) / 2)
+	skew := localTime.Sub(probe.CreateTime).Truncate(time.Second)
+
+	checker.mutex.Lock()
+	checker.skew = skew
+	checker.mutex.Unlock()
+
+	if checker.IsSkewExceeded() {
+		logger.Warnf("client clock differs from iRODS server clock by %s, timestamps may confuse tools", skew)
+	} else {
+		logger.Debugf("clock skew %s", skew)
+	}
+
+	return skew, nil
+}
+
+// SetFSClient replaces the client used for checking, e.g., after reconnection
+func (checker *ClockSkewChecker) SetFSClient(fsClient irodsfs_common_irods.IRODSFSClient) {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	checker.fsClient = fsClient
+}
+
+// GetSkew returns the clock skew measured last, local time - server time
+func (checker *ClockSkewChecker) GetSkew() time.Duration {
+	checker.mutex.RLock()
+	defer checker.mutex.RUnlock()
+
+	return checker.skew
+}
+
+// IsSkewExceeded checks if the clock skew measured last exceeds the threshold
+func (checker *ClockSkewChecker) IsSkewExceeded() bool {
+	skew := checker.GetSkew()
+	return skew > checker.threshold || -skew > checker.threshold
+}
+
+// Start checks clock skew periodically
+func (checker *ClockSkewChecker) Start(interval time.Duration) {
+	if interval <= 0 || checker.terminateChan != nil {
+		return
+	}
+
+	terminateChan := make(chan bool)
+	checker.terminateChan = terminateChan
+
+	go func() {
+		logger := log.WithFields(log.Fields{
+			"package":  "irodsfs",
+			"struct":   "ClockSkewChecker",
+			"function": "Start",
+		})
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-terminateChan:
+				return
+			case <-ticker.C:
+				_, err := checker.Check()
+				if err != nil {
+					logger.Errorf("%+v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops checking clock skew
+func (checker *ClockSkewChecker) Stop() {
+	if checker.terminateChan != nil {
+		close(checker.terminateChan)
+		checker.terminateChan = nil
+	}
+}
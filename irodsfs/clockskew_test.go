@@ -0,0 +1,79 @@
+package irodsfs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+)
+
+// skewedFSClient records create times of a server having its clock behind by the skew
+type skewedFSClient struct {
+	*fakeFSClient
+
+	skew time.Duration
+}
+
+func (client *skewedFSClient) CreateFile(filePath string, resource string, mode string) (irodsfs_common_irods.IRODSFSFileHandle, error) {
+	handle, err := client.fakeFSClient.CreateFile(filePath, resource, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	client.mutex.Lock()
+	client.entries[filePath].CreateTime = time.Now().Add(-client.skew)
+	client.mutex.Unlock()
+	return handle, nil
+}
+
+func TestClockSkewCheckerDetectsSkew(t *testing.T) {
+	homePath := "/" + testZone + "/home/" + testUser
+
+	tests := []struct {
+		skew     time.Duration
+		exceeded bool
+	}{
+		{0, false},
+		{10 * time.Minute, true},
+		{-10 * time.Minute, true},
+	}
+
+	for _, test := range tests {
+		client := &skewedFSClient{fakeFSClient: newFakeFSClient(), skew: test.skew}
+		checker := NewClockSkewChecker(client, homePath, time.Minute)
+
+		skew, err := checker.Check()
+		if err != nil {
+			t.Fatalf("skew %s: failed to check - %v", test.skew, err)
+		}
+
+		if diff := skew - test.skew; diff > time.Second || -diff > time.Second {
+			t.Errorf("expected skew %s, got %s", test.skew, skew)
+		}
+
+		if checker.GetSkew() != skew {
+			t.Errorf("expected skew %s kept, got %s", skew, checker.GetSkew())
+		}
+
+		if checker.IsSkewExceeded() != test.exceeded {
+			t.Errorf("skew %s: expected exceeded %t", test.skew, test.exceeded)
+		}
+
+		// the probe is removed, no metadata is left on the home collection
+		entries, err := client.List(homePath)
+		if err != nil {
+			t.Fatalf("failed to list - %v", err)
+		}
+
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name, clockSkewProbePrefix) {
+				t.Errorf("expected the probe %q removed", entry.Path)
+			}
+		}
+
+		if calls := client.getCalls("SetXattr"); calls != 0 {
+			t.Errorf("expected no metadata set, got %d calls", calls)
+		}
+	}
+}
@@ -2,15 +2,20 @@ package irodsfs
 
 import (
 	"context"
+	"fmt"
 	"io/fs"
+	"os"
+	"strings"
 	"time"
 
 	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_common "github.com/cyverse/go-irodsclient/irods/common"
 	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
 	irodsfs_common_inode "github.com/cyverse/irodsfs-common/inode"
 	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
 	fusefs "github.com/hanwen/go-fuse/v2/fs"
 	fuse "github.com/hanwen/go-fuse/v2/fuse"
+	"golang.org/x/xerrors"
 )
 
 func setAttrOutForVirtualDirEntry(inodeManager *irodsfs_common_inode.InodeManager, entry *irodsfs_common_vpath.VPathVirtualDirEntry, uid uint32, gid uint32, out *fuse.Attr) {
@@ -23,12 +28,13 @@ func setAttrOutForVirtualDirEntry(inodeManager *irodsfs_common_inode.InodeManage
 	out.Mode = uint32(fuse.S_IFDIR | 0o500)
 }
 
-func setAttrOutForIRODSEntry(inodeManager *irodsfs_common_inode.InodeManager, entry *irodsclient_fs.Entry, uid uint32, gid uint32, mode fs.FileMode, out *fuse.Attr) {
-	out.Ino = inodeManager.GetInodeIDForIRODSEntryID(entry.ID)
+func setAttrOutForIRODSEntry(inodeID uint64, entry *irodsclient_fs.Entry, uid uint32, gid uint32, mode fs.FileMode, out *fuse.Attr) {
+	out.Ino = inodeID
 	out.Uid = uid
 	out.Gid = gid
 	out.SetTimes(&entry.ModifyTime, &entry.ModifyTime, &entry.ModifyTime)
 	out.Size = uint64(entry.Size)
+	out.Blocks = getBlocks(entry.Size)
 
 	if entry.IsDir() {
 		out.Mode = uint32(fuse.S_IFDIR | mode)
@@ -37,6 +43,23 @@ func setAttrOutForIRODSEntry(inodeManager *irodsfs_common_inode.InodeManager, en
 	}
 }
 
+// setAttrOutForSymlink overrides attr of the data object holding the symlink
+func setAttrOutForSymlink(target []byte, out *fuse.Attr) {
+	out.Size = uint64(len(target))
+	out.Blocks = 0
+	out.Mode = uint32(fuse.S_IFLNK | 0o777)
+}
+
+// getBlocks returns the number of 512-byte blocks for the given size
+// du uses st_blocks, not st_size, to compute disk usage
+func getBlocks(size int64) uint64 {
+	if size <= 0 {
+		return 0
+	}
+
+	return uint64((size + 511) / 512)
+}
+
 func setAttrOutForDummy(inodeManager *irodsfs_common_inode.InodeManager, vpath string, uid uint32, gid uint32, dir bool, out *fuse.Attr) {
 	out.Ino = inodeManager.GetInodeIDForVPathEntry(vpath)
 	out.Uid = uid
@@ -79,6 +102,13 @@ func NewSubDirInode(ctx context.Context, dir *Dir, inodeID uint64, path string)
 	return subDir, subDirInode
 }
 
+func NewSubSymlinkInode(ctx context.Context, dir *Dir, inodeID uint64, path string) (*Symlink, *fusefs.Inode) {
+	subSymlink := NewSymlink(dir.fs, inodeID, path)
+	subSymlinkInode := dir.NewInode(ctx, subSymlink, subSymlink.getStableAttr())
+
+	return subSymlink, subSymlinkInode
+}
+
 func NewSubFileInode(ctx context.Context, dir *Dir, inodeID uint64, path string) (*File, *fusefs.Inode) {
 	subFile := NewFile(dir.fs, inodeID, path)
 	subFileInode := dir.NewInode(ctx, subFile, subFile.getStableAttr())
@@ -86,6 +116,86 @@ func NewSubFileInode(ctx context.Context, dir *Dir, inodeID uint64, path string)
 	return subFile, subFileInode
 }
 
+// getCallerUID returns local uid of the user who issued the FUSE request
+func getCallerUID(ctx context.Context) (uint32, bool) {
+	caller, ok := fuse.FromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+
+	return caller.Uid, true
+}
+
+// getCallerProcess returns pid and command name of the process which issued the FUSE request
+// command name is empty if the process already exited or is not visible in /proc
+func getCallerProcess(ctx context.Context) (uint32, string, bool) {
+	caller, ok := fuse.FromContext(ctx)
+	if !ok {
+		return 0, "", false
+	}
+
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", caller.Pid))
+	if err != nil {
+		return caller.Pid, "", true
+	}
+
+	return caller.Pid, strings.TrimSpace(string(comm)), true
+}
+
 func isTransitiveConnectionError(err error) bool {
 	return irodsclient_types.IsConnectionError(err) || irodsclient_types.IsConnectionPoolFullError(err)
 }
+
+// ProtocolError is an error caused by broken iRODS wire protocol framing, e.g., SYS_HEADER_READ_LEN_ERR
+type ProtocolError struct {
+	err error
+}
+
+// NewProtocolError creates a ProtocolError
+func NewProtocolError(err error) *ProtocolError {
+	return &ProtocolError{
+		err: err,
+	}
+}
+
+// Error returns error message
+func (err *ProtocolError) Error() string {
+	return fmt.Sprintf("iRODS protocol error: %v", err.err)
+}
+
+// Unwrap returns the wrapped error
+func (err *ProtocolError) Unwrap() error {
+	return err.err
+}
+
+// IsProtocolError checks if the given error is ProtocolError
+func IsProtocolError(err error) bool {
+	var protocolErr *ProtocolError
+	return xerrors.As(err, &protocolErr)
+}
+
+func isIRODSProtocolError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch irodsclient_types.GetIRODSErrorCode(err) {
+	case irodsclient_common.SYS_HEADER_READ_LEN_ERR, irodsclient_common.SYS_HEADER_WRITE_LEN_ERR, irodsclient_common.SYS_HEADER_TPYE_LEN_ERR:
+		return true
+	default:
+		return false
+	}
+}
+
+// isPermissionError checks if the error is caused by lacking access to the entry
+func isPermissionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if irodsclient_types.IsAuthError(err) {
+		return true
+	}
+
+	return irodsclient_types.GetIRODSErrorCode(err) == irodsclient_common.CAT_NO_ACCESS_PERMISSION
+}
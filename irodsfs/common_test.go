@@ -0,0 +1,44 @@
+package irodsfs
+
+import (
+	"testing"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestGetBlocks(t *testing.T) {
+	testCases := []struct {
+		size   int64
+		blocks uint64
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 1},
+		{511, 1},
+		{512, 1},
+		{513, 2},
+		{1 << 20, 2048},
+	}
+
+	for _, testCase := range testCases {
+		if blocks := getBlocks(testCase.size); blocks != testCase.blocks {
+			t.Errorf("expected %d blocks for size %d, got %d", testCase.blocks, testCase.size, blocks)
+		}
+	}
+}
+
+func TestSetAttrOutReportsBlocks(t *testing.T) {
+	entry := &irodsclient_fs.Entry{
+		Type: irodsclient_fs.FileEntry,
+		Path: "/testzone/home/testuser/file",
+		Size: 1000,
+	}
+
+	out := &fuse.Attr{}
+	setAttrOutForIRODSEntry(1, entry, 0, 0, 0o644, out)
+
+	if out.Blocks != 2 {
+		t.Errorf("expected 2 blocks for size %d, got %d", entry.Size, out.Blocks)
+	}
+}
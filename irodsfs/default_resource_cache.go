@@ -0,0 +1,88 @@
+package irodsfs
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultResourceCache retains default resources of collections set in xattr, so creates do not ask iRODS for the xattr every time
+// collections without the xattr are cached too, as most collections do not have it
+type DefaultResourceCache struct {
+	timeout     time.Duration
+	mutex       sync.Mutex
+	entries     map[string]*defaultResourceCacheEntry // key is collection path
+	lastCleanup time.Time
+}
+
+type defaultResourceCacheEntry struct {
+	expireTime time.Time
+	resource   string // empty if the collection does not have the xattr
+}
+
+// NewDefaultResourceCache creates a new DefaultResourceCache
+func NewDefaultResourceCache(timeout time.Duration) *DefaultResourceCache {
+	return &DefaultResourceCache{
+		timeout:     timeout,
+		mutex:       sync.Mutex{},
+		entries:     map[string]*defaultResourceCacheEntry{},
+		lastCleanup: time.Now(),
+	}
+}
+
+// Get returns the default resource cached, empty if the collection does not have the xattr
+// returns false if not cached
+func (cache *DefaultResourceCache) Get(collPath string) (string, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cachedEntry, ok := cache.entries[collPath]
+	if !ok {
+		return "", false
+	}
+
+	if time.Now().After(cachedEntry.expireTime) {
+		delete(cache.entries, collPath)
+		return "", false
+	}
+
+	return cachedEntry.resource, true
+}
+
+// Set caches the default resource, pass empty resource if the collection does not have the xattr
+func (cache *DefaultResourceCache) Set(collPath string, resource string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+
+	// clean up expired entries once in a timeout, not to scan all entries on every set
+	if now.Sub(cache.lastCleanup) > cache.timeout {
+		for cachedPath, cachedEntry := range cache.entries {
+			if now.After(cachedEntry.expireTime) {
+				delete(cache.entries, cachedPath)
+			}
+		}
+		cache.lastCleanup = now
+	}
+
+	cache.entries[collPath] = &defaultResourceCacheEntry{
+		expireTime: now.Add(cache.timeout),
+		resource:   resource,
+	}
+}
+
+// Invalidate removes the cached default resource of the path
+func (cache *DefaultResourceCache) Invalidate(collPath string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	delete(cache.entries, collPath)
+}
+
+// Clear clears all cached default resources
+func (cache *DefaultResourceCache) Clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries = map[string]*defaultResourceCacheEntry{}
+}
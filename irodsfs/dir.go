@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 	"syscall"
+	"time"
 
 	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
 	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
@@ -21,7 +22,10 @@ func NewIRODSRoot(fs *IRODSFS, vpathEntry *irodsfs_common_vpath.VPathEntry) (*Di
 		"function": "NewIRODSRoot",
 	})
 
-	err := ensureVPathEntryIsIRODSDir(fs.fsClient, vpathEntry)
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	err := ensureVPathEntryIsIRODSDir(fsClient, vpathEntry)
 	if err != nil {
 		logger.Errorf("%+v", err)
 		if isTransitiveConnectionError(err) {
@@ -33,7 +37,7 @@ func NewIRODSRoot(fs *IRODSFS, vpathEntry *irodsfs_common_vpath.VPathEntry) (*Di
 		return nil, syscall.EREMOTEIO
 	}
 
-	inodeID := fs.inodeManager.GetInodeIDForIRODSEntryID(vpathEntry.IRODSEntry.ID)
+	inodeID := fs.getInodeIDForIRODSEntry(vpathEntry.IRODSEntry.ID, vpathEntry.IRODSEntry.Path)
 	return NewDir(fs, inodeID, "/"), nil
 }
 
@@ -66,17 +70,24 @@ func (dir *Dir) getStableAttr() fusefs.StableAttr {
 }
 
 func (dir *Dir) ensureDirIRODSPath(vpathEntry *irodsfs_common_vpath.VPathEntry) error {
-	return ensureVPathEntryIsIRODSDir(dir.fs.fsClient, vpathEntry)
+	fsClient, done := dir.fs.acquireFSClient()
+	defer done()
+
+	return ensureVPathEntryIsIRODSDir(fsClient, vpathEntry)
 }
 
 func (dir *Dir) ensureIRODSPath(vpathEntry *irodsfs_common_vpath.VPathEntry) error {
-	return ensureVPathEntryIsIRODSEntry(dir.fs.fsClient, vpathEntry)
+	fsClient, done := dir.fs.acquireFSClient()
+	defer done()
+
+	return ensureVPathEntryIsIRODSEntry(fsClient, vpathEntry)
 }
 
 // Getattr returns stat of file entry
-func (dir *Dir) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+func (dir *Dir) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) (errno syscall.Errno) {
+	defer dir.fs.metrics.ObserveOperation("Getattr", time.Now(), &errno)
 	if dir.fs.terminated {
-		return syscall.ECONNABORTED
+		return dir.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -135,7 +146,11 @@ func (dir *Dir) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.Att
 // Setattr sets dir attributes
 func (dir *Dir) Setattr(ctx context.Context, fh fusefs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
 	if dir.fs.terminated {
-		return syscall.ECONNABORTED
+		return dir.fs.terminatedErrno
+	}
+
+	if dir.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -180,6 +195,91 @@ func (dir *Dir) Setattr(ctx context.Context, fh fusefs.FileHandle, in *fuse.SetA
 		}
 	*/
 
+	if mode, ok := in.GetMode(); ok && dir.fs.config.ChmodACL {
+		// chmod is ignored without chmod_acl
+		errno := dir.setMode(ctx, mode)
+		if errno != fusefs.OK {
+			return errno
+		}
+	}
+
+	if modifyTime, ok := in.GetMTime(); ok {
+		return dir.setModifyTime(ctx, modifyTime, out)
+	}
+
+	return fusefs.OK
+}
+
+// setMode applies the mode set by chmod to iRODS ACLs
+func (dir *Dir) setMode(ctx context.Context, mode uint32) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "Dir",
+		"function": "setMode",
+	})
+
+	vpathEntry := dir.fs.vpathManager.GetClosestEntry(dir.path)
+	if vpathEntry == nil {
+		logger.Errorf("failed to get VPath Entry for %q", dir.path)
+		return syscall.EREMOTEIO
+	}
+
+	if vpathEntry.IsVirtualDirEntry() {
+		logger.Debugf("failed to change mode of virtual dir entry %q", dir.path)
+		return syscall.EOPNOTSUPP
+	}
+
+	if vpathEntry.ReadOnly {
+		logger.Debugf("failed to change mode of readonly vpath mapping entry %q", dir.path)
+		return syscall.EROFS
+	}
+
+	irodsPath, err := vpathEntry.GetIRODSPath(dir.path)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	return IRODSChmod(ctx, dir.fs, irodsPath, mode)
+}
+
+// setModifyTime persists the modify time set by users, e.g., touch -d, if persist timestamps is enabled
+func (dir *Dir) setModifyTime(ctx context.Context, modifyTime time.Time, out *fuse.AttrOut) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "Dir",
+		"function": "setModifyTime",
+	})
+
+	if !dir.fs.config.PersistTimestamps {
+		// not supported but return OK to not cause various errors in linux commands
+		logger.Debugf("ignoring modify time of %q, persist timestamps is disabled", dir.path)
+		return fusefs.OK
+	}
+
+	vpathEntry := dir.fs.vpathManager.GetClosestEntry(dir.path)
+	if vpathEntry == nil {
+		logger.Errorf("failed to get VPath Entry for %q", dir.path)
+		return syscall.EREMOTEIO
+	}
+
+	if vpathEntry.ReadOnly || vpathEntry.IsVirtualDirEntry() {
+		logger.Debugf("ignoring modify time of readonly vpath mapping entry %q", dir.path)
+		return fusefs.OK
+	}
+
+	irodsPath, err := vpathEntry.GetIRODSPath(dir.path)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	errno := IRODSSetModifyTime(ctx, dir.fs, irodsPath, modifyTime)
+	if errno != fusefs.OK {
+		return errno
+	}
+
+	out.Attr.SetTimes(nil, &modifyTime, nil)
 	return fusefs.OK
 }
 
@@ -190,7 +290,7 @@ func (dir *Dir) Setattr(ctx context.Context, fh fusefs.FileHandle, in *fuse.SetA
 // success.
 func (dir *Dir) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
 	if dir.fs.terminated {
-		return 0, syscall.ECONNABORTED
+		return 0, dir.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -214,10 +314,15 @@ func (dir *Dir) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Err
 		return 0, syscall.EREMOTEIO
 	}
 
+	var pseudoXattrNames []string
+	if dir.path == "/" && dir.fs.config.ExposeMountInfo {
+		pseudoXattrNames = mountInfoXattrNames
+	}
+
 	// Virtual Dir
 	if vpathEntry.IsVirtualDirEntry() {
-		// no data
-		return 0, fusefs.OK
+		// no data but mount info
+		return irodsCopyXattrNames(pseudoXattrNames, dest)
 	}
 
 	// IRODS Dir
@@ -233,7 +338,7 @@ func (dir *Dir) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Err
 		return 0, syscall.EREMOTEIO
 	}
 
-	return IRODSListxattr(ctx, dir.fs, irodsPath, dest)
+	return IRODSListxattr(ctx, dir.fs, irodsPath, pseudoXattrNames, dest)
 }
 
 // Getxattr returns xattr
@@ -242,10 +347,10 @@ func (dir *Dir) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Err
 // If not defined, Getxattr will return ENOATTR.
 func (dir *Dir) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
 	if dir.fs.terminated {
-		return 0, syscall.ECONNABORTED
+		return 0, dir.fs.terminatedErrno
 	}
 
-	if IsUnhandledAttr(attr) {
+	if IsUnhandledAttr(attr) && !(attr == PosixACLAccessXattrName && dir.fs.config.PosixACL) {
 		return 0, syscall.ENODATA
 	}
 
@@ -261,6 +366,17 @@ func (dir *Dir) Getxattr(ctx context.Context, attr string, dest []byte) (uint32,
 	logger.Infof("Calling Getxattr (%d) - %q, name %q", operID, dir.path, attr)
 	defer logger.Infof("Called Getxattr (%d) - %q, name %q", operID, dir.path, attr)
 
+	if dir.path == "/" && dir.fs.config.ExposeMountInfo {
+		if value, ok := dir.fs.getMountInfoXattr(attr); ok {
+			if len(dest) < len(value) {
+				return uint32(len(value)), syscall.ERANGE
+			}
+
+			copy(dest, value)
+			return uint32(len(value)), fusefs.OK
+		}
+	}
+
 	dir.mutex.RLock()
 	defer dir.mutex.RUnlock()
 
@@ -288,6 +404,10 @@ func (dir *Dir) Getxattr(ctx context.Context, attr string, dest []byte) (uint32,
 		return 0, syscall.EREMOTEIO
 	}
 
+	if attr == PosixACLAccessXattrName {
+		return IRODSGetPosixACL(ctx, dir.fs, irodsPath, vpathEntry.ReadOnly, dest)
+	}
+
 	return IRODSGetxattr(ctx, dir.fs, irodsPath, attr, dest)
 }
 
@@ -295,7 +415,11 @@ func (dir *Dir) Getxattr(ctx context.Context, attr string, dest []byte) (uint32,
 // If not defined, Setxattr will return ENOATTR.
 func (dir *Dir) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
 	if dir.fs.terminated {
-		return syscall.ECONNABORTED
+		return dir.fs.terminatedErrno
+	}
+
+	if dir.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -318,6 +442,14 @@ func (dir *Dir) Setxattr(ctx context.Context, attr string, data []byte, flags ui
 		return syscall.EACCES
 	}
 
+	if IsReadOnlyAttr(dir.fs.config, attr) {
+		return syscall.EPERM
+	}
+
+	if dir.fs.config.CollectionDefaultResource && attr == DefaultResourceXattrName && !IsValidResourceName(string(data)) {
+		return syscall.EINVAL
+	}
+
 	dir.mutex.RLock()
 	defer dir.mutex.RUnlock()
 
@@ -352,7 +484,11 @@ func (dir *Dir) Setxattr(ctx context.Context, attr string, data []byte, flags ui
 // If not defined, Removexattr will return ENOATTR.
 func (dir *Dir) Removexattr(ctx context.Context, attr string) syscall.Errno {
 	if dir.fs.terminated {
-		return syscall.ECONNABORTED
+		return dir.fs.terminatedErrno
+	}
+
+	if dir.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -367,6 +503,10 @@ func (dir *Dir) Removexattr(ctx context.Context, attr string) syscall.Errno {
 	logger.Infof("Calling Removexattr (%d) - %q", operID, dir.path)
 	defer logger.Infof("Called Removexattr (%d) - %q", operID, dir.path)
 
+	if IsReadOnlyAttr(dir.fs.config, attr) {
+		return syscall.EPERM
+	}
+
 	dir.mutex.RLock()
 	defer dir.mutex.RUnlock()
 
@@ -398,9 +538,10 @@ func (dir *Dir) Removexattr(ctx context.Context, attr string) syscall.Errno {
 }
 
 // Lookup returns a node for the path
-func (dir *Dir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+func (dir *Dir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (inode *fusefs.Inode, errno syscall.Errno) {
+	defer dir.fs.metrics.ObserveOperation("Lookup", time.Now(), &errno)
 	if dir.fs.terminated {
-		return nil, syscall.ECONNABORTED
+		return nil, dir.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -420,6 +561,13 @@ func (dir *Dir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*f
 	dir.mutex.RLock()
 	defer dir.mutex.RUnlock()
 
+	// Rule Control Dir, hides an iRODS entry of the same name
+	if dir.path == "/" && name == RuleDirName && dir.fs.ruleRunner != nil {
+		ruleDir, ruleDirInode := NewSubRuleDirInode(ctx, dir)
+		ruleDir.setAttrOut(&out.Attr)
+		return ruleDirInode, fusefs.OK
+	}
+
 	vpathEntry := dir.fs.vpathManager.GetClosestEntry(targetPath)
 	if vpathEntry == nil {
 		logger.Errorf("failed to get VPath Entry for %q", targetPath)
@@ -455,20 +603,102 @@ func (dir *Dir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*f
 		return nil, errno
 	}
 
-	inodeID := dir.fs.inodeManager.GetInodeIDForIRODSEntryID(entryID)
+	inodeID := dir.fs.getInodeIDForIRODSEntry(entryID, irodsPath)
 	if entryDir {
 		_, subDirInode := NewSubDirInode(ctx, dir, inodeID, targetPath)
 		return subDirInode, fusefs.OK
 	}
 
+	// with resolve_softlinks, symlinks are nodes the kernel follows, so targets are not aliased into this dir
+	// the kernel returns ENOENT for dangling symlinks and ELOOP for cycles
+	// iRODS linked collections are not detected, go-irodsclient does not expose collection types
+	// symlinks are empty data objects, others are not asked for a target
+	if (dir.fs.config.EnableSymlink || dir.fs.config.ResolveSoftlinks) && out.Attr.Size == 0 {
+		target, errno := irodsReadlinkCached(ctx, dir.fs, irodsPath)
+		if errno == fusefs.OK {
+			target = dir.fs.getSymlinkTarget(target)
+			setAttrOutForSymlink(target, &out.Attr)
+			_, subSymlinkInode := NewSubSymlinkInode(ctx, dir, inodeID, targetPath)
+			return subSymlinkInode, fusefs.OK
+		}
+	}
+
 	_, subFileInode := NewSubFileInode(ctx, dir, inodeID, targetPath)
 	return subFileInode, fusefs.OK
 }
 
+// Symlink creates a symlink
+func (dir *Dir) Symlink(ctx context.Context, target string, name string, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+	if dir.fs.terminated {
+		return nil, dir.fs.terminatedErrno
+	}
+
+	if dir.fs.config.ReadOnly {
+		return nil, syscall.EROFS
+	}
+
+	if !dir.fs.config.EnableSymlink {
+		return nil, syscall.ENOTSUP
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "Dir",
+		"function": "Symlink",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	targetPath := irodsfs_common_utils.JoinPath(dir.path, name)
+
+	operID := dir.fs.GetNextOperationID()
+	logger.Infof("Calling Symlink (%d) - %q to %q", operID, targetPath, target)
+	defer logger.Infof("Called Symlink (%d) - %q to %q", operID, targetPath, target)
+
+	dir.mutex.Lock()
+	defer dir.mutex.Unlock()
+
+	vpathEntry := dir.fs.vpathManager.GetClosestEntry(targetPath)
+	if vpathEntry == nil {
+		logger.Errorf("failed to get VPath Entry for %q", targetPath)
+		return nil, syscall.EREMOTEIO
+	}
+
+	if isVPathEntryUnmodifiable(vpathEntry, targetPath) {
+		// failed to create. read only
+		err := xerrors.Errorf("failed to create a symlink in readonly vpath mapping entry %q", vpathEntry.Path)
+		logger.Error(err)
+		return nil, syscall.EPERM
+	}
+
+	// IRODS Dir
+	err := dir.ensureDirIRODSPath(vpathEntry)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return nil, syscall.EREMOTEIO
+	}
+
+	irodsPath, err := vpathEntry.GetIRODSPath(targetPath)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return nil, syscall.EREMOTEIO
+	}
+
+	entryID, errno := IRODSSymlink(ctx, dir.fs, dir, irodsPath, target, out)
+	if errno != fusefs.OK {
+		return nil, errno
+	}
+
+	inodeID := dir.fs.getInodeIDForIRODSEntry(entryID, irodsPath)
+	_, subSymlinkInode := NewSubSymlinkInode(ctx, dir, inodeID, targetPath)
+	return subSymlinkInode, fusefs.OK
+}
+
 // Opendir validates the existance of a dir
-func (dir *Dir) Opendir(ctx context.Context) syscall.Errno {
+func (dir *Dir) Opendir(ctx context.Context) (errno syscall.Errno) {
+	defer dir.fs.metrics.ObserveOperation("Opendir", time.Now(), &errno)
 	if dir.fs.terminated {
-		return syscall.ECONNABORTED
+		return dir.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -521,13 +751,19 @@ func (dir *Dir) Opendir(ctx context.Context) syscall.Errno {
 		return syscall.EREMOTEIO
 	}
 
-	return IRODSOpendir(ctx, dir.fs, irodsPath)
+	errno = IRODSOpendir(ctx, dir.fs, irodsPath)
+	if errno == fusefs.OK {
+		dir.fs.prefetchDirAttrs(irodsPath)
+	}
+
+	return errno
 }
 
 // Readdir returns directory entries
-func (dir *Dir) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
+func (dir *Dir) Readdir(ctx context.Context) (stream fusefs.DirStream, errno syscall.Errno) {
+	defer dir.fs.metrics.ObserveOperation("Readdir", time.Now(), &errno)
 	if dir.fs.terminated {
-		return nil, syscall.ECONNABORTED
+		return nil, dir.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -553,6 +789,14 @@ func (dir *Dir) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
 
 	dirEntries := getDefaultDirEntries()
 
+	if dir.path == "/" && dir.fs.ruleRunner != nil {
+		dirEntries = append(dirEntries, fuse.DirEntry{
+			Ino:  0,
+			Mode: uint32(fuse.S_IFDIR),
+			Name: RuleDirName,
+		})
+	}
+
 	// Virtual Dir
 	if vpathEntry.IsVirtualDirEntry() {
 		if vpathEntry.Path == dir.path {
@@ -575,7 +819,7 @@ func (dir *Dir) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
 						entryType = uint32(fuse.S_IFDIR)
 					}
 
-					inodeID := dir.fs.inodeManager.GetInodeIDForIRODSEntryID(entry.IRODSEntry.ID)
+					inodeID := dir.fs.getInodeIDForIRODSEntry(entry.IRODSEntry.ID, entry.IRODSEntry.Path)
 					dirEntry := fuse.DirEntry{
 						Ino:  inodeID,
 						Mode: entryType,
@@ -611,15 +855,138 @@ func (dir *Dir) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
 	}
 
 	irodsDirEntries, errno := IRODSReaddir(ctx, dir.fs, irodsPath)
-	dirEntries = append(dirEntries, irodsDirEntries...)
+	if errno == fusefs.OK && dir.fs.config.OverlayMappings {
+		irodsDirEntries = dir.overlayMappedDirEntries(irodsDirEntries)
+	}
+
+	for _, irodsDirEntry := range irodsDirEntries {
+		if dir.path == "/" && irodsDirEntry.Name == RuleDirName && dir.fs.ruleRunner != nil {
+			// hidden by the rule control dir
+			continue
+		}
+
+		dirEntries = append(dirEntries, irodsDirEntry)
+	}
+
+	if errno != fusefs.OK && len(irodsDirEntries) > 0 {
+		// entries known before the listing failed, e.g., timed out, are presented and then the error
+		return &partialDirStream{
+			entries: dirEntries,
+			errno:   errno,
+		}, fusefs.OK
+	}
 
 	return fusefs.NewListDirStream(dirEntries), errno
 }
 
+// partialDirStream lists entries, and then fails with the errno
+type partialDirStream struct {
+	entries []fuse.DirEntry
+	errno   syscall.Errno
+}
+
+// HasNext checks if an entry or the error is left
+func (stream *partialDirStream) HasNext() bool {
+	return len(stream.entries) > 0 || stream.errno != fusefs.OK
+}
+
+// Next returns the next entry, or the error once all entries are returned
+func (stream *partialDirStream) Next() (fuse.DirEntry, syscall.Errno) {
+	if len(stream.entries) > 0 {
+		entry := stream.entries[0]
+		stream.entries = stream.entries[1:]
+		return entry, fusefs.OK
+	}
+
+	errno := stream.errno
+	stream.errno = fusefs.OK
+	return fuse.DirEntry{}, errno
+}
+
+// Close closes the stream
+func (stream *partialDirStream) Close() {
+}
+
+// overlayMappedDirEntries merges entries of path mappings placed in the dir into the dir entries
+// a mapped entry takes precedence over an iRODS entry with the same name, as lookup resolves the name to the mapping
+func (dir *Dir) overlayMappedDirEntries(dirEntries []fuse.DirEntry) []fuse.DirEntry {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "Dir",
+		"function": "overlayMappedDirEntries",
+	})
+
+	mappedDirEntries := map[string]fuse.DirEntry{}
+	fsClient, done := dir.fs.acquireFSClient()
+	defer done()
+
+	for _, mapping := range dir.fs.pathMappings {
+		if mapping.MappingPath == dir.path || irodsfs_common_utils.GetDirname(mapping.MappingPath) != dir.path {
+			continue
+		}
+
+		vpathEntry := dir.fs.vpathManager.GetEntry(mapping.MappingPath)
+		if vpathEntry == nil {
+			continue
+		}
+
+		name := irodsfs_common_utils.GetFileName(mapping.MappingPath)
+		if vpathEntry.IsVirtualDirEntry() {
+			mappedDirEntries[name] = fuse.DirEntry{
+				Ino:  dir.fs.inodeManager.GetInodeIDForVPathEntryID(vpathEntry.VirtualDirEntry.ID),
+				Mode: uint32(fuse.S_IFDIR),
+				Name: name,
+			}
+			continue
+		}
+
+		err := ensureVPathEntryIsIRODSEntry(fsClient, vpathEntry)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			continue
+		}
+
+		entryType := uint32(fuse.S_IFREG)
+		if vpathEntry.IRODSEntry.IsDir() {
+			entryType = uint32(fuse.S_IFDIR)
+		}
+
+		mappedDirEntries[name] = fuse.DirEntry{
+			Ino:  dir.fs.getInodeIDForIRODSEntry(vpathEntry.IRODSEntry.ID, vpathEntry.IRODSEntry.Path),
+			Mode: entryType,
+			Name: name,
+		}
+	}
+
+	if len(mappedDirEntries) == 0 {
+		return dirEntries
+	}
+
+	newDirEntries := []fuse.DirEntry{}
+	for _, dirEntry := range dirEntries {
+		if _, ok := mappedDirEntries[dirEntry.Name]; ok {
+			// hidden by the mapping
+			continue
+		}
+		newDirEntries = append(newDirEntries, dirEntry)
+	}
+
+	for _, mappedDirEntry := range mappedDirEntries {
+		newDirEntries = append(newDirEntries, mappedDirEntry)
+	}
+
+	return newDirEntries
+}
+
 // Rmdir removes a dir
-func (dir *Dir) Rmdir(ctx context.Context, name string) syscall.Errno {
+func (dir *Dir) Rmdir(ctx context.Context, name string) (errno syscall.Errno) {
+	defer dir.fs.metrics.ObserveOperation("Rmdir", time.Now(), &errno)
 	if dir.fs.terminated {
-		return syscall.ECONNABORTED
+		return dir.fs.terminatedErrno
+	}
+
+	if dir.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -669,9 +1036,14 @@ func (dir *Dir) Rmdir(ctx context.Context, name string) syscall.Errno {
 }
 
 // Unlink removes a file for the path
-func (dir *Dir) Unlink(ctx context.Context, name string) syscall.Errno {
+func (dir *Dir) Unlink(ctx context.Context, name string) (errno syscall.Errno) {
+	defer dir.fs.metrics.ObserveOperation("Unlink", time.Now(), &errno)
 	if dir.fs.terminated {
-		return syscall.ECONNABORTED
+		return dir.fs.terminatedErrno
+	}
+
+	if dir.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -721,9 +1093,14 @@ func (dir *Dir) Unlink(ctx context.Context, name string) syscall.Errno {
 }
 
 // Mkdir makes a dir for the path
-func (dir *Dir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+func (dir *Dir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (inode *fusefs.Inode, errno syscall.Errno) {
+	defer dir.fs.metrics.ObserveOperation("Mkdir", time.Now(), &errno)
 	if dir.fs.terminated {
-		return nil, syscall.ECONNABORTED
+		return nil, dir.fs.terminatedErrno
+	}
+
+	if dir.fs.config.ReadOnly {
+		return nil, syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -774,7 +1151,7 @@ func (dir *Dir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.E
 		return nil, errno
 	}
 
-	inodeID := dir.fs.inodeManager.GetInodeIDForIRODSEntryID(entryID)
+	inodeID := dir.fs.getInodeIDForIRODSEntry(entryID, irodsPath)
 	_, subDirInode := NewSubDirInode(ctx, dir, inodeID, targetPath)
 	return subDirInode, fusefs.OK
 }
@@ -823,9 +1200,14 @@ func (dir *Dir) renameNode(srcPath string, destPath string, node *fusefs.Inode)
 }
 
 // Rename renames a node for the path
-func (dir *Dir) Rename(ctx context.Context, name string, newParent fusefs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+func (dir *Dir) Rename(ctx context.Context, name string, newParent fusefs.InodeEmbedder, newName string, flags uint32) (errno syscall.Errno) {
+	defer dir.fs.metrics.ObserveOperation("Rename", time.Now(), &errno)
 	if dir.fs.terminated {
-		return syscall.ECONNABORTED
+		return dir.fs.terminatedErrno
+	}
+
+	if dir.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -909,6 +1291,12 @@ func (dir *Dir) Rename(ctx context.Context, name string, newParent fusefs.InodeE
 		return syscall.EREMOTEIO
 	}
 
+	if vpathSrcEntry.Path != vpathDestEntry.Path && irodsGetZone(irodsSrcPath) != irodsGetZone(irodsDestPath) {
+		// iRODS cannot move across zones, tools copy and delete instead
+		logger.Debugf("failed to rename %q to %q across path mappings in different zones", irodsSrcPath, irodsDestPath)
+		return syscall.EXDEV
+	}
+
 	// lock first
 	// dir?
 	openFilePaths := dir.fs.fileHandleMap.ListPathsInDir(irodsSrcPath)
@@ -927,7 +1315,7 @@ func (dir *Dir) Rename(ctx context.Context, name string, newParent fusefs.InodeE
 		defer handle.mutex.Unlock()
 	}
 
-	errno := IRODSRename(ctx, dir.fs, dir, irodsSrcPath, irodsDestPath)
+	errno = IRODSRename(ctx, dir.fs, dir, irodsSrcPath, irodsDestPath)
 	if errno != fusefs.OK {
 		return errno
 	}
@@ -948,9 +1336,15 @@ func (dir *Dir) Rename(ctx context.Context, name string, newParent fusefs.InodeE
 }
 
 // Create creates a file for the path and returns file handle
-func (dir *Dir) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fusefs.Inode, fusefs.FileHandle, uint32, syscall.Errno) {
-	if dir.fs.terminated {
-		return nil, nil, 0, syscall.ECONNABORTED
+// O_TMPFILE never reaches here, FUSE has no operation for anonymous files, so the kernel fails it with EOPNOTSUPP
+func (dir *Dir) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (inode *fusefs.Inode, fh fusefs.FileHandle, fuseFlags uint32, errno syscall.Errno) {
+	defer dir.fs.metrics.ObserveOperation("Create", time.Now(), &errno)
+	if dir.fs.terminated || dir.fs.isDraining() {
+		return nil, nil, 0, dir.fs.terminatedErrno
+	}
+
+	if dir.fs.config.ReadOnly {
+		return nil, nil, 0, syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -1000,17 +1394,28 @@ func (dir *Dir) Create(ctx context.Context, name string, flags uint32, mode uint
 		return nil, nil, 0, syscall.EREMOTEIO
 	}
 
+	callerUID, hasCaller := getCallerUID(ctx)
+	reserved, ok := dir.fs.reserveOpenFile(callerUID, hasCaller)
+	if !ok {
+		logger.Errorf("failed to create file %q, uid %d reached the open file limit %d", targetPath, callerUID, dir.fs.config.OpenFileMaxPerUser)
+		return nil, nil, 0, syscall.EAGAIN
+	}
+
 	entryID, fileHandle, errno := IRODSCreate(ctx, dir.fs, dir, irodsPath, flags, out)
 	if errno != fusefs.OK {
+		if reserved {
+			dir.fs.fileHandleMap.CancelReservation(callerUID)
+		}
 		return nil, nil, 0, errno
 	}
 
-	inodeID := dir.fs.inodeManager.GetInodeIDForIRODSEntryID(entryID)
+	inodeID := dir.fs.getInodeIDForIRODSEntry(entryID, irodsPath)
 	subFile, subFileInode := NewSubFileInode(ctx, dir, inodeID, targetPath)
 	fileHandle.SetFile(subFile)
+	fileHandle.SetUID(callerUID)
 
 	// add to file handle map
-	dir.fs.fileHandleMap.Add(fileHandle)
+	dir.fs.addOpenedFile(fileHandle, reserved)
 
 	return subFileInode, fileHandle, fuseFlag, fusefs.OK
 }
@@ -1018,7 +1423,7 @@ func (dir *Dir) Create(ctx context.Context, name string, flags uint32, mode uint
 // Fsync flushes content changes
 func (dir *Dir) Fsync(ctx context.Context, fh fusefs.FileHandle, flags uint32) syscall.Errno {
 	if dir.fs.terminated {
-		return syscall.ECONNABORTED
+		return dir.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -1037,10 +1442,28 @@ func (dir *Dir) Fsync(ctx context.Context, fh fusefs.FileHandle, flags uint32) s
 	return fusefs.OK
 }
 
-/*
+// Statfs returns file system statistics
 func (dir *Dir) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	if dir.fs.terminated {
+		return dir.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "Dir",
+		"function": "Statfs",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	operID := dir.fs.GetNextOperationID()
+	logger.Infof("Calling Statfs (%d) - %q", operID, dir.path)
+	defer logger.Infof("Called Statfs (%d) - %q", operID, dir.path)
+
+	return IRODSStatfs(ctx, dir.fs, out)
 }
 
+/*
 func (dir *Dir) Link(ctx context.Context, target InodeEmbedder, name string, out *fuse.EntryOut) (node *Inode, errno syscall.Errno) {
 }
 
@@ -0,0 +1,306 @@
+package irodsfs
+
+import (
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+)
+
+const (
+	// estimated memory held by a cached entry, including its path and checksum
+	dirAttrCacheEntrySize int64 = 512
+)
+
+// DirAttrCache retains attributes of entries listed in a dir for a short window
+// this serves stats following a listing, e.g., ls -l, without asking iRODS for each entry
+type DirAttrCache struct {
+	timeout     time.Duration
+	mutex       sync.Mutex
+	dirs        map[string]*dirAttrCacheEntry // key is dir path
+	prefetching map[string]*dirAttrPrefetch   // key is dir path being prefetched
+}
+
+type dirAttrCacheEntry struct {
+	expireTime time.Time
+	entries    map[string]*irodsclient_fs.Entry // key is entry path
+	listing    []*irodsclient_fs.Entry          // entries in the order listed, nil until all entries are added
+	targets    map[string][]byte                // targets of symlinks resolved, key is entry path, nil value if the entry is not a symlink
+}
+
+// dirAttrPrefetch is a listing of a dir in background
+type dirAttrPrefetch struct {
+	doneChan    chan bool
+	invalidated bool // the dir is changed after the listing started, entries listed are dropped
+}
+
+// NewDirAttrCache creates a new DirAttrCache
+func NewDirAttrCache(timeout time.Duration) *DirAttrCache {
+	return &DirAttrCache{
+		timeout:     timeout,
+		mutex:       sync.Mutex{},
+		dirs:        map[string]*dirAttrCacheEntry{},
+		prefetching: map[string]*dirAttrPrefetch{},
+	}
+}
+
+// AddDir caches entries listed in the dir
+func (cache *DirAttrCache) AddDir(dirPath string, entries []*irodsclient_fs.Entry) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if entries == nil {
+		entries = []*irodsclient_fs.Entry{}
+	}
+
+	cachedDir := cache.newDir(dirPath)
+	for _, entry := range entries {
+		cachedDir.entries[entry.Path] = entry
+	}
+	cachedDir.listing = entries
+}
+
+// newDir replaces cached entries of the dir with an empty set, caller must hold the mutex
+func (cache *DirAttrCache) newDir(dirPath string) *dirAttrCacheEntry {
+	now := time.Now()
+
+	// clean up expired dirs
+	for cachedDirPath, cachedDir := range cache.dirs {
+		if now.After(cachedDir.expireTime) {
+			delete(cache.dirs, cachedDirPath)
+		}
+	}
+
+	cachedDir := &dirAttrCacheEntry{
+		expireTime: now.Add(cache.timeout),
+		entries:    map[string]*irodsclient_fs.Entry{},
+		listing:    nil,
+		targets:    map[string][]byte{},
+	}
+
+	cache.dirs[dirPath] = cachedDir
+	return cachedDir
+}
+
+// BeginPrefetch marks the dir as being prefetched, and returns the prefetch to pass to AddPrefetchedDir
+// returns false if the dir is cached already or being prefetched by others
+func (cache *DirAttrCache) BeginPrefetch(dirPath string) (*dirAttrPrefetch, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if _, ok := cache.prefetching[dirPath]; ok {
+		return nil, false
+	}
+
+	if cachedDir, ok := cache.dirs[dirPath]; ok && time.Now().Before(cachedDir.expireTime) {
+		return nil, false
+	}
+
+	prefetch := &dirAttrPrefetch{
+		doneChan:    make(chan bool),
+		invalidated: false,
+	}
+
+	cache.prefetching[dirPath] = prefetch
+	return prefetch, true
+}
+
+// AddPrefetchedDir caches entries prefetched, batchSize entries at a time so stats are not blocked by a large dir
+// entries are dropped if the dir is invalidated after BeginPrefetch, pass nil entries to end prefetching on failure
+func (cache *DirAttrCache) AddPrefetchedDir(dirPath string, prefetch *dirAttrPrefetch, entries []*irodsclient_fs.Entry, batchSize int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	defer close(prefetch.doneChan)
+
+	if cache.prefetching[dirPath] == prefetch {
+		delete(cache.prefetching, dirPath)
+	}
+
+	if entries == nil || prefetch.invalidated {
+		return
+	}
+
+	if batchSize <= 0 {
+		batchSize = len(entries)
+	}
+
+	cachedDir := cache.newDir(dirPath)
+	remaining := entries
+	for len(remaining) > 0 {
+		batchLen := batchSize
+		if batchLen > len(remaining) {
+			batchLen = len(remaining)
+		}
+
+		for _, entry := range remaining[:batchLen] {
+			cachedDir.entries[entry.Path] = entry
+		}
+		remaining = remaining[batchLen:]
+
+		if len(remaining) > 0 {
+			// let stats in
+			cache.mutex.Unlock()
+			cache.mutex.Lock()
+
+			if prefetch.invalidated || cache.dirs[dirPath] != cachedDir {
+				// invalidated or replaced meanwhile
+				return
+			}
+		}
+	}
+
+	cachedDir.listing = entries
+}
+
+// GetDir returns entries listed in the dir in the order listed, waiting for the dir being prefetched
+// returns false if the dir is not cached, or is changed while prefetching
+func (cache *DirAttrCache) GetDir(dirPath string) ([]*irodsclient_fs.Entry, bool) {
+	cache.mutex.Lock()
+	prefetch, ok := cache.prefetching[dirPath]
+	cache.mutex.Unlock()
+
+	if ok {
+		<-prefetch.doneChan
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cachedDir, ok := cache.dirs[dirPath]
+	if !ok || cachedDir.listing == nil {
+		return nil, false
+	}
+
+	if time.Now().After(cachedDir.expireTime) {
+		delete(cache.dirs, dirPath)
+		return nil, false
+	}
+
+	return cachedDir.listing, true
+}
+
+// GetDirEntries returns entries of the dir known, without waiting for the dir being prefetched
+// entries are in the order listed if all entries are added, otherwise in the order of paths
+// returns false if the dir is not cached
+func (cache *DirAttrCache) GetDirEntries(dirPath string) ([]*irodsclient_fs.Entry, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cachedDir, ok := cache.dirs[dirPath]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(cachedDir.expireTime) {
+		delete(cache.dirs, dirPath)
+		return nil, false
+	}
+
+	if cachedDir.listing != nil {
+		return cachedDir.listing, true
+	}
+
+	entries := make([]*irodsclient_fs.Entry, 0, len(cachedDir.entries))
+	for _, entry := range cachedDir.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i int, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, true
+}
+
+// SetSymlinkTarget caches the target of the entry resolved, nil target if the entry is not a symlink
+// the target is cached only while the dir of the entry is cached
+func (cache *DirAttrCache) SetSymlinkTarget(entryPath string, target []byte) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cachedDir, ok := cache.dirs[path.Dir(entryPath)]
+	if !ok || time.Now().After(cachedDir.expireTime) {
+		return
+	}
+
+	if _, ok := cachedDir.entries[entryPath]; !ok {
+		return
+	}
+
+	cachedDir.targets[entryPath] = target
+}
+
+// GetSymlinkTarget returns the target of the symlink cached, nil if the entry is not a symlink
+// returns false if it is not known whether the entry is a symlink
+func (cache *DirAttrCache) GetSymlinkTarget(entryPath string) ([]byte, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cachedDir, ok := cache.dirs[path.Dir(entryPath)]
+	if !ok || time.Now().After(cachedDir.expireTime) {
+		return nil, false
+	}
+
+	target, ok := cachedDir.targets[entryPath]
+	return target, ok
+}
+
+// Get returns an entry cached, returns nil if not cached
+func (cache *DirAttrCache) Get(entryPath string) *irodsclient_fs.Entry {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	dirPath := path.Dir(entryPath)
+	cachedDir, ok := cache.dirs[dirPath]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(cachedDir.expireTime) {
+		delete(cache.dirs, dirPath)
+		return nil
+	}
+
+	return cachedDir.entries[entryPath]
+}
+
+// Invalidate removes cached entries of the dir containing the path, and of the path if it is a dir
+// entries of the dirs being prefetched are dropped, prefetching other dirs is not affected
+func (cache *DirAttrCache) Invalidate(entryPath string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for _, dirPath := range []string{path.Dir(entryPath), entryPath} {
+		delete(cache.dirs, dirPath)
+
+		if prefetch, ok := cache.prefetching[dirPath]; ok {
+			prefetch.invalidated = true
+		}
+	}
+}
+
+// Clear clears all cached entries
+func (cache *DirAttrCache) Clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.dirs = map[string]*dirAttrCacheEntry{}
+
+	for _, prefetch := range cache.prefetching {
+		prefetch.invalidated = true
+	}
+}
+
+// GetMemoryUsage returns the estimated memory held by cached entries
+func (cache *DirAttrCache) GetMemoryUsage() int64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entries := 0
+	for _, cachedDir := range cache.dirs {
+		entries += len(cachedDir.entries)
+	}
+	return int64(entries) * dirAttrCacheEntrySize
+}
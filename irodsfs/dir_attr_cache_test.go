@@ -0,0 +1,134 @@
+package irodsfs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestIRODSReaddirReusesPrefetchedListing(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.DirAttrPrefetch = true
+	fs.dirAttrCache = NewDirAttrCache(time.Minute)
+
+	dirPath := "/testzone/home/testuser/dir"
+	client.addDir(dirPath)
+	client.addFile(dirPath+"/a.txt", []byte("a"))
+	client.addFile(dirPath+"/b.txt", []byte("b"))
+
+	// opendir
+	fs.prefetchDirAttrs(dirPath)
+
+	dirEntries, errno := IRODSReaddir(context.Background(), fs, dirPath)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to list, errno %v", errno)
+	}
+
+	if len(dirEntries) != 2 {
+		t.Errorf("expected 2 entries, got %d", len(dirEntries))
+	}
+
+	if calls := client.getCalls("List"); calls != 1 {
+		t.Errorf("expected the dir listed once, got %d", calls)
+	}
+}
+
+func TestDirAttrCacheInvalidatesPrefetchPerDir(t *testing.T) {
+	cache := NewDirAttrCache(time.Minute)
+
+	dirA := "/zone/home/user/a"
+	dirB := "/zone/home/user/b"
+
+	prefetchA, ok := cache.BeginPrefetch(dirA)
+	if !ok {
+		t.Fatalf("failed to begin prefetching %q", dirA)
+	}
+
+	prefetchB, ok := cache.BeginPrefetch(dirB)
+	if !ok {
+		t.Fatalf("failed to begin prefetching %q", dirB)
+	}
+
+	// a file in dir a is removed while listing
+	cache.Invalidate(dirA + "/file.txt")
+
+	cache.AddPrefetchedDir(dirA, prefetchA, []*irodsclient_fs.Entry{{Path: dirA + "/file.txt"}}, 0)
+	cache.AddPrefetchedDir(dirB, prefetchB, []*irodsclient_fs.Entry{{Path: dirB + "/file.txt"}}, 0)
+
+	if cache.Get(dirA+"/file.txt") != nil {
+		t.Errorf("expected entries of %q listed before invalidation dropped", dirA)
+	}
+
+	if cache.Get(dirB+"/file.txt") == nil {
+		t.Errorf("expected entries of %q kept", dirB)
+	}
+}
+
+func TestDirAttrCacheGetDirWaitsForPrefetch(t *testing.T) {
+	cache := NewDirAttrCache(time.Minute)
+
+	dirPath := "/zone/home/user/dir"
+	prefetch, ok := cache.BeginPrefetch(dirPath)
+	if !ok {
+		t.Fatalf("failed to begin prefetching %q", dirPath)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cache.AddPrefetchedDir(dirPath, prefetch, []*irodsclient_fs.Entry{{Path: dirPath + "/a.txt"}, {Path: dirPath + "/b.txt"}}, 1)
+	}()
+
+	entries, ok := cache.GetDir(dirPath)
+	if !ok || len(entries) != 2 {
+		t.Fatalf("expected 2 entries prefetched, got %d", len(entries))
+	}
+
+	if entries[0].Path != dirPath+"/a.txt" || entries[1].Path != dirPath+"/b.txt" {
+		t.Errorf("expected entries in the order listed")
+	}
+}
+
+// BenchmarkListLong lists a dir and stats every entry listed, as ls -l does
+// with the dir attr cache, repeated listings within the window do not stat entries on iRODS
+func BenchmarkListLong(b *testing.B) {
+	for _, dirAttrCacheTimeout := range []time.Duration{0, time.Minute} {
+		b.Run(fmt.Sprintf("dir_attr_cache_timeout=%s", dirAttrCacheTimeout), func(b *testing.B) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+			if dirAttrCacheTimeout > 0 {
+				fs.dirAttrCache = NewDirAttrCache(dirAttrCacheTimeout)
+			}
+
+			dirPath := "/testzone/home/testuser/dir"
+			client.addDir(dirPath)
+			for i := 0; i < 100; i++ {
+				client.addFile(fmt.Sprintf("%s/file%03d.txt", dirPath, i), []byte("data"))
+			}
+
+			b.ResetTimer()
+			statCalls := client.getCalls("Stat")
+			for i := 0; i < b.N; i++ {
+				dirEntries, errno := IRODSReaddir(context.Background(), fs, dirPath)
+				if errno != fusefs.OK {
+					b.Fatalf("failed to list, errno %v", errno)
+				}
+
+				for _, dirEntry := range dirEntries {
+					out := fuse.AttrOut{}
+					if errno := IRODSGetattr(context.Background(), fs, dirPath+"/"+dirEntry.Name, false, &out); errno != fusefs.OK {
+						b.Fatalf("failed to stat %q, errno %v", dirEntry.Name, errno)
+					}
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(client.getCalls("Stat")-statCalls)/float64(b.N), "stats/op")
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package irodsfs
+
+import (
+	irodsclient_conn "github.com/cyverse/go-irodsclient/irods/connection"
+	irodsclient_irodsfs "github.com/cyverse/go-irodsclient/irods/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
+	"golang.org/x/xerrors"
+)
+
+// directFSClient implements optional fs client interfaces, e.g., ReplicaLister and ACLChanger, for the direct fs client
+// through go-irodsclient, as IRODSFSClientDirect of irodsfs-common does not
+// irodsfs-pool clients do not implement them, so features requiring them are rejected with pool_endpoint
+type directFSClient struct {
+	*irodsfs_common_irods.IRODSFSClientDirect
+}
+
+// extendFSClient returns the fs client to check optional interfaces against, the direct fs client is wrapped by directFSClient
+func extendFSClient(fsClient irodsfs_common_irods.IRODSFSClient) irodsfs_common_irods.IRODSFSClient {
+	if client, ok := fsClient.(*irodsfs_common_irods.IRODSFSClientDirect); ok {
+		return &directFSClient{
+			IRODSFSClientDirect: client,
+		}
+	}
+
+	return fsClient
+}
+
+// withMetadataConnection runs the function with a metadata connection of go-irodsclient
+func (client *directFSClient) withMetadataConnection(fn func(conn *irodsclient_conn.IRODSConnection) error) error {
+	irodsFS := client.GetFSClient()
+	if irodsFS == nil {
+		return xerrors.Errorf("FSClient is nil")
+	}
+
+	conn, err := irodsFS.GetMetadataConnection()
+	if err != nil {
+		return err
+	}
+	defer irodsFS.ReturnMetadataConnection(conn)
+
+	return fn(conn)
+}
+
+// ListReplicas returns replicas of the data object, read from the catalog
+func (client *directFSClient) ListReplicas(path string) ([]*irodsclient_types.IRODSReplica, error) {
+	var replicas []*irodsclient_types.IRODSReplica
+	err := client.withMetadataConnection(func(conn *irodsclient_conn.IRODSConnection) error {
+		collection, err := irodsclient_irodsfs.GetCollection(conn, irodsfs_common_utils.GetDirname(path))
+		if err != nil {
+			return err
+		}
+
+		dataObject, err := irodsclient_irodsfs.GetDataObject(conn, collection, irodsfs_common_utils.GetFileName(path))
+		if err != nil {
+			return err
+		}
+
+		replicas = dataObject.Replicas
+		return nil
+	})
+	return replicas, err
+}
+
+// ReplicateFile replicates the data object to the resource
+func (client *directFSClient) ReplicateFile(path string, resource string) error {
+	irodsFS := client.GetFSClient()
+	if irodsFS == nil {
+		return xerrors.Errorf("FSClient is nil")
+	}
+
+	return irodsFS.ReplicateFile(path, resource, false)
+}
+
+// CopyFile copies the data object on the server, overwriting the dest
+func (client *directFSClient) CopyFile(srcPath string, destPath string) error {
+	irodsFS := client.GetFSClient()
+	if irodsFS == nil {
+		return xerrors.Errorf("FSClient is nil")
+	}
+
+	return irodsFS.CopyFile(srcPath, destPath, true)
+}
+
+// SetXattrWithUnits sets an AVU with units, replacing AVUs of the name
+func (client *directFSClient) SetXattrWithUnits(path string, name string, value string, units string) error {
+	irodsFS := client.GetFSClient()
+	if irodsFS == nil {
+		return xerrors.Errorf("FSClient is nil")
+	}
+
+	// remove first if exists, ignore error if raised
+	irodsFS.DeleteMetadata(path, name, "", "")
+	return irodsFS.AddMetadata(path, name, value, units)
+}
+
+// ComputeChecksum computes checksum of the data object on the server
+func (client *directFSClient) ComputeChecksum(path string) error {
+	irodsFS := client.GetFSClient()
+	if irodsFS == nil {
+		return xerrors.Errorf("FSClient is nil")
+	}
+
+	_, err := irodsFS.ComputeChecksum(path, "")
+	return err
+}
+
+// ListDataTypes returns data types registered in the zone
+func (client *directFSClient) ListDataTypes() ([]string, error) {
+	var dataTypes []string
+	err := client.withMetadataConnection(func(conn *irodsclient_conn.IRODSConnection) error {
+		var listErr error
+		dataTypes, listErr = irodsclient_irodsfs.ListDataTypes(conn)
+		return listErr
+	})
+	return dataTypes, err
+}
+
+// SetDataType sets the data type of the data object
+func (client *directFSClient) SetDataType(path string, dataType string) error {
+	return client.withMetadataConnection(func(conn *irodsclient_conn.IRODSConnection) error {
+		return irodsclient_irodsfs.ModifyDataObjectDataType(conn, path, dataType)
+	})
+}
+
+// ChangeACL sets access of the user or group to the path, null access removes it
+func (client *directFSClient) ChangeACL(path string, access irodsclient_types.IRODSAccessLevelType, user string, zone string) error {
+	irodsFS := client.GetFSClient()
+	if irodsFS == nil {
+		return xerrors.Errorf("FSClient is nil")
+	}
+
+	return irodsFS.ChangeACLs(path, access, user, zone, false, false)
+}
+
+// ExecuteRule executes the rule, returns its output
+func (client *directFSClient) ExecuteRule(rule string) (string, error) {
+	var output string
+	err := client.withMetadataConnection(func(conn *irodsclient_conn.IRODSConnection) error {
+		var execErr error
+		output, execErr = irodsclient_irodsfs.ExecuteRule(conn, rule)
+		return execErr
+	})
+	return output, err
+}
+
+// CreateBundle bundles data objects of the collection into a tar data object at the bundle path
+func (client *directFSClient) CreateBundle(bundlePath string, collPath string) error {
+	return client.withMetadataConnection(func(conn *irodsclient_conn.IRODSConnection) error {
+		return irodsclient_irodsfs.CreateStructFileBundle(conn, bundlePath, collPath)
+	})
+}
@@ -0,0 +1,77 @@
+package irodsfs
+
+import (
+	"testing"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	"golang.org/x/xerrors"
+)
+
+func TestDirectFSClientExtensions(t *testing.T) {
+	// the zero value has no go-irodsclient fs client, so calls fail after being routed to go-irodsclient
+	directClient := &irodsfs_common_irods.IRODSFSClientDirect{}
+	poolClient := &unitlessFSClient{IRODSFSClient: newFakeFSClient()}
+
+	testCases := []struct {
+		name        string
+		call        func(fsClient irodsfs_common_irods.IRODSFSClient) error
+		unsupported error
+	}{
+		{"listReplicas", func(fsClient irodsfs_common_irods.IRODSFSClient) error {
+			_, err := listReplicas(fsClient, "/testzone/home/testuser/file")
+			return err
+		}, errReplicasNotSupported},
+		{"replicateFile", func(fsClient irodsfs_common_irods.IRODSFSClient) error {
+			return replicateFile(fsClient, "/testzone/home/testuser/file", "resc2")
+		}, errReplicationNotSupported},
+		{"copyFile", func(fsClient irodsfs_common_irods.IRODSFSClient) error {
+			return copyFile(fsClient, "/testzone/home/testuser/file", "/testzone/home/testuser/copy")
+		}, errCopyNotSupported},
+		{"setXattrWithUnits", func(fsClient irodsfs_common_irods.IRODSFSClient) error {
+			return setXattrWithUnits(fsClient, "/testzone/home/testuser/file", "user.foo", "bar", "kg")
+		}, errXattrUnitsNotSupported},
+		{"computeChecksum", func(fsClient irodsfs_common_irods.IRODSFSClient) error {
+			return computeChecksum(fsClient, "/testzone/home/testuser/file")
+		}, errChecksumNotSupported},
+		{"setDataType", func(fsClient irodsfs_common_irods.IRODSFSClient) error {
+			return setDataType(fsClient, "/testzone/home/testuser/file", "generic")
+		}, errDataTypeNotSupported},
+		{"changeACL", func(fsClient irodsfs_common_irods.IRODSFSClient) error {
+			return changeACL(fsClient, "/testzone/home/testuser/file", irodsclient_types.IRODSAccessLevelReadObject, "other", testZone)
+		}, errACLChangeNotSupported},
+		{"executeRule", func(fsClient irodsfs_common_irods.IRODSFSClient) error {
+			_, err := executeRule(fsClient, "writeLine(\"stdout\", \"hello\")")
+			return err
+		}, errRuleExecutionNotSupported},
+		{"createBundle", func(fsClient irodsfs_common_irods.IRODSFSClient) error {
+			return createBundle(fsClient, "/testzone/staging/bundle.tar", "/testzone/home/testuser")
+		}, errBundleNotSupported},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := testCase.call(directClient)
+			if err == nil {
+				t.Fatalf("expected an error without go-irodsclient fs client")
+			}
+
+			if xerrors.Is(err, testCase.unsupported) {
+				t.Errorf("expected the direct fs client supported, got %v", err)
+			}
+
+			err = testCase.call(poolClient)
+			if !xerrors.Is(err, testCase.unsupported) {
+				t.Errorf("expected %v with a client without extensions, got %v", testCase.unsupported, err)
+			}
+		})
+	}
+
+	if !isReplicationSupported(directClient) || !isCopySupported(directClient) {
+		t.Errorf("expected the direct fs client to replicate and copy")
+	}
+
+	if isReplicationSupported(poolClient) || isCopySupported(poolClient) {
+		t.Errorf("expected a client without extensions not to replicate nor copy")
+	}
+}
@@ -17,7 +17,10 @@ func DummyDirGetattr(ctx context.Context, fs *IRODSFS, path string, vpathReadonl
 		"function": "DummyDirGetattr",
 	})
 
-	entry, err := fs.fsClient.Stat(path)
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	entry, err := fsClient.Stat(path)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", path)
@@ -28,7 +31,6 @@ func DummyDirGetattr(ctx context.Context, fs *IRODSFS, path string, vpathReadonl
 		return syscall.EREMOTEIO
 	}
 
-	mode := IRODSGetACL(ctx, fs, entry, vpathReadonly)
-	setAttrOutForIRODSEntry(fs.inodeManager, entry, fs.uid, fs.gid, mode, &out.Attr)
+	irodsSetAttrOut(ctx, fs, entry, entry, vpathReadonly, &out.Attr)
 	return fusefs.OK
 }
@@ -0,0 +1,893 @@
+package irodsfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_inode "github.com/cyverse/irodsfs-common/inode"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
+
+	"github.com/cyverse/irodsfs/commons"
+)
+
+const (
+	testZone = "testzone"
+	testUser = "testuser"
+)
+
+// fakeFSClient is an in-memory iRODS fs client for tests
+// methods not implemented here panic through the nil embedded interface
+type fakeFSClient struct {
+	irodsfs_common_irods.IRODSFSClient
+
+	mutex     sync.Mutex
+	nextID    int64
+	entries   map[string]*irodsclient_fs.Entry
+	data      map[string][]byte
+	metadata  map[string][]*irodsclient_types.IRODSMeta
+	acls      map[string][]*irodsclient_types.IRODSAccess
+	replicas  map[string][]*irodsclient_types.IRODSReplica
+	calls     map[string]int
+	failNext  map[string]error // error returned by the next call of the method
+	statDelay time.Duration
+	listDelay time.Duration
+	released  bool
+
+	dataGate    chan struct{} // data reads and writes of file handles wait for it to close, if set
+	dataWaiting int64         // data reads and writes waiting for the gate
+}
+
+func newFakeFSClient() *fakeFSClient {
+	client := &fakeFSClient{
+		nextID:   1,
+		entries:  map[string]*irodsclient_fs.Entry{},
+		data:     map[string][]byte{},
+		metadata: map[string][]*irodsclient_types.IRODSMeta{},
+		acls:     map[string][]*irodsclient_types.IRODSAccess{},
+		replicas: map[string][]*irodsclient_types.IRODSReplica{},
+		calls:    map[string]int{},
+		failNext: map[string]error{},
+	}
+
+	client.addDir("/")
+	client.addDir("/" + testZone)
+	client.addDir("/" + testZone + "/home")
+	client.addDir("/" + testZone + "/home/" + testUser)
+	return client
+}
+
+// call counts a call of the method, and returns the error set to fail it
+func (client *fakeFSClient) call(method string) error {
+	client.calls[method]++
+	if client.released {
+		// the connections are closed
+		return irodsclient_types.NewConnectionError()
+	}
+
+	if err, ok := client.failNext[method]; ok {
+		delete(client.failNext, method)
+		return err
+	}
+	return nil
+}
+
+func (client *fakeFSClient) getCalls(method string) int {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.calls[method]
+}
+
+// waitDataGate blocks a data read or write until the gate set is closed
+func (client *fakeFSClient) waitDataGate() {
+	client.mutex.Lock()
+	gate := client.dataGate
+	client.mutex.Unlock()
+
+	if gate == nil {
+		return
+	}
+
+	atomic.AddInt64(&client.dataWaiting, 1)
+	<-gate
+}
+
+func (client *fakeFSClient) setFailNext(method string, err error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.failNext[method] = err
+}
+
+func (client *fakeFSClient) addDir(dirPath string) *irodsclient_fs.Entry {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.addEntry(dirPath, irodsclient_fs.DirectoryEntry)
+}
+
+func (client *fakeFSClient) addFile(filePath string, data []byte) *irodsclient_fs.Entry {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	entry := client.addEntry(filePath, irodsclient_fs.FileEntry)
+	client.data[filePath] = append([]byte{}, data...)
+	entry.Size = int64(len(data))
+	return entry
+}
+
+// addEntry adds an entry, caller must hold mutex
+func (client *fakeFSClient) addEntry(entryPath string, entryType irodsclient_fs.EntryType) *irodsclient_fs.Entry {
+	now := time.Now()
+	entry := &irodsclient_fs.Entry{
+		ID:         client.nextID,
+		Type:       entryType,
+		Name:       path.Base(entryPath),
+		Path:       entryPath,
+		Owner:      testUser,
+		CreateTime: now,
+		ModifyTime: now,
+	}
+	client.nextID++
+	client.entries[entryPath] = entry
+	return entry
+}
+
+func (client *fakeFSClient) getData(filePath string) []byte {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return append([]byte{}, client.data[filePath]...)
+}
+
+func (client *fakeFSClient) GetAccount() *irodsclient_types.IRODSAccount {
+	return &irodsclient_types.IRODSAccount{
+		ClientUser: testUser,
+		ClientZone: testZone,
+		ProxyUser:  testUser,
+		ProxyZone:  testZone,
+	}
+}
+
+func (client *fakeFSClient) Stat(entryPath string) (*irodsclient_fs.Entry, error) {
+	if client.statDelay > 0 {
+		time.Sleep(client.statDelay)
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("Stat"); err != nil {
+		return nil, err
+	}
+
+	entry, ok := client.entries[entryPath]
+	if !ok {
+		return nil, irodsclient_types.NewFileNotFoundError(entryPath)
+	}
+
+	entryCopy := *entry
+	return &entryCopy, nil
+}
+
+func (client *fakeFSClient) List(dirPath string) ([]*irodsclient_fs.Entry, error) {
+	if client.listDelay > 0 {
+		time.Sleep(client.listDelay)
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("List"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := client.entries[dirPath]; !ok {
+		return nil, irodsclient_types.NewFileNotFoundError(dirPath)
+	}
+
+	entries := []*irodsclient_fs.Entry{}
+	for entryPath, entry := range client.entries {
+		if entryPath != dirPath && path.Dir(entryPath) == dirPath {
+			entryCopy := *entry
+			entries = append(entries, &entryCopy)
+		}
+	}
+
+	sort.Slice(entries, func(i int, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+func (client *fakeFSClient) ExistsFile(filePath string) bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.call("ExistsFile")
+
+	entry, ok := client.entries[filePath]
+	return ok && !entry.IsDir()
+}
+
+func (client *fakeFSClient) ExistsDir(dirPath string) bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.call("ExistsDir")
+
+	entry, ok := client.entries[dirPath]
+	return ok && entry.IsDir()
+}
+
+func (client *fakeFSClient) ListXattr(entryPath string) ([]*irodsclient_types.IRODSMeta, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("ListXattr"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := client.entries[entryPath]; !ok {
+		return nil, irodsclient_types.NewFileNotFoundError(entryPath)
+	}
+
+	metas := []*irodsclient_types.IRODSMeta{}
+	for _, meta := range client.metadata[entryPath] {
+		metaCopy := *meta
+		metas = append(metas, &metaCopy)
+	}
+	return metas, nil
+}
+
+func (client *fakeFSClient) GetXattr(entryPath string, name string) (*irodsclient_types.IRODSMeta, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("GetXattr"); err != nil {
+		return nil, err
+	}
+
+	if _, ok := client.entries[entryPath]; !ok {
+		return nil, irodsclient_types.NewFileNotFoundError(entryPath)
+	}
+
+	for _, meta := range client.metadata[entryPath] {
+		if meta.Name == name {
+			metaCopy := *meta
+			return &metaCopy, nil
+		}
+	}
+	return nil, nil
+}
+
+func (client *fakeFSClient) SetXattr(entryPath string, name string, value string) error {
+	return client.SetXattrWithUnits(entryPath, name, value, "")
+}
+
+// SetXattrWithUnits sets an AVU, replacing AVUs of the name
+func (client *fakeFSClient) SetXattrWithUnits(entryPath string, name string, value string, units string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("SetXattr"); err != nil {
+		return err
+	}
+
+	if _, ok := client.entries[entryPath]; !ok {
+		return irodsclient_types.NewFileNotFoundError(entryPath)
+	}
+
+	metas := []*irodsclient_types.IRODSMeta{}
+	for _, meta := range client.metadata[entryPath] {
+		if meta.Name != name {
+			metas = append(metas, meta)
+		}
+	}
+
+	client.nextID++
+	metas = append(metas, &irodsclient_types.IRODSMeta{
+		AVUID: client.nextID,
+		Name:  name,
+		Value: value,
+		Units: units,
+	})
+	client.metadata[entryPath] = metas
+	return nil
+}
+
+func (client *fakeFSClient) RemoveXattr(entryPath string, name string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("RemoveXattr"); err != nil {
+		return err
+	}
+
+	metas := []*irodsclient_types.IRODSMeta{}
+	for _, meta := range client.metadata[entryPath] {
+		if meta.Name != name {
+			metas = append(metas, meta)
+		}
+	}
+	client.metadata[entryPath] = metas
+	return nil
+}
+
+func (client *fakeFSClient) ListUserGroups(user string) ([]*irodsclient_types.IRODSUser, error) {
+	return []*irodsclient_types.IRODSUser{}, nil
+}
+
+func (client *fakeFSClient) ListDirACLs(dirPath string) ([]*irodsclient_types.IRODSAccess, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.call("ListDirACLs")
+	return append([]*irodsclient_types.IRODSAccess{}, client.acls[dirPath]...), nil
+}
+
+func (client *fakeFSClient) ListFileACLs(filePath string) ([]*irodsclient_types.IRODSAccess, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.call("ListFileACLs")
+	return append([]*irodsclient_types.IRODSAccess{}, client.acls[filePath]...), nil
+}
+
+// setACLs sets the access list of the entry
+func (client *fakeFSClient) setACLs(entryPath string, accesses []*irodsclient_types.IRODSAccess) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.acls[entryPath] = accesses
+}
+
+// ChangeACL sets access of the user or group, null access removes it
+func (client *fakeFSClient) ChangeACL(entryPath string, access irodsclient_types.IRODSAccessLevelType, user string, zone string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("ChangeACL"); err != nil {
+		return err
+	}
+
+	entry, ok := client.entries[entryPath]
+	if !ok {
+		return irodsclient_types.NewFileNotFoundError(entryPath)
+	}
+
+	userType := irodsclient_types.IRODSUserRodsUser
+	accesses := []*irodsclient_types.IRODSAccess{}
+	for _, existing := range client.acls[entryPath] {
+		if existing.UserName == user && existing.UserZone == zone {
+			userType = existing.UserType
+			continue
+		}
+		accesses = append(accesses, existing)
+	}
+
+	if user == irodsPublicGroupName {
+		userType = irodsclient_types.IRODSUserRodsGroup
+	}
+
+	if access != irodsclient_types.IRODSAccessLevelNull {
+		accesses = append(accesses, &irodsclient_types.IRODSAccess{
+			Path:        entry.Path,
+			UserName:    user,
+			UserZone:    zone,
+			UserType:    userType,
+			AccessLevel: access,
+		})
+	}
+
+	client.acls[entryPath] = accesses
+	return nil
+}
+
+// ComputeChecksum registers sha256 checksum of the file data
+func (client *fakeFSClient) ComputeChecksum(filePath string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("ComputeChecksum"); err != nil {
+		return err
+	}
+
+	entry, ok := client.entries[filePath]
+	if !ok || entry.IsDir() {
+		return irodsclient_types.NewFileNotFoundError(filePath)
+	}
+
+	checksum := sha256.Sum256(client.data[filePath])
+	entry.CheckSumAlgorithm = irodsclient_types.ChecksumAlgorithmSHA256
+	entry.CheckSum = checksum[:]
+	return nil
+}
+
+// ListDataTypes returns data types registered in the zone
+func (client *fakeFSClient) ListDataTypes() ([]string, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("ListDataTypes"); err != nil {
+		return nil, err
+	}
+
+	return []string{"generic", "tar file", "text"}, nil
+}
+
+// SetDataType sets the data type of the file
+func (client *fakeFSClient) SetDataType(filePath string, dataType string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("SetDataType"); err != nil {
+		return err
+	}
+
+	entry, ok := client.entries[filePath]
+	if !ok || entry.IsDir() {
+		return irodsclient_types.NewFileNotFoundError(filePath)
+	}
+
+	entry.DataType = dataType
+	return nil
+}
+
+// ListReplicas returns replicas of the file set by setReplicas
+func (client *fakeFSClient) ListReplicas(filePath string) ([]*irodsclient_types.IRODSReplica, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("ListReplicas"); err != nil {
+		return nil, err
+	}
+
+	entry, ok := client.entries[filePath]
+	if !ok || entry.IsDir() {
+		return nil, irodsclient_types.NewFileNotFoundError(filePath)
+	}
+
+	return append([]*irodsclient_types.IRODSReplica{}, client.replicas[filePath]...), nil
+}
+
+// ReplicateFile adds a good replica of the file on the resource
+func (client *fakeFSClient) ReplicateFile(filePath string, resource string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("ReplicateFile"); err != nil {
+		return err
+	}
+
+	entry, ok := client.entries[filePath]
+	if !ok || entry.IsDir() {
+		return irodsclient_types.NewFileNotFoundError(filePath)
+	}
+
+	client.replicas[filePath] = append(client.replicas[filePath], &irodsclient_types.IRODSReplica{
+		Number:       int64(len(client.replicas[filePath])),
+		ResourceName: resource,
+		Status:       "1",
+	})
+	return nil
+}
+
+// CopyFile copies data of the file to the dest, overwriting the dest
+func (client *fakeFSClient) CopyFile(srcPath string, destPath string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("CopyFile"); err != nil {
+		return err
+	}
+
+	srcEntry, ok := client.entries[srcPath]
+	if !ok || srcEntry.IsDir() {
+		return irodsclient_types.NewFileNotFoundError(srcPath)
+	}
+
+	destEntry, ok := client.entries[destPath]
+	if !ok {
+		destEntry = client.addEntry(destPath, irodsclient_fs.FileEntry)
+	}
+
+	client.data[destPath] = append([]byte{}, client.data[srcPath]...)
+	destEntry.Size = srcEntry.Size
+	destEntry.ModifyTime = time.Now()
+	return nil
+}
+
+// setReplicas sets replicas of the file
+func (client *fakeFSClient) setReplicas(filePath string, replicas []*irodsclient_types.IRODSReplica) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.replicas[filePath] = replicas
+}
+
+// CreateBundle bundles files in the collection into a tar data object, with names relative to the collection
+func (client *fakeFSClient) CreateBundle(bundlePath string, collPath string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("CreateBundle"); err != nil {
+		return err
+	}
+
+	if _, ok := client.entries[collPath]; !ok {
+		return irodsclient_types.NewFileNotFoundError(collPath)
+	}
+
+	filePaths := []string{}
+	for entryPath, entry := range client.entries {
+		if path.Dir(entryPath) == collPath && !entry.IsDir() {
+			filePaths = append(filePaths, entryPath)
+		}
+	}
+	sort.Strings(filePaths)
+
+	buffer := bytes.Buffer{}
+	tarWriter := tar.NewWriter(&buffer)
+	for _, filePath := range filePaths {
+		data := client.data[filePath]
+		err := tarWriter.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Base(filePath),
+			Mode:     0o644,
+			Size:     int64(len(data)),
+		})
+		if err != nil {
+			return err
+		}
+
+		if _, err := tarWriter.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+
+	entry := client.addEntry(bundlePath, irodsclient_fs.FileEntry)
+	client.data[bundlePath] = buffer.Bytes()
+	entry.Size = int64(buffer.Len())
+	return nil
+}
+
+// ExecuteRule returns the rule body given as its output, as a rule printing its body
+func (client *fakeFSClient) ExecuteRule(rule string) (string, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("ExecuteRule"); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("executed %s", rule), nil
+}
+
+func (client *fakeFSClient) CreateFile(filePath string, resource string, mode string) (irodsfs_common_irods.IRODSFSFileHandle, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("CreateFile"); err != nil {
+		return nil, err
+	}
+
+	entry := client.addEntry(filePath, irodsclient_fs.FileEntry)
+	client.data[filePath] = []byte{}
+	return newFakeFileHandle(client, entry, irodsclient_types.FileOpenMode(mode)), nil
+}
+
+func (client *fakeFSClient) OpenFile(filePath string, resource string, mode string) (irodsfs_common_irods.IRODSFSFileHandle, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("OpenFile"); err != nil {
+		return nil, err
+	}
+
+	entry, ok := client.entries[filePath]
+	if !ok {
+		return nil, irodsclient_types.NewFileNotFoundError(filePath)
+	}
+
+	if irodsclient_types.FileOpenMode(mode).GetFlag()&int(irodsclient_types.O_TRUNC) != 0 {
+		client.data[filePath] = []byte{}
+		entry.Size = 0
+	}
+
+	entryCopy := *entry
+	return newFakeFileHandle(client, &entryCopy, irodsclient_types.FileOpenMode(mode)), nil
+}
+
+func (client *fakeFSClient) TruncateFile(filePath string, size int64) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("TruncateFile"); err != nil {
+		return err
+	}
+
+	return client.truncate(filePath, size)
+}
+
+// truncate resizes file data, caller must hold mutex
+func (client *fakeFSClient) truncate(filePath string, size int64) error {
+	entry, ok := client.entries[filePath]
+	if !ok {
+		return irodsclient_types.NewFileNotFoundError(filePath)
+	}
+
+	data := client.data[filePath]
+	if int64(len(data)) > size {
+		data = data[:size]
+	} else {
+		data = append(data, make([]byte, size-int64(len(data)))...)
+	}
+
+	client.data[filePath] = data
+	entry.Size = size
+	return nil
+}
+
+func (client *fakeFSClient) RemoveFile(filePath string, force bool) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("RemoveFile"); err != nil {
+		return err
+	}
+
+	if _, ok := client.entries[filePath]; !ok {
+		return irodsclient_types.NewFileNotFoundError(filePath)
+	}
+
+	delete(client.entries, filePath)
+	delete(client.data, filePath)
+	delete(client.metadata, filePath)
+	return nil
+}
+
+func (client *fakeFSClient) MakeDir(dirPath string, recurse bool) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if err := client.call("MakeDir"); err != nil {
+		return err
+	}
+
+	client.addEntry(dirPath, irodsclient_fs.DirectoryEntry)
+	return nil
+}
+
+func (client *fakeFSClient) AddCacheEventHandler(handler irodsclient_fs.FilesystemCacheEventHandler) (string, error) {
+	return "handler", nil
+}
+
+func (client *fakeFSClient) RemoveCacheEventHandler(handlerID string) error {
+	return nil
+}
+
+func (client *fakeFSClient) Release() {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.released = true
+}
+
+func (client *fakeFSClient) isReleased() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.released
+}
+
+// fakeFileHandle is an iRODS file handle of fakeFSClient
+type fakeFileHandle struct {
+	irodsfs_common_irods.IRODSFSFileHandle
+
+	client   *fakeFSClient
+	id       string
+	entry    *irodsclient_fs.Entry
+	openMode irodsclient_types.FileOpenMode
+	closed   int
+}
+
+func newFakeFileHandle(client *fakeFSClient, entry *irodsclient_fs.Entry, openMode irodsclient_types.FileOpenMode) *fakeFileHandle {
+	client.nextID++
+	return &fakeFileHandle{
+		client:   client,
+		id:       fmt.Sprintf("handle-%d", client.nextID),
+		entry:    entry,
+		openMode: openMode,
+	}
+}
+
+func (handle *fakeFileHandle) GetID() string                               { return handle.id }
+func (handle *fakeFileHandle) GetEntry() *irodsclient_fs.Entry             { return handle.entry }
+func (handle *fakeFileHandle) GetOpenMode() irodsclient_types.FileOpenMode { return handle.openMode }
+func (handle *fakeFileHandle) IsReadMode() bool                            { return handle.openMode.IsRead() }
+func (handle *fakeFileHandle) IsWriteMode() bool                           { return handle.openMode.IsWrite() }
+func (handle *fakeFileHandle) Flush() error                                { return nil }
+func (handle *fakeFileHandle) Lock(wait bool) error                        { return nil }
+func (handle *fakeFileHandle) RLock(wait bool) error                       { return nil }
+func (handle *fakeFileHandle) Unlock() error                               { return nil }
+func (handle *fakeFileHandle) GetOffset() int64                            { return 0 }
+func (handle *fakeFileHandle) isClosed() bool                              { return handle.closed > 0 }
+func (handle *fakeFileHandle) closeCount() int                             { return handle.closed }
+func (handle *fakeFileHandle) Truncate(size int64) error {
+	return handle.client.TruncateFile(handle.entry.Path, size)
+}
+func (handle *fakeFileHandle) Close() error { handle.closed++; return nil }
+
+func (handle *fakeFileHandle) ReadAt(buffer []byte, offset int64) (int, error) {
+	handle.client.waitDataGate()
+
+	handle.client.mutex.Lock()
+	defer handle.client.mutex.Unlock()
+
+	if err := handle.client.call("ReadAt"); err != nil {
+		return 0, err
+	}
+
+	data := handle.client.data[handle.entry.Path]
+	if offset >= int64(len(data)) {
+		return 0, io.EOF
+	}
+
+	readLen := copy(buffer, data[offset:])
+	if readLen < len(buffer) {
+		return readLen, io.EOF
+	}
+	return readLen, nil
+}
+
+func (handle *fakeFileHandle) WriteAt(data []byte, offset int64) (int, error) {
+	handle.client.waitDataGate()
+
+	handle.client.mutex.Lock()
+	defer handle.client.mutex.Unlock()
+
+	if err := handle.client.call("WriteAt"); err != nil {
+		return 0, err
+	}
+
+	fileData := handle.client.data[handle.entry.Path]
+	if end := offset + int64(len(data)); end > int64(len(fileData)) {
+		fileData = append(fileData, make([]byte, end-int64(len(fileData)))...)
+	}
+
+	copy(fileData[offset:], data)
+	handle.client.data[handle.entry.Path] = fileData
+	handle.client.entries[handle.entry.Path].Size = int64(len(fileData))
+	return len(data), nil
+}
+
+// fakeHandleClient returns the fake client that opened the handle, or nil
+func fakeHandleClient(handle irodsfs_common_irods.IRODSFSFileHandle) irodsfs_common_irods.IRODSFSClient {
+	if fakeHandle, ok := handle.(*fakeFileHandle); ok {
+		return fakeHandle.client
+	}
+	return nil
+}
+
+// fakeWriter writes through to the iRODS file handle, without buffering
+type fakeWriter struct {
+	handle irodsfs_common_irods.IRODSFSFileHandle
+}
+
+func (writer *fakeWriter) WriteAt(data []byte, offset int64) (int, error) {
+	return writer.handle.WriteAt(data, offset)
+}
+func (writer *fakeWriter) GetFSClient() irodsfs_common_irods.IRODSFSClient {
+	return fakeHandleClient(writer.handle)
+}
+func (writer *fakeWriter) Flush() error    { return nil }
+func (writer *fakeWriter) GetPath() string { return writer.handle.GetEntry().Path }
+func (writer *fakeWriter) GetError() error { return nil }
+func (writer *fakeWriter) Release()        {}
+
+// fakeReader reads through the iRODS file handle, without prefetching
+type fakeReader struct {
+	handle   irodsfs_common_irods.IRODSFSFileHandle
+	released int32
+}
+
+func (reader *fakeReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	return reader.handle.ReadAt(buffer, offset)
+}
+func (reader *fakeReader) GetFSClient() irodsfs_common_irods.IRODSFSClient {
+	return fakeHandleClient(reader.handle)
+}
+func (reader *fakeReader) GetChecksum() string {
+	return hex.EncodeToString(reader.handle.GetEntry().CheckSum)
+}
+func (reader *fakeReader) GetSize() int64                  { return reader.handle.GetEntry().Size }
+func (reader *fakeReader) GetAvailable(offset int64) int64 { return -1 }
+func (reader *fakeReader) GetPath() string                 { return reader.handle.GetEntry().Path }
+func (reader *fakeReader) GetError() error                 { return nil }
+func (reader *fakeReader) Release()                        { reader.released++ }
+
+// newTestFS creates a file system on the fake client, not mounted
+func newTestFS(client *fakeFSClient) *IRODSFS {
+	config := commons.NewDefaultConfig()
+	config.Zone = testZone
+	config.ClientUser = testUser
+	config.ProxyUser = testUser
+	config.OperationTimeout = 0
+	config.TransientErrorRetry = 0
+
+	inodeManager := irodsfs_common_inode.NewInodeManager()
+
+	// the home collection is mounted
+	vpathManager, err := irodsfs_common_vpath.NewVPathManager(client, inodeManager, []irodsfs_common_vpath.VPathMapping{
+		{
+			IRODSPath:    "/" + testZone + "/home/" + testUser,
+			MappingPath:  "/",
+			ResourceType: irodsfs_common_vpath.VPathMappingDirectory,
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	fs := &IRODSFS{
+		config:        config,
+		inodeManager:  inodeManager,
+		vpathManager:  vpathManager,
+		session:       newFSSession(client, nil),
+		fileHandleMap: NewFileHandleMap(),
+		userGroupsMap: map[string]*irodsclient_types.IRODSUser{},
+
+		sharedReadHandleMap: NewSharedReadHandleMap(),
+		cacheEventHandlers:  map[irodsfs_common_irods.IRODSFSClient]string{},
+		fileModeMask:        0o777,
+		dirModeMask:         0o777,
+		appendLocks:         NewPathLockMap(),
+		remoteLockPathLocks: NewPathLockMap(),
+		createLocks:         NewPathLockMap(),
+		localLockManagers:   NewFileHandleLocalLockManagerMap(),
+
+		account: client.GetAccount(),
+
+		uid:          uint32(config.UID),
+		gid:          uint32(config.GID),
+		userMappings: map[string]commons.UserMapping{},
+	}
+	return fs
+}
+
+// newTestFileHandle opens a file handle on the test file system with writes and reads passed through
+func newTestFileHandle(fs *IRODSFS, client *fakeFSClient, filePath string, openMode irodsclient_types.FileOpenMode) *FileHandle {
+	irodsHandle, err := client.OpenFile(filePath, "", string(openMode))
+	if err != nil {
+		panic(err)
+	}
+
+	handle, err := NewFileHandleLazy(fs, filePath, openMode)
+	if err != nil {
+		panic(err)
+	}
+
+	handle.SetFile(NewFile(fs, 0, filePath))
+	handle.iRODSFileHandle = irodsHandle
+	handle.reader = &fakeReader{handle: irodsHandle}
+	handle.writer = &fakeWriter{handle: irodsHandle}
+	fs.fileHandleMap.Add(handle)
+	return handle
+}
@@ -2,8 +2,10 @@ package irodsfs
 
 import (
 	"context"
+	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
 	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
@@ -45,18 +47,21 @@ func (file *File) getStableAttr() fusefs.StableAttr {
 }
 
 func (file *File) setAttrOutForIRODSEntry(ctx context.Context, entry *irodsclient_fs.Entry, readonly bool, out *fuse.Attr) {
-	mode := IRODSGetACL(ctx, file.fs, entry, readonly)
-	setAttrOutForIRODSEntry(file.fs.inodeManager, entry, file.fs.uid, file.fs.gid, mode, out)
+	irodsSetAttrOut(ctx, file.fs, entry, entry, readonly, out)
 }
 
 func (file *File) ensureIRODSPath(vpathEntry *irodsfs_common_vpath.VPathEntry) error {
-	return ensureVPathEntryIsIRODSEntry(file.fs.fsClient, vpathEntry)
+	fsClient, done := file.fs.acquireFSClient()
+	defer done()
+
+	return ensureVPathEntryIsIRODSEntry(fsClient, vpathEntry)
 }
 
 // Getattr returns stat of file entry
-func (file *File) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+func (file *File) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) (errno syscall.Errno) {
+	defer file.fs.metrics.ObserveOperation("Getattr", time.Now(), &errno)
 	if file.fs.terminated {
-		return syscall.ECONNABORTED
+		return file.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -99,13 +104,24 @@ func (file *File) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.A
 		return syscall.EREMOTEIO
 	}
 
-	return IRODSGetattr(ctx, file.fs, irodsPath, vpathEntry.ReadOnly, out)
+	errno = IRODSGetattr(ctx, file.fs, irodsPath, vpathEntry.ReadOnly, out)
+	if errno == fusefs.OK && file.fs.config.IsChangePollPath(irodsPath) {
+		// files not open are polled only if watched explicitly
+		file.fs.touchChangePoller(file, irodsPath)
+	}
+
+	return errno
 }
 
 // Setattr sets file attributes
-func (file *File) Setattr(ctx context.Context, fh fusefs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+func (file *File) Setattr(ctx context.Context, fh fusefs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) (errno syscall.Errno) {
+	defer file.fs.metrics.ObserveOperation("Setattr", time.Now(), &errno)
 	if file.fs.terminated {
-		return syscall.ECONNABORTED
+		return file.fs.terminatedErrno
+	}
+
+	if file.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -156,9 +172,100 @@ func (file *File) Setattr(ctx context.Context, fh fusefs.FileHandle, in *fuse.Se
 		}
 
 		out.Size = size
+	}
+
+	if mode, ok := in.GetMode(); ok && file.fs.config.ChmodACL {
+		// chmod is ignored without chmod_acl
+		errno := file.setMode(ctx, mode)
+		if errno != fusefs.OK {
+			return errno
+		}
+	}
+
+	if modifyTime, ok := in.GetMTime(); ok {
+		return file.setModifyTime(ctx, modifyTime, out)
+	}
+
+	return fusefs.OK
+}
+
+// setMode applies the mode set by chmod to iRODS ACLs
+func (file *File) setMode(ctx context.Context, mode uint32) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "File",
+		"function": "setMode",
+	})
+
+	vpathEntry := file.fs.vpathManager.GetClosestEntry(file.path)
+	if vpathEntry == nil {
+		logger.Errorf("failed to get VPath Entry for %q", file.path)
+		return syscall.EREMOTEIO
+	}
+
+	if vpathEntry.IsVirtualDirEntry() {
+		logger.Debugf("failed to change mode of virtual dir entry %q", file.path)
+		return syscall.EOPNOTSUPP
+	}
+
+	if vpathEntry.ReadOnly {
+		logger.Debugf("failed to change mode of readonly vpath mapping entry %q", file.path)
+		return syscall.EROFS
+	}
+
+	irodsPath, err := vpathEntry.GetIRODSPath(file.path)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	return IRODSChmod(ctx, file.fs, irodsPath, mode)
+}
+
+// setModifyTime persists the modify time set by users, e.g., touch -d, if persist timestamps is enabled
+func (file *File) setModifyTime(ctx context.Context, modifyTime time.Time, out *fuse.AttrOut) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "File",
+		"function": "setModifyTime",
+	})
+
+	if !file.fs.config.PersistTimestamps {
+		// not supported but return OK to not cause various errors in linux commands
+		logger.Debugf("ignoring modify time of %q, persist timestamps is disabled", file.path)
 		return fusefs.OK
 	}
 
+	vpathEntry := file.fs.vpathManager.GetClosestEntry(file.path)
+	if vpathEntry == nil {
+		logger.Errorf("failed to get VPath Entry for %q", file.path)
+		return syscall.EREMOTEIO
+	}
+
+	if vpathEntry.ReadOnly || vpathEntry.IsVirtualDirEntry() {
+		logger.Debugf("ignoring modify time of readonly vpath mapping entry %q", file.path)
+		return fusefs.OK
+	}
+
+	irodsPath, err := vpathEntry.GetIRODSPath(file.path)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	// writes update iRODS modify time, so handles open for write persist it again after closing
+	for _, handle := range file.fs.fileHandleMap.ListByPath(irodsPath) {
+		if handle.openMode.IsWrite() {
+			handle.setPendingModifyTime(modifyTime)
+		}
+	}
+
+	errno := IRODSSetModifyTime(ctx, file.fs, irodsPath, modifyTime)
+	if errno != fusefs.OK {
+		return errno
+	}
+
+	out.Attr.SetTimes(nil, &modifyTime, nil)
 	return fusefs.OK
 }
 
@@ -169,7 +276,7 @@ func (file *File) Setattr(ctx context.Context, fh fusefs.FileHandle, in *fuse.Se
 // success.
 func (file *File) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
 	if file.fs.terminated {
-		return 0, syscall.ECONNABORTED
+		return 0, file.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -212,7 +319,7 @@ func (file *File) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.E
 		return 0, syscall.EREMOTEIO
 	}
 
-	return IRODSListxattr(ctx, file.fs, irodsPath, dest)
+	return IRODSListxattr(ctx, file.fs, irodsPath, nil, dest)
 }
 
 // Getxattr returns xattr
@@ -221,10 +328,10 @@ func (file *File) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.E
 // If not defined, Getxattr will return ENOATTR.
 func (file *File) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
 	if file.fs.terminated {
-		return 0, syscall.ECONNABORTED
+		return 0, file.fs.terminatedErrno
 	}
 
-	if IsUnhandledAttr(attr) {
+	if IsUnhandledAttr(attr) && !(attr == PosixACLAccessXattrName && file.fs.config.PosixACL) {
 		return 0, syscall.ENODATA
 	}
 
@@ -268,6 +375,54 @@ func (file *File) Getxattr(ctx context.Context, attr string, dest []byte) (uint3
 		return 0, syscall.EREMOTEIO
 	}
 
+	if attr == PosixACLAccessXattrName {
+		return IRODSGetPosixACL(ctx, file.fs, irodsPath, vpathEntry.ReadOnly, dest)
+	}
+
+	if attr == ReplicateXattrName && file.fs.config.EnableReplication {
+		// an action, replicas xattrs present the result
+		return 0, syscall.ENODATA
+	}
+
+	if attr == OpenHandlesXattrName && file.fs.config.ExposeOpenHandles {
+		// process-local, other mounts may have the file open too
+		handlesOpened := file.fs.fileHandleMap.ListByPath(irodsPath)
+		value := []byte(strconv.Itoa(len(handlesOpened)))
+
+		if len(dest) < len(value) {
+			return uint32(len(value)), syscall.ERANGE
+		}
+
+		copy(dest, value)
+		return uint32(len(value)), fusefs.OK
+	}
+
+	if attr == DataTypeXattrName && file.fs.config.ExposeDataType {
+		// the data type is set bypassing the metadata cache, so read it back uncached
+		irodsEntry, err := irodsStatUncached(ctx, file.fs, irodsPath)
+		if err != nil {
+			if irodsclient_types.IsFileNotFoundError(err) {
+				logger.Debugf("failed to find a file - %q", irodsPath)
+				return 0, syscall.ENOENT
+			}
+
+			logger.Errorf("%+v", err)
+			return 0, syscall.EREMOTEIO
+		}
+
+		if len(irodsEntry.DataType) == 0 {
+			return 0, syscall.ENODATA
+		}
+
+		value := []byte(irodsEntry.DataType)
+		if len(dest) < len(value) {
+			return uint32(len(value)), syscall.ERANGE
+		}
+
+		copy(dest, value)
+		return uint32(len(value)), fusefs.OK
+	}
+
 	return IRODSGetxattr(ctx, file.fs, irodsPath, attr, dest)
 }
 
@@ -275,7 +430,11 @@ func (file *File) Getxattr(ctx context.Context, attr string, dest []byte) (uint3
 // If not defined, Setxattr will return ENOATTR.
 func (file *File) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
 	if file.fs.terminated {
-		return syscall.ECONNABORTED
+		return file.fs.terminatedErrno
+	}
+
+	if file.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -298,6 +457,13 @@ func (file *File) Setxattr(ctx context.Context, attr string, data []byte, flags
 		return syscall.EINVAL
 	}
 
+	// the data type is managed by irodsfs, but users can change it
+	setDataType := attr == DataTypeXattrName && file.fs.config.ExposeDataType
+	replicate := attr == ReplicateXattrName && file.fs.config.EnableReplication
+	if IsReadOnlyAttr(file.fs.config, attr) && !setDataType && !replicate {
+		return syscall.EPERM
+	}
+
 	file.mutex.RLock()
 	defer file.mutex.RUnlock()
 
@@ -326,6 +492,14 @@ func (file *File) Setxattr(ctx context.Context, attr string, data []byte, flags
 		return syscall.EREMOTEIO
 	}
 
+	if setDataType {
+		return IRODSSetDataType(ctx, file.fs, irodsPath, string(data))
+	}
+
+	if replicate {
+		return IRODSReplicate(ctx, file.fs, irodsPath, string(data))
+	}
+
 	return IRODSSetxattr(ctx, file.fs, irodsPath, attr, data)
 }
 
@@ -333,7 +507,11 @@ func (file *File) Setxattr(ctx context.Context, attr string, data []byte, flags
 // If not defined, Removexattr will return ENOATTR.
 func (file *File) Removexattr(ctx context.Context, attr string) syscall.Errno {
 	if file.fs.terminated {
-		return syscall.ECONNABORTED
+		return file.fs.terminatedErrno
+	}
+
+	if file.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -348,6 +526,10 @@ func (file *File) Removexattr(ctx context.Context, attr string) syscall.Errno {
 	logger.Infof("Calling Removexattr (%d) - %q", operID, file.path)
 	defer logger.Infof("Called Removexattr (%d) - %q", operID, file.path)
 
+	if IsReadOnlyAttr(file.fs.config, attr) {
+		return syscall.EPERM
+	}
+
 	file.mutex.RLock()
 	defer file.mutex.RUnlock()
 
@@ -380,9 +562,14 @@ func (file *File) Removexattr(ctx context.Context, attr string) syscall.Errno {
 }
 
 // Truncate truncates file entry
-func (file *File) Truncate(ctx context.Context, size uint64) syscall.Errno {
+func (file *File) Truncate(ctx context.Context, size uint64) (errno syscall.Errno) {
+	defer file.fs.metrics.ObserveOperation("Truncate", time.Now(), &errno)
 	if file.fs.terminated {
-		return syscall.ECONNABORTED
+		return file.fs.terminatedErrno
+	}
+
+	if file.fs.config.ReadOnly {
+		return syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -413,7 +600,10 @@ func (file *File) Truncate(ctx context.Context, size uint64) syscall.Errno {
 	}
 
 	// IRODS File
-	err := ensureVPathEntryIsIRODSEntry(file.fs.fsClient, vpathEntry)
+	fsClient, done := file.fs.acquireFSClient()
+	defer done()
+
+	err := ensureVPathEntryIsIRODSEntry(fsClient, vpathEntry)
 	if err != nil {
 		logger.Errorf("%+v", err)
 		return syscall.EREMOTEIO
@@ -460,7 +650,7 @@ func (file *File) Truncate(ctx context.Context, size uint64) syscall.Errno {
 
 	if !callFtruncate {
 		if irodsEntry.Size != int64(size) {
-			err = file.fs.fsClient.TruncateFile(irodsEntry.Path, int64(size))
+			err = fsClient.TruncateFile(irodsEntry.Path, int64(size))
 			if err != nil {
 				if irodsclient_types.IsFileNotFoundError(err) {
 					logger.Debugf("failed to find a file - %q", irodsEntry.Path)
@@ -477,9 +667,14 @@ func (file *File) Truncate(ctx context.Context, size uint64) syscall.Errno {
 }
 
 // Open opens file for the path and returns file handle
-func (file *File) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
-	if file.fs.terminated {
-		return nil, 0, syscall.ECONNABORTED
+func (file *File) Open(ctx context.Context, flags uint32) (fh fusefs.FileHandle, fuseFlags uint32, errno syscall.Errno) {
+	defer file.fs.metrics.ObserveOperation("Open", time.Now(), &errno)
+	if file.fs.terminated || file.fs.isDraining() {
+		return nil, 0, file.fs.terminatedErrno
+	}
+
+	if file.fs.config.ReadOnly && IRODSGetOpenFlags(flags) != irodsclient_types.FileOpenModeReadOnly {
+		return nil, 0, syscall.EROFS
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -537,15 +732,27 @@ func (file *File) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, ui
 		return nil, 0, syscall.EREMOTEIO
 	}
 
+	callerUID, hasCaller := getCallerUID(ctx)
+	reserved, ok := file.fs.reserveOpenFile(callerUID, hasCaller)
+	if !ok {
+		logger.Errorf("failed to open file %q, uid %d reached the open file limit %d", file.path, callerUID, file.fs.config.OpenFileMaxPerUser)
+		return nil, 0, syscall.EAGAIN
+	}
+
 	fileHandle, errno := IRODSOpenLazy(ctx, file.fs, file, irodsPath, flags)
 	if errno != fusefs.OK {
+		if reserved {
+			file.fs.fileHandleMap.CancelReservation(callerUID)
+		}
 		return nil, 0, errno
 	}
 
 	fileHandle.SetFile(file)
+	fileHandle.SetUID(callerUID)
 
 	// add to file handle map
-	file.fs.fileHandleMap.Add(fileHandle)
+	file.fs.addOpenedFile(fileHandle, reserved)
+	file.fs.touchChangePoller(file, irodsPath)
 
 	return fileHandle, fuseFlag, fusefs.OK
 }
@@ -553,7 +760,7 @@ func (file *File) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, ui
 // Getlk returns locks
 func (file *File) Getlk(ctx context.Context, fh fusefs.FileHandle, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) syscall.Errno {
 	if file.fs.terminated {
-		return syscall.ECONNABORTED
+		return file.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -574,13 +781,17 @@ func (file *File) Getlk(ctx context.Context, fh fusefs.FileHandle, owner uint64,
 		return syscall.EREMOTEIO
 	}
 
+	if file.fs.config.DistributedLocks {
+		return fileHandle.GetRemoteLock(ctx, owner, lk, flags, out)
+	}
+
 	return fileHandle.GetLocalLock(ctx, owner, lk, flags, out)
 }
 
 // Setlk obtains a lock on a file, or fail if the lock could not obtained
 func (file *File) Setlk(ctx context.Context, fh fusefs.FileHandle, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
 	if file.fs.terminated {
-		return syscall.ECONNABORTED
+		return file.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -601,13 +812,17 @@ func (file *File) Setlk(ctx context.Context, fh fusefs.FileHandle, owner uint64,
 		return syscall.EREMOTEIO
 	}
 
+	if file.fs.config.DistributedLocks {
+		return fileHandle.SetRemoteLock(ctx, owner, lk, flags)
+	}
+
 	return fileHandle.SetLocalLock(ctx, owner, lk, flags)
 }
 
 // Setlkw obtains a lock on a file, waiting if necessary
 func (file *File) Setlkw(ctx context.Context, fh fusefs.FileHandle, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
 	if file.fs.terminated {
-		return syscall.ECONNABORTED
+		return file.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -628,16 +843,68 @@ func (file *File) Setlkw(ctx context.Context, fh fusefs.FileHandle, owner uint64
 		return syscall.EREMOTEIO
 	}
 
+	if file.fs.config.DistributedLocks {
+		return fileHandle.SetRemoteLockW(ctx, owner, lk, flags)
+	}
+
 	return fileHandle.SetLocalLockW(ctx, owner, lk, flags)
 }
 
-/*
-func (dir *Dir) Link(ctx context.Context, target InodeEmbedder, name string, out *fuse.EntryOut) (node *Inode, errno syscall.Errno) {
+// CopyFileRange copies data of the file to the out file, on the server if the whole file is copied to an empty file
+func (file *File) CopyFileRange(ctx context.Context, fhIn fusefs.FileHandle, offIn uint64, out *fusefs.Inode, fhOut fusefs.FileHandle, offOut uint64, length uint64, flags uint64) (uint32, syscall.Errno) {
+	if file.fs.terminated {
+		return 0, file.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "File",
+		"function": "CopyFileRange",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	operID := file.fs.GetNextOperationID()
+	logger.Infof("Calling CopyFileRange (%d) - %q", operID, file.path)
+	defer logger.Infof("Called CopyFileRange (%d) - %q", operID, file.path)
+
+	fileHandleIn, ok := fhIn.(*FileHandle)
+	if !ok {
+		logger.Errorf("failed to convert fh to a file handle - %q", file.path)
+		return 0, syscall.EREMOTEIO
+	}
+
+	// e.g., pseudo-files of the rule control dir
+	fileHandleOut, ok := fhOut.(*FileHandle)
+	if !ok {
+		return 0, syscall.ENOTSUP
+	}
+
+	return fileHandleIn.CopyFileRange(ctx, offIn, fileHandleOut, offOut, length)
 }
 
-func (dir *Dir) Symlink(ctx context.Context, target, name string, out *fuse.EntryOut) (node *Inode, errno syscall.Errno) {
+// Statfs returns file system statistics
+func (file *File) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	if file.fs.terminated {
+		return file.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "File",
+		"function": "Statfs",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	operID := file.fs.GetNextOperationID()
+	logger.Infof("Calling Statfs (%d) - %q", operID, file.path)
+	defer logger.Infof("Called Statfs (%d) - %q", operID, file.path)
+
+	return IRODSStatfs(ctx, file.fs, out)
 }
 
-func (dir *Dir) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+/*
+func (dir *Dir) Link(ctx context.Context, target InodeEmbedder, name string, out *fuse.EntryOut) (node *Inode, errno syscall.Errno) {
 }
 */
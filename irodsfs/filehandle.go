@@ -2,9 +2,13 @@ package irodsfs
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"os"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
 	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
@@ -13,14 +17,29 @@ import (
 	fusefs "github.com/hanwen/go-fuse/v2/fs"
 	fuse "github.com/hanwen/go-fuse/v2/fuse"
 	"github.com/rs/xid"
+	"golang.org/x/xerrors"
 
+	"github.com/cyverse/irodsfs/commons"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
-	iRODSWriteBufferSize int = 16 * 1024 * 1024 // 16MB
-	iRODSIOBlockSize     int = 16 * 1024 * 1024 // 16MB
-	iRODSReadWriteSize   int = 128 * 1024       // 128KB
+	remoteLockPollInterval time.Duration = 1 * time.Second
+
+	// number of sequential reads after a seek to resume prefetching
+	prefetchResumeReads int = 4
+	// prefetch window doubles after reading this many windows sequentially
+	prefetchWindowGrowthWindows int64 = 2
+
+	// whence of lseek not defined in syscall
+	seekData uint32 = 3 // SEEK_DATA
+	seekHole uint32 = 4 // SEEK_HOLE
+
+	// flag of fsync for fdatasync, not defined in go-fuse
+	fsyncFlagDataSync uint32 = 0x01 // FUSE_FSYNC_FDATASYNC
+
+	// mode of fallocate not defined in syscall
+	fallocFlKeepSize uint32 = 0x01 // FALLOC_FL_KEEP_SIZE
 )
 
 // FileHandle is a file handle
@@ -30,13 +49,32 @@ type FileHandle struct {
 	file     *File
 	path     string
 	openMode irodsclient_types.FileOpenMode
-
-	reader               irodsfscommon_io.Reader
-	writer               irodsfscommon_io.Writer
-	iRODSFileHandle      irodsfscommon_irods.IRODSFSFileHandle // this may be nil as we can set this handle lazily
-	localFileLockManager *FileHandleLocalLockManager
-
-	mutex sync.Mutex
+	uid      uint32 // local uid of the user who opened the file
+
+	reader                irodsfscommon_io.Reader
+	writer                irodsfscommon_io.Writer
+	iRODSFileHandle       irodsfscommon_irods.IRODSFSFileHandle // this may be nil as we can set this handle lazily
+	sharedReadHandle      *SharedReadHandle                     // this is set when the iRODS file handle is shared with other readers
+	remoteFileLockManager *FileHandleRemoteLockManager
+	modified              bool
+	size                  int64    // file size written through the handle, valid when modified
+	clientProcessAudited  bool     // client process is recorded once per handle
+	prefetching           bool     // reader prefetches file content
+	rangeReadServed       bool     // the first read is served by readRange, with defer_prefetch
+	bundleFile            *os.File // file extracted from a bundle of the collection serving reads, with bulk_small_file_mode
+	bundleChecked         bool     // the bundle cache is asked for the file once per handle
+	readOffsetNext        int64    // offset following the last read, to detect seeks
+	sequentialReads       int      // number of sequential reads since prefetching is cancelled
+	sequentialBytes       int64    // bytes read sequentially since the prefetch window is set
+	prefetchWindow        int      // size of data prefetched ahead, 0 if the reader does not use a window
+	checksumVerifier      *ChecksumVerifier
+	pendingModifyTime     time.Time // modify time set while open, persisted again after closing
+	broken                bool      // set when commit fails to reopen the iRODS file handle, operations fail with EIO
+	bytesRead             uint64    // accessed atomically
+	bytesWritten          uint64    // accessed atomically
+
+	readerMutex sync.RWMutex // protects reader and writer from being replaced while reading or writing
+	mutex       sync.Mutex
 }
 
 func NewFileHandleLazy(fs *IRODSFS, path string, openMode irodsclient_types.FileOpenMode) (*FileHandle, error) {
@@ -47,12 +85,30 @@ func NewFileHandleLazy(fs *IRODSFS, path string, openMode irodsclient_types.File
 		path:     path,
 		openMode: openMode,
 
-		reader:               nil,
-		writer:               nil,
-		iRODSFileHandle:      nil,
-		localFileLockManager: NewFileHandleLocalLockManager(),
-
-		mutex: sync.Mutex{},
+		reader:                nil,
+		writer:                nil,
+		iRODSFileHandle:       nil,
+		sharedReadHandle:      nil,
+		remoteFileLockManager: NewFileHandleRemoteLockManager(fs, path),
+		modified:              false,
+		size:                  0,
+		clientProcessAudited:  false,
+		prefetching:           false,
+		rangeReadServed:       false,
+		bundleFile:            nil,
+		bundleChecked:         false,
+		readOffsetNext:        0,
+		sequentialReads:       0,
+		sequentialBytes:       0,
+		prefetchWindow:        0,
+		checksumVerifier:      nil,
+		pendingModifyTime:     time.Time{},
+		broken:                false,
+		bytesRead:             0,
+		bytesWritten:          0,
+
+		readerMutex: sync.RWMutex{},
+		mutex:       sync.Mutex{},
 	}, nil
 }
 
@@ -66,12 +122,30 @@ func NewFileHandle(fs *IRODSFS, fileHandle irodsfscommon_irods.IRODSFSFileHandle
 		path:     fileHandle.GetEntry().Path,
 		openMode: openMode,
 
-		reader:               nil,
-		writer:               nil,
-		iRODSFileHandle:      fileHandle,
-		localFileLockManager: NewFileHandleLocalLockManager(),
-
-		mutex: sync.Mutex{},
+		reader:                nil,
+		writer:                nil,
+		iRODSFileHandle:       fileHandle,
+		sharedReadHandle:      nil,
+		remoteFileLockManager: NewFileHandleRemoteLockManager(fs, fileHandle.GetEntry().Path),
+		modified:              false,
+		size:                  0,
+		clientProcessAudited:  false,
+		prefetching:           false,
+		rangeReadServed:       false,
+		bundleFile:            nil,
+		bundleChecked:         false,
+		readOffsetNext:        0,
+		sequentialReads:       0,
+		sequentialBytes:       0,
+		prefetchWindow:        0,
+		checksumVerifier:      nil,
+		pendingModifyTime:     time.Time{},
+		broken:                false,
+		bytesRead:             0,
+		bytesWritten:          0,
+
+		readerMutex: sync.RWMutex{},
+		mutex:       sync.Mutex{},
 	}
 
 	err := handle.initReaderWriter()
@@ -97,7 +171,25 @@ func (handle *FileHandle) SetFile(file *File) {
 	handle.file = file
 }
 
-func (handle *FileHandle) initLazy() error {
+// SetUID sets local uid of the user who opened the file
+func (handle *FileHandle) SetUID(uid uint32) {
+	handle.uid = uid
+}
+
+// isBroken checks if the iRODS file handle is lost by failing commit
+func (handle *FileHandle) isBroken() bool {
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	return handle.broken
+}
+
+// GetUID returns local uid of the user who opened the file
+func (handle *FileHandle) GetUID() uint32 {
+	return handle.uid
+}
+
+func (handle *FileHandle) initLazy(ctx context.Context) error {
 	logger := log.WithFields(log.Fields{
 		"package":  "irodsfs",
 		"struct":   "FileHandle",
@@ -109,15 +201,34 @@ func (handle *FileHandle) initLazy() error {
 	defer handle.mutex.Unlock()
 
 	if handle.iRODSFileHandle == nil {
+		if handle.openMode.IsReadOnly() && handle.fs.config.SharedReadHandle {
+			// share a handle with other readers of the same file
+			sharedReadHandle, err := handle.fs.sharedReadHandleMap.Acquire(handle.fs, handle.path)
+			if err != nil {
+				return err
+			}
+
+			handle.sharedReadHandle = sharedReadHandle
+			handle.iRODSFileHandle = sharedReadHandle.iRODSFileHandle
+			handle.reader = sharedReadHandle.reader
+			handle.writer = irodsfscommon_io.NewNilWriter(handle.fs.getDataFSClient(handle.openMode), handle.iRODSFileHandle)
+			return nil
+		}
+
 		logger.Infof("Open file %q with mode %q", handle.path, handle.openMode)
 
-		irodsHandle, err := handle.fs.fsClient.OpenFile(handle.path, "", string(handle.openMode))
+		var irodsHandle irodsfscommon_irods.IRODSFSFileHandle
+		err := irodsRetry(ctx, handle.fs, handle.path, true, func() error {
+			var openErr error
+			irodsHandle, openErr = handle.fs.openDataFile(handle.path, handle.openMode)
+			return openErr
+		})
 		if err != nil {
 			return err
 		}
 
-		if handle.fs.instanceReportClient != nil {
-			handle.fs.instanceReportClient.StartFileAccess(irodsHandle)
+		if reportClient := handle.fs.getAccessReportClient(handle.openMode); reportClient != nil {
+			reportClient.StartFileAccess(irodsHandle)
 		}
 
 		handle.iRODSFileHandle = irodsHandle
@@ -135,35 +246,53 @@ func (handle *FileHandle) initReaderWriter() error {
 	var writer irodsfscommon_io.Writer
 	var reader irodsfscommon_io.Reader
 
-	fsClient := handle.fs.fsClient
+	fsClient := handle.fs.getDataFSClient(handle.openMode)
 
 	if handle.openMode.IsReadOnly() {
 		// writer
 		writer = irodsfscommon_io.NewNilWriter(fsClient, handle.iRODSFileHandle)
 
 		// reader
-		syncReader := irodsfscommon_io.NewSyncReader(fsClient, handle.iRODSFileHandle, handle.fs.instanceReportClient)
-
-		// use prefetching
-		// requires multiple readers
-		readers := []irodsfscommon_io.Reader{syncReader}
-
-		asyncReader, err := irodsfscommon_io.NewAsyncCacheThroughReader(readers, iRODSIOBlockSize, nil)
-		if err != nil {
-			return err
+		readAhead := handle.fs.config.GetReadAhead(handle.path)
+		if readAhead == 0 {
+			reader = newNonPrefetchingReader(handle.fs, handle.iRODSFileHandle)
+			handle.prefetching = false
+		} else {
+			readOnlyReader, err := newReadOnlyReader(handle.fs, handle.iRODSFileHandle)
+			if err != nil {
+				return err
+			}
+			reader = readOnlyReader
+			handle.prefetching = handle.fs.config.GetIOHint(handle.path) != commons.IOHintRandom
+			if _, ok := readOnlyReader.(*ParallelReader); !ok && handle.prefetching {
+				handle.prefetchWindow = readAhead
+			}
 		}
-		reader = asyncReader
 	} else if handle.openMode.IsWriteOnly() {
 		// writer
 		syncWriter := irodsfscommon_io.NewSyncWriter(fsClient, handle.iRODSFileHandle, handle.fs.instanceReportClient)
-		syncBufferedWriter := irodsfscommon_io.NewSyncBufferedWriter(syncWriter, iRODSIOBlockSize)
-		writer = irodsfscommon_io.NewAsyncWriter(syncBufferedWriter)
+		syncBufferedWriter := irodsfscommon_io.NewSyncBufferedWriter(syncWriter, handle.fs.config.IOBlockSize)
+		if handle.fs.ioWorkerPool != nil {
+			// write in background on the I/O worker pool instead of a goroutine per handle
+			writer = NewPooledAsyncWriter(syncBufferedWriter, handle.fs.submitAsync)
+		} else {
+			writer = irodsfscommon_io.NewAsyncWriter(syncBufferedWriter)
+		}
+
+		if handle.fs.config.WriteBackFlushInterval > 0 {
+			// coalesce small writes, nothing reads dirty data as the file is write-only
+			if handle.fs.writeBackFlusher != nil {
+				writer = NewSharedWriteBackWriter(writer, handle.fs.config.WriteBackMaxDirty, handle.fs.writeBackFlusher)
+			} else {
+				writer = NewWriteBackWriter(writer, handle.fs.config.WriteBackMaxDirty, time.Duration(handle.fs.config.WriteBackFlushInterval))
+			}
+		}
 
 		// reader
 		reader = irodsfscommon_io.NewNilReader(fsClient, handle.iRODSFileHandle)
 	} else {
 		writer = irodsfscommon_io.NewSyncWriter(fsClient, handle.iRODSFileHandle, handle.fs.instanceReportClient)
-		reader = irodsfscommon_io.NewSyncReader(fsClient, handle.iRODSFileHandle, handle.fs.instanceReportClient)
+		reader = irodsfscommon_io.NewSyncReader(fsClient, handle.iRODSFileHandle, handle.fs.getAccessReportClient(handle.openMode))
 	}
 
 	handle.reader = reader
@@ -171,10 +300,185 @@ func (handle *FileHandle) initReaderWriter() error {
 	return nil
 }
 
+// setModified marks the file handle as the file content is modified, and tracks the file size written through the handle
+// truncate sets the size as given, write only grows the size
+func (handle *FileHandle) setModified(size int64, truncate bool) {
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	if !handle.modified {
+		handle.size = handle.iRODSFileHandle.GetEntry().Size
+		handle.modified = true
+	}
+
+	if truncate || size > handle.size {
+		handle.size = size
+	}
+
+	handle.fs.invalidateDirAttrCache(handle.path)
+}
+
+// resetModifiedSize sets the file size tracked if the handle modified the file
+// this is called when other handle truncates the file
+func (handle *FileHandle) resetModifiedSize(size int64) {
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	if handle.modified {
+		handle.size = size
+	}
+}
+
+// getEOF returns the logical end of the file, considering data written through all handles opened for the file
+func (handle *FileHandle) getEOF(ctx context.Context) (int64, error) {
+	irodsPath := handle.iRODSFileHandle.GetEntry().Path
+	entry, err := IRODSStat(ctx, handle.fs, irodsPath)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to stat %q: %w", irodsPath, err)
+	}
+
+	eof := entry.Size
+	for _, otherHandle := range handle.fs.fileHandleMap.ListByPath(handle.path) {
+		// written data may not be flushed yet
+		if size, modified := otherHandle.getModifiedSize(); modified && size > eof {
+			eof = size
+		}
+	}
+
+	if size, modified := handle.getModifiedSize(); modified && size > eof {
+		eof = size
+	}
+
+	return eof, nil
+}
+
+// isAppendMode checks if the file is opened for appending, with O_APPEND
+func (handle *FileHandle) isAppendMode() bool {
+	return handle.openMode == irodsclient_types.FileOpenModeAppend || handle.openMode == irodsclient_types.FileOpenModeReadAppend
+}
+
+// getModifiedSize returns the file size written through the handle, returns false if the handle didn't modify the file
+func (handle *FileHandle) getModifiedSize() (int64, bool) {
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	return handle.size, handle.modified
+}
+
+// getDirtySize returns the size of data buffered in memory by the write-back cache
+func (handle *FileHandle) getDirtySize() int64 {
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	if writeBackWriter, ok := handle.writer.(*WriteBackWriter); ok {
+		return writeBackWriter.GetDirtySize()
+	}
+	return 0
+}
+
+// getReadBufferSize returns the size of data prefetched or cached in memory by the reader
+// readers of shared read handles are not counted, they are released with the shared read handle
+func (handle *FileHandle) getReadBufferSize() int64 {
+	handle.readerMutex.RLock()
+	defer handle.readerMutex.RUnlock()
+
+	if handle.sharedReadHandle != nil {
+		return 0
+	}
+
+	switch reader := handle.reader.(type) {
+	case *AlignedReader:
+		return reader.GetCachedSize()
+	case *ParallelReader:
+		return reader.GetBufferSize()
+	}
+
+	if handle.prefetching {
+		return int64(handle.prefetchWindow)
+	}
+	return 0
+}
+
+// releaseReadBuffers drops data prefetched or cached in memory by the reader, following reads are served on demand
+func (handle *FileHandle) releaseReadBuffers() {
+	handle.readerMutex.Lock()
+	defer handle.readerMutex.Unlock()
+
+	if handle.sharedReadHandle != nil || handle.reader == nil || !handle.openMode.IsReadOnly() {
+		return
+	}
+
+	if alignedReader, ok := handle.reader.(*AlignedReader); ok {
+		alignedReader.DropBlocks()
+		return
+	}
+
+	_, parallel := handle.reader.(*ParallelReader)
+	if !handle.prefetching && !parallel {
+		return
+	}
+
+	// data being prefetched is discarded, release stops transfers and waits for them in background
+	prefetchingReader := handle.reader
+	handle.fs.runAsync(prefetchingReader.Release)
+
+	handle.reader = newNonPrefetchingReader(handle.fs, handle.iRODSFileHandle)
+	handle.prefetching = false
+	handle.prefetchWindow = 0
+}
+
+// newReadOnlyReader creates a reader for read-only access, chosen by the I/O hint of the file extension and the read-ahead of the path
+// prefetching only wastes transfers for files read randomly, e.g., databases
+func newReadOnlyReader(fs *IRODSFS, fileHandle irodsfscommon_irods.IRODSFSFileHandle) (irodsfscommon_io.Reader, error) {
+	readAhead := fs.config.GetReadAhead(fileHandle.GetEntry().Path)
+	if readAhead == 0 || fs.config.GetIOHint(fileHandle.GetEntry().Path) == commons.IOHintRandom {
+		return newNonPrefetchingReader(fs, fileHandle), nil
+	}
+
+	// leave a connection for metadata operations
+	streams := fs.config.ConnectionMax - 1
+	if fs.config.ParallelRead && streams > 1 && fileHandle.GetEntry().Size > int64(fs.config.IOBlockSize) {
+		parallelReader, err := NewParallelReader(fs, fileHandle, streams)
+		if err == nil {
+			return parallelReader, nil
+		}
+
+		if !xerrors.Is(err, errParallelStreamsExhausted) {
+			return nil, err
+		}
+		// other files use all streams, prefetch through the handle given
+	}
+
+	return newPrefetchingReader(fs, fileHandle, readAhead)
+}
+
+// newNonPrefetchingReader creates a reader that reads file content on demand for read-only access
+// reads are aligned to blocks if configured, so overlapping reads are served from blocks read
+func newNonPrefetchingReader(fs *IRODSFS, fileHandle irodsfscommon_irods.IRODSFSFileHandle) irodsfscommon_io.Reader {
+	syncReader := irodsfscommon_io.NewSyncReader(fs.getDataFSClient(fileHandle.GetOpenMode()), fileHandle, fs.getAccessReportClient(fileHandle.GetOpenMode()))
+	if fs.config.AlignedReadBlockSize <= 0 {
+		return syncReader
+	}
+
+	return NewAlignedReader(syncReader, fs.config.AlignedReadBlockSize, fileHandle.GetEntry().Size)
+}
+
+// newPrefetchingReader creates a reader that prefetches file content for read-only access, window bytes at a time
+func newPrefetchingReader(fs *IRODSFS, fileHandle irodsfscommon_irods.IRODSFSFileHandle, window int) (irodsfscommon_io.Reader, error) {
+	syncReader := irodsfscommon_io.NewSyncReader(fs.getDataFSClient(fileHandle.GetOpenMode()), fileHandle, fs.getAccessReportClient(fileHandle.GetOpenMode()))
+
+	// the whole window a read falls in is fetched in background
+	prefetchingReader, err := NewPrefetchingReader([]irodsfscommon_io.Reader{syncReader}, window, fs.submitAsync)
+	if err != nil {
+		return nil, err
+	}
+	return prefetchingReader, nil
+}
+
 // Getattr returns stat of file entry
 func (handle *FileHandle) Getattr(ctx context.Context, out *fuse.AttrOut) syscall.Errno {
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -189,13 +493,24 @@ func (handle *FileHandle) Getattr(ctx context.Context, out *fuse.AttrOut) syscal
 	logger.Infof("Calling Getattr (%d) - %q", operID, handle.file.path)
 	defer logger.Infof("Called Getattr (%d) - %q", operID, handle.file.path)
 
-	return handle.file.Getattr(ctx, handle, out)
+	errno := handle.file.Getattr(ctx, handle, out)
+	if errno != fusefs.OK {
+		return errno
+	}
+
+	// iRODS may not know the size written through the handle yet as writes are buffered
+	if size, modified := handle.getModifiedSize(); modified {
+		out.Size = uint64(size)
+		out.Blocks = getBlocks(size)
+	}
+
+	return fusefs.OK
 }
 
 // Setattr sets file attributes
 func (handle *FileHandle) Setattr(ctx context.Context, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -206,7 +521,7 @@ func (handle *FileHandle) Setattr(ctx context.Context, in *fuse.SetAttrIn, out *
 
 	defer irodsfs_common_utils.StackTraceFromPanic(logger)
 
-	err := handle.initLazy()
+	err := handle.initLazy(ctx)
 	if err != nil {
 		logger.Errorf("%+v", err)
 		return syscall.EREMOTEIO
@@ -224,6 +539,10 @@ func (handle *FileHandle) Setattr(ctx context.Context, in *fuse.SetAttrIn, out *
 		}
 
 		out.Size = size
+
+		if modifyTime, ok := in.GetMTime(); ok {
+			return handle.file.setModifyTime(ctx, modifyTime, out)
+		}
 		return fusefs.OK
 	}
 
@@ -231,9 +550,10 @@ func (handle *FileHandle) Setattr(ctx context.Context, in *fuse.SetAttrIn, out *
 }
 
 // Read reads file content
-func (handle *FileHandle) Read(ctx context.Context, dest []byte, offset int64) (fuse.ReadResult, syscall.Errno) {
+func (handle *FileHandle) Read(ctx context.Context, dest []byte, offset int64) (result fuse.ReadResult, errno syscall.Errno) {
+	defer handle.fs.metrics.ObserveOperation("Read", time.Now(), &errno)
 	if handle.fs.terminated {
-		return nil, syscall.ECONNABORTED
+		return nil, handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -244,7 +564,52 @@ func (handle *FileHandle) Read(ctx context.Context, dest []byte, offset int64) (
 
 	defer irodsfs_common_utils.StackTraceFromPanic(logger)
 
-	err := handle.initLazy()
+	if handle.isBroken() {
+		logger.Errorf("failed to use a file handle lost by failing commit - %q", handle.file.path)
+		return nil, syscall.EIO
+	}
+
+	if handle.useBundleRead(ctx) {
+		if !handle.fs.readBandwidthLimiter.Wait(ctx, len(dest)) {
+			return nil, syscall.EINTR
+		}
+
+		if !handle.fs.getUserBandwidthLimiter(handle.uid).Wait(ctx, len(dest)) {
+			return nil, syscall.EINTR
+		}
+
+		readLen, err := handle.bundleFile.ReadAt(dest, offset)
+		if err != nil && err != io.EOF {
+			logger.Errorf("%+v", err)
+			return nil, syscall.EIO
+		}
+
+		handle.fs.metrics.AddBytesRead(readLen)
+		atomic.AddUint64(&handle.bytesRead, uint64(readLen))
+		return fuse.ReadResultData(dest[:readLen]), fusefs.OK
+	}
+
+	if handle.useRangeRead() {
+		if !handle.fs.readBandwidthLimiter.Wait(ctx, len(dest)) {
+			return nil, syscall.EINTR
+		}
+
+		if !handle.fs.getUserBandwidthLimiter(handle.uid).Wait(ctx, len(dest)) {
+			return nil, syscall.EINTR
+		}
+
+		readLen, err := handle.readRange(ctx, dest, offset)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return nil, syscall.EREMOTEIO
+		}
+
+		handle.fs.metrics.AddBytesRead(readLen)
+		atomic.AddUint64(&handle.bytesRead, uint64(readLen))
+		return fuse.ReadResultData(dest[:readLen]), fusefs.OK
+	}
+
+	err := handle.initLazy(ctx)
 	if err != nil {
 		logger.Errorf("%+v", err)
 		return nil, syscall.EREMOTEIO
@@ -274,7 +639,42 @@ func (handle *FileHandle) Read(ctx context.Context, dest []byte, offset int64) (
 		return fuse.ReadResultData(dest[:0]), fusefs.OK
 	}
 
-	readLen, err := handle.reader.ReadAt(dest, offset)
+	if (handle.fs.config.CancelPrefetchOnSeek || handle.fs.config.AdaptivePrefetch) && handle.sharedReadHandle == nil && handle.openMode.IsReadOnly() {
+		handle.adjustPrefetch(offset, size)
+	}
+
+	if !handle.fs.readBandwidthLimiter.Wait(ctx, size) {
+		return nil, syscall.EINTR
+	}
+
+	if !handle.fs.getUserBandwidthLimiter(handle.uid).Wait(ctx, size) {
+		return nil, syscall.EINTR
+	}
+
+	generation := handle.fs.getSessionGeneration()
+
+	var readLen int
+	// the handle is reopened on a new session below, instead of reconnecting
+	err = irodsRetry(ctx, handle.fs, handle.path, false, func() error {
+		var readErr error
+		handle.readerMutex.RLock()
+		readLen, readErr = handle.reader.ReadAt(dest, offset)
+		handle.readerMutex.RUnlock()
+		return readErr
+	})
+	if err != nil && err != io.EOF && isIRODSConnectionError(err) && handle.isReopenable() {
+		logger.Warnf("retrying read of %q on a new session on connection error - %v", handle.file.path, err)
+
+		reopenErr := handle.reopen(generation)
+		if reopenErr != nil {
+			logger.Errorf("%+v", reopenErr)
+		} else {
+			handle.readerMutex.RLock()
+			readLen, err = handle.reader.ReadAt(dest, offset)
+			handle.readerMutex.RUnlock()
+		}
+	}
+
 	if err != nil && err != io.EOF {
 		logger.Errorf("%+v", err)
 		return nil, syscall.EREMOTEIO
@@ -282,131 +682,636 @@ func (handle *FileHandle) Read(ctx context.Context, dest []byte, offset int64) (
 
 	logger.Debugf("read %d bytes, eof? %t", readLen, err == io.EOF)
 
+	if handle.fs.config.VerifyChecksum {
+		err = handle.verifyChecksum(dest[:readLen], offset)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return nil, syscall.EIO
+		}
+	}
+	handle.fs.metrics.AddBytesRead(readLen)
+	atomic.AddUint64(&handle.bytesRead, uint64(readLen))
+
 	return fuse.ReadResultData(dest[:readLen]), fusefs.OK
 }
 
-// Write writes file content
-func (handle *FileHandle) Write(ctx context.Context, data []byte, offset int64) (uint32, syscall.Errno) {
-	if handle.fs.terminated {
-		return 0, syscall.ECONNABORTED
+// useRangeRead checks if the read is the first read of a handle served by readRange, and marks it served
+// with defer_prefetch, a read-only handle is opened on iRODS at the second read, so an open-read-close, e.g., a ranged request of an HTTP gateway,
+// sets up no reader and retains no connection
+func (handle *FileHandle) useRangeRead() bool {
+	if !handle.fs.config.DeferPrefetch || !handle.openMode.IsReadOnly() || handle.fs.config.SharedReadHandle || handle.fs.config.VerifyChecksum {
+		return false
 	}
 
-	logger := log.WithFields(log.Fields{
-		"package":  "irodsfs",
-		"struct":   "FileHandle",
-		"function": "Write",
-	})
-
-	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
 
-	err := handle.initLazy()
-	if err != nil {
-		logger.Errorf("%+v", err)
-		return 0, syscall.EREMOTEIO
+	if handle.iRODSFileHandle != nil || handle.rangeReadServed {
+		return false
 	}
 
-	size := len(data)
-
-	logger.Debugf("Calling Write - %q, %d Offset, %d Bytes", handle.file.path, offset, size)
-	defer logger.Debugf("Called Write - %q, %d Offset, %d Bytes", handle.file.path, offset, size)
+	handle.rangeReadServed = true
+	return true
+}
 
-	if handle.iRODSFileHandle == nil {
-		logger.Errorf("failed to get a file handle - %q", handle.file.path)
-		return 0, syscall.EBADFD
+// useBundleRead checks if reads of the handle are served from a file extracted from a bundle of the collection
+// the bundle cache is asked at the first read of a read-only handle not opened on iRODS yet
+func (handle *FileHandle) useBundleRead(ctx context.Context) bool {
+	if handle.fs.bundleCache == nil || !handle.openMode.IsReadOnly() || handle.fs.config.VerifyChecksum {
+		return false
 	}
 
-	if !handle.openMode.IsWrite() {
-		logger.Errorf("failed to write file opened with readonly mode - %q", handle.file.path)
-		return 0, syscall.EBADFD
+	handle.mutex.Lock()
+	if handle.bundleFile != nil {
+		handle.mutex.Unlock()
+		return true
 	}
 
-	if handle.writer == nil {
-		logger.Errorf("failed to write file opened with readonly mode - %q", handle.file.path)
-		return 0, syscall.EBADFD
+	if handle.iRODSFileHandle != nil || handle.bundleChecked {
+		handle.mutex.Unlock()
+		return false
 	}
 
-	if size == 0 {
-		return 0, fusefs.OK
-	}
+	handle.bundleChecked = true
+	handle.mutex.Unlock()
 
-	if offset < 0 {
-		return 0, syscall.EBADFD
+	// this may wait for the collection being bundled
+	localPath, ok := handle.fs.bundleCache.GetFile(ctx, handle.path)
+	if !ok {
+		return false
 	}
 
-	writeLen, err := handle.writer.WriteAt(data, offset)
+	bundleFile, err := os.Open(localPath)
 	if err != nil {
-		logger.Errorf("%+v", err)
-		return 0, syscall.EREMOTEIO
+		// the bundle may be removed on expiry
+		return false
 	}
 
-	return uint32(writeLen), fusefs.OK
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	handle.bundleFile = bundleFile
+	return true
 }
 
-// Truncate truncates file content
-func (handle *FileHandle) Truncate(ctx context.Context, size uint64) syscall.Errno {
-	if handle.fs.terminated {
-		return syscall.ECONNABORTED
-	}
+// readRange reads data through an iRODS file handle opened for the read only
+func (handle *FileHandle) readRange(ctx context.Context, dest []byte, offset int64) (int, error) {
+	readLen := 0
+	err := irodsRetry(ctx, handle.fs, handle.path, true, func() error {
+		irodsHandle, err := handle.fs.openDataFile(handle.path, handle.openMode)
+		if err != nil {
+			return err
+		}
+		defer irodsHandle.Close()
 
-	logger := log.WithFields(log.Fields{
-		"package":  "irodsfs",
-		"struct":   "FileHandle",
-		"function": "Truncate",
-	})
+		if reportClient := handle.fs.getAccessReportClient(handle.openMode); reportClient != nil {
+			reportClient.StartFileAccess(irodsHandle)
+			defer reportClient.DoneFileAccess(irodsHandle)
+		}
 
-	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+		if offset > irodsHandle.GetEntry().Size {
+			readLen = 0
+			return nil
+		}
 
-	err := handle.initLazy()
+		readLen, err = irodsHandle.ReadAt(dest, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		logger.Errorf("%+v", err)
-		return syscall.EREMOTEIO
+		return 0, err
 	}
 
-	logger.Infof("Calling Truncate - %q, %d Bytes", handle.file.path, size)
-	defer logger.Infof("Called Truncate - %q, %d Bytes", handle.file.path, size)
+	return readLen, nil
+}
 
-	if handle.iRODSFileHandle == nil {
-		logger.Errorf("failed to get a file handle - %q", handle.file.path)
-		return syscall.EBADFD
-	}
+// verifyChecksum verifies checksum of data read sequentially from the beginning of the file
+func (handle *FileHandle) verifyChecksum(data []byte, offset int64) error {
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
 
-	if !handle.openMode.IsWrite() {
-		logger.Errorf("failed to truncate file opened with readonly mode - %q", handle.file.path)
-		return syscall.EBADFD
+	if handle.modified {
+		// checksum in iRODS is of old content
+		return nil
 	}
 
-	err = handle.iRODSFileHandle.Truncate(int64(size))
-	if err != nil {
-		logger.Errorf("%+v", err)
-		return syscall.EREMOTEIO
+	if handle.checksumVerifier == nil {
+		if offset != 0 {
+			return nil
+		}
+
+		handle.checksumVerifier = NewChecksumVerifier(handle.iRODSFileHandle.GetEntry())
 	}
 
-	return fusefs.OK
+	return handle.checksumVerifier.Update(data, offset)
 }
 
-// Flush flushes content changes
-func (handle *FileHandle) Flush(ctx context.Context) syscall.Errno {
-	if handle.fs.terminated {
-		return syscall.ECONNABORTED
-	}
+// setPendingModifyTime sets the modify time to persist after closing
+func (handle *FileHandle) setPendingModifyTime(modifyTime time.Time) {
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
 
-	logger := log.WithFields(log.Fields{
-		"package":  "irodsfs",
-		"struct":   "FileHandle",
-		"function": "Flush",
-	})
+	handle.pendingModifyTime = modifyTime
+}
 
-	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+// isReopenable checks if the file handle can be reopened on a new session
+// only read-only handles are reopened, as data being written through the old session may be lost
+func (handle *FileHandle) isReopenable() bool {
+	return handle.fs.config.ReconnectMaxRetries > 0 && handle.openMode.IsReadOnly() && handle.sharedReadHandle == nil
+}
 
-	handle.mutex.Lock()
-	if handle.iRODSFileHandle == nil {
-		// do nothing
-		handle.mutex.Unlock()
-		return fusefs.OK
+// reopen reconnects the session and reopens the iRODS file handle with a new reader
+// generation is the session generation seen before the failure
+func (handle *FileHandle) reopen(generation uint64) error {
+	err := handle.fs.reconnectSession(generation)
+	if err != nil {
+		return err
 	}
-	handle.mutex.Unlock()
 
-	logger.Debugf("Calling Flush - %q", handle.file.path)
+	iRODSFileHandle, err := handle.fs.openDataFile(handle.path, handle.openMode)
+	if err != nil {
+		return xerrors.Errorf("failed to reopen %q: %w", handle.path, err)
+	}
+
+	handle.readerMutex.Lock()
+	defer handle.readerMutex.Unlock()
+
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	oldReader := handle.reader
+	oldWriter := handle.writer
+	oldIRODSFileHandle := handle.iRODSFileHandle
+
+	handle.iRODSFileHandle = iRODSFileHandle
+	handle.prefetchWindow = 0
+	handle.sequentialReads = 0
+	handle.sequentialBytes = 0
+
+	err = handle.initReaderWriter()
+	if err != nil {
+		handle.iRODSFileHandle = oldIRODSFileHandle
+		handle.reader = oldReader
+		handle.writer = oldWriter
+		iRODSFileHandle.Close()
+		return err
+	}
+
+	oldReader.Release()
+	oldWriter.Release()
+
+	// the old session is gone
+	oldIRODSFileHandle.Close()
+	return nil
+}
+
+// adjustPrefetch adapts prefetching to the access pattern detected from read offsets
+// with cancel_prefetch_on_seek, it cancels prefetching when the read seeks away from data prefetched, and resumes it when reads become sequential again
+// with adaptive_prefetch, it grows the prefetch window on sequential reads, and shrinks it back to the initial on seeks
+func (handle *FileHandle) adjustPrefetch(offset int64, size int) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "adjustPrefetch",
+	})
+
+	handle.readerMutex.Lock()
+	defer handle.readerMutex.Unlock()
+
+	// the kernel may issue read-ahead requests slightly out of order
+	tolerance := int64(handle.fs.config.ReadAheadMax)
+	seek := handle.readOffsetNext > 0 && (offset < handle.readOffsetNext-tolerance || offset > handle.readOffsetNext+int64(handle.fs.config.IOBlockSize))
+	handle.readOffsetNext = offset + int64(size)
+
+	windowInitial := handle.fs.config.GetReadAhead(handle.path)
+
+	if seek {
+		handle.sequentialReads = 0
+		handle.sequentialBytes = 0
+
+		if !handle.prefetching {
+			return
+		}
+
+		if handle.fs.config.CancelPrefetchOnSeek {
+			logger.Debugf("cancel prefetching %q on seek to %d", handle.path, offset)
+
+			// data being prefetched is not needed anymore, release stops transfers and waits for them in background
+			prefetchingReader := handle.reader
+			handle.fs.runAsync(prefetchingReader.Release)
+
+			handle.reader = newNonPrefetchingReader(handle.fs, handle.iRODSFileHandle)
+			handle.prefetching = false
+			handle.prefetchWindow = 0
+			return
+		}
+
+		if handle.fs.config.AdaptivePrefetch && handle.prefetchWindow > windowInitial {
+			logger.Debugf("shrink prefetch window of %q to %d on seek to %d", handle.path, windowInitial, offset)
+
+			err := handle.setPrefetchWindow(windowInitial)
+			if err != nil {
+				logger.Errorf("%+v", err)
+			}
+		}
+		return
+	}
+
+	if handle.prefetching {
+		windowMax := handle.fs.config.GetPrefetchWindowMax()
+		if !handle.fs.config.AdaptivePrefetch || handle.prefetchWindow == 0 || handle.prefetchWindow >= windowMax {
+			return
+		}
+
+		handle.sequentialBytes += int64(size)
+		if handle.sequentialBytes < int64(handle.prefetchWindow)*prefetchWindowGrowthWindows {
+			return
+		}
+
+		window := handle.prefetchWindow * 2
+		if window > windowMax {
+			window = windowMax
+		}
+
+		logger.Debugf("grow prefetch window of %q to %d at %d", handle.path, window, offset)
+
+		err := handle.setPrefetchWindow(window)
+		if err != nil {
+			logger.Errorf("%+v", err)
+		}
+		return
+	}
+
+	if !handle.fs.config.CancelPrefetchOnSeek || windowInitial == 0 || handle.fs.config.GetIOHint(handle.path) == commons.IOHintRandom {
+		return
+	}
+
+	handle.sequentialReads++
+	if handle.sequentialReads < prefetchResumeReads {
+		return
+	}
+
+	logger.Debugf("resume prefetching %q at %d", handle.path, offset)
+
+	err := handle.setPrefetchWindow(windowInitial)
+	if err != nil {
+		logger.Errorf("%+v", err)
+	}
+}
+
+// setPrefetchWindow replaces the reader with a prefetching reader of the window, caller must hold readerMutex
+func (handle *FileHandle) setPrefetchWindow(window int) error {
+	prefetchingReader, err := newPrefetchingReader(handle.fs, handle.iRODSFileHandle, window)
+	if err != nil {
+		return err
+	}
+
+	oldReader := handle.reader
+	if handle.prefetching && window > handle.prefetchWindow {
+		// data prefetched in the old window is read before the new window
+		handle.reader = NewHandoverReader(prefetchingReader, oldReader, handle.fs.runAsync)
+	} else {
+		// data being prefetched in the old window is discarded, release stops transfers and waits for them in background
+		handle.fs.runAsync(oldReader.Release)
+		handle.reader = prefetchingReader
+	}
+
+	handle.prefetching = true
+	handle.prefetchWindow = window
+	handle.sequentialBytes = 0
+	return nil
+}
+
+// Write writes file content
+func (handle *FileHandle) Write(ctx context.Context, data []byte, offset int64) (written uint32, errno syscall.Errno) {
+	defer handle.fs.metrics.ObserveOperation("Write", time.Now(), &errno)
+	if handle.fs.terminated {
+		return 0, handle.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "Write",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	if handle.isBroken() {
+		logger.Errorf("failed to use a file handle lost by failing commit - %q", handle.file.path)
+		return 0, syscall.EIO
+	}
+
+	err := handle.initLazy(ctx)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	size := len(data)
+
+	logger.Debugf("Calling Write - %q, %d Offset, %d Bytes", handle.file.path, offset, size)
+	defer logger.Debugf("Called Write - %q, %d Offset, %d Bytes", handle.file.path, offset, size)
+
+	if handle.iRODSFileHandle == nil {
+		logger.Errorf("failed to get a file handle - %q", handle.file.path)
+		return 0, syscall.EBADFD
+	}
+
+	if !handle.isWritable() {
+		if !handle.fs.config.UpgradeReadOnlyHandleOnWrite {
+			logger.Errorf("failed to write file opened with readonly mode - %q", handle.file.path)
+			return 0, syscall.EBADFD
+		}
+
+		errno := handle.upgradeToWrite(ctx)
+		if errno != fusefs.OK {
+			return 0, errno
+		}
+	}
+
+	if handle.writer == nil {
+		logger.Errorf("failed to write file opened with readonly mode - %q", handle.file.path)
+		return 0, syscall.EBADFD
+	}
+
+	if size == 0 {
+		return 0, fusefs.OK
+	}
+
+	if offset < 0 {
+		return 0, syscall.EBADFD
+	}
+
+	if handle.isAppendMode() {
+		// appending writes always land at the end of the file, ignore the offset given
+		// appends to other files are not serialized with this
+		unlock := handle.fs.appendLocks.Lock(handle.path)
+		defer unlock()
+
+		eof, err := handle.getEOF(ctx)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return 0, syscall.EREMOTEIO
+		}
+
+		logger.Debugf("append to %q at %d, requested offset %d", handle.file.path, eof, offset)
+		offset = eof
+	}
+
+	if !handle.fs.writeBandwidthLimiter.Wait(ctx, size) {
+		return 0, syscall.EINTR
+	}
+
+	if !handle.fs.getUserBandwidthLimiter(handle.uid).Wait(ctx, size) {
+		return 0, syscall.EINTR
+	}
+
+	// writes are not retried, data may be written partially before the failure
+	handle.readerMutex.RLock()
+	writeLen, err := handle.writer.WriteAt(data, offset)
+	handle.readerMutex.RUnlock()
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	handle.setModified(offset+int64(writeLen), false)
+	handle.fs.metrics.AddBytesWritten(writeLen)
+	atomic.AddUint64(&handle.bytesWritten, uint64(writeLen))
+
+	if handle.fs.config.AuditClientProcess {
+		handle.auditClientProcess(ctx)
+	}
+
+	return uint32(writeLen), fusefs.OK
+}
+
+// auditClientProcess records the local process writing the file in AVU, once per handle
+func (handle *FileHandle) auditClientProcess(ctx context.Context) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "auditClientProcess",
+	})
+
+	handle.mutex.Lock()
+	if handle.clientProcessAudited {
+		handle.mutex.Unlock()
+		return
+	}
+	handle.clientProcessAudited = true
+	handle.mutex.Unlock()
+
+	uid, _ := getCallerUID(ctx)
+	pid, comm, ok := getCallerProcess(ctx)
+	if !ok {
+		return
+	}
+
+	value := fmt.Sprintf("pid=%d,uid=%d,comm=%s", pid, uid, comm)
+	fsClient, done := handle.fs.acquireFSClient()
+	defer done()
+
+	err := fsClient.SetXattr(handle.path, ClientProcessXattrName, value)
+	if err != nil {
+		logger.Errorf("%+v", err)
+	}
+}
+
+// isWritable checks if the file handle is opened for writing, or upgraded to
+func (handle *FileHandle) isWritable() bool {
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	return handle.openMode.IsWrite()
+}
+
+// upgradeToWrite reopens the file opened with readonly mode in read-write mode
+// this is for applications writing to a file they opened with readonly mode
+func (handle *FileHandle) upgradeToWrite(ctx context.Context) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "upgradeToWrite",
+	})
+
+	ctx, cancel := withRetryBudget(ctx, handle.fs)
+	defer cancel()
+
+	vpathEntry := handle.fs.vpathManager.GetClosestEntry(handle.file.path)
+	if vpathEntry == nil {
+		logger.Errorf("failed to get VPath Entry for %q", handle.file.path)
+		return syscall.EREMOTEIO
+	}
+
+	if vpathEntry.ReadOnly {
+		logger.Errorf("failed to upgrade a file handle of read-only vpath mapping entry %q", vpathEntry.Path)
+		return syscall.EACCES
+	}
+
+	entry, err := IRODSStat(ctx, handle.fs, handle.path)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	// the mode mask does not take away permissions granted on iRODS
+	if irodsGetACLMode(ctx, handle.fs, entry, false)&0o200 == 0 {
+		logger.Errorf("failed to upgrade a file handle for %q, no permission to modify", handle.path)
+		return syscall.EACCES
+	}
+
+	// wait for reads and writes in flight, the reader and writer are released below
+	handle.readerMutex.Lock()
+	defer handle.readerMutex.Unlock()
+
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	if handle.openMode.IsWrite() {
+		// upgraded by other write
+		return fusefs.OK
+	}
+
+	logger.Infof("Upgrade a file handle for %q from mode %q to %q", handle.path, handle.openMode, irodsclient_types.FileOpenModeReadWrite)
+
+	fsClient, done := handle.fs.acquireFSClient()
+	defer done()
+
+	irodsHandle, err := fsClient.OpenFile(handle.path, "", string(irodsclient_types.FileOpenModeReadWrite))
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	// release the readonly handle
+	if handle.sharedReadHandle != nil {
+		handle.fs.sharedReadHandleMap.Release(handle.fs, handle.sharedReadHandle)
+		handle.sharedReadHandle = nil
+	} else {
+		handle.reader.Release()
+		handle.writer.Release()
+
+		if reportClient := handle.fs.getAccessReportClient(handle.iRODSFileHandle.GetOpenMode()); reportClient != nil {
+			err = reportClient.DoneFileAccess(handle.iRODSFileHandle)
+			if err != nil {
+				logger.Errorf("%+v", err)
+			}
+		}
+
+		err = handle.iRODSFileHandle.Close()
+		if err != nil {
+			logger.Errorf("%+v", err)
+		}
+	}
+
+	if reportClient := handle.fs.getAccessReportClient(irodsclient_types.FileOpenModeReadWrite); reportClient != nil {
+		reportClient.StartFileAccess(irodsHandle)
+	}
+
+	handle.openMode = irodsclient_types.FileOpenModeReadWrite
+	handle.iRODSFileHandle = irodsHandle
+
+	err = handle.initReaderWriter()
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	return fusefs.OK
+}
+
+// Truncate truncates file content
+func (handle *FileHandle) Truncate(ctx context.Context, size uint64) syscall.Errno {
+	if handle.fs.terminated {
+		return handle.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "Truncate",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	if handle.isBroken() {
+		logger.Errorf("failed to use a file handle lost by failing commit - %q", handle.file.path)
+		return syscall.EIO
+	}
+
+	err := handle.initLazy(ctx)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	logger.Infof("Calling Truncate - %q, %d Bytes", handle.file.path, size)
+	defer logger.Infof("Called Truncate - %q, %d Bytes", handle.file.path, size)
+
+	if handle.iRODSFileHandle == nil {
+		logger.Errorf("failed to get a file handle - %q", handle.file.path)
+		return syscall.EBADFD
+	}
+
+	if !handle.openMode.IsWrite() {
+		logger.Errorf("failed to truncate file opened with readonly mode - %q", handle.file.path)
+		return syscall.EBADFD
+	}
+
+	// commit of fsync_durable and upgrading read-only handles replace the iRODS file handle
+	handle.readerMutex.RLock()
+	err = handle.iRODSFileHandle.Truncate(int64(size))
+	handle.readerMutex.RUnlock()
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	handle.setModified(int64(size), true)
+
+	// other handles must not append beyond the truncated size
+	for _, otherHandle := range handle.fs.fileHandleMap.ListByPath(handle.path) {
+		if otherHandle != handle {
+			otherHandle.resetModifiedSize(int64(size))
+		}
+	}
+
+	return fusefs.OK
+}
+
+// Flush flushes content changes
+func (handle *FileHandle) Flush(ctx context.Context) (errno syscall.Errno) {
+	defer handle.fs.metrics.ObserveOperation("Flush", time.Now(), &errno)
+	if handle.fs.terminated {
+		return handle.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "Flush",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	if handle.isBroken() {
+		logger.Errorf("failed to use a file handle lost by failing commit - %q", handle.file.path)
+		return syscall.EIO
+	}
+
+	handle.mutex.Lock()
+	if handle.iRODSFileHandle == nil {
+		// do nothing
+		handle.mutex.Unlock()
+		return fusefs.OK
+	}
+	handle.mutex.Unlock()
+
+	logger.Debugf("Calling Flush - %q", handle.file.path)
 	defer logger.Debugf("Called Flush - %q", handle.file.path)
 
 	if handle.iRODSFileHandle == nil {
@@ -414,22 +1319,27 @@ func (handle *FileHandle) Flush(ctx context.Context) syscall.Errno {
 		return syscall.EREMOTEIO
 	}
 
+	// commit of fsync_durable and upgrading read-only handles replace the writer
+	handle.readerMutex.RLock()
 	if handle.writer != nil {
 		// Flush
 		err := handle.writer.Flush()
 		if err != nil {
+			handle.readerMutex.RUnlock()
 			logger.Errorf("%+v", err)
 			return syscall.EREMOTEIO
 		}
 	}
+	handle.readerMutex.RUnlock()
 
 	return fusefs.OK
 }
 
 // Fsync flushes content changes
-func (handle *FileHandle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+func (handle *FileHandle) Fsync(ctx context.Context, flags uint32) (errno syscall.Errno) {
+	defer handle.fs.metrics.ObserveOperation("Fsync", time.Now(), &errno)
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -438,40 +1348,310 @@ func (handle *FileHandle) Fsync(ctx context.Context, flags uint32) syscall.Errno
 		"function": "Fsync",
 	})
 
-	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	if handle.isBroken() {
+		logger.Errorf("failed to use a file handle lost by failing commit - %q", handle.file.path)
+		return syscall.EIO
+	}
+
+	handle.mutex.Lock()
+	if handle.iRODSFileHandle == nil {
+		// do nothing
+		handle.mutex.Unlock()
+		return fusefs.OK
+	}
+	handle.mutex.Unlock()
+
+	logger.Debugf("Calling Fsync - %q", handle.file.path)
+	defer logger.Debugf("Called Fsync - %q", handle.file.path)
+
+	if handle.iRODSFileHandle == nil {
+		logger.Errorf("failed to get a file handle - %q", handle.file.path)
+		return syscall.EREMOTEIO
+	}
+
+	// commit of fsync_durable and upgrading read-only handles replace the writer
+	handle.readerMutex.RLock()
+	if handle.writer != nil {
+		// Flush
+		err := handle.writer.Flush()
+		if err != nil {
+			handle.readerMutex.RUnlock()
+			logger.Errorf("%+v", err)
+			return syscall.EREMOTEIO
+		}
+	}
+	handle.readerMutex.RUnlock()
+
+	if handle.fs.config.FsyncDurable && handle.openMode.IsWrite() {
+		err := handle.commit(ctx, flags&fsyncFlagDataSync != 0)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return syscall.EREMOTEIO
+		}
+	}
+
+	return fusefs.OK
+}
+
+// commit closes and reopens the iRODS file handle, so data written is committed on the resource
+// iRODS finalizes the replica, e.g., its size, on close, as it has no sync for open data objects
+// datasync skips persisting the modify time set while open
+func (handle *FileHandle) commit(ctx context.Context, datasync bool) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "commit",
+	})
+
+	// wait for reads and writes in flight, the reader and writer are released below
+	handle.readerMutex.Lock()
+	defer handle.readerMutex.Unlock()
+
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	logger.Infof("Commit file %q", handle.path)
+
+	// wait until all queued tasks complete
+	handle.reader.Release()
+	handle.writer.Release()
+
+	// the reader and writer are released, so the handle is broken if it is not reopened
+	writeErr := handle.writer.GetError()
+
+	if reportClient := handle.fs.getAccessReportClient(handle.iRODSFileHandle.GetOpenMode()); reportClient != nil {
+		err := reportClient.DoneFileAccess(handle.iRODSFileHandle)
+		if err != nil {
+			logger.Errorf("%+v", err)
+		}
+	}
+
+	closeErr := handle.iRODSFileHandle.Close()
+
+	if writeErr != nil {
+		handle.broken = true
+		return xerrors.Errorf("failed to write %q: %w", handle.path, writeErr)
+	}
+
+	if closeErr != nil {
+		handle.broken = true
+		return xerrors.Errorf("failed to close %q: %w", handle.path, closeErr)
+	}
+
+	err := handle.reopenClosed(ctx)
+	if err != nil {
+		return err
+	}
+
+	handle.fs.invalidateDirAttrCache(handle.path)
+
+	if !datasync && !handle.pendingModifyTime.IsZero() {
+		// closing updates iRODS modify time
+		IRODSSetModifyTime(ctx, handle.fs, handle.path, handle.pendingModifyTime)
+	}
+
+	if handle.modified && handle.fs.changePoller != nil {
+		// written by ourselves, not a change to notify
+		handle.fs.changePoller.ResetBaseline(handle.path)
+	}
+
+	return nil
+}
+
+// reopenClosed reopens the iRODS file handle closed, with the reader and writer released, caller must hold the mutex
+// the handle is broken if it is not reopened
+func (handle *FileHandle) reopenClosed(ctx context.Context) error {
+	// reopening must not truncate the file
+	reopenMode := handle.iRODSFileHandle.GetOpenMode()
+	if reopenMode == irodsclient_types.FileOpenModeWriteOnly || reopenMode == irodsclient_types.FileOpenModeWriteTruncate {
+		reopenMode = irodsclient_types.FileOpenModeReadWrite
+	}
+
+	var irodsHandle irodsfscommon_irods.IRODSFSFileHandle
+	err := irodsRetry(ctx, handle.fs, handle.path, true, func() error {
+		var openErr error
+		irodsHandle, openErr = handle.fs.openDataFile(handle.path, reopenMode)
+		return openErr
+	})
+	if err != nil {
+		handle.broken = true
+		return xerrors.Errorf("failed to reopen %q: %w", handle.path, err)
+	}
+
+	if reportClient := handle.fs.getAccessReportClient(reopenMode); reportClient != nil {
+		reportClient.StartFileAccess(irodsHandle)
+	}
+
+	handle.iRODSFileHandle = irodsHandle
+
+	err = handle.initReaderWriter()
+	if err != nil {
+		handle.broken = true
+		irodsHandle.Close()
+		return err
+	}
+
+	return nil
+}
+
+// CopyFileRange copies the whole file to the empty file of the out handle through a server-side copy of iRODS
+// other copies, e.g., partial ranges, return ENOTSUP, so the kernel falls back to copying bytes through reads and writes
+func (handle *FileHandle) CopyFileRange(ctx context.Context, offIn uint64, out *FileHandle, offOut uint64, length uint64) (copied uint32, errno syscall.Errno) {
+	defer handle.fs.metrics.ObserveOperation("CopyFileRange", time.Now(), &errno)
+	if handle.fs.terminated {
+		return 0, handle.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "CopyFileRange",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	logger.Infof("Calling CopyFileRange - %q to %q, %d bytes", handle.path, out.path, length)
+	defer logger.Infof("Called CopyFileRange - %q to %q, %d bytes", handle.path, out.path, length)
+
+	if handle.isBroken() || out.isBroken() {
+		logger.Errorf("failed to use a file handle lost by failing commit - %q to %q", handle.path, out.path)
+		return 0, syscall.EIO
+	}
+
+	if !handle.openMode.IsRead() || !out.openMode.IsWrite() {
+		return 0, syscall.EBADF
+	}
+
+	// a server-side copy replaces the whole data object
+	if offIn != 0 || offOut != 0 || handle.path == out.path {
+		return 0, syscall.ENOTSUP
+	}
+
+	fsClient, done := handle.fs.acquireFSClient()
+	supported := isCopySupported(fsClient)
+	done()
+
+	if !supported {
+		logger.Debugf("failed to copy %q on the server, the fs client cannot copy data objects", handle.path)
+		return 0, syscall.ENOTSUP
+	}
+
+	// a server-side copy is placed on the default resource of the server, not on the default resource of the collection
+	if handle.fs.config.CollectionDefaultResource && len(IRODSGetDefaultResource(ctx, handle.fs, irodsfs_common_utils.GetDirname(out.path))) > 0 {
+		return 0, syscall.ENOTSUP
+	}
+
+	// the server does not see data written but not flushed yet
+	for _, path := range []string{handle.path, out.path} {
+		for _, otherHandle := range handle.fs.fileHandleMap.ListByPath(path) {
+			if _, modified := otherHandle.getModifiedSize(); modified {
+				return 0, syscall.ENOTSUP
+			}
+		}
+	}
+
+	srcEntry, err := irodsStatUncached(ctx, handle.fs, handle.path)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	if srcEntry.Size == 0 {
+		return 0, fusefs.OK
+	}
+
+	if uint64(srcEntry.Size) > length {
+		// partial copy
+		return 0, syscall.ENOTSUP
+	}
+
+	destEntry, err := irodsStatUncached(ctx, handle.fs, out.path)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	if destEntry.Size != 0 {
+		return 0, syscall.ENOTSUP
+	}
+
+	errno = out.replaceWithCopy(ctx, handle.path)
+	if errno != fusefs.OK {
+		return 0, errno
+	}
+
+	return uint32(srcEntry.Size), fusefs.OK
+}
+
+// replaceWithCopy replaces content of the file with a copy of the source on the server
+// the iRODS file handle is closed while copying, as the server does not overwrite data objects open, and reopened after
+func (handle *FileHandle) replaceWithCopy(ctx context.Context, srcPath string) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "replaceWithCopy",
+	})
+
+	// wait for reads and writes in flight, the reader and writer are released below
+	handle.readerMutex.Lock()
+	defer handle.readerMutex.Unlock()
+
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	opened := handle.iRODSFileHandle != nil
+	if opened {
+		handle.reader.Release()
+		handle.writer.Release()
+
+		if reportClient := handle.fs.getAccessReportClient(handle.iRODSFileHandle.GetOpenMode()); reportClient != nil {
+			err := reportClient.DoneFileAccess(handle.iRODSFileHandle)
+			if err != nil {
+				logger.Errorf("%+v", err)
+			}
+		}
 
-	handle.mutex.Lock()
-	if handle.iRODSFileHandle == nil {
-		// do nothing
-		handle.mutex.Unlock()
-		return fusefs.OK
+		err := handle.iRODSFileHandle.Close()
+		if err != nil {
+			handle.broken = true
+			logger.Errorf("failed to close %q - %+v", handle.path, err)
+			return syscall.EREMOTEIO
+		}
 	}
-	handle.mutex.Unlock()
 
-	logger.Debugf("Calling Fsync - %q", handle.file.path)
-	defer logger.Debugf("Called Fsync - %q", handle.file.path)
-
-	if handle.iRODSFileHandle == nil {
-		logger.Errorf("failed to get a file handle - %q", handle.file.path)
-		return syscall.EREMOTEIO
+	errno := IRODSCopyFile(ctx, handle.fs, srcPath, handle.path)
+	if errno == fusefs.OK && handle.fs.config.ChmodACL {
+		// the data is copied already, a mode not carried is not an error of the copy
+		if modeErrno := IRODSCopyMode(ctx, handle.fs, srcPath, handle.path); modeErrno != fusefs.OK {
+			logger.Debugf("failed to carry the mode of %q to %q, errno %v", srcPath, handle.path, modeErrno)
+		}
 	}
 
-	if handle.writer != nil {
-		// Flush
-		err := handle.writer.Flush()
+	if opened {
+		err := handle.reopenClosed(ctx)
 		if err != nil {
 			logger.Errorf("%+v", err)
-			return syscall.EREMOTEIO
+			if errno == fusefs.OK {
+				errno = syscall.EIO
+			}
 		}
 	}
 
-	return fusefs.OK
+	if errno == fusefs.OK && handle.fs.changePoller != nil {
+		// written by ourselves, not a change to notify
+		handle.fs.changePoller.ResetBaseline(handle.path)
+	}
+
+	return errno
 }
 
 // Release closes file handle
-func (handle *FileHandle) Release(ctx context.Context) syscall.Errno {
+func (handle *FileHandle) Release(ctx context.Context) (errno syscall.Errno) {
+	defer handle.fs.metrics.ObserveOperation("Release", time.Now(), &errno)
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -482,7 +1662,17 @@ func (handle *FileHandle) Release(ctx context.Context) syscall.Errno {
 
 	defer irodsfs_common_utils.StackTraceFromPanic(logger)
 
+	// locks are released when the file handle is closed, even if it is not opened on iRODS
+	localLockManager, releaseLocalLockManager := handle.fs.localLockManagers.Acquire(handle.path)
+	localLockManager.UnlockHandle(handle.id)
+	releaseLocalLockManager()
+
 	handle.mutex.Lock()
+	if handle.bundleFile != nil {
+		handle.bundleFile.Close()
+		handle.bundleFile = nil
+	}
+
 	if handle.iRODSFileHandle == nil {
 		// do nothing
 
@@ -492,6 +1682,15 @@ func (handle *FileHandle) Release(ctx context.Context) syscall.Errno {
 		handle.mutex.Unlock()
 		return fusefs.OK
 	}
+
+	if handle.broken {
+		// commit closed the iRODS file handle, and released the reader and writer
+		handle.fs.fileHandleMap.Remove(handle.GetID())
+		handle.mutex.Unlock()
+
+		handle.remoteFileLockManager.ReleaseAll()
+		return fusefs.OK
+	}
 	handle.mutex.Unlock()
 
 	logger.Infof("Calling Release - %q", handle.file.path)
@@ -502,12 +1701,28 @@ func (handle *FileHandle) Release(ctx context.Context) syscall.Errno {
 		return syscall.EREMOTEIO
 	}
 
+	// locks are released when the file handle is closed
+	handle.remoteFileLockManager.ReleaseAll()
+
+	if handle.sharedReadHandle != nil {
+		// remove the handle from file handle map
+		handle.fs.fileHandleMap.Remove(handle.GetID())
+
+		// the shared handle is closed when the last reader releases it
+		handle.fs.sharedReadHandleMap.Release(handle.fs, handle.sharedReadHandle)
+		handle.reader = nil
+		handle.writer = nil
+		return fusefs.OK
+	}
+
+	// errors of the reader and writer are returned after closing the handle, not to leak it
+	releaseErrno := fusefs.OK
 	if handle.reader != nil {
 		handle.reader.Release()
 		err := handle.reader.GetError()
 		if err != nil {
 			logger.Errorf("%+v", err)
-			return syscall.EREMOTEIO
+			releaseErrno = syscall.EREMOTEIO
 		}
 		handle.reader = nil
 	}
@@ -520,7 +1735,7 @@ func (handle *FileHandle) Release(ctx context.Context) syscall.Errno {
 		err := handle.writer.GetError()
 		if err != nil {
 			logger.Errorf("%+v", err)
-			return syscall.EREMOTEIO
+			releaseErrno = syscall.EREMOTEIO
 		}
 		handle.writer = nil
 	}
@@ -535,8 +1750,8 @@ func (handle *FileHandle) Release(ctx context.Context) syscall.Errno {
 		handle.fs.fileHandleMap.Remove(handle.GetID())
 
 		// Report
-		if handle.fs.instanceReportClient != nil {
-			err := handle.fs.instanceReportClient.DoneFileAccess(handle.iRODSFileHandle)
+		if reportClient := handle.fs.getAccessReportClient(handle.iRODSFileHandle.GetOpenMode()); reportClient != nil {
+			err := reportClient.DoneFileAccess(handle.iRODSFileHandle)
 			if err != nil {
 				logger.Errorf("%+v", err)
 			}
@@ -546,22 +1761,56 @@ func (handle *FileHandle) Release(ctx context.Context) syscall.Errno {
 		if err != nil {
 			logger.Errorf("%+v", err)
 		}
+
+		if handle.modified && handle.fs.config.ChecksumOnWrite {
+			// zones may require every data object to have a checksum, compute it once data is closed
+			err = irodsComputeChecksum(context.Background(), handle.fs, handle.path)
+			if err != nil {
+				if handle.fs.config.ChecksumOnWriteStrict {
+					// write handles are closed synchronously, the error is returned
+					logger.Errorf("%+v", err)
+					releaseErrno = syscall.EIO
+				} else {
+					logger.Warnf("failed to compute checksum of %q - %v", handle.path, err)
+				}
+			}
+		}
+
+		if handle.modified && handle.fs.config.TrackLastModifiedBy {
+			// iRODS does not track who modified the file last, record it in AVU
+			fsClient, done := handle.fs.acquireFSClient()
+			err = fsClient.SetXattr(handle.path, LastModifiedByXattrName, handle.fs.config.ClientUser)
+			done()
+			if err != nil {
+				logger.Errorf("%+v", err)
+			}
+		}
+
+		if !handle.pendingModifyTime.IsZero() {
+			// closing updates iRODS modify time
+			IRODSSetModifyTime(context.Background(), handle.fs, handle.path, handle.pendingModifyTime)
+		}
+
+		if handle.modified && handle.fs.changePoller != nil {
+			// written by ourselves, not a change to notify
+			handle.fs.changePoller.ResetBaseline(handle.path)
+		}
 	}
 
 	if handle.openMode.IsReadOnly() {
 		// close it asynchronously
-		go closeFunc()
+		handle.fs.runAsync(closeFunc)
 	} else {
 		closeFunc()
 	}
 
-	return fusefs.OK
+	return releaseErrno
 }
 
 // Getlk returns lock
 func (handle *FileHandle) Getlk(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) syscall.Errno {
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -582,7 +1831,7 @@ func (handle *FileHandle) Getlk(ctx context.Context, owner uint64, lk *fuse.File
 // Setlk locks the file handle
 func (handle *FileHandle) Setlk(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -603,7 +1852,7 @@ func (handle *FileHandle) Setlk(ctx context.Context, owner uint64, lk *fuse.File
 // Setlkw locks the file handle and wait until it acquires the lock
 func (handle *FileHandle) Setlkw(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -623,7 +1872,7 @@ func (handle *FileHandle) Setlkw(ctx context.Context, owner uint64, lk *fuse.Fil
 // GetLocalLock returns local lock
 func (handle *FileHandle) GetLocalLock(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) syscall.Errno {
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -647,7 +1896,10 @@ func (handle *FileHandle) GetLocalLock(ctx context.Context, owner uint64, lk *fu
 		End:      lk.End,
 	}
 
-	lockFound := handle.localFileLockManager.Get(lock.Start, lock.End)
+	localLockManager, releaseLocalLockManager := handle.fs.localLockManagers.Acquire(handle.path)
+	defer releaseLocalLockManager()
+
+	lockFound := localLockManager.Get(&lock)
 	if lockFound != nil {
 		out.Start = lockFound.Start
 		out.End = lockFound.End
@@ -666,7 +1918,7 @@ func (handle *FileHandle) GetLocalLock(ctx context.Context, owner uint64, lk *fu
 // SetLocalLock sets local lock
 func (handle *FileHandle) SetLocalLock(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -685,21 +1937,25 @@ func (handle *FileHandle) SetLocalLock(ctx context.Context, owner uint64, lk *fu
 
 	lock := FileHandleLocalLock{
 		ID:       xid.New().String(),
+		HandleID: handle.id,
 		LockType: lk.Typ,
 		Pid:      lk.Pid,
 		Start:    lk.Start,
 		End:      lk.End,
 	}
 
+	localLockManager, releaseLocalLockManager := handle.fs.localLockManagers.Acquire(handle.path)
+	defer releaseLocalLockManager()
+
 	if lk.Typ == syscall.F_UNLCK {
 		// unlock
-		err := handle.localFileLockManager.Unlock(&lock)
+		err := localLockManager.Unlock(&lock)
 		if err != nil {
 			logger.Errorf("%+v", err)
 			return syscall.ENOENT
 		}
 	} else {
-		err := handle.localFileLockManager.Lock(&lock)
+		err := localLockManager.Lock(&lock)
 		if err != nil {
 			logger.Errorf("%+v", err)
 			return syscall.EAGAIN
@@ -712,7 +1968,7 @@ func (handle *FileHandle) SetLocalLock(ctx context.Context, owner uint64, lk *fu
 // SetLocalLockW sets local lock and wait until it acquires the lock
 func (handle *FileHandle) SetLocalLockW(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
 	if handle.fs.terminated {
-		return syscall.ECONNABORTED
+		return handle.fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -728,13 +1984,298 @@ func (handle *FileHandle) SetLocalLockW(ctx context.Context, owner uint64, lk *f
 
 	logger.Debugf("owner %d, type %d, start %d, end %d, pid %d, flags %d", owner, lk.Typ, lk.Start, lk.End, lk.Pid, flags)
 
-	return syscall.ENOTSUP
+	lock := FileHandleLocalLock{
+		ID:       xid.New().String(),
+		HandleID: handle.id,
+		LockType: lk.Typ,
+		Pid:      lk.Pid,
+		Start:    lk.Start,
+		End:      lk.End,
+	}
+
+	localLockManager, releaseLocalLockManager := handle.fs.localLockManagers.Acquire(handle.path)
+	defer releaseLocalLockManager()
+
+	if lk.Typ == syscall.F_UNLCK {
+		// unlock
+		err := localLockManager.Unlock(&lock)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return syscall.ENOENT
+		}
+		return fusefs.OK
+	}
+
+	err := localLockManager.LockW(ctx, &lock)
+	if err != nil {
+		// the process waiting is interrupted
+		logger.Debugf("%+v", err)
+		return syscall.EINTR
+	}
+
+	return fusefs.OK
+}
+
+// GetRemoteLock returns lock shared via iRODS
+func (handle *FileHandle) GetRemoteLock(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) syscall.Errno {
+	if handle.fs.terminated {
+		return handle.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "GetRemoteLock",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	operID := handle.fs.GetNextOperationID()
+	logger.Infof("Calling GetRemoteLock (%d) - %q", operID, handle.file.path)
+	defer logger.Infof("Called GetRemoteLock (%d) - %q", operID, handle.file.path)
+
+	logger.Debugf("owner %d, type %d, start %d, end %d, pid %d, flags %d", owner, lk.Typ, lk.Start, lk.End, lk.Pid, flags)
+
+	lock := FileHandleRemoteLock{
+		Owner:    handle.fs.config.InstanceID,
+		LockType: lk.Typ,
+		Pid:      lk.Pid,
+		Start:    lk.Start,
+		End:      lk.End,
+	}
+
+	lockFound, err := handle.remoteFileLockManager.Get(&lock)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	if lockFound != nil {
+		out.Start = lockFound.Start
+		out.End = lockFound.End
+		out.Pid = lockFound.Pid
+		out.Typ = lockFound.LockType
+		return fusefs.OK
+	}
+
+	out.Start = lk.Start
+	out.End = lk.End
+	out.Pid = lk.Pid
+	out.Typ = syscall.F_UNLCK
+	return fusefs.OK
+}
+
+// SetRemoteLock sets lock shared via iRODS
+func (handle *FileHandle) SetRemoteLock(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
+	if handle.fs.terminated {
+		return handle.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "SetRemoteLock",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	operID := handle.fs.GetNextOperationID()
+	logger.Infof("Calling SetRemoteLock (%d) - %q", operID, handle.file.path)
+	defer logger.Infof("Called SetRemoteLock (%d) - %q", operID, handle.file.path)
+
+	logger.Debugf("owner %d, type %d, start %d, end %d, pid %d, flags %d", owner, lk.Typ, lk.Start, lk.End, lk.Pid, flags)
+
+	return handle.setRemoteLock(lk)
+}
+
+// SetRemoteLockW sets lock shared via iRODS and wait until it acquires the lock
+func (handle *FileHandle) SetRemoteLockW(ctx context.Context, owner uint64, lk *fuse.FileLock, flags uint32) syscall.Errno {
+	if handle.fs.terminated {
+		return handle.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "SetRemoteLockW",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	logger.Debugf("Calling SetRemoteLockW - %q", handle.file.path)
+	defer logger.Debugf("Called SetRemoteLockW - %q", handle.file.path)
+
+	logger.Debugf("owner %d, type %d, start %d, end %d, pid %d, flags %d", owner, lk.Typ, lk.Start, lk.End, lk.Pid, flags)
+
+	// other mounts can't notify us when they unlock, poll
+	ticker := time.NewTicker(remoteLockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		errno := handle.setRemoteLock(lk)
+		if errno != syscall.EAGAIN {
+			return errno
+		}
+
+		select {
+		case <-ctx.Done():
+			return syscall.EINTR
+		case <-ticker.C:
+		}
+
+		if handle.fs.terminated {
+			return handle.fs.terminatedErrno
+		}
+	}
+}
+
+func (handle *FileHandle) setRemoteLock(lk *fuse.FileLock) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "setRemoteLock",
+	})
+
+	lock := FileHandleRemoteLock{
+		ID:       xid.New().String(),
+		Owner:    handle.fs.config.InstanceID,
+		LockType: lk.Typ,
+		Pid:      lk.Pid,
+		Start:    lk.Start,
+		End:      lk.End,
+	}
+
+	if lk.Typ == syscall.F_UNLCK {
+		// unlock
+		err := handle.remoteFileLockManager.Unlock(&lock)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return syscall.EREMOTEIO
+		}
+		return fusefs.OK
+	}
+
+	err := handle.remoteFileLockManager.Lock(&lock)
+	if err != nil {
+		if xerrors.Is(err, errRemoteLockConflict) {
+			return syscall.EAGAIN
+		}
+
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	return fusefs.OK
 }
 
-/*
+// Lseek returns the offset to seek to
+// iRODS has no notion of holes, so the whole file is treated as data
 func (handle *FileHandle) Lseek(ctx context.Context, off uint64, whence uint32) (uint64, syscall.Errno) {
+	if handle.fs.terminated {
+		return 0, handle.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "Lseek",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	err := handle.initLazy(ctx)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	logger.Debugf("Calling Lseek - %q, %d Offset, whence %d", handle.file.path, off, whence)
+	defer logger.Debugf("Called Lseek - %q, %d Offset, whence %d", handle.file.path, off, whence)
+
+	if handle.iRODSFileHandle == nil {
+		logger.Errorf("failed to get a file handle - %q", handle.file.path)
+		return 0, syscall.EBADFD
+	}
+
+	size := handle.iRODSFileHandle.GetEntry().Size
+	if modifiedSize, modified := handle.getModifiedSize(); modified {
+		size = modifiedSize
+	}
+
+	switch whence {
+	case io.SeekStart, io.SeekCurrent:
+		// the kernel passes the offset resolved
+		return off, fusefs.OK
+	case io.SeekEnd:
+		// the offset is signed, e.g., -1 for the last byte
+		position := size + int64(off)
+		if position < 0 {
+			return 0, syscall.EINVAL
+		}
+		return uint64(position), fusefs.OK
+	case seekData:
+		if int64(off) < 0 || int64(off) >= size {
+			return 0, syscall.ENXIO
+		}
+		return off, fusefs.OK
+	case seekHole:
+		if int64(off) < 0 || int64(off) >= size {
+			return 0, syscall.ENXIO
+		}
+		// implicit hole at the end of the file
+		return uint64(size), fusefs.OK
+	default:
+		return 0, syscall.EINVAL
+	}
 }
 
+// Allocate preallocates file content
+// iRODS has no preallocation, so the file is extended by truncating up
 func (handle *FileHandle) Allocate(ctx context.Context, off uint64, size uint64, mode uint32) syscall.Errno {
+	if handle.fs.terminated {
+		return handle.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandle",
+		"function": "Allocate",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	err := handle.initLazy(ctx)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	logger.Debugf("Calling Allocate - %q, %d Offset, %d Bytes, mode %d", handle.file.path, off, size, mode)
+	defer logger.Debugf("Called Allocate - %q, %d Offset, %d Bytes, mode %d", handle.file.path, off, size, mode)
+
+	switch mode {
+	case 0:
+		// extend
+	case fallocFlKeepSize:
+		// nothing to allocate without changing the size
+		return fusefs.OK
+	default:
+		return syscall.EOPNOTSUPP
+	}
+
+	if handle.iRODSFileHandle == nil {
+		logger.Errorf("failed to get a file handle - %q", handle.file.path)
+		return syscall.EBADFD
+	}
+
+	currentSize := handle.iRODSFileHandle.GetEntry().Size
+	if modifiedSize, modified := handle.getModifiedSize(); modified {
+		currentSize = modifiedSize
+	}
+
+	if int64(off+size) <= currentSize {
+		return fusefs.OK
+	}
+
+	return handle.Truncate(ctx, off+size)
 }
-*/
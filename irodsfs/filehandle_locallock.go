@@ -1,6 +1,7 @@
 package irodsfs
 
 import (
+	"context"
 	"sync"
 	"syscall"
 
@@ -8,10 +9,68 @@ import (
 	"golang.org/x/xerrors"
 )
 
+// FileHandleLocalLockManagerMap holds FileHandleLocalLockManagers per iRODS path
+// all file handles of a path share the manager, so locks set through a handle conflict with locks of other handles
+type FileHandleLocalLockManagerMap struct {
+	mutex    sync.Mutex
+	managers map[string]*FileHandleLocalLockManager
+}
+
+// NewFileHandleLocalLockManagerMap creates a new FileHandleLocalLockManagerMap
+func NewFileHandleLocalLockManagerMap() *FileHandleLocalLockManagerMap {
+	return &FileHandleLocalLockManagerMap{
+		mutex:    sync.Mutex{},
+		managers: map[string]*FileHandleLocalLockManager{},
+	}
+}
+
+// Acquire returns the manager of the path, release must be called when the manager is no longer used
+// managers are removed when no one uses them and they hold no locks, so the map does not grow with paths locked
+func (managerMap *FileHandleLocalLockManagerMap) Acquire(path string) (*FileHandleLocalLockManager, func()) {
+	managerMap.mutex.Lock()
+	defer managerMap.mutex.Unlock()
+
+	manager, ok := managerMap.managers[path]
+	if !ok {
+		manager = NewFileHandleLocalLockManager()
+		managerMap.managers[path] = manager
+	}
+	manager.refs++
+
+	release := func() {
+		managerMap.mutex.Lock()
+		defer managerMap.mutex.Unlock()
+
+		manager.refs--
+		if manager.refs == 0 && manager.isEmpty() {
+			delete(managerMap.managers, path)
+		}
+	}
+	return manager, release
+}
+
+// List returns copies of locks held, key is iRODS path
+func (managerMap *FileHandleLocalLockManagerMap) List() map[string][]FileHandleLocalLock {
+	managerMap.mutex.Lock()
+	defer managerMap.mutex.Unlock()
+
+	locks := map[string][]FileHandleLocalLock{}
+	for path, manager := range managerMap.managers {
+		pathLocks := manager.List()
+		if len(pathLocks) > 0 {
+			locks[path] = pathLocks
+		}
+	}
+	return locks
+}
+
 // FileHandleLocalLockManager is a manager that manages FileHandleLocalLocks
 type FileHandleLocalLockManager struct {
 	lock            sync.RWMutex
 	fileHandleLocks map[string]*FileHandleLocalLock // key is ID
+	waiters         []*FileHandleLocalLock          // locks waiting to be acquired, in arrival order
+	releaseChan     chan bool                       // closed when locks are released or waiters change
+	refs            int                             // users of the manager, guarded by FileHandleLocalLockManagerMap
 }
 
 // NewFileHandleLocalLockManager creates a new FileHandleLocalLockManager
@@ -19,6 +78,8 @@ func NewFileHandleLocalLockManager() *FileHandleLocalLockManager {
 	return &FileHandleLocalLockManager{
 		lock:            sync.RWMutex{},
 		fileHandleLocks: map[string]*FileHandleLocalLock{},
+		waiters:         []*FileHandleLocalLock{},
+		releaseChan:     make(chan bool),
 	}
 }
 
@@ -50,13 +111,25 @@ func (manager *FileHandleLocalLockManager) combineRange(s1 uint64, e1 uint64, s2
 	return cs, ce
 }
 
-// Get returns lock
-func (manager *FileHandleLocalLockManager) Get(start uint64, end uint64) *FileHandleLocalLock {
+// isEmpty checks if no lock is held or waited for
+func (manager *FileHandleLocalLockManager) isEmpty() bool {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
+	return len(manager.fileHandleLocks) == 0 && len(manager.waiters) == 0
+}
+
+// Get returns a lock of other process conflicting with the lock given, nil if the lock can be set
+func (manager *FileHandleLocalLockManager) Get(lock *FileHandleLocalLock) *FileHandleLocalLock {
 	manager.lock.RLock()
 	defer manager.lock.RUnlock()
 
 	for _, fileHandlelock := range manager.fileHandleLocks {
-		if manager.overlapRange(fileHandlelock.Start, fileHandlelock.End, start, end) {
+		if fileHandlelock.Pid == lock.Pid || !manager.overlapRange(fileHandlelock.Start, fileHandlelock.End, lock.Start, lock.End) {
+			continue
+		}
+
+		if fileHandlelock.LockType == syscall.F_WRLCK || lock.LockType == syscall.F_WRLCK {
 			return fileHandlelock
 		}
 	}
@@ -65,14 +138,93 @@ func (manager *FileHandleLocalLockManager) Get(start uint64, end uint64) *FileHa
 
 // Lock locks, return error if it errors
 func (manager *FileHandleLocalLockManager) Lock(lock *FileHandleLocalLock) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	return manager.lockWithoutMutex(lock)
+}
+
+// LockW locks, waits until conflicting locks are released
+// waiters acquire locks in arrival order, so a waiter is not starved by later waiters
+func (manager *FileHandleLocalLockManager) LockW(ctx context.Context, lock *FileHandleLocalLock) error {
 	logger := log.WithFields(log.Fields{
 		"package":  "irodsfs",
 		"struct":   "FileHandleLocalLockManager",
-		"function": "Lock",
+		"function": "LockW",
 	})
 
-	manager.lock.RLock()
-	defer manager.lock.RUnlock()
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	manager.waiters = append(manager.waiters, lock)
+	defer manager.removeWaiter(lock)
+
+	for {
+		if !manager.hasPrecedingWaiter(lock) {
+			err := manager.lockWithoutMutex(lock)
+			if err == nil {
+				return nil
+			}
+		}
+
+		logger.Debugf("wait for lock - start %d, end %d", lock.Start, lock.End)
+
+		releaseChan := manager.releaseChan
+		manager.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			manager.lock.Lock()
+			return xerrors.Errorf("failed to wait for a lock: %w", ctx.Err())
+		case <-releaseChan:
+			manager.lock.Lock()
+		}
+	}
+}
+
+// hasPrecedingWaiter checks if there is a waiter arrived earlier and conflicting with the lock
+func (manager *FileHandleLocalLockManager) hasPrecedingWaiter(lock *FileHandleLocalLock) bool {
+	for _, waiter := range manager.waiters {
+		if waiter == lock {
+			return false
+		}
+
+		if waiter.Pid == lock.Pid || !manager.overlapRange(waiter.Start, waiter.End, lock.Start, lock.End) {
+			continue
+		}
+
+		if waiter.LockType == syscall.F_WRLCK || lock.LockType == syscall.F_WRLCK {
+			return true
+		}
+	}
+	return false
+}
+
+// removeWaiter removes the lock from waiters and wakes up other waiters
+func (manager *FileHandleLocalLockManager) removeWaiter(lock *FileHandleLocalLock) {
+	newWaiters := []*FileHandleLocalLock{}
+	for _, waiter := range manager.waiters {
+		if waiter != lock {
+			newWaiters = append(newWaiters, waiter)
+		}
+	}
+	manager.waiters = newWaiters
+
+	manager.wakeWaiters()
+}
+
+// wakeWaiters wakes up waiters to retry
+func (manager *FileHandleLocalLockManager) wakeWaiters() {
+	close(manager.releaseChan)
+	manager.releaseChan = make(chan bool)
+}
+
+func (manager *FileHandleLocalLockManager) lockWithoutMutex(lock *FileHandleLocalLock) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandleLocalLockManager",
+		"function": "lockWithoutMutex",
+	})
 
 	for _, fileHandlelock := range manager.fileHandleLocks {
 		if manager.overlapRange(fileHandlelock.Start, fileHandlelock.End, lock.Start, lock.End) {
@@ -90,9 +242,8 @@ func (manager *FileHandleLocalLockManager) Lock(lock *FileHandleLocalLock) error
 					return xerrors.Errorf("there is a lock")
 				}
 
-				// read lock - add
+				// read lock - ok, added after checking all locks
 				logger.Debugf("found other process's read lock - ok")
-				manager.fileHandleLocks[lock.ID] = lock
 			} else {
 				// same pid
 				// update?
@@ -111,7 +262,37 @@ func (manager *FileHandleLocalLockManager) Lock(lock *FileHandleLocalLock) error
 	return nil
 }
 
-// Unlock unlocks
+// List returns copies of locks held
+func (manager *FileHandleLocalLockManager) List() []FileHandleLocalLock {
+	manager.lock.RLock()
+	defer manager.lock.RUnlock()
+
+	locks := []FileHandleLocalLock{}
+	for _, lock := range manager.fileHandleLocks {
+		locks = append(locks, *lock)
+	}
+	return locks
+}
+
+// UnlockHandle unlocks all locks set through the file handle
+func (manager *FileHandleLocalLockManager) UnlockHandle(handleID string) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	found := false
+	for _, fileHandlelock := range manager.fileHandleLocks {
+		if fileHandlelock.HandleID == handleID {
+			delete(manager.fileHandleLocks, fileHandlelock.ID)
+			found = true
+		}
+	}
+
+	if found {
+		manager.wakeWaiters()
+	}
+}
+
+// Unlock unlocks locks of the process overlapping the lock given
 func (manager *FileHandleLocalLockManager) Unlock(lock *FileHandleLocalLock) error {
 	logger := log.WithFields(log.Fields{
 		"package":  "irodsfs",
@@ -119,13 +300,13 @@ func (manager *FileHandleLocalLockManager) Unlock(lock *FileHandleLocalLock) err
 		"function": "Unlock",
 	})
 
-	manager.lock.RLock()
-	defer manager.lock.RUnlock()
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
 
 	found := false
 
 	for _, fileHandlelock := range manager.fileHandleLocks {
-		if manager.overlapRange(fileHandlelock.Start, fileHandlelock.End, lock.Start, lock.End) {
+		if fileHandlelock.Pid == lock.Pid && manager.overlapRange(fileHandlelock.Start, fileHandlelock.End, lock.Start, lock.End) {
 			// found - remove
 			logger.Debugf("delete lock - start %d, end %d", fileHandlelock.Start, fileHandlelock.End)
 			delete(manager.fileHandleLocks, fileHandlelock.ID)
@@ -134,6 +315,7 @@ func (manager *FileHandleLocalLockManager) Unlock(lock *FileHandleLocalLock) err
 	}
 
 	if found {
+		manager.wakeWaiters()
 		return nil
 	}
 	return xerrors.Errorf("failed to find a lock")
@@ -142,6 +324,7 @@ func (manager *FileHandleLocalLockManager) Unlock(lock *FileHandleLocalLock) err
 // FileHandleLocalLock is a struct for locally managed file lock
 type FileHandleLocalLock struct {
 	ID       string
+	HandleID string // file handle the lock is set through, released when the handle is closed
 	LockType uint32 // syscall.F_RDLCK or syscall.F_WRLCK
 	Pid      uint32
 	Start    uint64
@@ -0,0 +1,108 @@
+package irodsfs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestFileHandleLocalLockContention(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/lock.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle1 := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	handle2 := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+
+	ctx := context.Background()
+
+	errno := handle1.SetLocalLock(ctx, 1, &fuse.FileLock{Start: 0, End: 10, Typ: syscall.F_WRLCK, Pid: 100}, 0)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to lock, errno %v", errno)
+	}
+
+	// the lock is visible through the other handle
+	out := fuse.FileLock{}
+	errno = handle2.GetLocalLock(ctx, 2, &fuse.FileLock{Start: 5, End: 20, Typ: syscall.F_RDLCK, Pid: 200}, 0, &out)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to get lock, errno %v", errno)
+	}
+
+	if out.Typ != syscall.F_WRLCK || out.Pid != 100 {
+		t.Errorf("expected the write lock of pid 100, got type %d, pid %d", out.Typ, out.Pid)
+	}
+
+	errno = handle2.SetLocalLock(ctx, 2, &fuse.FileLock{Start: 5, End: 20, Typ: syscall.F_RDLCK, Pid: 200}, 0)
+	if errno != syscall.EAGAIN {
+		t.Errorf("expected EAGAIN locking through the other handle, got %v", errno)
+	}
+
+	// unlocking by other process does not release the lock
+	handle2.SetLocalLock(ctx, 2, &fuse.FileLock{Start: 0, End: 10, Typ: syscall.F_UNLCK, Pid: 200}, 0)
+
+	acquired := make(chan syscall.Errno)
+	go func() {
+		acquired <- handle2.SetLocalLockW(ctx, 2, &fuse.FileLock{Start: 5, End: 20, Typ: syscall.F_WRLCK, Pid: 200}, 0)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("acquired a lock conflicting with the lock of the other handle")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// closing the handle releases its locks
+	errno = handle1.Release(ctx)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to release, errno %v", errno)
+	}
+
+	select {
+	case errno = <-acquired:
+		if errno != fusefs.OK {
+			t.Fatalf("failed to lock after the other handle is closed, errno %v", errno)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the lock acquired after the other handle is closed")
+	}
+
+	errno = handle2.Release(ctx)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to release, errno %v", errno)
+	}
+
+	if len(fs.localLockManagers.List()) != 0 || len(fs.localLockManagers.managers) != 0 {
+		t.Errorf("expected no lock manager left after all handles are closed")
+	}
+}
+
+func TestFileHandleLocalLockSameProcess(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/lock.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle1 := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	handle2 := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadOnly)
+
+	ctx := context.Background()
+
+	errno := handle1.SetLocalLock(ctx, 1, &fuse.FileLock{Start: 0, End: 10, Typ: syscall.F_WRLCK, Pid: 100}, 0)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to lock, errno %v", errno)
+	}
+
+	// locks of the same process do not conflict
+	errno = handle2.SetLocalLock(ctx, 1, &fuse.FileLock{Start: 5, End: 20, Typ: syscall.F_RDLCK, Pid: 100}, 0)
+	if errno != fusefs.OK {
+		t.Errorf("expected locking by the same process to succeed, got %v", errno)
+	}
+}
@@ -10,6 +10,9 @@ type FileHandleMap struct {
 	mutex       sync.Mutex
 	fileHandles map[string]*FileHandle // ID-handle mapping
 	filePathID  map[string][]string    // path-IDs mappings
+	reserved    map[uint32]int         // uid-count of file handles being opened
+
+	bandwidthLimiters map[uint32]*BandwidthLimiter // uid-limiter of data transfer, kept after file handles are closed
 }
 
 // NewFileHandleMap creates a new FileHandleMap
@@ -18,6 +21,9 @@ func NewFileHandleMap() *FileHandleMap {
 		mutex:       sync.Mutex{},
 		fileHandles: map[string]*FileHandle{},
 		filePathID:  map[string][]string{},
+		reserved:    map[uint32]int{},
+
+		bandwidthLimiters: map[uint32]*BandwidthLimiter{},
 	}
 }
 
@@ -26,6 +32,11 @@ func (fileHandleMap *FileHandleMap) Add(handle *FileHandle) {
 	fileHandleMap.mutex.Lock()
 	defer fileHandleMap.mutex.Unlock()
 
+	fileHandleMap.add(handle)
+}
+
+// add registers a file handle, caller must hold the mutex
+func (fileHandleMap *FileHandleMap) add(handle *FileHandle) {
 	handleID := handle.GetID()
 	handlePath := handle.GetPath()
 
@@ -156,6 +167,85 @@ func (fileHandleMap *FileHandleMap) ListByPath(path string) []*FileHandle {
 	return handles
 }
 
+// CountByUID returns the number of file handles opened or being opened by the local uid
+func (fileHandleMap *FileHandleMap) CountByUID(uid uint32) int {
+	fileHandleMap.mutex.Lock()
+	defer fileHandleMap.mutex.Unlock()
+
+	return fileHandleMap.countByUID(uid)
+}
+
+// countByUID returns the number of file handles opened or being opened by the local uid, caller must hold the mutex
+func (fileHandleMap *FileHandleMap) countByUID(uid uint32) int {
+	count := fileHandleMap.reserved[uid]
+	for _, handle := range fileHandleMap.fileHandles {
+		if handle.GetUID() == uid {
+			count++
+		}
+	}
+	return count
+}
+
+// Reserve reserves a slot for a file handle the local uid is opening, returns false if the uid has max file handles already
+// the slot is released by AddReserved when the handle is opened, or by CancelReservation if opening fails
+func (fileHandleMap *FileHandleMap) Reserve(uid uint32, max int) bool {
+	fileHandleMap.mutex.Lock()
+	defer fileHandleMap.mutex.Unlock()
+
+	if fileHandleMap.countByUID(uid) >= max {
+		return false
+	}
+
+	fileHandleMap.reserved[uid]++
+	return true
+}
+
+// CancelReservation releases a slot reserved by Reserve
+func (fileHandleMap *FileHandleMap) CancelReservation(uid uint32) {
+	fileHandleMap.mutex.Lock()
+	defer fileHandleMap.mutex.Unlock()
+
+	fileHandleMap.cancelReservation(uid)
+}
+
+// cancelReservation releases a slot reserved by Reserve, caller must hold the mutex
+func (fileHandleMap *FileHandleMap) cancelReservation(uid uint32) {
+	if fileHandleMap.reserved[uid] <= 1 {
+		delete(fileHandleMap.reserved, uid)
+		return
+	}
+
+	fileHandleMap.reserved[uid]--
+}
+
+// AddReserved registers a file handle opened in a slot reserved by Reserve, in place of the slot
+func (fileHandleMap *FileHandleMap) AddReserved(handle *FileHandle) {
+	fileHandleMap.mutex.Lock()
+	defer fileHandleMap.mutex.Unlock()
+
+	fileHandleMap.cancelReservation(handle.GetUID())
+	fileHandleMap.add(handle)
+}
+
+// GetBandwidthLimiter returns the limiter shared by reads and writes of file handles opened by the local uid
+// it is created with the given bytes per second at first use, returns nil if bytesPerSec is 0, i.e., unlimited
+func (fileHandleMap *FileHandleMap) GetBandwidthLimiter(uid uint32, bytesPerSec int) *BandwidthLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+
+	fileHandleMap.mutex.Lock()
+	defer fileHandleMap.mutex.Unlock()
+
+	if limiter, ok := fileHandleMap.bandwidthLimiters[uid]; ok {
+		return limiter
+	}
+
+	limiter := NewBandwidthLimiter(bytesPerSec)
+	fileHandleMap.bandwidthLimiters[uid] = limiter
+	return limiter
+}
+
 // ListPathsUnderDir returns paths of file handles under given parent path
 func (fileHandleMap *FileHandleMap) ListPathsInDir(parentPath string) []string {
 	fileHandleMap.mutex.Lock()
@@ -0,0 +1,454 @@
+package irodsfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// errRemoteLockConflict is returned when a lock conflicts with a lock held by other process or mount
+	errRemoteLockConflict = xerrors.New("found conflict lock")
+)
+
+// FileHandleRemoteLockManager is a manager that manages FileHandleRemoteLocks
+// remote locks are stored in AVUs of the data object, so mounts on other hosts can see them
+type FileHandleRemoteLockManager struct {
+	fs                   *IRODSFS
+	path                 string
+	lock                 sync.Mutex
+	fileHandleLocks      map[string]*FileHandleRemoteLock // key is ID, locks held by the file handle
+	refreshTerminateChan chan bool
+}
+
+// NewFileHandleRemoteLockManager creates a new FileHandleRemoteLockManager
+func NewFileHandleRemoteLockManager(fs *IRODSFS, path string) *FileHandleRemoteLockManager {
+	return &FileHandleRemoteLockManager{
+		fs:                   fs,
+		path:                 path,
+		lock:                 sync.Mutex{},
+		fileHandleLocks:      map[string]*FileHandleRemoteLock{},
+		refreshTerminateChan: nil,
+	}
+}
+
+func (manager *FileHandleRemoteLockManager) overlapRange(s1 uint64, e1 uint64, s2 uint64, e2 uint64) bool {
+	if s2 < s1 {
+		// s2-e2-s1-e1
+		if e2 < s1 {
+			return false
+		}
+	} else {
+		// s1-e1-s2-e2
+		if e1 < s2 {
+			return false
+		}
+	}
+	return true
+}
+
+func (manager *FileHandleRemoteLockManager) combineRange(s1 uint64, e1 uint64, s2 uint64, e2 uint64) (uint64, uint64) {
+	cs := s1
+	if s2 < s1 {
+		cs = s2
+	}
+
+	ce := e1
+	if e2 > e1 {
+		ce = e2
+	}
+	return cs, ce
+}
+
+// isConflict checks if the existing lock conflicts with the lock
+func (manager *FileHandleRemoteLockManager) isConflict(existing *FileHandleRemoteLock, lock *FileHandleRemoteLock) bool {
+	if existing.ID == lock.ID {
+		return false
+	}
+
+	if !manager.overlapRange(existing.Start, existing.End, lock.Start, lock.End) {
+		return false
+	}
+
+	if existing.Owner == lock.Owner && existing.Pid == lock.Pid {
+		// my process's lock
+		return false
+	}
+
+	return existing.LockType == syscall.F_WRLCK || lock.LockType == syscall.F_WRLCK
+}
+
+// listLocks lists locks registered in the data object, stale locks are removed
+func (manager *FileHandleRemoteLockManager) listLocks() ([]*FileHandleRemoteLock, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandleRemoteLockManager",
+		"function": "listLocks",
+	})
+
+	fsClient, done := manager.fs.acquireFSClient()
+	defer done()
+
+	irodsMetadata, err := fsClient.ListXattr(manager.path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to list locks of %q: %w", manager.path, err)
+	}
+
+	timeout := time.Duration(manager.fs.config.DistributedLockTimeout)
+	now := time.Now()
+
+	locks := []*FileHandleRemoteLock{}
+	for _, irodsMeta := range irodsMetadata {
+		if !strings.HasPrefix(irodsMeta.Name, RemoteLockXattrPrefix) {
+			continue
+		}
+
+		lock, err := decodeFileHandleRemoteLock(irodsMeta.Name, irodsMeta.Value)
+		if err != nil {
+			logger.Warnf("%+v", err)
+			continue
+		}
+
+		if timeout > 0 && now.Sub(lock.Timestamp) > timeout {
+			// the mount holding the lock may have crashed
+			logger.Debugf("expire stale lock %q of %q", lock.ID, lock.Owner)
+			err = fsClient.RemoveXattr(manager.path, irodsMeta.Name)
+			if err != nil {
+				logger.Warnf("%+v", err)
+			}
+			continue
+		}
+
+		locks = append(locks, lock)
+	}
+
+	return locks, nil
+}
+
+// setLock registers the lock in the data object
+func (manager *FileHandleRemoteLockManager) setLock(lock *FileHandleRemoteLock) error {
+	lock.Timestamp = time.Now()
+
+	fsClient, done := manager.fs.acquireFSClient()
+	defer done()
+
+	err := fsClient.SetXattr(manager.path, lock.getAttrName(), lock.encode())
+	if err != nil {
+		return xerrors.Errorf("failed to set lock of %q: %w", manager.path, err)
+	}
+	return nil
+}
+
+// removeLock unregisters the lock from the data object
+func (manager *FileHandleRemoteLockManager) removeLock(lock *FileHandleRemoteLock) error {
+	fsClient, done := manager.fs.acquireFSClient()
+	defer done()
+
+	err := fsClient.RemoveXattr(manager.path, lock.getAttrName())
+	if err != nil {
+		return xerrors.Errorf("failed to remove lock of %q: %w", manager.path, err)
+	}
+	return nil
+}
+
+// Get returns a lock conflicting with given lock
+func (manager *FileHandleRemoteLockManager) Get(lock *FileHandleRemoteLock) (*FileHandleRemoteLock, error) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	locks, err := manager.listLocks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, existing := range locks {
+		if manager.isConflict(existing, lock) {
+			return existing, nil
+		}
+	}
+	return nil, nil
+}
+
+// Lock locks, return errRemoteLockConflict if other process or mount holds a conflicting lock
+func (manager *FileHandleRemoteLockManager) Lock(lock *FileHandleRemoteLock) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandleRemoteLockManager",
+		"function": "Lock",
+	})
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	unlockPath := manager.fs.remoteLockPathLocks.Lock(manager.path)
+	defer unlockPath()
+
+	locks, err := manager.listLocks()
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range locks {
+		if manager.isConflict(existing, lock) {
+			logger.Debugf("found conflict lock %q of %q", existing.ID, existing.Owner)
+			return errRemoteLockConflict
+		}
+	}
+
+	// merge my process's locks
+	for _, held := range manager.fileHandleLocks {
+		if held.Pid == lock.Pid && manager.overlapRange(held.Start, held.End, lock.Start, lock.End) {
+			logger.Debugf("found my process's lock - update")
+			lock.Start, lock.End = manager.combineRange(held.Start, held.End, lock.Start, lock.End)
+
+			err = manager.removeLock(held)
+			if err != nil {
+				return err
+			}
+			delete(manager.fileHandleLocks, held.ID)
+		}
+	}
+
+	err = manager.setLock(lock)
+	if err != nil {
+		return err
+	}
+
+	// AVUs can't be set atomically, check again if other mount took the lock at the same time
+	locks, err = manager.listLocks()
+	if err != nil {
+		manager.removeLock(lock)
+		return err
+	}
+
+	for _, existing := range locks {
+		if manager.isConflict(existing, lock) {
+			logger.Debugf("found conflict lock %q of %q set concurrently", existing.ID, existing.Owner)
+			manager.removeLock(lock)
+			return errRemoteLockConflict
+		}
+	}
+
+	manager.fileHandleLocks[lock.ID] = lock
+	manager.startRefresh()
+	return nil
+}
+
+// Unlock unlocks the range of locks held by the process, parts of the locks outside the range are kept held
+// unlocking a range not locked succeeds, as in POSIX
+func (manager *FileHandleRemoteLockManager) Unlock(lock *FileHandleRemoteLock) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandleRemoteLockManager",
+		"function": "Unlock",
+	})
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	unlockPath := manager.fs.remoteLockPathLocks.Lock(manager.path)
+	defer unlockPath()
+
+	heldLocks := []*FileHandleRemoteLock{}
+	for _, held := range manager.fileHandleLocks {
+		heldLocks = append(heldLocks, held)
+	}
+
+	for _, held := range heldLocks {
+		if held.Pid != lock.Pid || !manager.overlapRange(held.Start, held.End, lock.Start, lock.End) {
+			continue
+		}
+
+		// the rest is set before removing the lock, so other mounts do not see the range unlocked
+		remains := []*FileHandleRemoteLock{}
+		if held.Start < lock.Start {
+			remains = append(remains, held.split(held.Start, lock.Start-1))
+		}
+
+		if held.End > lock.End {
+			remains = append(remains, held.split(lock.End+1, held.End))
+		}
+
+		for _, remain := range remains {
+			logger.Debugf("keep lock - start %d, end %d", remain.Start, remain.End)
+			err := manager.setLock(remain)
+			if err != nil {
+				return err
+			}
+			manager.fileHandleLocks[remain.ID] = remain
+		}
+
+		logger.Debugf("delete lock - start %d, end %d", held.Start, held.End)
+		err := manager.removeLock(held)
+		if err != nil {
+			return err
+		}
+
+		delete(manager.fileHandleLocks, held.ID)
+	}
+
+	if len(manager.fileHandleLocks) == 0 {
+		manager.stopRefresh()
+	}
+
+	return nil
+}
+
+// ReleaseAll unlocks all locks held by the file handle
+func (manager *FileHandleRemoteLockManager) ReleaseAll() {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandleRemoteLockManager",
+		"function": "ReleaseAll",
+	})
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	unlockPath := manager.fs.remoteLockPathLocks.Lock(manager.path)
+	defer unlockPath()
+
+	for _, held := range manager.fileHandleLocks {
+		err := manager.removeLock(held)
+		if err != nil {
+			// it will be expired later
+			logger.Errorf("%+v", err)
+		}
+	}
+
+	manager.fileHandleLocks = map[string]*FileHandleRemoteLock{}
+	manager.stopRefresh()
+}
+
+// startRefresh starts refreshing timestamps of locks held, so other mounts do not expire them
+func (manager *FileHandleRemoteLockManager) startRefresh() {
+	timeout := time.Duration(manager.fs.config.DistributedLockTimeout)
+	if timeout <= 0 || manager.refreshTerminateChan != nil {
+		return
+	}
+
+	terminateChan := make(chan bool)
+	manager.refreshTerminateChan = terminateChan
+
+	go func() {
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-terminateChan:
+				return
+			case <-ticker.C:
+				manager.refresh(terminateChan)
+			}
+		}
+	}()
+}
+
+// refresh refreshes timestamps of locks held, unless refreshing is stopped by terminateChan meanwhile
+func (manager *FileHandleRemoteLockManager) refresh(terminateChan chan bool) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "FileHandleRemoteLockManager",
+		"function": "refresh",
+	})
+
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	select {
+	case <-terminateChan:
+		// locks are released while waiting
+		return
+	default:
+	}
+
+	// other handles of the path do not see locks removed for a moment below
+	unlockPath := manager.fs.remoteLockPathLocks.Lock(manager.path)
+	defer unlockPath()
+
+	for _, held := range manager.fileHandleLocks {
+		// remove first as setting an AVU adds a new one
+		err := manager.removeLock(held)
+		if err == nil {
+			err = manager.setLock(held)
+		}
+
+		if err != nil {
+			logger.Errorf("%+v", err)
+		}
+	}
+}
+
+// stopRefresh stops refreshing timestamps of locks
+func (manager *FileHandleRemoteLockManager) stopRefresh() {
+	if manager.refreshTerminateChan != nil {
+		close(manager.refreshTerminateChan)
+		manager.refreshTerminateChan = nil
+	}
+}
+
+// FileHandleRemoteLock is a struct for file lock shared via iRODS
+type FileHandleRemoteLock struct {
+	ID        string
+	Owner     string // instance ID of the mount
+	LockType  uint32 // syscall.F_RDLCK or syscall.F_WRLCK
+	Pid       uint32
+	Start     uint64
+	End       uint64
+	Timestamp time.Time
+}
+
+// split returns a new lock of the range of the lock
+func (lock *FileHandleRemoteLock) split(start uint64, end uint64) *FileHandleRemoteLock {
+	return &FileHandleRemoteLock{
+		ID:        xid.New().String(),
+		Owner:     lock.Owner,
+		LockType:  lock.LockType,
+		Pid:       lock.Pid,
+		Start:     start,
+		End:       end,
+		Timestamp: lock.Timestamp,
+	}
+}
+
+func (lock *FileHandleRemoteLock) getAttrName() string {
+	return fmt.Sprintf("%s%s", RemoteLockXattrPrefix, lock.ID)
+}
+
+func (lock *FileHandleRemoteLock) encode() string {
+	return fmt.Sprintf("%s,%d,%d,%d,%d,%d", lock.Owner, lock.LockType, lock.Pid, lock.Start, lock.End, lock.Timestamp.Unix())
+}
+
+func decodeFileHandleRemoteLock(name string, value string) (*FileHandleRemoteLock, error) {
+	fields := strings.Split(value, ",")
+	if len(fields) != 6 {
+		return nil, xerrors.Errorf("failed to parse lock %q: %q", name, value)
+	}
+
+	numbers := make([]uint64, 5)
+	for i, field := range fields[1:] {
+		number, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to parse lock %q: %w", name, err)
+		}
+		numbers[i] = number
+	}
+
+	return &FileHandleRemoteLock{
+		ID:        strings.TrimPrefix(name, RemoteLockXattrPrefix),
+		Owner:     fields[0],
+		LockType:  uint32(numbers[0]),
+		Pid:       uint32(numbers[1]),
+		Start:     numbers[2],
+		End:       numbers[3],
+		Timestamp: time.Unix(int64(numbers[4]), 0),
+	}, nil
+}
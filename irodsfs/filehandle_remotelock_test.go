@@ -0,0 +1,200 @@
+package irodsfs
+
+import (
+	"sort"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"golang.org/x/xerrors"
+)
+
+const (
+	remoteLockTestPath string = "/testzone/home/testuser/locked.txt"
+)
+
+// slowSetXattrFSClient takes a while to set the xattr of the name, like a busy iRODS server
+type slowSetXattrFSClient struct {
+	*fakeFSClient
+
+	slowName string
+}
+
+func (client *slowSetXattrFSClient) SetXattr(entryPath string, name string, value string) error {
+	if name == client.slowName {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return client.fakeFSClient.SetXattr(entryPath, name, value)
+}
+
+func newTestRemoteLock(fs *IRODSFS, lockType uint32, pid uint32, start uint64, end uint64) *FileHandleRemoteLock {
+	return &FileHandleRemoteLock{
+		ID:       xid.New().String(),
+		Owner:    fs.config.InstanceID,
+		LockType: lockType,
+		Pid:      pid,
+		Start:    start,
+		End:      end,
+	}
+}
+
+// listRemoteLockRanges returns ranges of locks registered in the data object, sorted by start
+func listRemoteLockRanges(t *testing.T, manager *FileHandleRemoteLockManager) [][2]uint64 {
+	locks, err := manager.listLocks()
+	if err != nil {
+		t.Fatalf("failed to list locks - %v", err)
+	}
+
+	ranges := [][2]uint64{}
+	for _, lock := range locks {
+		ranges = append(ranges, [2]uint64{lock.Start, lock.End})
+	}
+
+	sort.Slice(ranges, func(i int, j int) bool {
+		return ranges[i][0] < ranges[j][0]
+	})
+	return ranges
+}
+
+func TestRemoteLockUnlockNotHeld(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	client.addFile(remoteLockTestPath, []byte("0123"))
+
+	manager := NewFileHandleRemoteLockManager(fs, remoteLockTestPath)
+
+	err := manager.Unlock(newTestRemoteLock(fs, syscall.F_UNLCK, 1, 0, 100))
+	if err != nil {
+		t.Errorf("expected unlocking a range not locked to succeed, got %v", err)
+	}
+}
+
+func TestRemoteLockPartialUnlockSplitsRange(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	client.addFile(remoteLockTestPath, []byte("0123"))
+
+	manager := NewFileHandleRemoteLockManager(fs, remoteLockTestPath)
+
+	err := manager.Lock(newTestRemoteLock(fs, syscall.F_WRLCK, 1, 0, 99))
+	if err != nil {
+		t.Fatalf("failed to lock - %v", err)
+	}
+
+	// other process does not unlock my lock
+	err = manager.Unlock(newTestRemoteLock(fs, syscall.F_UNLCK, 2, 0, 99))
+	if err != nil {
+		t.Fatalf("failed to unlock - %v", err)
+	}
+
+	err = manager.Unlock(newTestRemoteLock(fs, syscall.F_UNLCK, 1, 20, 29))
+	if err != nil {
+		t.Fatalf("failed to unlock - %v", err)
+	}
+
+	ranges := listRemoteLockRanges(t, manager)
+	expected := [][2]uint64{{0, 19}, {30, 99}}
+	if len(ranges) != len(expected) || ranges[0] != expected[0] || ranges[1] != expected[1] {
+		t.Fatalf("expected locked ranges %v, got %v", expected, ranges)
+	}
+
+	if len(manager.fileHandleLocks) != 2 {
+		t.Errorf("expected 2 locks held, got %d", len(manager.fileHandleLocks))
+	}
+
+	// the range unlocked can be locked by others
+	otherManager := NewFileHandleRemoteLockManager(fs, remoteLockTestPath)
+	err = otherManager.Lock(newTestRemoteLock(fs, syscall.F_WRLCK, 2, 20, 29))
+	if err != nil {
+		t.Errorf("expected the range unlocked available, got %v", err)
+	}
+
+	err = otherManager.Lock(newTestRemoteLock(fs, syscall.F_WRLCK, 2, 10, 19))
+	if !xerrors.Is(err, errRemoteLockConflict) {
+		t.Errorf("expected the range kept locked, got %v", err)
+	}
+}
+
+func TestRemoteLockRefreshIsSerialized(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	client.addFile(remoteLockTestPath, []byte("0123"))
+
+	holder := NewFileHandleRemoteLockManager(fs, remoteLockTestPath)
+	heldLock := newTestRemoteLock(fs, syscall.F_WRLCK, 1, 0, 99)
+	err := holder.Lock(heldLock)
+	if err != nil {
+		t.Fatalf("failed to lock - %v", err)
+	}
+
+	// the lock is absent for a while when refreshing
+	fs.session = newFSSession(&slowSetXattrFSClient{fakeFSClient: client, slowName: heldLock.getAttrName()}, nil)
+
+	terminateChan := make(chan bool)
+	refreshedChan := make(chan bool)
+
+	go func() {
+		defer close(refreshedChan)
+
+		for i := 0; i < 20; i++ {
+			holder.refresh(terminateChan)
+		}
+	}()
+
+	// the lock removed for refreshing is not seen
+	acquired := 0
+	other := NewFileHandleRemoteLockManager(fs, remoteLockTestPath)
+	for refreshing := true; refreshing; {
+		select {
+		case <-refreshedChan:
+			refreshing = false
+		default:
+		}
+
+		err := other.Lock(newTestRemoteLock(fs, syscall.F_WRLCK, 2, 0, 99))
+		if err == nil {
+			acquired++
+			other.ReleaseAll()
+		}
+	}
+
+	if acquired > 0 {
+		t.Errorf("expected the lock never taken while refreshing, taken %d times", acquired)
+	}
+}
+
+func TestRemoteLockConcurrentLock(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	client.addFile(remoteLockTestPath, []byte("0123"))
+
+	managers := []*FileHandleRemoteLockManager{}
+	for i := 0; i < 8; i++ {
+		managers = append(managers, NewFileHandleRemoteLockManager(fs, remoteLockTestPath))
+	}
+
+	acquiredMutex := sync.Mutex{}
+	acquired := 0
+
+	wg := sync.WaitGroup{}
+	for i, manager := range managers {
+		wg.Add(1)
+		go func(manager *FileHandleRemoteLockManager, pid uint32) {
+			defer wg.Done()
+
+			err := manager.Lock(newTestRemoteLock(fs, syscall.F_WRLCK, pid, 0, 99))
+			if err == nil {
+				acquiredMutex.Lock()
+				acquired++
+				acquiredMutex.Unlock()
+			}
+		}(manager, uint32(i+1))
+	}
+	wg.Wait()
+
+	if acquired != 1 {
+		t.Errorf("expected exactly one write lock acquired, got %d", acquired)
+	}
+}
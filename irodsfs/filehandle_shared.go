@@ -0,0 +1,180 @@
+package irodsfs
+
+import (
+	"sync"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
+	irodsfscommon_irods "github.com/cyverse/irodsfs-common/irods"
+	log "github.com/sirupsen/logrus"
+)
+
+// sharedReader serializes reads of FileHandles sharing a reader, as the reader is not safe for concurrent use
+// FileHandles do not release it, it is released when the shared read handle is closed
+type sharedReader struct {
+	irodsfscommon_io.Reader
+
+	mutex sync.Mutex
+}
+
+// ReadAt reads data
+func (reader *sharedReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	return reader.Reader.ReadAt(buffer, offset)
+}
+
+// GetAvailable returns available data len
+func (reader *sharedReader) GetAvailable(offset int64) int64 {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	return reader.Reader.GetAvailable(offset)
+}
+
+// Release does nothing, the reader is released with the shared read handle
+func (reader *sharedReader) Release() {}
+
+// release releases the reader after reads in flight complete
+func (reader *sharedReader) release() {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	reader.Reader.Release()
+}
+
+// SharedReadHandle is an iRODS file handle and a reader shared by read-only FileHandles of the same path
+type SharedReadHandle struct {
+	path            string
+	iRODSFileHandle irodsfscommon_irods.IRODSFSFileHandle
+	reader          *sharedReader
+	refCount        int
+	closed          bool // closed by Clear before all references are released
+}
+
+// SharedReadHandleMap manages SharedReadHandles
+type SharedReadHandleMap struct {
+	mutex   sync.Mutex
+	handles map[string]*SharedReadHandle // path-handle mapping
+}
+
+// NewSharedReadHandleMap creates a new SharedReadHandleMap
+func NewSharedReadHandleMap() *SharedReadHandleMap {
+	return &SharedReadHandleMap{
+		mutex:   sync.Mutex{},
+		handles: map[string]*SharedReadHandle{},
+	}
+}
+
+// Acquire returns a shared read handle for the path, opens a new one if there is no handle opened
+func (sharedMap *SharedReadHandleMap) Acquire(fs *IRODSFS, path string) (*SharedReadHandle, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "SharedReadHandleMap",
+		"function": "Acquire",
+	})
+
+	sharedMap.mutex.Lock()
+	defer sharedMap.mutex.Unlock()
+
+	if handle, ok := sharedMap.handles[path]; ok {
+		handle.refCount++
+		logger.Debugf("Sharing a read handle for %q, references %d", path, handle.refCount)
+		return handle, nil
+	}
+
+	logger.Infof("Open file %q with mode %q for sharing", path, irodsclient_types.FileOpenModeReadOnly)
+
+	irodsHandle, err := fs.openDataFile(path, irodsclient_types.FileOpenModeReadOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	if reportClient := fs.getAccessReportClient(irodsclient_types.FileOpenModeReadOnly); reportClient != nil {
+		reportClient.StartFileAccess(irodsHandle)
+	}
+
+	reader, err := newReadOnlyReader(fs, irodsHandle)
+	if err != nil {
+		irodsHandle.Close()
+		return nil, err
+	}
+
+	handle := &SharedReadHandle{
+		path:            path,
+		iRODSFileHandle: irodsHandle,
+		reader: &sharedReader{
+			Reader: reader,
+			mutex:  sync.Mutex{},
+		},
+		refCount: 1,
+		closed:   false,
+	}
+
+	sharedMap.handles[path] = handle
+	return handle, nil
+}
+
+// Release releases a reference to the shared read handle, closes it when the last reference is released
+func (sharedMap *SharedReadHandleMap) Release(fs *IRODSFS, handle *SharedReadHandle) {
+	sharedMap.mutex.Lock()
+	defer sharedMap.mutex.Unlock()
+
+	handle.refCount--
+	if handle.refCount > 0 || handle.closed {
+		return
+	}
+
+	if sharedMap.handles[handle.path] == handle {
+		delete(sharedMap.handles, handle.path)
+	}
+
+	// close it asynchronously
+	handle.closed = true
+	fs.runAsync(func() {
+		handle.close(fs)
+	})
+}
+
+// Clear closes all shared read handles registered, FileHandles still referencing them can no longer read
+func (sharedMap *SharedReadHandleMap) Clear(fs *IRODSFS) {
+	sharedMap.mutex.Lock()
+	defer sharedMap.mutex.Unlock()
+
+	for _, handle := range sharedMap.handles {
+		if !handle.closed {
+			handle.closed = true
+			handle.close(fs)
+		}
+	}
+
+	sharedMap.handles = map[string]*SharedReadHandle{}
+}
+
+func (handle *SharedReadHandle) close(fs *IRODSFS) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "SharedReadHandle",
+		"function": "close",
+	})
+
+	handle.reader.release()
+	err := handle.reader.GetError()
+	if err != nil {
+		logger.Errorf("%+v", err)
+	}
+
+	// Report
+	if reportClient := fs.getAccessReportClient(irodsclient_types.FileOpenModeReadOnly); reportClient != nil {
+		err := reportClient.DoneFileAccess(handle.iRODSFileHandle)
+		if err != nil {
+			logger.Errorf("%+v", err)
+		}
+	}
+
+	err = handle.iRODSFileHandle.Close()
+	if err != nil {
+		logger.Errorf("%+v", err)
+	}
+}
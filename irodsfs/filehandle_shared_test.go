@@ -0,0 +1,132 @@
+package irodsfs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+)
+
+// exclusiveReader fails reads made concurrently, like readers not safe for concurrent use
+type exclusiveReader struct {
+	fakeReader
+
+	t       *testing.T
+	reading int32
+}
+
+func (reader *exclusiveReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	if !atomic.CompareAndSwapInt32(&reader.reading, 0, 1) {
+		reader.t.Errorf("concurrent reads of a shared reader")
+	}
+	defer atomic.StoreInt32(&reader.reading, 0)
+
+	return reader.fakeReader.ReadAt(buffer, offset)
+}
+
+func (reader *exclusiveReader) Release() { atomic.AddInt32(&reader.released, 1) }
+
+func newTestSharedReadFileHandle(t *testing.T, fs *IRODSFS, filePath string) *FileHandle {
+	handle, err := NewFileHandleLazy(fs, filePath, irodsclient_types.FileOpenModeReadOnly)
+	if err != nil {
+		t.Fatalf("failed to create a file handle - %v", err)
+	}
+
+	handle.SetFile(NewFile(fs, 0, filePath))
+	fs.fileHandleMap.Add(handle)
+
+	err = handle.initLazy(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open %q - %v", filePath, err)
+	}
+	return handle
+}
+
+func TestSharedReadHandleSerializesReads(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.SharedReadHandle = true
+
+	filePath := "/testzone/home/testuser/shared.txt"
+	client.addFile(filePath, []byte("0123456789"))
+
+	handles := []*FileHandle{}
+	for i := 0; i < 4; i++ {
+		handles = append(handles, newTestSharedReadFileHandle(t, fs, filePath))
+	}
+
+	sharedReadHandle := handles[0].sharedReadHandle
+	for _, handle := range handles {
+		if handle.sharedReadHandle != sharedReadHandle {
+			t.Fatalf("expected the read handle shared")
+		}
+	}
+
+	sharedReadHandle.reader.Reader = &exclusiveReader{fakeReader: fakeReader{handle: sharedReadHandle.iRODSFileHandle}, t: t}
+
+	wg := sync.WaitGroup{}
+	for _, handle := range handles {
+		wg.Add(1)
+		go func(handle *FileHandle) {
+			defer wg.Done()
+
+			for i := 0; i < 50; i++ {
+				dest := make([]byte, 4)
+				result, errno := handle.Read(context.Background(), dest, 2)
+				if errno != fusefs.OK {
+					t.Errorf("failed to read, errno %v", errno)
+					return
+				}
+
+				data, _ := result.Bytes(nil)
+				if string(data) != "2345" {
+					t.Errorf("expected data %q, got %q", "2345", data)
+					return
+				}
+			}
+		}(handle)
+	}
+	wg.Wait()
+}
+
+func TestSharedReadHandleMapClearReleasesReaders(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.SharedReadHandle = true
+
+	filePath := "/testzone/home/testuser/shared.txt"
+	client.addFile(filePath, []byte("0123456789"))
+
+	handle := newTestSharedReadFileHandle(t, fs, filePath)
+	sharedReadHandle := handle.sharedReadHandle
+
+	reader := &exclusiveReader{fakeReader: fakeReader{handle: sharedReadHandle.iRODSFileHandle}, t: t}
+	sharedReadHandle.reader.Reader = reader
+
+	fs.sharedReadHandleMap.Clear(fs)
+
+	if released := atomic.LoadInt32(&reader.released); released != 1 {
+		t.Errorf("expected the reader released once, got %d", released)
+	}
+
+	irodsHandle := sharedReadHandle.iRODSFileHandle.(*fakeFileHandle)
+	if irodsHandle.closeCount() != 1 {
+		t.Errorf("expected the iRODS file handle closed once, got %d", irodsHandle.closeCount())
+	}
+
+	// releasing the file handle does not close the shared handle again
+	errno := handle.Release(context.Background())
+	if errno != fusefs.OK {
+		t.Errorf("failed to release, errno %v", errno)
+	}
+
+	if released := atomic.LoadInt32(&reader.released); released != 1 {
+		t.Errorf("expected the reader released once, got %d", released)
+	}
+	if irodsHandle.closeCount() != 1 {
+		t.Errorf("expected the iRODS file handle closed once, got %d", irodsHandle.closeCount())
+	}
+}
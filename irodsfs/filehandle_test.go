@@ -0,0 +1,1150 @@
+package irodsfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// bufferingWriter holds data written until flushed, like the buffered writers of irodsfs-common
+type bufferingWriter struct {
+	fakeWriter
+
+	mutex   sync.Mutex
+	pending map[int64][]byte
+}
+
+func (writer *bufferingWriter) WriteAt(data []byte, offset int64) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.pending == nil {
+		writer.pending = map[int64][]byte{}
+	}
+	writer.pending[offset] = append([]byte{}, data...)
+	return len(data), nil
+}
+
+func (writer *bufferingWriter) Flush() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	for offset, data := range writer.pending {
+		_, err := writer.handle.WriteAt(data, offset)
+		if err != nil {
+			return err
+		}
+	}
+	writer.pending = nil
+	return nil
+}
+
+func TestIRODSGetOpenFlagsAppend(t *testing.T) {
+	tests := []struct {
+		flags    int
+		openMode irodsclient_types.FileOpenMode
+	}{
+		{os.O_RDONLY, irodsclient_types.FileOpenModeReadOnly},
+		{os.O_WRONLY, irodsclient_types.FileOpenModeWriteOnly},
+		{os.O_WRONLY | os.O_TRUNC, irodsclient_types.FileOpenModeWriteTruncate},
+		{os.O_WRONLY | os.O_APPEND, irodsclient_types.FileOpenModeAppend},
+		{os.O_RDWR, irodsclient_types.FileOpenModeReadWrite},
+		{os.O_RDWR | os.O_APPEND, irodsclient_types.FileOpenModeReadAppend},
+	}
+
+	for _, test := range tests {
+		openMode := IRODSGetOpenFlags(uint32(test.flags))
+		if openMode != test.openMode {
+			t.Errorf("flags %o: expected open mode %q, got %q", test.flags, test.openMode, openMode)
+		}
+	}
+}
+
+func TestFileHandleAppendIgnoresOffset(t *testing.T) {
+	for _, openMode := range []irodsclient_types.FileOpenMode{irodsclient_types.FileOpenModeAppend, irodsclient_types.FileOpenModeReadAppend} {
+		client := newFakeFSClient()
+		fs := newTestFS(client)
+
+		filePath := "/testzone/home/testuser/append.txt"
+		client.addFile(filePath, []byte("0123"))
+
+		handle := newTestFileHandle(fs, client, filePath, openMode)
+
+		written, errno := handle.Write(context.Background(), []byte("abc"), 0)
+		if errno != fusefs.OK || written != 3 {
+			t.Fatalf("%q: failed to append, written %d, errno %v", openMode, written, errno)
+		}
+
+		data := client.getData(filePath)
+		if string(data) != "0123abc" {
+			t.Errorf("%q: expected data %q, got %q", openMode, "0123abc", data)
+		}
+	}
+}
+
+func TestFileHandleAppendAfterUnflushedWriteOfOtherHandle(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/append.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	writeHandle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	writeHandle.writer = &bufferingWriter{fakeWriter: fakeWriter{handle: writeHandle.iRODSFileHandle}}
+
+	// the mount path differs from the iRODS path
+	writeHandle.SetFile(NewFile(fs, 0, "/mnt/append.txt"))
+
+	_, errno := writeHandle.Write(context.Background(), []byte("4567"), 4)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to write, errno %v", errno)
+	}
+
+	appendHandle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeAppend)
+	appendHandle.SetFile(NewFile(fs, 0, "/mnt/append.txt"))
+
+	_, errno = appendHandle.Write(context.Background(), []byte("89"), 0)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to append, errno %v", errno)
+	}
+
+	errno = writeHandle.Flush(context.Background())
+	if errno != fusefs.OK {
+		t.Fatalf("failed to flush, errno %v", errno)
+	}
+
+	data := client.getData(filePath)
+	if string(data) != "0123456789" {
+		t.Errorf("expected data %q, got %q", "0123456789", data)
+	}
+}
+
+func TestFileHandleAppendConcurrently(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/append.txt"
+	client.addFile(filePath, []byte{})
+
+	handles := []*FileHandle{}
+	for i := 0; i < 4; i++ {
+		handles = append(handles, newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeAppend))
+	}
+
+	records := [][]byte{
+		bytes.Repeat([]byte("a"), 10),
+		bytes.Repeat([]byte("b"), 10),
+		bytes.Repeat([]byte("c"), 10),
+		bytes.Repeat([]byte("d"), 10),
+	}
+
+	recordsPerHandle := 25
+
+	wg := sync.WaitGroup{}
+	for i, handle := range handles {
+		wg.Add(1)
+		go func(handle *FileHandle, record []byte) {
+			defer wg.Done()
+
+			for j := 0; j < recordsPerHandle; j++ {
+				_, errno := handle.Write(context.Background(), record, 0)
+				if errno != fusefs.OK {
+					t.Errorf("failed to append, errno %v", errno)
+					return
+				}
+			}
+		}(handle, records[i])
+	}
+	wg.Wait()
+
+	data := client.getData(filePath)
+	if len(data) != len(records)*recordsPerHandle*10 {
+		t.Fatalf("expected %d bytes, got %d", len(records)*recordsPerHandle*10, len(data))
+	}
+
+	// records are not interleaved or overwritten
+	counts := map[byte]int{}
+	for offset := 0; offset < len(data); offset += 10 {
+		record := data[offset : offset+10]
+		if !bytes.Equal(record, bytes.Repeat(record[:1], 10)) {
+			t.Fatalf("record at %d is torn: %q", offset, record)
+		}
+		counts[record[0]]++
+	}
+
+	for _, record := range records {
+		if counts[record[0]] != recordsPerHandle {
+			t.Errorf("expected %d records of %q, got %d", recordsPerHandle, record[:1], counts[record[0]])
+		}
+	}
+}
+
+func TestFileHandleGetattrReportsWrittenSize(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/size.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	handle.writer = &bufferingWriter{fakeWriter: fakeWriter{handle: handle.iRODSFileHandle}}
+	handle.SetFile(NewFile(fs, 0, "/size.txt"))
+
+	getattr := func() fuse.AttrOut {
+		out := fuse.AttrOut{}
+		if errno := handle.Getattr(context.Background(), &out); errno != fusefs.OK {
+			t.Fatalf("failed to get attr, errno %v", errno)
+		}
+		return out
+	}
+
+	// not modified yet, iRODS knows the size
+	if out := getattr(); out.Size != 4 || out.Blocks != 1 {
+		t.Errorf("expected size 4 in 1 block, got %d in %d", out.Size, out.Blocks)
+	}
+
+	data := bytes.Repeat([]byte("x"), 1000)
+	if _, errno := handle.Write(context.Background(), data, 4); errno != fusefs.OK {
+		t.Fatalf("failed to write, errno %v", errno)
+	}
+
+	// the write is buffered, iRODS still has the old size
+	if size := len(client.getData(filePath)); size != 4 {
+		t.Fatalf("expected the write buffered, got %d bytes in iRODS", size)
+	}
+
+	if out := getattr(); out.Size != 1004 || out.Blocks != 2 {
+		t.Errorf("expected size 1004 in 2 blocks, got %d in %d", out.Size, out.Blocks)
+	}
+
+	if errno := handle.Release(context.Background()); errno != fusefs.OK {
+		t.Errorf("failed to release, errno %v", errno)
+	}
+}
+
+func TestFileHandleTruncateResetsOtherHandles(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/truncate.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	writeHandle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	writeHandle.SetFile(NewFile(fs, 0, "/mnt/truncate.txt"))
+
+	_, errno := writeHandle.Write(context.Background(), []byte("4567"), 4)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to write, errno %v", errno)
+	}
+
+	truncateHandle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	truncateHandle.SetFile(NewFile(fs, 0, "/mnt/truncate.txt"))
+
+	errno = truncateHandle.Truncate(context.Background(), 2)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to truncate, errno %v", errno)
+	}
+
+	if size, modified := writeHandle.getModifiedSize(); !modified || size != 2 {
+		t.Errorf("expected size of other handle reset to 2, got %d", size)
+	}
+}
+
+func TestFileHandleUpgradeToWriteIgnoresModeMask(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.fileModeMask = 0o400
+
+	filePath := "/testzone/home/testuser/masked.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	entry, err := client.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to stat - %v", err)
+	}
+
+	if mode := IRODSGetACL(context.Background(), fs, entry, false); mode != 0o400 {
+		t.Errorf("expected mode reported %o, got %o", 0o400, mode)
+	}
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadOnly)
+
+	errno := handle.upgradeToWrite(context.Background())
+	if errno != fusefs.OK {
+		t.Fatalf("expected upgrading a handle of a writable file to succeed, got errno %v", errno)
+	}
+
+	if !handle.openMode.IsWrite() {
+		t.Errorf("expected the handle upgraded, open mode %q", handle.openMode)
+	}
+}
+
+// blockingReader blocks reads until unblocked, and records if it is released while reading
+type blockingReader struct {
+	fakeReader
+
+	reading          chan bool
+	unblock          chan bool
+	inFlight         int32
+	releasedInFlight int32
+}
+
+func (reader *blockingReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	atomic.StoreInt32(&reader.inFlight, 1)
+	defer atomic.StoreInt32(&reader.inFlight, 0)
+
+	reader.reading <- true
+	<-reader.unblock
+	return reader.fakeReader.ReadAt(buffer, offset)
+}
+
+func (reader *blockingReader) Release() {
+	if atomic.LoadInt32(&reader.inFlight) == 1 {
+		atomic.StoreInt32(&reader.releasedInFlight, 1)
+	}
+}
+
+func TestFileHandleUpgradeToWriteWaitsForReads(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.UpgradeReadOnlyHandleOnWrite = true
+
+	filePath := "/testzone/home/testuser/upgrade.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadOnly)
+	reader := &blockingReader{
+		fakeReader:       fakeReader{handle: handle.iRODSFileHandle},
+		reading:          make(chan bool, 1),
+		unblock:          make(chan bool),
+		inFlight:         0,
+		releasedInFlight: 0,
+	}
+	handle.reader = reader
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		dest := make([]byte, 4)
+		if _, errno := handle.Read(context.Background(), dest, 0); errno != fusefs.OK {
+			t.Errorf("expected read to succeed, got errno %v", errno)
+		}
+	}()
+
+	<-reader.reading
+
+	upgradeDone := make(chan syscall.Errno, 1)
+	go func() {
+		upgradeDone <- handle.upgradeToWrite(context.Background())
+	}()
+
+	var errno syscall.Errno
+	select {
+	case errno = <-upgradeDone:
+		t.Errorf("expected upgrading to wait for the read in flight")
+		close(reader.unblock)
+		wg.Wait()
+	case <-time.After(100 * time.Millisecond):
+		close(reader.unblock)
+		wg.Wait()
+		errno = <-upgradeDone
+	}
+
+	if errno != fusefs.OK {
+		t.Fatalf("expected upgrading to succeed, got errno %v", errno)
+	}
+
+	if atomic.LoadInt32(&reader.releasedInFlight) != 0 {
+		t.Errorf("expected the reader released after the read in flight")
+	}
+
+	if !handle.openMode.IsWrite() {
+		t.Errorf("expected the handle upgraded, open mode %q", handle.openMode)
+	}
+}
+
+func TestFileHandleBrokenAfterFailingCommit(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.FsyncDurable = true
+
+	filePath := "/testzone/home/testuser/commit.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	irodsHandle := handle.iRODSFileHandle.(*fakeFileHandle)
+
+	// reopening after closing fails
+	client.setFailNext("OpenFile", irodsclient_types.NewFileNotFoundError(filePath))
+
+	errno := handle.Fsync(context.Background(), 0)
+	if errno == fusefs.OK {
+		t.Fatalf("expected fsync to fail")
+	}
+
+	if irodsHandle.closeCount() != 1 {
+		t.Errorf("expected the iRODS file handle closed once, got %d", irodsHandle.closeCount())
+	}
+
+	if _, errno := handle.Read(context.Background(), make([]byte, 4), 0); errno != syscall.EIO {
+		t.Errorf("expected read to fail with EIO, got %v", errno)
+	}
+
+	if _, errno := handle.Write(context.Background(), []byte("data"), 0); errno != syscall.EIO {
+		t.Errorf("expected write to fail with EIO, got %v", errno)
+	}
+
+	if errno := handle.Flush(context.Background()); errno != syscall.EIO {
+		t.Errorf("expected flush to fail with EIO, got %v", errno)
+	}
+
+	errno = handle.Release(context.Background())
+	if errno != fusefs.OK {
+		t.Errorf("failed to release, errno %v", errno)
+	}
+
+	// not closed again
+	if irodsHandle.closeCount() != 1 {
+		t.Errorf("expected the iRODS file handle closed once, got %d", irodsHandle.closeCount())
+	}
+
+	if fs.fileHandleMap.Get(handle.GetID()) != nil {
+		t.Errorf("expected the file handle removed")
+	}
+}
+
+// blockingWriter blocks writes until unblocked, and records if it is released while writing
+type blockingWriter struct {
+	fakeWriter
+
+	writing          chan bool
+	unblock          chan bool
+	inFlight         int32
+	releasedInFlight int32
+}
+
+func (writer *blockingWriter) WriteAt(data []byte, offset int64) (int, error) {
+	atomic.StoreInt32(&writer.inFlight, 1)
+	defer atomic.StoreInt32(&writer.inFlight, 0)
+
+	writer.writing <- true
+	<-writer.unblock
+	return writer.fakeWriter.WriteAt(data, offset)
+}
+
+func (writer *blockingWriter) Release() {
+	if atomic.LoadInt32(&writer.inFlight) == 1 {
+		atomic.StoreInt32(&writer.releasedInFlight, 1)
+	}
+}
+
+func TestFileHandleCommitWaitsForWrites(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.FsyncDurable = true
+
+	filePath := "/testzone/home/testuser/commit_write.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	writer := &blockingWriter{
+		fakeWriter:       fakeWriter{handle: handle.iRODSFileHandle},
+		writing:          make(chan bool, 1),
+		unblock:          make(chan bool),
+		inFlight:         0,
+		releasedInFlight: 0,
+	}
+	handle.writer = writer
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if _, errno := handle.Write(context.Background(), []byte("abcd"), 0); errno != fusefs.OK {
+			t.Errorf("expected write to succeed, got errno %v", errno)
+		}
+	}()
+
+	<-writer.writing
+
+	fsyncDone := make(chan syscall.Errno, 1)
+	go func() {
+		fsyncDone <- handle.Fsync(context.Background(), 0)
+	}()
+
+	var errno syscall.Errno
+	select {
+	case errno = <-fsyncDone:
+		t.Errorf("expected commit to wait for the write in flight")
+		close(writer.unblock)
+		wg.Wait()
+	case <-time.After(100 * time.Millisecond):
+		close(writer.unblock)
+		wg.Wait()
+		errno = <-fsyncDone
+	}
+
+	if errno != fusefs.OK {
+		t.Fatalf("expected fsync to succeed, got errno %v", errno)
+	}
+
+	if atomic.LoadInt32(&writer.releasedInFlight) != 0 {
+		t.Errorf("expected the writer released after the write in flight")
+	}
+
+	if data := client.getData(filePath); string(data) != "abcd" {
+		t.Errorf("expected %q committed, got %q", "abcd", data)
+	}
+
+	if errno := handle.Release(context.Background()); errno != fusefs.OK {
+		t.Errorf("failed to release, errno %v", errno)
+	}
+}
+
+// failingWriter fails at writing back data buffered, like the async writers of irodsfs-common
+type failingWriter struct {
+	fakeWriter
+}
+
+func (writer *failingWriter) GetError() error {
+	return fmt.Errorf("failed to write back data")
+}
+
+func TestFileHandleReleaseClosesWithFailingWriter(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/failing.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	handle.writer = &failingWriter{fakeWriter: fakeWriter{handle: handle.iRODSFileHandle}}
+	irodsHandle := handle.iRODSFileHandle.(*fakeFileHandle)
+
+	if errno := handle.Release(context.Background()); errno != syscall.EREMOTEIO {
+		t.Errorf("expected EREMOTEIO, got %v", errno)
+	}
+
+	// the handle is closed and removed, not leaked
+	if irodsHandle.closeCount() != 1 {
+		t.Errorf("expected the iRODS file handle closed once, got %d", irodsHandle.closeCount())
+	}
+
+	if fs.fileHandleMap.Get(handle.GetID()) != nil {
+		t.Errorf("expected the file handle removed")
+	}
+}
+
+func TestFileHandleReleaseComputesChecksum(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ChecksumOnWrite = true
+
+	filePath := "/testzone/home/testuser/checksum.txt"
+	client.addFile(filePath, []byte{})
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	if _, errno := handle.Write(context.Background(), []byte("0123"), 0); errno != fusefs.OK {
+		t.Fatalf("failed to write, errno %v", errno)
+	}
+
+	if errno := handle.Release(context.Background()); errno != fusefs.OK {
+		t.Fatalf("failed to release, errno %v", errno)
+	}
+
+	entry, err := client.Stat(filePath)
+	if err != nil {
+		t.Fatalf("failed to stat - %v", err)
+	}
+
+	if len(entry.CheckSum) == 0 {
+		t.Errorf("expected a checksum computed after closing the written file")
+	}
+
+	// failures are only logged unless strict
+	client.setFailNext("ComputeChecksum", irodsclient_types.NewFileNotFoundError(filePath))
+	handle = newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	handle.Write(context.Background(), []byte("4567"), 4)
+	if errno := handle.Release(context.Background()); errno != fusefs.OK {
+		t.Errorf("expected the checksum failure ignored, got errno %v", errno)
+	}
+
+	fs.config.ChecksumOnWriteStrict = true
+	client.setFailNext("ComputeChecksum", irodsclient_types.NewFileNotFoundError(filePath))
+	handle = newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	handle.Write(context.Background(), []byte("89"), 8)
+	if errno := handle.Release(context.Background()); errno != syscall.EIO {
+		t.Errorf("expected EIO in strict mode, got errno %v", errno)
+	}
+}
+
+func TestOpenDataFileFallsBackFromPreferredResource(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.PreferredResource = "preferredResc"
+
+	filePath := "/testzone/home/testuser/replica.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	// no replica on the preferred resource
+	client.setFailNext("OpenFile", irodsclient_types.NewFileNotFoundError(filePath))
+
+	handle, err := fs.openDataFile(filePath, irodsclient_types.FileOpenModeReadOnly)
+	if err != nil {
+		t.Fatalf("expected to open other replica, got %v", err)
+	}
+	handle.Close()
+
+	if calls := client.getCalls("OpenFile"); calls != 2 {
+		t.Errorf("expected 2 opens, got %d", calls)
+	}
+
+	// a missing data object is not found on fallback either
+	_, err = fs.openDataFile("/testzone/home/testuser/missing.txt", irodsclient_types.FileOpenModeReadOnly)
+	if !irodsclient_types.IsFileNotFoundError(err) {
+		t.Errorf("expected file not found, got %v", err)
+	}
+}
+
+// newRangeReadTestFS returns a test file system reading files in parallel, so a reader set up opens sub-streams
+func newRangeReadTestFS(client *fakeFSClient, deferPrefetch bool) *IRODSFS {
+	fs := newTestFS(client)
+	fs.config.DeferPrefetch = deferPrefetch
+	fs.config.ParallelRead = true
+	fs.config.ConnectionMax = 5
+	fs.config.IOBlockSize = 4
+	fs.parallelStreamBudget = NewParallelStreamBudget(4)
+	return fs
+}
+
+func TestFileHandleRangeRead(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newRangeReadTestFS(client, true)
+
+	filePath := "/testzone/home/testuser/range.bin"
+	client.addFile(filePath, []byte("0123456789"))
+
+	handle, err := NewFileHandleLazy(fs, filePath, irodsclient_types.FileOpenModeReadOnly)
+	if err != nil {
+		t.Fatalf("failed to create a file handle - %v", err)
+	}
+	handle.SetFile(NewFile(fs, 0, filePath))
+
+	// the first read is served without opening the handle
+	dest := make([]byte, 4)
+	result, errno := handle.Read(context.Background(), dest, 3)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to read, errno %v", errno)
+	}
+	if data, _ := result.Bytes(nil); string(data) != "3456" {
+		t.Errorf("expected %q, got %q", "3456", data)
+	}
+
+	if calls := client.getCalls("OpenFile"); calls != 1 {
+		t.Errorf("expected 1 open, got %d", calls)
+	}
+	if handle.iRODSFileHandle != nil || handle.reader != nil {
+		t.Errorf("expected the handle not opened after the first read")
+	}
+
+	// a read past the end of the file
+	result, errno = handle.Read(context.Background(), dest, 10)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to read, errno %v", errno)
+	}
+	if data, _ := result.Bytes(nil); len(data) != 0 {
+		t.Errorf("expected no data at the end of the file, got %q", data)
+	}
+
+	// the handle is opened at the second read, with the reader of read-only handles
+	if handle.iRODSFileHandle == nil {
+		t.Fatalf("expected the handle opened at the second read")
+	}
+	if _, ok := handle.reader.(*ParallelReader); !ok {
+		t.Errorf("expected a parallel reader, got %T", handle.reader)
+	}
+
+	result, errno = handle.Read(context.Background(), dest, 8)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to read, errno %v", errno)
+	}
+	if data, _ := result.Bytes(nil); string(data) != "89" {
+		t.Errorf("expected %q, got %q", "89", data)
+	}
+
+	if errno := handle.Release(context.Background()); errno != fusefs.OK {
+		t.Errorf("failed to release, errno %v", errno)
+	}
+}
+
+func TestFileHandleRangeReadNotFound(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newRangeReadTestFS(client, true)
+
+	filePath := "/testzone/home/testuser/missing.bin"
+
+	handle, err := NewFileHandleLazy(fs, filePath, irodsclient_types.FileOpenModeReadOnly)
+	if err != nil {
+		t.Fatalf("failed to create a file handle - %v", err)
+	}
+	handle.SetFile(NewFile(fs, 0, filePath))
+
+	_, errno := handle.Read(context.Background(), make([]byte, 4), 0)
+	if errno != syscall.EREMOTEIO {
+		t.Errorf("expected EREMOTEIO, got %v", errno)
+	}
+
+	if errno := handle.Release(context.Background()); errno != fusefs.OK {
+		t.Errorf("failed to release, errno %v", errno)
+	}
+}
+
+// BenchmarkRangedReads opens a file, reads a range and closes it, as an HTTP gateway serves a range request
+func BenchmarkRangedReads(b *testing.B) {
+	for _, deferPrefetch := range []bool{false, true} {
+		b.Run(fmt.Sprintf("defer_prefetch=%t", deferPrefetch), func(b *testing.B) {
+			client := newFakeFSClient()
+			fs := newRangeReadTestFS(client, deferPrefetch)
+			fs.config.IOBlockSize = 64 * 1024
+
+			filePath := "/testzone/home/testuser/range.bin"
+			client.addFile(filePath, bytes.Repeat([]byte("0123456789abcdef"), 64*1024))
+
+			dest := make([]byte, 4096)
+			b.ResetTimer()
+			openCalls := client.getCalls("OpenFile")
+			for i := 0; i < b.N; i++ {
+				handle, err := NewFileHandleLazy(fs, filePath, irodsclient_types.FileOpenModeReadOnly)
+				if err != nil {
+					b.Fatalf("failed to create a file handle - %v", err)
+				}
+				handle.SetFile(NewFile(fs, 0, filePath))
+
+				offset := int64(i%256) * int64(len(dest))
+				if _, errno := handle.Read(context.Background(), dest, offset); errno != fusefs.OK {
+					b.Fatalf("failed to read, errno %v", errno)
+				}
+
+				if errno := handle.Release(context.Background()); errno != fusefs.OK {
+					b.Fatalf("failed to release, errno %v", errno)
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(client.getCalls("OpenFile")-openCalls)/float64(b.N), "opens/op")
+		})
+	}
+}
+
+func TestFileHandleLseek(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/seek.txt"
+	client.addFile(filePath, []byte("0123456789"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadOnly)
+
+	negative := func(off int64) uint64 {
+		return uint64(off)
+	}
+
+	testCases := []struct {
+		off      uint64
+		whence   uint32
+		position uint64
+		errno    syscall.Errno
+	}{
+		{4, 0, 4, fusefs.OK},
+		{0, 2, 10, fusefs.OK},
+		{negative(-1), 2, 9, fusefs.OK},
+		{negative(-10), 2, 0, fusefs.OK},
+		{negative(-11), 2, 0, syscall.EINVAL},
+		{5, 2, 15, fusefs.OK},
+		{3, seekData, 3, fusefs.OK},
+		{10, seekData, 0, syscall.ENXIO},
+		{negative(-1), seekData, 0, syscall.ENXIO},
+		{3, seekHole, 10, fusefs.OK},
+		{negative(-1), seekHole, 0, syscall.ENXIO},
+		{0, 7, 0, syscall.EINVAL},
+	}
+
+	for _, testCase := range testCases {
+		position, errno := handle.Lseek(context.Background(), testCase.off, testCase.whence)
+		if errno != testCase.errno {
+			t.Errorf("offset %d, whence %d: expected errno %v, got %v", int64(testCase.off), testCase.whence, testCase.errno, errno)
+			continue
+		}
+
+		if errno == fusefs.OK && position != testCase.position {
+			t.Errorf("offset %d, whence %d: expected position %d, got %d", int64(testCase.off), testCase.whence, testCase.position, position)
+		}
+	}
+}
+
+func TestFileHandleAllocate(t *testing.T) {
+	const fallocFlPunchHole uint32 = 0x02 // FALLOC_FL_PUNCH_HOLE
+
+	testCases := []struct {
+		name         string
+		off          uint64
+		size         uint64
+		mode         uint32
+		errno        syscall.Errno
+		expectedData string
+	}{
+		{"extend beyond EOF", 2, 6, 0, fusefs.OK, "0123\x00\x00\x00\x00"},
+		{"within size", 0, 4, 0, fusefs.OK, "0123"},
+		{"keep size beyond EOF", 2, 6, fallocFlKeepSize, fusefs.OK, "0123"},
+		{"punch hole", 0, 2, fallocFlPunchHole | fallocFlKeepSize, syscall.EOPNOTSUPP, "0123"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+
+			filePath := "/testzone/home/testuser/allocate.db"
+			client.addFile(filePath, []byte("0123"))
+
+			handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+
+			errno := handle.Allocate(context.Background(), testCase.off, testCase.size, testCase.mode)
+			if errno != testCase.errno {
+				t.Fatalf("expected errno %v, got %v", testCase.errno, errno)
+			}
+
+			if data := client.getData(filePath); string(data) != testCase.expectedData {
+				t.Errorf("expected data %q, got %q", testCase.expectedData, data)
+			}
+
+			truncated := len(testCase.expectedData) != 4
+			if calls := client.getCalls("TruncateFile"); (calls > 0) != truncated {
+				t.Errorf("expected truncated %t, got %d truncate calls", truncated, calls)
+			}
+		})
+	}
+}
+
+func TestFileHandleIOHintSeedsPrefetching(t *testing.T) {
+	testCases := []struct {
+		name        string
+		prefetching bool
+	}{
+		{"app.sqlite", false},
+		{"video.mp4", true},
+		{"notes.txt", true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+
+			filePath := "/testzone/home/testuser/" + testCase.name
+			client.addFile(filePath, []byte("0123456789"))
+
+			handle, err := NewFileHandleLazy(fs, filePath, irodsclient_types.FileOpenModeReadOnly)
+			if err != nil {
+				t.Fatalf("failed to create a file handle - %v", err)
+			}
+			handle.SetFile(NewFile(fs, 0, filePath))
+
+			// the reader is selected at the first read, before any access pattern is seen
+			result, errno := handle.Read(context.Background(), make([]byte, 4), 0)
+			if errno != fusefs.OK {
+				t.Fatalf("failed to read, errno %v", errno)
+			}
+			if data, _ := result.Bytes(nil); string(data) != "0123" {
+				t.Errorf("expected %q, got %q", "0123", data)
+			}
+
+			if handle.prefetching != testCase.prefetching {
+				t.Errorf("expected prefetching %t, got %t", testCase.prefetching, handle.prefetching)
+			}
+
+			if errno := handle.Release(context.Background()); errno != fusefs.OK {
+				t.Errorf("failed to release, errno %v", errno)
+			}
+		})
+	}
+}
+
+func TestFileHandleAuditClientProcess(t *testing.T) {
+	for _, auditClientProcess := range []bool{false, true} {
+		t.Run(fmt.Sprintf("audit_client_process=%t", auditClientProcess), func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+			fs.config.AuditClientProcess = auditClientProcess
+
+			filePath := "/testzone/home/testuser/audited.txt"
+			client.addFile(filePath, []byte(""))
+
+			handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeWriteOnly)
+
+			// the request comes from this test process
+			pid := uint32(os.Getpid())
+			comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+			if err != nil {
+				t.Fatalf("failed to read command name - %v", err)
+			}
+
+			ctx := fuse.NewContext(context.Background(), &fuse.Caller{Owner: fuse.Owner{Uid: 1000, Gid: 1000}, Pid: pid})
+			for i := 0; i < 3; i++ {
+				if _, errno := handle.Write(ctx, []byte("data"), int64(i*4)); errno != fusefs.OK {
+					t.Fatalf("failed to write, errno %v", errno)
+				}
+			}
+
+			// recorded once per handle
+			expectedCalls := 0
+			if auditClientProcess {
+				expectedCalls = 1
+			}
+			if calls := client.getCalls("SetXattr"); calls != expectedCalls {
+				t.Errorf("expected %d AVU writes, got %d", expectedCalls, calls)
+			}
+
+			meta, err := client.GetXattr(filePath, ClientProcessXattrName)
+			if err != nil {
+				t.Fatalf("failed to get the AVU - %v", err)
+			}
+
+			if !auditClientProcess {
+				if meta != nil {
+					t.Errorf("expected no AVU recorded, got %q", meta.Value)
+				}
+				return
+			}
+
+			if meta == nil {
+				t.Fatalf("expected the AVU recorded")
+			}
+
+			expected := fmt.Sprintf("pid=%d,uid=1000,comm=%s", pid, strings.TrimSpace(string(comm)))
+			if meta.Value != expected {
+				t.Errorf("expected %q recorded, got %q", expected, meta.Value)
+			}
+		})
+	}
+}
+
+// countingReader counts reads, and is released once, like a prefetching reader
+type countingReader struct {
+	fakeReader
+
+	reads    int32
+	released int32
+}
+
+func (reader *countingReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	atomic.AddInt32(&reader.reads, 1)
+	return reader.fakeReader.ReadAt(buffer, offset)
+}
+
+func (reader *countingReader) Release() {
+	atomic.AddInt32(&reader.released, 1)
+}
+
+func TestFileHandleCancelPrefetchOnSeek(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.CancelPrefetchOnSeek = true
+	fs.config.IOBlockSize = 4
+	fs.config.ReadAheadMax = 0
+
+	filePath := "/testzone/home/testuser/seek.bin"
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	client.addFile(filePath, data)
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadOnly)
+	prefetchingReader := &countingReader{fakeReader: fakeReader{handle: handle.iRODSFileHandle}}
+	handle.reader = prefetchingReader
+	handle.prefetching = true
+	handle.prefetchWindow = 8
+
+	read := func(offset int64) {
+		dest := make([]byte, 4)
+		result, errno := handle.Read(context.Background(), dest, offset)
+		if errno != fusefs.OK {
+			t.Fatalf("failed to read at %d, errno %v", offset, errno)
+		}
+
+		if readData, _ := result.Bytes(nil); string(readData) != string(data[offset:offset+4]) {
+			t.Errorf("expected %q at %d, got %q", data[offset:offset+4], offset, readData)
+		}
+	}
+
+	// sequential reads keep prefetching
+	read(0)
+	read(4)
+	read(8)
+	if !handle.prefetching || handle.reader != prefetchingReader {
+		t.Fatalf("expected prefetching kept on sequential reads")
+	}
+
+	// seeking away cancels data being prefetched
+	read(28)
+	if !waitFor(5*time.Second, func() bool { return atomic.LoadInt32(&prefetchingReader.released) == 1 }) {
+		t.Errorf("expected the prefetching reader released on seek")
+	}
+
+	if handle.prefetching || handle.prefetchWindow != 0 {
+		t.Errorf("expected prefetching cancelled on seek")
+	}
+
+	// reads after the seek are not served by the cancelled reader
+	reads := atomic.LoadInt32(&prefetchingReader.reads)
+	if reads != 3 {
+		t.Errorf("expected 3 reads through the prefetching reader, got %d", reads)
+	}
+
+	// seeking backward, then reading sequentially
+	read(12)
+	read(16)
+	read(20)
+	read(24)
+	if handle.prefetching {
+		t.Errorf("expected prefetching not resumed before %d sequential reads", prefetchResumeReads)
+	}
+
+	// prefetching resumes when reads become sequential again
+	read(28)
+	if !handle.prefetching {
+		t.Errorf("expected prefetching resumed after %d sequential reads", prefetchResumeReads)
+	}
+
+	if reads := atomic.LoadInt32(&prefetchingReader.reads); reads != 3 {
+		t.Errorf("expected no more reads through the cancelled reader, got %d", reads)
+	}
+}
+
+func TestFileHandleCopyFileRange(t *testing.T) {
+	testCases := []struct {
+		name         string
+		offIn        uint64
+		offOut       uint64
+		length       uint64
+		destData     string
+		pool         bool
+		copied       uint32
+		errno        syscall.Errno
+		expectedData string
+	}{
+		{"whole file", 0, 0, 1 << 20, "", false, 10, fusefs.OK, "0123456789"},
+		{"partial range", 0, 0, 4, "", false, 0, syscall.ENOTSUP, ""},
+		{"source offset", 2, 0, 1 << 20, "", false, 0, syscall.ENOTSUP, ""},
+		{"dest offset", 0, 2, 1 << 20, "", false, 0, syscall.ENOTSUP, ""},
+		{"dest not empty", 0, 0, 1 << 20, "abc", false, 0, syscall.ENOTSUP, "abc"},
+		{"no server-side copy", 0, 0, 1 << 20, "", true, 0, syscall.ENOTSUP, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+
+			srcPath := "/testzone/home/testuser/src.bin"
+			destPath := "/testzone/home/testuser/dest.bin"
+			client.addFile(srcPath, []byte("0123456789"))
+			client.addFile(destPath, []byte(testCase.destData))
+
+			if testCase.pool {
+				// clients which cannot copy on the server, e.g., irodsfs-pool clients
+				fs.session = newFSSession(&unitlessFSClient{IRODSFSClient: client}, nil)
+			}
+
+			in := newTestFileHandle(fs, client, srcPath, irodsclient_types.FileOpenModeReadOnly)
+			out := newTestFileHandle(fs, client, destPath, irodsclient_types.FileOpenModeWriteOnly)
+
+			copied, errno := in.CopyFileRange(context.Background(), testCase.offIn, out, testCase.offOut, testCase.length)
+			if errno != testCase.errno || copied != testCase.copied {
+				t.Fatalf("expected %d bytes copied with errno %v, got %d with %v", testCase.copied, testCase.errno, copied, errno)
+			}
+
+			if data := client.getData(destPath); string(data) != testCase.expectedData {
+				t.Errorf("expected data %q, got %q", testCase.expectedData, data)
+			}
+
+			copiedOnServer := errno == fusefs.OK
+			if calls := client.getCalls("CopyFile"); (calls > 0) != copiedOnServer {
+				t.Errorf("expected copied on the server %t, got %d copies", copiedOnServer, calls)
+			}
+
+			// the out handle is reopened to write after the copy
+			if out.isBroken() || out.iRODSFileHandle == nil || out.iRODSFileHandle.GetEntry().Size != int64(len(testCase.expectedData)) {
+				t.Errorf("expected the out handle open on %d bytes", len(testCase.expectedData))
+			}
+
+			if errno := out.Release(context.Background()); errno != fusefs.OK {
+				t.Errorf("failed to release the out handle, errno %v", errno)
+			}
+		})
+	}
+}
+
+func TestFileHandleCopyFileRangeCarriesMode(t *testing.T) {
+	testCases := []struct {
+		name         string
+		chmodACL     bool
+		publicAccess irodsclient_types.IRODSAccessLevelType
+	}{
+		{"without chmod_acl", false, irodsclient_types.IRODSAccessLevelNull},
+		{"with chmod_acl", true, irodsclient_types.IRODSAccessLevelReadObject},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+			fs.config.ChmodACL = testCase.chmodACL
+
+			srcPath := "/testzone/home/testuser/src.bin"
+			destPath := "/testzone/home/testuser/dest.bin"
+			client.addFile(srcPath, []byte("0123456789"))
+			client.addFile(destPath, []byte{})
+
+			// mode 0644 given by chmod
+			client.setACLs(srcPath, []*irodsclient_types.IRODSAccess{
+				{Path: srcPath, UserName: irodsPublicGroupName, UserZone: testZone, UserType: irodsclient_types.IRODSUserRodsGroup, AccessLevel: irodsclient_types.IRODSAccessLevelReadObject},
+			})
+
+			in := newTestFileHandle(fs, client, srcPath, irodsclient_types.FileOpenModeReadOnly)
+			out := newTestFileHandle(fs, client, destPath, irodsclient_types.FileOpenModeWriteOnly)
+
+			if _, errno := in.CopyFileRange(context.Background(), 0, out, 0, 1<<20); errno != fusefs.OK {
+				t.Fatalf("failed to copy - %v", errno)
+			}
+
+			publicAccess := irodsclient_types.IRODSAccessLevelNull
+			accesses, _ := client.ListFileACLs(destPath)
+			for _, access := range accesses {
+				if access.UserName == irodsPublicGroupName {
+					publicAccess = access.AccessLevel
+				}
+			}
+
+			if publicAccess != testCase.publicAccess {
+				t.Errorf("expected public access %q of the copy, got %q", testCase.publicAccess, publicAccess)
+			}
+
+			if errno := out.Release(context.Background()); errno != fusefs.OK {
+				t.Errorf("failed to release the out handle, errno %v", errno)
+			}
+		})
+	}
+}
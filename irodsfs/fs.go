@@ -1,6 +1,12 @@
 package irodsfs
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -12,7 +18,6 @@ import (
 	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
 	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
 	monitor_types "github.com/cyverse/irodsfs-monitor/types"
-	irodspoolclient "github.com/cyverse/irodsfs-pool/client"
 	"golang.org/x/xerrors"
 
 	fusefs "github.com/hanwen/go-fuse/v2/fs"
@@ -28,12 +33,18 @@ const (
 	Subtype string = "irodsfs"
 )
 
+const (
+	// tasks queued per I/O worker before submitters wait
+	ioWorkerQueueSizePerWorker int = 16
+	// metadata cached by the client bypassing the cache expires right away, a timeout of 0 never expires
+	uncachedMetadataCacheTimeout time.Duration = time.Nanosecond
+)
+
 // GetFuseOptions returns fuse options
 func GetFuseOptions(config *commons.Config) *fusefs.Options {
 	options := &fusefs.Options{}
 
-	// TODO: handle fuse specific options in config.FuseOptions
-	options.AllowOther = config.AllowOther
+	options.AllowOther = config.AllowOther || commons.HasFuseOption(config.FuseOptions, "allow_other")
 	if config.Debug && config.Foreground {
 		options.Debug = true
 	}
@@ -44,12 +55,32 @@ func GetFuseOptions(config *commons.Config) *fusefs.Options {
 	options.UID = uint32(config.UID)
 	options.GID = uint32(config.GID)
 	options.MaxReadAhead = config.ReadAheadMax
+	options.MaxWrite = config.ReadWriteSize
 	options.FsName = FSName
 	options.Name = Subtype
 	options.SingleThreaded = false
 	options.IgnoreSecurityLabels = true
 	options.EnableLocks = true
-	options.DisableReadDirPlus = true
+	// the kernel checks permissions with mode bits only, system.posix_acl_access presented by posix_acl is informational
+	// enforcing it would let local users named in iRODS ACLs access files as the client user
+	options.EnableAcl = false
+	// go-fuse looks up every entry listed to return attributes with readdir, served from the dir attr cache filled by the listing
+	options.DisableReadDirPlus = !config.ReaddirPlus
+
+	if config.ReadOnly && !commons.HasFuseOption(config.FuseOptions, "ro") {
+		// the kernel rejects writes, and statfs reports ST_RDONLY
+		options.Options = append(options.Options, "ro")
+	}
+
+	// validated by config
+	for _, fuseOption := range commons.DedupFuseOptions(config.FuseOptions) {
+		if fuseOption == "allow_other" {
+			// set by go-fuse
+			continue
+		}
+
+		options.Options = append(options.Options, fuseOption)
+	}
 	return options
 }
 
@@ -59,19 +90,68 @@ type IRODSFS struct {
 
 	fuseServer    *fuse.Server
 	inodeManager  *irodsfs_common_inode.InodeManager
+	pathInodeMap  *PathInodeIDMap // nil if inode ids are derived from iRODS entry ids
 	vpathManager  *irodsfs_common_vpath.VPathManager
-	fsClient      irodsfs_common_irods.IRODSFSClient
+	pathMappings  []irodsfs_common_vpath.VPathMapping // path mappings with data objects resolved
+	session       *fsSession                          // replaced on reconnect, accessed with acquireSession
+	sessionMutex  sync.RWMutex
 	fileHandleMap *FileHandleMap
 	userGroupsMap map[string]*irodsclient_types.IRODSUser
 
-	uid uint32
-	gid uint32
+	sharedReadHandleMap  *SharedReadHandleMap
+	metadataRateLimiter  *MetadataRateLimiter
+	dirAttrCache         *DirAttrCache
+	modifyTimeCache      *ModifyTimeCache      // nil if modify times are not persisted
+	defaultResourceCache *DefaultResourceCache // nil if default resources of collections are not used
+	replicaCache         *ReplicaCache         // nil if replicas are not used, for replica checksums or modify time
+	clockSkewChecker     *ClockSkewChecker
+	memoryMonitor        *MemoryPressureMonitor
+	metrics              *Metrics                                      // nil if metrics are not exported
+	cacheEventHandlers   map[irodsfs_common_irods.IRODSFSClient]string // client-handler ID mapping
+	terminatedErrno      syscall.Errno                                 // returned for operations after termination
+	fileModeMask         os.FileMode                                   // applied to modes of files derived from ACLs
+	dirModeMask          os.FileMode                                   // applied to modes of dirs derived from ACLs
+	appendLocks          *PathLockMap                                  // serializes appending writes per path
+	remoteLockPathLocks  *PathLockMap                                  // serializes updates of remote locks per path
+	createLocks          *PathLockMap                                  // serializes exclusive creates per path
+	parallelStreamBudget *ParallelStreamBudget                         // nil if parallel reads are disabled
+	localLockManagers    *FileHandleLocalLockManagerMap                // local locks shared by file handles of the same path
+	listings             listingGroup                                  // listings of dirs in progress, shared by callers
+
+	readBandwidthLimiter  *BandwidthLimiter // nil if unlimited
+	writeBandwidthLimiter *BandwidthLimiter // nil if unlimited
+
+	ioWorkerPool     *WorkerPool       // nil if background tasks run in their own goroutines
+	writeBackFlusher *WriteBackFlusher // nil if write-back writers flush by themselves
+	changePoller     *ChangePoller     // nil if changes by other clients are not polled
+	adminServer      *AdminServer      // nil if the admin socket is not served
+	ruleRunner       *RuleRunner       // nil if rule execution is not allowed
+	bundleCache      *BundleCache      // nil if small files are not served from bundles of collections
+
+	poolConnector            *PoolConnector // nil if irodsfs-pool is not used
+	poolMonitorTerminateChan chan bool
+
+	account                     *irodsclient_types.IRODSAccount
+	fsConfig                    *irodsclient_fs.FileSystemConfig
+	dataFSConfig                *irodsclient_fs.FileSystemConfig   // nil if data transfer shares fsClient
+	uncachedFSClient            irodsfs_common_irods.IRODSFSClient // bypasses the metadata cache, nil if irodsfs-pool is used
+	sessionGeneration           uint64                             // increased on every reconnect
+	sessionMonitorTerminateChan chan bool
+	reconnectDisabled           bool // set on authentication failure, not to retry endlessly
+	reconnectMutex              sync.Mutex
+
+	uid          uint32
+	gid          uint32
+	userMappings map[string]commons.UserMapping // key is iRODS user name, owners not mapped are reported as uid and gid
 
 	reportClient         irodsfs_common_report.IRODSFSReportClient
 	instanceReportClient irodsfs_common_report.IRODSFSInstanceReportClient
 
 	operationIDCurrent uint64
+	lastOperationTime  int64 // unix nano, accessed atomically
 
+	mountTime  time.Time
+	draining   int32 // 1 while shutting down, new files are not opened, accessed atomically
 	terminated bool
 }
 
@@ -84,48 +164,27 @@ func NewFileSystem(config *commons.Config) (*IRODSFS, error) {
 
 	defer irodsfs_common_utils.StackTraceFromPanic(logger)
 
-	authScheme := irodsclient_types.GetAuthScheme(config.AuthScheme)
-	if authScheme == irodsclient_types.AuthSchemeUnknown {
-		authScheme = irodsclient_types.AuthSchemeNative
+	terminatedErrno, err := config.GetTerminatedErrno()
+	if err != nil {
+		return nil, err
 	}
 
-	csNegotiation, err := irodsclient_types.GetCSNegotiationRequire(config.CSNegotiationPolicy)
+	fileModeMask, err := config.GetFileModeMask()
 	if err != nil {
 		return nil, err
 	}
 
-	account, err := irodsclient_types.CreateIRODSProxyAccount(config.Host, config.Port,
-		config.ClientUser, config.Zone, config.ProxyUser, config.Zone,
-		authScheme, config.Password, config.Resource)
+	dirModeMask, err := config.GetDirModeMask()
 	if err != nil {
-		accountErr := xerrors.Errorf("failed to create IRODS Account: %w", err)
-		logger.Errorf("%+v", accountErr)
-		return nil, accountErr
+		return nil, err
 	}
 
-	logger.Infof("Connect to IRODS server using %q auth scheme", string(authScheme))
-
-	// optional for ssl,
-	// no harm if it is not ssl
-	sslConfig, err := irodsclient_types.CreateIRODSSSLConfig(config.CACertificateFile, config.CACertificatePath, config.EncryptionKeySize,
-		config.EncryptionAlgorithm, config.SaltSize, config.HashRounds)
+	account, err := newIRODSAccount(config)
 	if err != nil {
-		sslErr := xerrors.Errorf("failed to create IRODS SSL Config: %w", err)
-		logger.Errorf("%+v", sslErr)
-		return nil, sslErr
+		return nil, err
 	}
 
-	if authScheme == irodsclient_types.AuthSchemePAM {
-		logger.Info("PAM requires SSL, enabling CS negotiation")
-
-		account.SetSSLConfiguration(sslConfig)
-		account.SetCSNegotiation(true, irodsclient_types.CSNegotiationRequireSSL)
-	} else if config.ClientServerNegotiation {
-		logger.Info("Enabling CS negotiation to turn on SSL")
-
-		account.SetSSLConfiguration(sslConfig)
-		account.SetCSNegotiation(config.ClientServerNegotiation, csNegotiation)
-	}
+	authScheme := account.AuthenticationScheme
 
 	cacheTimeoutSettings := []irodsclient_fs.MetadataCacheTimeoutSetting{}
 	for _, metadataCacheTimeoutSetting := range config.MetadataCacheTimeoutSettings {
@@ -139,6 +198,15 @@ func NewFileSystem(config *commons.Config) (*IRODSFS, error) {
 		}
 	}
 
+	if config.ConnectionKeepaliveInterval > 0 {
+		// keep-alive requests must reach the server
+		cacheTimeoutSettings = append(cacheTimeoutSettings, irodsclient_fs.MetadataCacheTimeoutSetting{
+			Path:    getKeepalivePath(config.Zone),
+			Timeout: uncachedMetadataCacheTimeout,
+			Inherit: false,
+		})
+	}
+
 	fsConfig := irodsclient_fs.NewFileSystemConfig(
 		FSName,
 		commons.ConnectionErrorTimeout,
@@ -154,27 +222,20 @@ func NewFileSystem(config *commons.Config) (*IRODSFS, error) {
 
 	logger.Info("Initializing an iRODS file system client")
 	var fsClient irodsfs_common_irods.IRODSFSClient = nil
+	var poolConnector *PoolConnector
 	if len(config.PoolEndpoint) > 0 {
 		// use pool driver
 		logger.Info("Initializing irodsfs-pool fs client")
-		poolClient := irodspoolclient.NewPoolServiceClient(config.PoolEndpoint, time.Duration(config.OperationTimeout), config.InstanceID)
-		err = poolClient.Connect()
-		if err != nil {
-			clientErr := xerrors.Errorf("failed to connect to irodsfs-pool server %q: %w", config.PoolEndpoint, err)
-			logger.Errorf("%+v", clientErr)
-			return nil, clientErr
-		}
-
-		fsClient, err = poolClient.NewSession(account, FSName)
+		poolConnector = NewPoolConnector(config.PoolEndpoint, time.Duration(config.OperationTimeout), config.InstanceID, account)
+		fsClient, _, err = poolConnector.Connect()
 		if err != nil {
-			sessionErr := xerrors.Errorf("failed to create a new irodsfs-pool fs client: %w", err)
-			logger.Errorf("%+v", sessionErr)
-			return nil, sessionErr
+			logger.Errorf("%+v", err)
+			return nil, err
 		}
 	} else {
 		// use go-irodsclient driver
 		logger.Info("Initializing an iRODS native file system client")
-		fsClient, err = irodsfs_common_irods.NewIRODSFSClientDirect(account, fsConfig)
+		fsClient, err = newIRODSFSClientDirect(config, account, fsConfig)
 		if err != nil {
 			clientErr := xerrors.Errorf("failed to create a new go-irodsclient fs client: %w", err)
 			logger.Errorf("%+v", clientErr)
@@ -182,13 +243,97 @@ func NewFileSystem(config *commons.Config) (*IRODSFS, error) {
 		}
 	}
 
+	var dataFSClient irodsfs_common_irods.IRODSFSClient = nil
+	var dataFSConfig *irodsclient_fs.FileSystemConfig = nil
+	if config.DataConnectionMax > 0 {
+		if len(config.PoolEndpoint) > 0 {
+			// irodsfs-pool server manages connections
+			logger.Info("Ignoring data connection max as irodsfs-pool server manages connections")
+		} else {
+			// dedicated connections for data transfer, so long transfers do not block metadata operations
+			logger.Infof("Initializing an iRODS native file system client for data transfer, max connections %d", config.DataConnectionMax)
+			dataFSConfig = irodsclient_fs.NewFileSystemConfig(
+				FSName,
+				commons.ConnectionErrorTimeout,
+				0,
+				time.Duration(config.ConnectionLifespan),
+				time.Duration(config.OperationTimeout), time.Duration(config.ConnectionIdleTimeout),
+				config.DataConnectionMax, commons.TCPBufferSizeDefault,
+				time.Duration(config.MetadataCacheTimeout), time.Duration(config.MetadataCacheCleanupTime),
+				cacheTimeoutSettings,
+				config.StartNewTransaction,
+				config.InvalidateParentEntryCacheImmediately,
+			)
+
+			dataFSClient, err = irodsfs_common_irods.NewIRODSFSClientDirect(account, dataFSConfig)
+			if err != nil {
+				fsClient.Release()
+				clientErr := xerrors.Errorf("failed to create a new go-irodsclient fs client for data transfer: %w", err)
+				logger.Errorf("%+v", clientErr)
+				return nil, clientErr
+			}
+		}
+	}
+
+	var uncachedFSClient irodsfs_common_irods.IRODSFSClient = nil
+	if len(config.PoolEndpoint) == 0 {
+		// stats of the client see changes by other clients before the metadata cache times out, for change polling and exclusive creates
+		// it connects on first use, irodsfs-pool server caches metadata by itself
+		logger.Info("Initializing an iRODS native file system client bypassing metadata cache")
+		uncachedFSConfig := irodsclient_fs.NewFileSystemConfig(
+			FSName,
+			commons.ConnectionErrorTimeout,
+			0,
+			time.Duration(config.ConnectionLifespan),
+			time.Duration(config.OperationTimeout), time.Duration(config.ConnectionIdleTimeout),
+			1, commons.TCPBufferSizeDefault,
+			uncachedMetadataCacheTimeout, time.Duration(config.MetadataCacheCleanupTime),
+			[]irodsclient_fs.MetadataCacheTimeoutSetting{},
+			config.StartNewTransaction,
+			config.InvalidateParentEntryCacheImmediately,
+		)
+
+		uncachedFSClient, err = irodsfs_common_irods.NewIRODSFSClientDirect(account, uncachedFSConfig)
+		if err != nil {
+			fsClient.Release()
+			if dataFSClient != nil {
+				dataFSClient.Release()
+			}
+			clientErr := xerrors.Errorf("failed to create a new go-irodsclient fs client bypassing metadata cache: %w", err)
+			logger.Errorf("%+v", clientErr)
+			return nil, clientErr
+		}
+	}
+
+	// releases the clients on failures until the file system takes them
+	releaseFSClients := func() {
+		fsClient.Release()
+		if dataFSClient != nil {
+			dataFSClient.Release()
+		}
+		if uncachedFSClient != nil {
+			uncachedFSClient.Release()
+		}
+		if poolConnector != nil {
+			poolConnector.Disconnect()
+		}
+	}
+
 	inodeManager := irodsfs_common_inode.NewInodeManager()
 
 	logger.Info("Initializing virtual path mappings")
-	vpathManager, err := irodsfs_common_vpath.NewVPathManager(fsClient, inodeManager, config.PathMappings)
+	pathMappings, err := resolveDataObjectPathMappings(fsClient, config.PathMappings)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		releaseFSClients()
+		return nil, err
+	}
+
+	vpathManager, err := newVPathManager(fsClient, inodeManager, pathMappings)
 	if err != nil {
 		vpathErr := xerrors.Errorf("failed to create Virtual Path Manager: %w", err)
 		logger.Errorf("%+v", vpathErr)
+		releaseFSClients()
 		return nil, vpathErr
 	}
 
@@ -234,6 +379,13 @@ func NewFileSystem(config *commons.Config) (*IRODSFS, error) {
 	if err != nil {
 		ugErr := xerrors.Errorf("failed to list groups for a user %q: %w", account.ClientUser, err)
 		logger.Errorf("%+v", ugErr)
+		if instanceReportClient != nil {
+			instanceReportClient.Terminate()
+		}
+		if reportClient != nil {
+			reportClient.Release()
+		}
+		releaseFSClients()
 		return nil, ugErr
 	}
 
@@ -242,23 +394,329 @@ func NewFileSystem(config *commons.Config) (*IRODSFS, error) {
 		userGroupsMap[userGroup.Name] = userGroup
 	}
 
-	return &IRODSFS{
+	var metadataRateLimiter *MetadataRateLimiter
+	if config.MaxMetadataOpsPerSec > 0 {
+		metadataRateLimiter = NewMetadataRateLimiter(config.MaxMetadataOpsPerSec, time.Duration(config.MetadataOpsWaitMax))
+	}
+
+	var readBandwidthLimiter *BandwidthLimiter
+	if config.MaxReadBandwidth > 0 {
+		readBandwidthLimiter = NewBandwidthLimiter(config.MaxReadBandwidth)
+	}
+
+	var writeBandwidthLimiter *BandwidthLimiter
+	if config.MaxWriteBandwidth > 0 {
+		writeBandwidthLimiter = NewBandwidthLimiter(config.MaxWriteBandwidth)
+	}
+
+	var dirAttrCache *DirAttrCache
+	if config.DirAttrCacheTimeout > 0 {
+		dirAttrCache = NewDirAttrCache(time.Duration(config.DirAttrCacheTimeout))
+	}
+
+	var modifyTimeCache *ModifyTimeCache
+	if config.PersistTimestamps {
+		modifyTimeCache = NewModifyTimeCache(time.Duration(config.MetadataCacheTimeout))
+	}
+
+	var defaultResourceCache *DefaultResourceCache
+	if config.CollectionDefaultResource {
+		defaultResourceCache = NewDefaultResourceCache(time.Duration(config.MetadataCacheTimeout))
+	}
+
+	var replicaCache *ReplicaCache
+	if config.ExposeReplicaChecksums || config.MTimeSource == commons.MTimeSourceReplica {
+		replicaCache = NewReplicaCache(time.Duration(config.MetadataCacheTimeout))
+	}
+
+	var clockSkewChecker *ClockSkewChecker
+	if config.CheckClockSkew {
+		// the home collection is writable by the user, the probe is removed right after
+		probeDirPath := fmt.Sprintf("/%s/home/%s", config.Zone, config.ClientUser)
+		clockSkewChecker = NewClockSkewChecker(fsClient, probeDirPath, time.Duration(config.ClockSkewThreshold))
+	}
+
+	var metrics *Metrics
+	if len(config.MetricsEndpoint) > 0 {
+		metrics = NewMetrics()
+	}
+
+	fs := &IRODSFS{
 		config:        config,
 		fuseServer:    nil,
 		inodeManager:  inodeManager,
+		pathInodeMap:  nil,
 		vpathManager:  vpathManager,
-		fsClient:      fsClient,
+		pathMappings:  pathMappings,
+		session:       newFSSession(fsClient, dataFSClient),
 		fileHandleMap: fileHandleMap,
 		userGroupsMap: userGroupsMap,
 
-		uid: uint32(config.UID),
-		gid: uint32(config.GID),
+		sharedReadHandleMap:  NewSharedReadHandleMap(),
+		metadataRateLimiter:  metadataRateLimiter,
+		dirAttrCache:         dirAttrCache,
+		modifyTimeCache:      modifyTimeCache,
+		defaultResourceCache: defaultResourceCache,
+		replicaCache:         replicaCache,
+		clockSkewChecker:     clockSkewChecker,
+		memoryMonitor:        nil,
+		metrics:              metrics,
+		cacheEventHandlers:   map[irodsfs_common_irods.IRODSFSClient]string{},
+		terminatedErrno:      terminatedErrno,
+		fileModeMask:         fileModeMask,
+		dirModeMask:          dirModeMask,
+		appendLocks:          NewPathLockMap(),
+		remoteLockPathLocks:  NewPathLockMap(),
+		createLocks:          NewPathLockMap(),
+		localLockManagers:    NewFileHandleLocalLockManagerMap(),
+
+		readBandwidthLimiter:  readBandwidthLimiter,
+		writeBandwidthLimiter: writeBandwidthLimiter,
+
+		ioWorkerPool:     nil,
+		writeBackFlusher: nil,
+		changePoller:     nil,
+		adminServer:      nil,
+		ruleRunner:       nil,
+		bundleCache:      nil,
+
+		poolConnector:            poolConnector,
+		poolMonitorTerminateChan: nil,
+
+		account:                     account,
+		fsConfig:                    fsConfig,
+		dataFSConfig:                dataFSConfig,
+		uncachedFSClient:            uncachedFSClient,
+		sessionGeneration:           0,
+		sessionMonitorTerminateChan: nil,
+		reconnectDisabled:           false,
+		reconnectMutex:              sync.Mutex{},
+
+		uid:          uint32(config.UID),
+		gid:          uint32(config.GID),
+		userMappings: map[string]commons.UserMapping{},
 
 		reportClient:         reportClient,
 		instanceReportClient: instanceReportClient,
 
 		operationIDCurrent: 0,
-	}, nil
+		lastOperationTime:  time.Now().UnixNano(),
+	}
+
+	for _, mapping := range config.UserMappings {
+		fs.userMappings[mapping.IRODSUser] = mapping
+	}
+
+	fs.startKeepalive(fs.session)
+
+	if config.InodeFromPath {
+		fs.pathInodeMap = NewPathInodeIDMap(pathInodeIDMapMax)
+	}
+
+	if dirAttrCache != nil || modifyTimeCache != nil || defaultResourceCache != nil || replicaCache != nil {
+		// changes are notified by the clients
+		for _, client := range []irodsfs_common_irods.IRODSFSClient{fsClient, dataFSClient} {
+			if client == nil {
+				continue
+			}
+
+			handlerID, err := client.AddCacheEventHandler(fs.handleCacheEvent)
+			if err != nil {
+				logger.Errorf("%+v", err)
+				fs.Release()
+				return nil, err
+			}
+
+			fs.cacheEventHandlers[client] = handlerID
+		}
+	}
+
+	if config.ParallelRead && config.ConnectionMax > 2 {
+		// sub-streams of all files share connections, leaving a connection for metadata operations and one for the handle read
+		fs.parallelStreamBudget = NewParallelStreamBudget(config.ConnectionMax - 2)
+	}
+
+	if config.IOWorkersMax > 0 {
+		fs.ioWorkerPool = NewWorkerPool(config.IOWorkersMax, config.IOWorkersMax*ioWorkerQueueSizePerWorker)
+		fs.metrics.SetWorkerPool(fs.ioWorkerPool)
+
+		if config.WriteBackFlushInterval > 0 {
+			fs.writeBackFlusher = NewWriteBackFlusher(fs)
+		}
+	}
+
+	if config.ChangePollInterval > 0 {
+		fs.changePoller = NewChangePoller(fs)
+	}
+
+	if len(config.AdminSocket) > 0 {
+		fs.adminServer = NewAdminServer(fs, config.AdminSocket)
+	}
+
+	if config.AllowRuleExecution {
+		fs.ruleRunner = NewRuleRunner(fs)
+	}
+
+	if config.BulkSmallFileMode {
+		fs.bundleCache = NewBundleCache(fs, filepath.Join(config.GetInstanceDataRootDirPath(), "bundles"))
+	}
+
+	if config.MemoryPressureCheckInterval > 0 {
+		fs.memoryMonitor = NewMemoryPressureMonitor(fs, time.Duration(config.MemoryPressureCheckInterval), int64(config.MemoryAvailableMin))
+	}
+
+	return fs, nil
+}
+
+// newIRODSAccount creates an iRODS account from the config, enabling SSL if required
+func newIRODSAccount(config *commons.Config) (*irodsclient_types.IRODSAccount, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "newIRODSAccount",
+	})
+
+	authScheme := irodsclient_types.GetAuthScheme(config.AuthScheme)
+	if authScheme == irodsclient_types.AuthSchemeUnknown {
+		authScheme = irodsclient_types.AuthSchemeNative
+	}
+
+	csNegotiation, err := irodsclient_types.GetCSNegotiationRequire(config.CSNegotiationPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := irodsclient_types.CreateIRODSProxyAccount(config.Host, config.Port,
+		config.ClientUser, config.Zone, config.ProxyUser, config.Zone,
+		authScheme, config.Password, config.Resource)
+	if err != nil {
+		accountErr := xerrors.Errorf("failed to create IRODS Account: %w", err)
+		logger.Errorf("%+v", accountErr)
+		return nil, accountErr
+	}
+
+	logger.Infof("Connect to IRODS server using %q auth scheme", string(authScheme))
+
+	// optional for ssl,
+	// no harm if it is not ssl
+	sslConfig, err := irodsclient_types.CreateIRODSSSLConfig(config.CACertificateFile, config.CACertificatePath, config.EncryptionKeySize,
+		config.EncryptionAlgorithm, config.SaltSize, config.HashRounds)
+	if err != nil {
+		sslErr := xerrors.Errorf("failed to create IRODS SSL Config: %w", err)
+		logger.Errorf("%+v", sslErr)
+		return nil, sslErr
+	}
+
+	if isPAMTokenCacheEnabled(config, account) {
+		account.PamTTL = getPAMTokenTTLHours(config)
+
+		pamToken := loadPAMToken(config)
+		if len(pamToken) > 0 {
+			logger.Info("Using cached PAM token")
+			account.PamToken = pamToken
+		}
+	}
+
+	if authScheme == irodsclient_types.AuthSchemePAM {
+		logger.Info("PAM requires SSL, enabling CS negotiation")
+
+		account.SetSSLConfiguration(sslConfig)
+		account.SetCSNegotiation(true, irodsclient_types.CSNegotiationRequireSSL)
+	} else if config.ClientServerNegotiation {
+		logger.Infof("Enabling CS negotiation with %q policy", string(csNegotiation))
+
+		account.SetSSLConfiguration(sslConfig)
+		account.SetCSNegotiation(config.ClientServerNegotiation, csNegotiation)
+	}
+
+	return account, nil
+}
+
+// handleCacheEvent invalidates dir attr cache, modify time cache, default resource cache and replica cache when the client notifies changes
+func (fs *IRODSFS) handleCacheEvent(path string, eventType irodsclient_fs.FilesystemCacheEventType) {
+	fs.invalidateDirAttrCache(path)
+	fs.invalidateModifyTimeCache(path)
+	fs.invalidateDefaultResourceCache(path)
+	fs.invalidateReplicaCache(path)
+}
+
+// invalidateReplicaCache invalidates replicas cached for the data object path
+func (fs *IRODSFS) invalidateReplicaCache(path string) {
+	if fs.replicaCache != nil {
+		fs.replicaCache.Invalidate(path)
+	}
+}
+
+// invalidateDefaultResourceCache invalidates default resource cached for the collection path
+func (fs *IRODSFS) invalidateDefaultResourceCache(path string) {
+	if fs.defaultResourceCache != nil {
+		fs.defaultResourceCache.Invalidate(path)
+	}
+}
+
+// invalidateModifyTimeCache invalidates modify time persisted and cached for the path
+func (fs *IRODSFS) invalidateModifyTimeCache(path string) {
+	if fs.modifyTimeCache != nil {
+		fs.modifyTimeCache.Invalidate(path)
+	}
+}
+
+// invalidateDirAttrCache invalidates dir attr cache for the dir containing the path
+// callers listing the dir from now on do not join the listing in progress, which may miss the change
+func (fs *IRODSFS) invalidateDirAttrCache(path string) {
+	fs.listings.forget(irodsfs_common_utils.GetDirname(path))
+	fs.listings.forget(path)
+
+	if fs.dirAttrCache != nil {
+		fs.dirAttrCache.Invalidate(path)
+	}
+}
+
+// touchChangePoller polls the file for changes by other clients for a while
+func (fs *IRODSFS) touchChangePoller(file *File, path string) {
+	if fs.changePoller != nil {
+		fs.changePoller.Touch(file, path)
+	}
+}
+
+// forgetChangePoller stops polling the file removed or renamed through this mount
+func (fs *IRODSFS) forgetChangePoller(path string) {
+	if fs.changePoller != nil {
+		fs.changePoller.Forget(path)
+	}
+}
+
+// prefetchDirAttrs lists the dir in background and caches attributes of its entries
+// stats of the entries following opening the dir are served from the cache, and Readdir reuses the listing
+func (fs *IRODSFS) prefetchDirAttrs(path string) {
+	if fs.dirAttrCache == nil || !fs.config.DirAttrPrefetch {
+		return
+	}
+
+	prefetch, ok := fs.dirAttrCache.BeginPrefetch(path)
+	if !ok {
+		return
+	}
+
+	fs.runAsync(func() {
+		logger := log.WithFields(log.Fields{
+			"package":  "irodsfs",
+			"struct":   "IRODSFS",
+			"function": "prefetchDirAttrs",
+		})
+
+		entries, err := IRODSList(context.Background(), fs, path)
+		if err != nil {
+			logger.Debugf("failed to prefetch attributes of entries in dir %q - %v", path, err)
+			fs.dirAttrCache.AddPrefetchedDir(path, prefetch, nil, 0)
+			return
+		}
+
+		if entries == nil {
+			entries = []*irodsclient_fs.Entry{}
+		}
+
+		fs.dirAttrCache.AddPrefetchedDir(path, prefetch, entries, fs.config.DirAttrPrefetchBatchSize)
+	})
 }
 
 // Release destroys the file system
@@ -288,9 +746,77 @@ func (fs *IRODSFS) Release() {
 		fs.fileHandleMap = nil
 	}
 
-	if fs.fsClient != nil {
-		fs.fsClient.Release()
-		fs.fsClient = nil
+	if fs.sharedReadHandleMap != nil {
+		fs.sharedReadHandleMap.Clear(fs)
+		fs.sharedReadHandleMap = nil
+	}
+
+	if fs.clockSkewChecker != nil {
+		fs.clockSkewChecker.Stop()
+	}
+
+	fs.stopPoolMonitor()
+	fs.stopSessionMonitor()
+	fs.stopKeepalive()
+
+	if fs.memoryMonitor != nil {
+		fs.memoryMonitor.Stop()
+	}
+
+	if fs.writeBackFlusher != nil {
+		fs.writeBackFlusher.Stop()
+	}
+
+	if fs.changePoller != nil {
+		fs.changePoller.Stop()
+	}
+
+	if fs.ioWorkerPool != nil {
+		// run tasks queued, e.g., closing files
+		// tasks submitted from now on run in their callers
+		fs.ioWorkerPool.Stop()
+	}
+
+	for client, handlerID := range fs.cacheEventHandlers {
+		client.RemoveCacheEventHandler(handlerID)
+	}
+	fs.cacheEventHandlers = map[irodsfs_common_irods.IRODSFSClient]string{}
+
+	if fs.dirAttrCache != nil {
+		fs.dirAttrCache.Clear()
+	}
+
+	if fs.modifyTimeCache != nil {
+		fs.modifyTimeCache.Clear()
+	}
+
+	if fs.defaultResourceCache != nil {
+		fs.defaultResourceCache.Clear()
+	}
+
+	if fs.replicaCache != nil {
+		fs.replicaCache.Clear()
+	}
+
+	if fs.bundleCache != nil {
+		fs.bundleCache.Release()
+	}
+
+	fs.sessionMutex.Lock()
+	if fs.session != nil {
+		fs.session.release(nil)
+		fs.session = newFSSession(nil, nil)
+	}
+	fs.sessionMutex.Unlock()
+
+	if fs.uncachedFSClient != nil {
+		fs.uncachedFSClient.Release()
+		fs.uncachedFSClient = nil
+	}
+
+	if fs.poolConnector != nil {
+		fs.poolConnector.Disconnect()
+		fs.poolConnector = nil
 	}
 }
 
@@ -304,6 +830,47 @@ func (fs *IRODSFS) Start() error {
 
 	defer irodsfs_common_utils.StackTraceFromPanic(logger)
 
+	if fs.clockSkewChecker != nil {
+		// skew is informative, do not fail
+		_, err := fs.clockSkewChecker.Check()
+		if err != nil {
+			logger.Errorf("%+v", err)
+		}
+
+		fs.clockSkewChecker.Start(time.Duration(fs.config.ClockSkewCheckInterval))
+	}
+
+	fs.startPoolMonitor()
+	fs.startSessionMonitor()
+
+	if fs.memoryMonitor != nil {
+		fs.memoryMonitor.Start()
+	}
+
+	if fs.writeBackFlusher != nil {
+		fs.writeBackFlusher.Start(time.Duration(fs.config.WriteBackFlushInterval))
+	}
+
+	if fs.changePoller != nil {
+		fs.changePoller.Start(time.Duration(fs.config.ChangePollInterval))
+	}
+
+	if fs.metrics != nil {
+		err := fs.metrics.StartServer(fs.config.MetricsEndpoint)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return err
+		}
+	}
+
+	if fs.adminServer != nil {
+		err := fs.adminServer.Start()
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return err
+		}
+	}
+
 	// mount
 	logger.Infof("Starting iRODS FUSE Lite, connecting to FUSE on %q", fs.config.MountPath)
 
@@ -320,12 +887,202 @@ func (fs *IRODSFS) Start() error {
 	}
 
 	fs.fuseServer = fuseServer
+	fs.mountTime = time.Now()
 
 	logger.Infof("Connected to FUSE, mount on %q", fs.config.MountPath)
 
+	if fs.config.MountReadyTimeout > 0 {
+		statRoot := func() error {
+			_, statErr := os.Stat(fs.config.MountPath)
+			return statErr
+		}
+
+		err = fs.waitMountReady(time.Duration(fs.config.MountReadyTimeout), fuseServer.WaitMount, statRoot)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			fs.Stop()
+			return err
+		}
+	}
+
+	// service managers waiting for the mount, e.g., systemd with Type=notify, can start dependents
+	err = utils.NotifySystemd(utils.SystemdNotifyReady)
+	if err != nil {
+		// the mount works, do not fail
+		logger.Errorf("%+v", err)
+	}
+
 	return nil
 }
 
+// waitMountReady waits until the kernel completes the mount and the mount root is servable through the mount, up to timeout
+// waitMount waits for the kernel to complete the mount, statRoot stats the mount root through the mount
+func (fs *IRODSFS) waitMountReady(timeout time.Duration, waitMount func() error, statRoot func() error) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "IRODSFS",
+		"function": "waitMountReady",
+	})
+
+	deadline := time.Now().Add(timeout)
+
+	// the kernel may never complete the mount, e.g., if the mount point hangs, so do not wait beyond the deadline
+	waitMountChan := make(chan error, 1)
+	go func() {
+		waitMountChan <- waitMount()
+	}()
+
+	select {
+	case err := <-waitMountChan:
+		if err != nil {
+			return xerrors.Errorf("failed to wait for mount on %q: %w", fs.config.MountPath, err)
+		}
+	case <-time.After(time.Until(deadline)):
+		return xerrors.Errorf("mount on %q is not completed by the kernel in %s", fs.config.MountPath, timeout)
+	}
+
+	for {
+		err := statRoot()
+		if err == nil {
+			logger.Infof("Mount on %q is ready", fs.config.MountPath)
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return xerrors.Errorf("mount on %q is not ready in %s: %w", fs.config.MountPath, timeout, err)
+		}
+
+		logger.Debugf("Mount on %q is not ready yet, retrying - %v", fs.config.MountPath, err)
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// drainFileHandles waits until file handles opened for write are closed, up to timeout
+func (fs *IRODSFS) drainFileHandles(timeout time.Duration, shutdownDeadline time.Time) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "IRODSFS",
+		"function": "drainFileHandles",
+	})
+
+	if timeout <= 0 {
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	if !shutdownDeadline.IsZero() && shutdownDeadline.Before(deadline) {
+		deadline = shutdownDeadline
+	}
+
+	listWriteHandles := func() []*FileHandle {
+		writeHandles := []*FileHandle{}
+		for _, handle := range fs.fileHandleMap.List() {
+			if handle.openMode.IsWrite() {
+				writeHandles = append(writeHandles, handle)
+			}
+		}
+		return writeHandles
+	}
+
+	writeHandles := listWriteHandles()
+	logger.Infof("Waiting for %d file handles opened for write to be closed", len(writeHandles))
+
+	for len(writeHandles) > 0 {
+		if time.Now().After(deadline) {
+			for _, handle := range writeHandles {
+				logger.Warnf("File handle for %q is not closed in time, it may have data not written yet", handle.GetPath())
+			}
+			return
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		writeHandles = listWriteHandles()
+	}
+
+	logger.Info("All file handles opened for write are closed")
+}
+
+// isDraining checks if the file system is shutting down, new files are not opened
+func (fs *IRODSFS) isDraining() bool {
+	return atomic.LoadInt32(&fs.draining) == 1
+}
+
+// Shutdown stops opening new files, waits for files opened for write to be closed up to drain timeout, flushes the rest and stops FUSE
+// draining and flushing are given up at deadline to not block service managers, zero deadline means no deadline
+func (fs *IRODSFS) Shutdown(deadline time.Time) {
+	if fs.terminated {
+		return
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "IRODSFS",
+		"function": "Shutdown",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	atomic.StoreInt32(&fs.draining, 1)
+	fs.drainFileHandles(time.Duration(fs.config.DrainTimeout), deadline)
+
+	writeHandles := []*FileHandle{}
+	for _, handle := range fs.fileHandleMap.List() {
+		if handle.openMode.IsWrite() {
+			writeHandles = append(writeHandles, handle)
+		}
+	}
+
+	logger.Infof("Flushing %d file handles opened for write", len(writeHandles))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	flushedMutex := sync.Mutex{}
+	flushed := map[string]bool{}
+	doneChan := make(chan bool)
+
+	go func() {
+		for _, handle := range writeHandles {
+			if ctx.Err() != nil {
+				break
+			}
+
+			errno := handle.Flush(ctx)
+
+			flushedMutex.Lock()
+			flushed[handle.GetID()] = errno == fusefs.OK
+			flushedMutex.Unlock()
+		}
+		close(doneChan)
+	}()
+
+	var timeoutChan <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	select {
+	case <-doneChan:
+	case <-timeoutChan:
+		logger.Warn("Failed to flush all file handles before shutdown deadline")
+		cancel()
+	}
+
+	flushedMutex.Lock()
+	for _, handle := range writeHandles {
+		if ok, done := flushed[handle.GetID()]; done && ok {
+			logger.Infof("Flushed %q", handle.GetPath())
+		} else {
+			logger.Errorf("Failed to flush %q", handle.GetPath())
+		}
+	}
+	flushedMutex.Unlock()
+
+	fs.Stop()
+}
+
 func (fs *IRODSFS) Stop() {
 	if fs.terminated {
 		return
@@ -343,7 +1100,17 @@ func (fs *IRODSFS) Stop() {
 
 	fs.terminated = true
 
+	fs.stopPoolMonitor()
+	fs.stopSessionMonitor()
+	fs.stopKeepalive()
+	fs.metrics.StopServer()
+
+	if fs.adminServer != nil {
+		fs.adminServer.Stop()
+	}
+
 	//fs.fuseServer.Unmount()
+	// unmounts lazily, FUSE exits once files in use are closed
 	err := utils.UnmountFuse(fs.config.MountPath)
 	if err != nil {
 		logger.Error(err)
@@ -355,10 +1122,29 @@ func (fs *IRODSFS) Wait() {
 	fs.fuseServer.Wait()
 }
 
+// mountInfoXattrNames is a list of xattrs getMountInfoXattr returns
+var mountInfoXattrNames = []string{InstanceIDXattrName, ConfigPathXattrName, MountTimeXattrName, VersionXattrName}
+
+// getMountInfoXattr returns a value of xattr on the mount root describing the mount, returns false if the attr is not one of them
+func (fs *IRODSFS) getMountInfoXattr(attr string) ([]byte, bool) {
+	switch attr {
+	case InstanceIDXattrName:
+		return []byte(fs.config.InstanceID), true
+	case ConfigPathXattrName:
+		return []byte(fs.config.ConfigPath), true
+	case MountTimeXattrName:
+		return []byte(fs.mountTime.UTC().Format(time.RFC3339)), true
+	case VersionXattrName:
+		return []byte(commons.GetClientVersion()), true
+	default:
+		return nil, false
+	}
+}
+
 // Root returns root directory node
 func (fs *IRODSFS) Root() (*Dir, error) {
 	if fs.terminated {
-		return nil, syscall.ECONNABORTED
+		return nil, fs.terminatedErrno
 	}
 
 	logger := log.WithFields(log.Fields{
@@ -383,8 +1169,156 @@ func (fs *IRODSFS) Root() (*Dir, error) {
 	return NewIRODSRoot(fs, vpathEntry)
 }
 
+// waitMetadataRate waits for the turn of a metadata operation, returns false if the operation exceeds the rate
+func (fs *IRODSFS) waitMetadataRate(ctx context.Context) bool {
+	if fs.metadataRateLimiter == nil {
+		return true
+	}
+
+	return fs.metadataRateLimiter.Wait(ctx)
+}
+
+// getInodeIDForIRODSEntry returns inode id for the iRODS entry, the same entry gets the same inode id while mounted
+// inode ids are derived from entry ids, or hashed from paths if inode_from_path is set
+func (fs *IRODSFS) getInodeIDForIRODSEntry(entryID int64, irodsPath string) uint64 {
+	if fs.pathInodeMap != nil {
+		return fs.pathInodeMap.GetInodeID(irodsPath)
+	}
+	return fs.inodeManager.GetInodeIDForIRODSEntryID(entryID)
+}
+
+// getAccessReportClient returns the report client reporting file accesses of the open mode, returns nil if they are not reported
+// read-only accesses are not reported with noatime, not to load the monitor with reads
+func (fs *IRODSFS) getAccessReportClient(openMode irodsclient_types.FileOpenMode) irodsfs_common_report.IRODSFSInstanceReportClient {
+	if fs.instanceReportClient == nil {
+		return nil
+	}
+
+	if openMode.IsReadOnly() && (fs.config.NoAtime || commons.HasFuseOption(fs.config.FuseOptions, "noatime")) {
+		return nil
+	}
+
+	return fs.instanceReportClient
+}
+
+// getOwnerID returns local uid and gid reported for files owned by the iRODS user
+func (fs *IRODSFS) getOwnerID(irodsUser string) (uint32, uint32) {
+	if mapping, ok := fs.userMappings[irodsUser]; ok {
+		return uint32(mapping.UID), uint32(mapping.GID)
+	}
+	return fs.uid, fs.gid
+}
+
+// getOwnerAttr returns local uid, gid and mode reported for the entry, given the mode of the client user
+// when the owner is mapped to other local user, owner bits are of the owner, and the client user's permission is in group and other bits,
+// as all local users access iRODS as the client user
+func (fs *IRODSFS) getOwnerAttr(entry *irodsclient_fs.Entry, mode os.FileMode, readonly bool) (uint32, uint32, os.FileMode) {
+	uid, gid := fs.getOwnerID(entry.Owner)
+	if uid == fs.uid {
+		return uid, gid, mode
+	}
+
+	clientMode := mode & 0o700
+	return uid, gid, irodsGetOwnerMode(fs, entry, readonly) | clientMode>>3 | clientMode>>6
+}
+
+// reserveOpenFile reserves a slot for a file the local uid is opening, in the per user open file limit
+// returns false if the uid reached the limit, reserved is false if no limit applies
+func (fs *IRODSFS) reserveOpenFile(uid uint32, hasCaller bool) (reserved bool, ok bool) {
+	if !hasCaller || fs.config.OpenFileMaxPerUser <= 0 {
+		return false, true
+	}
+
+	if !fs.fileHandleMap.Reserve(uid, fs.config.OpenFileMaxPerUser) {
+		return false, false
+	}
+	return true, true
+}
+
+// addOpenedFile registers a file handle opened, in place of the slot reserved by reserveOpenFile
+func (fs *IRODSFS) addOpenedFile(handle *FileHandle, reserved bool) {
+	if reserved {
+		fs.fileHandleMap.AddReserved(handle)
+		return
+	}
+
+	fs.fileHandleMap.Add(handle)
+}
+
+// getUserBandwidthLimiter returns the limiter of data transfer of file handles opened by the local uid, nil if unlimited
+// one user of a shared allow_other mount cannot use up the bandwidth of others
+func (fs *IRODSFS) getUserBandwidthLimiter(uid uint32) *BandwidthLimiter {
+	return fs.fileHandleMap.GetBandwidthLimiter(uid, fs.config.MaxBandwidthPerUser)
+}
+
+// getDataFSClient returns fs client to transfer data of a file opened with the given mode, for readers and writers of file handles opened on it
+// file handles fail anyway once their session is released, so the client is not tracked as in use
+func (fs *IRODSFS) getDataFSClient(openMode irodsclient_types.FileOpenMode) irodsfs_common_irods.IRODSFSClient {
+	fsClient, done := fs.acquireDataFSClient(openMode)
+	done()
+	return fsClient
+}
+
+// acquireDataFSClient returns fs client to transfer data of a file opened with the given mode, done must be called when the client is no longer used
+// Writable files use the metadata client so cached attributes stay coherent with writes
+func (fs *IRODSFS) acquireDataFSClient(openMode irodsclient_types.FileOpenMode) (irodsfs_common_irods.IRODSFSClient, func()) {
+	session, done := fs.acquireSession()
+	if session.dataFSClient != nil && openMode.IsReadOnly() {
+		return session.dataFSClient, done
+	}
+
+	return session.fsClient, done
+}
+
+// openDataFile opens a data object for data transfer
+// reads prefer the replica on the preferred resource, and fall back to other replicas if it is not available
+func (fs *IRODSFS) openDataFile(path string, openMode irodsclient_types.FileOpenMode) (irodsfs_common_irods.IRODSFSFileHandle, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "IRODSFS",
+		"function": "openDataFile",
+	})
+
+	fsClient, done := fs.acquireDataFSClient(openMode)
+	defer done()
+
+	if openMode.IsReadOnly() && len(fs.config.PreferredResource) > 0 {
+		handle, err := fsClient.OpenFile(path, fs.config.PreferredResource, string(openMode))
+		if err == nil {
+			return handle, nil
+		}
+
+		// iRODS reports a missing replica on the resource as a missing file, so any error falls back
+		// the error of the fallback is returned, e.g., ENOENT if the data object does not exist at all
+		logger.Debugf("failed to open %q on preferred resource %q, falling back to other replicas - %v", path, fs.config.PreferredResource, err)
+	}
+
+	return fsClient.OpenFile(path, "", string(openMode))
+}
+
+// submitAsync queues a background task on the I/O worker pool if configured, or runs it in its own goroutine otherwise
+// returns false if the pool is busy or stopped, the caller must run the task by itself then
+func (fs *IRODSFS) submitAsync(task func()) bool {
+	if fs.ioWorkerPool == nil {
+		go task()
+		return true
+	}
+
+	return fs.ioWorkerPool.Submit(task)
+}
+
+// runAsync runs a background task, on the I/O worker pool if configured
+// the task runs in the caller if the pool is busy or stopped, so background goroutines never grow beyond the pool
+func (fs *IRODSFS) runAsync(task func()) {
+	if !fs.submitAsync(task) {
+		task()
+	}
+}
+
 // GetNextOperationID returns next operation ID
 func (fs *IRODSFS) GetNextOperationID() uint64 {
+	atomic.StoreInt64(&fs.lastOperationTime, time.Now().UnixNano())
+
 	fs.operationIDCurrent++
 	return fs.operationIDCurrent
 }
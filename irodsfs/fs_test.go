@@ -0,0 +1,501 @@
+package irodsfs
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
+	"github.com/cyverse/irodsfs/commons"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// stuckWriter does not return from flushing for a while, like writes to an unresponsive server
+type stuckWriter struct {
+	fakeWriter
+}
+
+func (writer *stuckWriter) Flush() error {
+	time.Sleep(5 * time.Second)
+	return nil
+}
+
+func TestShutdownHonorsDeadline(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	// draining alone would exceed the shutdown deadline
+	fs.config.DrainTimeout = irodsfs_common_utils.Duration(10 * time.Second)
+
+	filePath := "/testzone/home/testuser/shutdown.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	handle.writer = &stuckWriter{fakeWriter: fakeWriter{handle: handle.iRODSFileHandle}}
+
+	shutdownTimeout := 500 * time.Millisecond
+	start := time.Now()
+	fs.Shutdown(start.Add(shutdownTimeout))
+	elapsed := time.Since(start)
+
+	if elapsed > shutdownTimeout+time.Second {
+		t.Errorf("expected shutdown within %s, took %s", shutdownTimeout, elapsed)
+	}
+
+	if !fs.terminated {
+		t.Errorf("expected the filesystem stopped")
+	}
+}
+
+func TestReserveOpenFileIsAtomic(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.OpenFileMaxPerUser = 3
+
+	var reservedCount int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			reserved, ok := fs.reserveOpenFile(1000, true)
+			if ok && reserved {
+				atomic.AddInt32(&reservedCount, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if reservedCount != 3 {
+		t.Fatalf("expected 3 files reserved for the uid, got %d", reservedCount)
+	}
+
+	// other users have their own limit
+	if _, ok := fs.reserveOpenFile(1001, true); !ok {
+		t.Fatalf("expected a file reserved for another uid")
+	}
+
+	// opened files take the place of the reservations
+	filePath := "/testzone/home/testuser/limit.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadOnly)
+	handle.SetUID(1000)
+	fs.addOpenedFile(handle, true)
+
+	if count := fs.fileHandleMap.CountByUID(1000); count != 3 {
+		t.Fatalf("expected 3 files counted for the uid, got %d", count)
+	}
+
+	if _, ok := fs.reserveOpenFile(1000, true); ok {
+		t.Fatalf("expected the open file limit to be reached")
+	}
+
+	// failed opens release their reservations
+	fs.fileHandleMap.CancelReservation(1000)
+	fs.fileHandleMap.Remove(handle.GetID())
+
+	if count := fs.fileHandleMap.CountByUID(1000); count != 1 {
+		t.Fatalf("expected 1 file counted for the uid, got %d", count)
+	}
+
+	if _, ok := fs.reserveOpenFile(1000, true); !ok {
+		t.Fatalf("expected a file reserved after others are released")
+	}
+
+	// reads and writes of a uid share its bandwidth, other users have their own
+	fs.config.MaxBandwidthPerUser = 100
+
+	writeHandle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	writeHandle.SetUID(1000)
+
+	// 200 bytes are two seconds of the bandwidth, a second over the burst allowed
+	if _, errno := writeHandle.Write(context.Background(), make([]byte, 200), 0); errno != fusefs.OK {
+		t.Fatalf("failed to write, errno %v", errno)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, errno := writeHandle.Write(ctx, []byte("0123"), 0); errno != syscall.EINTR {
+		t.Errorf("expected the write of the uid throttled, got errno %v", errno)
+	}
+
+	otherCtx, otherCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer otherCancel()
+
+	if !fs.getUserBandwidthLimiter(1001).Wait(otherCtx, 100) {
+		t.Errorf("expected other uid not throttled")
+	}
+}
+
+func TestGetFuseOptionsDedups(t *testing.T) {
+	config := commons.NewDefaultConfig()
+	config.ReadOnly = true
+	config.FuseOptions = []string{"allow_other", "x-gvfs-hide", "ro", "x-gvfs-hide"}
+
+	options := GetFuseOptions(config)
+	if !options.AllowOther {
+		t.Errorf("expected allow_other set by go-fuse")
+	}
+
+	expected := []string{"x-gvfs-hide", "ro"}
+	if !reflect.DeepEqual(options.Options, expected) {
+		t.Errorf("expected mount options %q, got %q", expected, options.Options)
+	}
+
+	if len(config.FuseOptions) != 4 {
+		t.Errorf("expected fuse options of config not modified, got %q", config.FuseOptions)
+	}
+}
+
+func TestShutdownRejectsOpensWhileDraining(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.terminatedErrno = syscall.EIO
+	fs.config.DrainTimeout = irodsfs_common_utils.Duration(10 * time.Second)
+
+	filePath := "/testzone/home/testuser/draining.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	// draining waits for the handle opened for write
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		fs.Shutdown(time.Time{})
+	}()
+
+	if !waitFor(5*time.Second, fs.isDraining) {
+		t.Fatalf("expected the filesystem draining")
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, _, errno := NewFile(fs, 0, filePath).Open(context.Background(), uint32(os.O_RDONLY)); errno != syscall.EIO {
+				t.Errorf("expected open rejected while draining, got %v", errno)
+			}
+
+			out := fuse.EntryOut{}
+			if _, _, _, errno := NewDir(fs, 1, "/").Create(context.Background(), "new.txt", uint32(os.O_WRONLY|os.O_CREATE), 0o644, &out); errno != syscall.EIO {
+				t.Errorf("expected create rejected while draining, got %v", errno)
+			}
+		}()
+	}
+	wg.Wait()
+
+	fs.fileHandleMap.Remove(handle.GetID())
+	<-shutdownDone
+}
+
+func TestShutdownDrainsHandlesWithFailingWriter(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.DrainTimeout = irodsfs_common_utils.Duration(10 * time.Second)
+
+	filePath := "/testzone/home/testuser/failing.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	handle.writer = &failingWriter{fakeWriter: fakeWriter{handle: handle.iRODSFileHandle}}
+
+	start := time.Now()
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		fs.Shutdown(time.Time{})
+	}()
+
+	if !waitFor(5*time.Second, fs.isDraining) {
+		t.Fatalf("expected the filesystem draining")
+	}
+
+	// the handle failing to write back is released, draining does not wait for it
+	if errno := handle.Release(context.Background()); errno != syscall.EREMOTEIO {
+		t.Errorf("expected EREMOTEIO, got %v", errno)
+	}
+
+	<-shutdownDone
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected draining done after the handle is released, took %s", elapsed)
+	}
+}
+
+func TestTerminatedErrno(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.TerminatedErrno = "ESHUTDOWN"
+
+	terminatedErrno, err := fs.config.GetTerminatedErrno()
+	if err != nil {
+		t.Fatalf("failed to get terminated errno - %v", err)
+	}
+	fs.terminatedErrno = terminatedErrno
+
+	filePath := "/testzone/home/testuser/terminated.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadWrite)
+	file := NewFile(fs, 0, filePath)
+	dir := NewDir(fs, 1, "/")
+
+	fs.terminated = true
+
+	ctx := context.Background()
+	operations := map[string]func() syscall.Errno{
+		"Dir.Getattr": func() syscall.Errno {
+			return dir.Getattr(ctx, nil, &fuse.AttrOut{})
+		},
+		"Dir.Lookup": func() syscall.Errno {
+			_, errno := dir.Lookup(ctx, "terminated.txt", &fuse.EntryOut{})
+			return errno
+		},
+		"Dir.Mkdir": func() syscall.Errno {
+			_, errno := dir.Mkdir(ctx, "newdir", 0o755, &fuse.EntryOut{})
+			return errno
+		},
+		"Dir.Statfs": func() syscall.Errno {
+			return dir.Statfs(ctx, &fuse.StatfsOut{})
+		},
+		"File.Getattr": func() syscall.Errno {
+			return file.Getattr(ctx, nil, &fuse.AttrOut{})
+		},
+		"File.Open": func() syscall.Errno {
+			_, _, errno := file.Open(ctx, uint32(os.O_RDONLY))
+			return errno
+		},
+		"FileHandle.Read": func() syscall.Errno {
+			_, errno := handle.Read(ctx, make([]byte, 4), 0)
+			return errno
+		},
+		"FileHandle.Write": func() syscall.Errno {
+			_, errno := handle.Write(ctx, []byte("data"), 0)
+			return errno
+		},
+	}
+
+	for name, operation := range operations {
+		if errno := operation(); errno != syscall.ESHUTDOWN {
+			t.Errorf("%s: expected ESHUTDOWN after termination, got %v", name, errno)
+		}
+	}
+}
+
+func TestReadOnlyMountRejectsWrites(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ReadOnly = true
+
+	filePath := "/testzone/home/testuser/file.txt"
+	client.addFile(filePath, []byte("0123"))
+	client.addDir("/testzone/home/testuser/dir")
+
+	file := NewFile(fs, 0, "/file.txt")
+	dir := NewDir(fs, 1, "/")
+
+	ctx := context.Background()
+	operations := map[string]func() syscall.Errno{
+		"File.Open write-only": func() syscall.Errno {
+			_, _, errno := file.Open(ctx, uint32(os.O_WRONLY))
+			return errno
+		},
+		"File.Open read-write": func() syscall.Errno {
+			_, _, errno := file.Open(ctx, uint32(os.O_RDWR))
+			return errno
+		},
+		"File.Open append": func() syscall.Errno {
+			_, _, errno := file.Open(ctx, uint32(os.O_WRONLY|os.O_APPEND))
+			return errno
+		},
+		"File.Setattr": func() syscall.Errno {
+			return file.Setattr(ctx, nil, &fuse.SetAttrIn{}, &fuse.AttrOut{})
+		},
+		"File.Truncate": func() syscall.Errno {
+			return file.Truncate(ctx, 0)
+		},
+		"File.Setxattr": func() syscall.Errno {
+			return file.Setxattr(ctx, "user.key", []byte("value"), 0)
+		},
+		"File.Removexattr": func() syscall.Errno {
+			return file.Removexattr(ctx, "user.key")
+		},
+		"Dir.Setxattr": func() syscall.Errno {
+			return dir.Setxattr(ctx, "user.key", []byte("value"), 0)
+		},
+		"Dir.Removexattr": func() syscall.Errno {
+			return dir.Removexattr(ctx, "user.key")
+		},
+		"Dir.Create": func() syscall.Errno {
+			_, _, _, errno := dir.Create(ctx, "new.txt", uint32(os.O_WRONLY|os.O_CREATE), 0o644, &fuse.EntryOut{})
+			return errno
+		},
+		"Dir.Mkdir": func() syscall.Errno {
+			_, errno := dir.Mkdir(ctx, "newdir", 0o755, &fuse.EntryOut{})
+			return errno
+		},
+		"Dir.Unlink": func() syscall.Errno {
+			return dir.Unlink(ctx, "file.txt")
+		},
+		"Dir.Rmdir": func() syscall.Errno {
+			return dir.Rmdir(ctx, "dir")
+		},
+		"Dir.Rename": func() syscall.Errno {
+			return dir.Rename(ctx, "file.txt", dir, "renamed.txt", 0)
+		},
+		"Dir.Symlink": func() syscall.Errno {
+			_, errno := dir.Symlink(ctx, "file.txt", "link", &fuse.EntryOut{})
+			return errno
+		},
+	}
+
+	for name, operation := range operations {
+		if errno := operation(); errno != syscall.EROFS {
+			t.Errorf("%s: expected EROFS, got %v", name, errno)
+		}
+	}
+
+	for _, method := range []string{"OpenFile", "CreateFile", "TruncateFile", "RemoveFile", "RemoveDir", "MakeDir", "RenameFileToFile", "SetXattr", "RemoveXattr"} {
+		if calls := client.getCalls(method); calls != 0 {
+			t.Errorf("expected no %s on iRODS, got %d calls", method, calls)
+		}
+	}
+
+	if data := client.getData(filePath); string(data) != "0123" {
+		t.Errorf("expected data unchanged, got %q", data)
+	}
+
+	// write permission is not presented
+	out := fuse.AttrOut{}
+	if errno := file.Getattr(ctx, nil, &out); errno != fusefs.OK {
+		t.Fatalf("failed to get attr, errno %v", errno)
+	}
+	if out.Mode&0o222 != 0 {
+		t.Errorf("expected no write permission, got mode %o", out.Mode&0o777)
+	}
+
+	// the kernel rejects writes too, and statfs reports ST_RDONLY, along with allow_other
+	fs.config.AllowOther = true
+	options := GetFuseOptions(fs.config)
+	if !options.AllowOther || !reflect.DeepEqual(options.Options, []string{"ro"}) {
+		t.Errorf("expected ro mount with allow_other, got allow_other %t, options %q", options.AllowOther, options.Options)
+	}
+}
+
+func TestWaitMountReady(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.MountPath = "/mnt/irods"
+
+	mounted := func() error { return nil }
+
+	// returns only once the root is servable
+	statCalls := int32(0)
+	statRoot := func() error {
+		if atomic.AddInt32(&statCalls, 1) < 3 {
+			return syscall.ENOTCONN
+		}
+		return nil
+	}
+
+	if err := fs.waitMountReady(5*time.Second, mounted, statRoot); err != nil {
+		t.Fatalf("expected the mount ready, got %v", err)
+	}
+
+	if calls := atomic.LoadInt32(&statCalls); calls != 3 {
+		t.Errorf("expected to return on the first successful stat of the root, got %d stats", calls)
+	}
+
+	// the root never gets servable
+	start := time.Now()
+	err := fs.waitMountReady(300*time.Millisecond, mounted, func() error { return syscall.ENOTCONN })
+	if err == nil {
+		t.Errorf("expected an error for the root not servable")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected to give up after the timeout, took %v", elapsed)
+	}
+
+	// the kernel never completes the mount
+	hang := make(chan struct{})
+	defer close(hang)
+
+	start = time.Now()
+	err = fs.waitMountReady(300*time.Millisecond, func() error {
+		<-hang
+		return nil
+	}, func() error { return nil })
+	if err == nil {
+		t.Errorf("expected an error for the mount not completed")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected waiting for the mount bounded by the timeout, took %v", elapsed)
+	}
+}
+
+func TestAcquireDataFSClient(t *testing.T) {
+	client := newFakeFSClient()
+	dataClient := newFakeFSClient()
+
+	testCases := []struct {
+		name       string
+		dataClient *fakeFSClient
+		openMode   irodsclient_types.FileOpenMode
+		expected   *fakeFSClient
+	}{
+		{"read with data connections", dataClient, irodsclient_types.FileOpenModeReadOnly, dataClient},
+		// writes use the metadata client, so cached attributes stay coherent with writes
+		{"write with data connections", dataClient, irodsclient_types.FileOpenModeWriteOnly, client},
+		{"read write with data connections", dataClient, irodsclient_types.FileOpenModeReadWrite, client},
+		{"read without data connections", nil, irodsclient_types.FileOpenModeReadOnly, client},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fs := newTestFS(client)
+			if testCase.dataClient != nil {
+				fs.session = newFSSession(client, testCase.dataClient)
+			}
+
+			fsClient, done := fs.acquireDataFSClient(testCase.openMode)
+			done()
+
+			if fsClient != testCase.expected {
+				t.Errorf("expected the data client used %t", testCase.expected == dataClient)
+			}
+		})
+	}
+}
+
+func TestSessionReleaseKeepsSharedDataClient(t *testing.T) {
+	client := newFakeFSClient()
+	dataClient := newFakeFSClient()
+
+	session := newFSSession(client, dataClient)
+	next := newFSSession(newFakeFSClient(), dataClient)
+
+	// the data client is shared with the next session on reconnecting
+	session.release(next)
+	if !client.isReleased() || dataClient.isReleased() {
+		t.Fatalf("expected only the metadata client released")
+	}
+
+	next.release(nil)
+	if !dataClient.isReleased() {
+		t.Errorf("expected the data client released with the last session")
+	}
+}
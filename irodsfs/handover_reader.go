@@ -0,0 +1,89 @@
+package irodsfs
+
+import (
+	"sync"
+
+	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
+)
+
+// HandoverReader replaces a reader without discarding data it has prefetched
+// reads are served by the previous reader while it has the data available, and by the next reader afterwards
+type HandoverReader struct {
+	irodsfscommon_io.Reader
+
+	previous        irodsfscommon_io.Reader // nil once released
+	releasePrevious func(task func())       // runs release of the previous reader, e.g., in background
+	mutex           sync.Mutex
+}
+
+// NewHandoverReader creates a new HandoverReader reading from previous first, then from next
+func NewHandoverReader(next irodsfscommon_io.Reader, previous irodsfscommon_io.Reader, releasePrevious func(task func())) *HandoverReader {
+	return &HandoverReader{
+		Reader: next,
+
+		previous:        previous,
+		releasePrevious: releasePrevious,
+		mutex:           sync.Mutex{},
+	}
+}
+
+// ReadAt reads data at the offset, from the previous reader if it has all data requested available
+// the previous reader is released on the first read it cannot serve
+func (reader *HandoverReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	readLen, served, err := reader.readPrevious(buffer, offset)
+	if served {
+		return readLen, err
+	}
+
+	return reader.Reader.ReadAt(buffer, offset)
+}
+
+// readPrevious reads data from the previous reader if it has the data available, or releases it
+// data available is read from memory, so the mutex is held while reading not to release the reader being read
+func (reader *HandoverReader) readPrevious(buffer []byte, offset int64) (int, bool, error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	if reader.previous == nil {
+		return 0, false, nil
+	}
+
+	if reader.previous.GetAvailable(offset) >= int64(len(buffer)) {
+		readLen, err := reader.previous.ReadAt(buffer, offset)
+		return readLen, true, err
+	}
+
+	reader.releasePrevious(reader.previous.Release)
+	reader.previous = nil
+	return 0, false, nil
+}
+
+// GetAvailable returns the number of bytes available at the offset without fetching
+func (reader *HandoverReader) GetAvailable(offset int64) int64 {
+	reader.mutex.Lock()
+	available := int64(-1)
+	if reader.previous != nil {
+		available = reader.previous.GetAvailable(offset)
+	}
+	reader.mutex.Unlock()
+
+	if available > 0 {
+		return available
+	}
+
+	return reader.Reader.GetAvailable(offset)
+}
+
+// Release releases both readers
+func (reader *HandoverReader) Release() {
+	reader.mutex.Lock()
+	previous := reader.previous
+	reader.previous = nil
+	reader.mutex.Unlock()
+
+	if previous != nil {
+		previous.Release()
+	}
+
+	reader.Reader.Release()
+}
@@ -0,0 +1,96 @@
+package irodsfs
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+)
+
+// windowReader has data of a range in memory, like a prefetching reader having a window prefetched
+type windowReader struct {
+	data     []byte
+	start    int64
+	end      int64
+	reads    int32
+	released int32
+}
+
+func (reader *windowReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	atomic.AddInt32(&reader.reads, 1)
+	return copy(buffer, reader.data[offset:]), nil
+}
+
+func (reader *windowReader) GetAvailable(offset int64) int64 {
+	if offset < reader.start || offset >= reader.end {
+		return -1
+	}
+	return reader.end - offset
+}
+
+func (reader *windowReader) GetFSClient() irodsfs_common_irods.IRODSFSClient { return nil }
+func (reader *windowReader) GetPath() string                                 { return "/testzone/home/testuser/window.txt" }
+func (reader *windowReader) GetChecksum() string                             { return "" }
+func (reader *windowReader) GetSize() int64                                  { return int64(len(reader.data)) }
+func (reader *windowReader) GetError() error                                 { return nil }
+func (reader *windowReader) Release()                                        { atomic.AddInt32(&reader.released, 1) }
+
+func TestHandoverReaderReadsPrefetchedDataFirst(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64)
+
+	previous := &windowReader{data: data, start: 0, end: 512}
+	next := &windowReader{data: data, start: 0, end: 0}
+
+	reader := NewHandoverReader(next, previous, func(task func()) { task() })
+
+	buffer := make([]byte, 256)
+	for _, offset := range []int64{0, 256} {
+		readLen, err := reader.ReadAt(buffer, offset)
+		if err != nil || readLen != len(buffer) || !bytes.Equal(buffer, data[offset:offset+256]) {
+			t.Fatalf("failed to read at %d, %d bytes, %v", offset, readLen, err)
+		}
+	}
+
+	if previous.reads != 2 || next.reads != 0 {
+		t.Errorf("expected data prefetched read from the previous reader, got %d reads of previous, %d of next", previous.reads, next.reads)
+	}
+
+	// the previous reader does not have the data, it is released
+	readLen, err := reader.ReadAt(buffer, 512)
+	if err != nil || readLen != len(buffer) || !bytes.Equal(buffer, data[512:768]) {
+		t.Fatalf("failed to read at %d, %d bytes, %v", 512, readLen, err)
+	}
+
+	if next.reads != 1 || previous.released != 1 {
+		t.Errorf("expected the previous reader released on reading from the next reader, got %d reads of next, %d releases of previous", next.reads, previous.released)
+	}
+
+	// data read before is read from the next reader once the previous is released
+	_, err = reader.ReadAt(buffer, 0)
+	if err != nil || previous.reads != 2 || next.reads != 2 {
+		t.Errorf("expected reads from the next reader after handover, got %d reads of previous, %d of next, %v", previous.reads, next.reads, err)
+	}
+
+	reader.Release()
+	if previous.released != 1 || next.released != 1 {
+		t.Errorf("expected both readers released once, got %d releases of previous, %d of next", previous.released, next.released)
+	}
+}
+
+func TestHandoverReaderReleasesBothReaders(t *testing.T) {
+	data := make([]byte, 1024)
+
+	previous := &windowReader{data: data, start: 0, end: 512}
+	next := &windowReader{data: data, start: 0, end: 0}
+
+	reader := NewHandoverReader(next, previous, func(task func()) { task() })
+	if available := reader.GetAvailable(0); available != 512 {
+		t.Errorf("expected data of the previous reader available, got %d", available)
+	}
+
+	reader.Release()
+	if previous.released != 1 || next.released != 1 {
+		t.Errorf("expected both readers released once, got %d releases of previous, %d of next", previous.released, next.released)
+	}
+}
@@ -2,16 +2,53 @@ package irodsfs
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
 	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
 	fusefs "github.com/hanwen/go-fuse/v2/fs"
 	fuse "github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/cyverse/irodsfs/commons"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// errXattrUnitsNotSupported is returned when the fs client cannot set units of AVUs
+	errXattrUnitsNotSupported = xerrors.New("setting units of AVUs is not supported by the fs client")
+	// errChecksumNotSupported is returned when the fs client cannot compute checksums of data objects
+	errChecksumNotSupported = xerrors.New("computing checksums is not supported by the fs client")
+	// errDataTypeNotSupported is returned when the fs client cannot set data types of data objects
+	errDataTypeNotSupported = xerrors.New("setting data types is not supported by the fs client")
+	// errUnknownDataType is returned when the data type is not registered in the zone
+	errUnknownDataType = xerrors.New("unknown data type")
+	// errReplicasNotSupported is returned when the fs client cannot list replicas of data objects
+	errReplicasNotSupported = xerrors.New("listing replicas is not supported by the fs client")
+	// errReplicationNotSupported is returned when the fs client cannot replicate data objects
+	errReplicationNotSupported = xerrors.New("replicating data objects is not supported by the fs client")
+	// errCopyNotSupported is returned when the fs client cannot copy data objects on the server
+	errCopyNotSupported = xerrors.New("copying data objects is not supported by the fs client")
 )
 
+// FileCopier is implemented by fs clients able to copy data objects on the server
+type FileCopier interface {
+	CopyFile(srcPath string, destPath string) error
+}
+
+// ChecksumComputer is implemented by fs clients able to compute checksums of data objects
+type ChecksumComputer interface {
+	ComputeChecksum(path string) error
+}
+
 // IRODSGetACL returns permission flag from iRODS access level type
 func IRODSGetPermission(level irodsclient_types.IRODSAccessLevelType) os.FileMode {
 	switch level {
@@ -26,6 +63,15 @@ func IRODSGetPermission(level irodsclient_types.IRODSAccessLevelType) os.FileMod
 	}
 }
 
+// statfs values reported as iRODS does not tell quota and usage through IRODSFSClient
+// they are large so apps checking free space do not refuse to write
+const (
+	statfsBlockSize  uint32 = 4096
+	statfsBlocks     uint64 = 1 << 40 // 4PB in blocks
+	statfsFiles      uint64 = 1 << 32
+	statfsNameLenMax uint32 = 255
+)
+
 // IRODSGetOpenFlags converts file open flags to iRODS file open mode
 func IRODSGetOpenFlags(flags uint32) irodsclient_types.FileOpenMode {
 	if flags&uint32(os.O_WRONLY) == uint32(os.O_WRONLY) {
@@ -41,22 +87,51 @@ func IRODSGetOpenFlags(flags uint32) irodsclient_types.FileOpenMode {
 
 		return openMode
 	} else if flags&uint32(os.O_RDWR) == uint32(os.O_RDWR) {
+		if flags&uint32(os.O_APPEND) == uint32(os.O_APPEND) {
+			// read and append
+			return irodsclient_types.FileOpenModeReadAppend
+		}
+
 		return irodsclient_types.FileOpenModeReadWrite
 	}
 
 	return irodsclient_types.FileOpenModeReadOnly
 }
 
-// IRODSGetACL returns ACL flag from iRODS entry
+// IRODSGetACL returns ACL flag from iRODS entry, masked by the default mode configured
+// the mask only narrows modes reported in attributes, use irodsGetACLMode to check permissions
 func IRODSGetACL(ctx context.Context, fs *IRODSFS, entry *irodsclient_fs.Entry, readonly bool) os.FileMode {
+	mode := irodsGetACLMode(ctx, fs, entry, readonly)
+	if entry.IsDir() {
+		return mode & fs.dirModeMask
+	}
+	return mode & fs.fileModeMask
+}
+
+// irodsGetOwnerMode returns ACL flag of the owner of iRODS entry, masked by the default mode configured
+// owners have full permission, as irodsGetACLMode gives for entries of the client user
+func irodsGetOwnerMode(fs *IRODSFS, entry *irodsclient_fs.Entry, readonly bool) os.FileMode {
+	var mode os.FileMode = 0o700
+	if readonly || fs.config.ReadOnly {
+		mode = 0o500
+	}
+
+	if entry.IsDir() {
+		return mode & fs.dirModeMask
+	}
+	return mode & fs.fileModeMask
+}
+
+// irodsGetACLMode returns ACL flag from iRODS entry, not masked
+func irodsGetACLMode(ctx context.Context, fs *IRODSFS, entry *irodsclient_fs.Entry, readonly bool) os.FileMode {
 	logger := log.WithFields(log.Fields{
 		"package":  "irodsfs",
-		"function": "IRODSGetACL",
+		"function": "irodsGetACLMode",
 	})
 
 	// we don't actually check permissions for reading file when vpathEntry is read only
 	// because files with no-access for the user will not be visible
-	if readonly {
+	if readonly || fs.config.ReadOnly {
 		return 0o500
 	}
 
@@ -77,10 +152,13 @@ func IRODSGetACL(ctx context.Context, fs *IRODSFS, entry *irodsclient_fs.Entry,
 
 	var err error
 	var accesses []*irodsclient_types.IRODSAccess
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
 	if entry.IsDir() {
-		accesses, err = fs.fsClient.ListDirACLs(entry.Path)
+		accesses, err = fsClient.ListDirACLs(entry.Path)
 	} else {
-		accesses, err = fs.fsClient.ListFileACLs(entry.Path)
+		accesses, err = fsClient.ListFileACLs(entry.Path)
 	}
 
 	if err != nil {
@@ -90,7 +168,7 @@ func IRODSGetACL(ctx context.Context, fs *IRODSFS, entry *irodsclient_fs.Entry,
 
 	var highestPermission os.FileMode = 0o500
 	for _, access := range accesses {
-		if access.UserType == irodsclient_types.IRODSUserRodsUser && access.UserName == fs.config.ClientUser {
+		if access.UserType != irodsclient_types.IRODSUserRodsGroup && isClientUserAccess(fs, access) {
 			perm := IRODSGetPermission(access.AccessLevel)
 			if perm == 0o700 {
 				return perm
@@ -118,19 +196,1198 @@ func IRODSGetACL(ctx context.Context, fs *IRODSFS, entry *irodsclient_fs.Entry,
 	return highestPermission
 }
 
-// IRODSStat returns a stat for the given irods path
-func IRODSStat(ctx context.Context, fs *IRODSFS, path string) (*irodsclient_fs.Entry, error) {
-	return fs.fsClient.Stat(path)
-}
+// isClientUserAccess checks if the access is given to the client user
+// permissions must reflect the client user even when a proxy user (e.g., admin) impersonates it,
+// and the client user may be of any user type, not only rodsuser
+func isClientUserAccess(fs *IRODSFS, access *irodsclient_types.IRODSAccess) bool {
+	if access.UserName != fs.config.ClientUser {
+		return false
+	}
+
+	// a user with the same name in other zone is a different user
+	if len(access.UserZone) > 0 && access.UserZone != fs.config.Zone {
+		return false
+	}
+
+	return true
+}
+
+// withRetryBudget returns a context bounding the total time spent on retries of an operation
+// all sub-steps of the operation share the budget by passing the context down
+func withRetryBudget(ctx context.Context, fs *IRODSFS) (context.Context, context.CancelFunc) {
+	retryBudget := time.Duration(fs.config.RetryBudget)
+	if retryBudget <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, retryBudget)
+}
+
+const (
+	// the first wait before retrying on a transient error, doubled on every retry
+	transientErrorRetryBackoffMin time.Duration = 100 * time.Millisecond
+)
+
+// isIRODSTransientError checks if the error may go away by retrying, e.g., a broken connection or a full connection pool
+// errors caused by the request itself, e.g., file not found, are permanent
+func isIRODSTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if irodsclient_types.IsFileNotFoundError(err) || irodsclient_types.IsCollectionNotEmptyError(err) || irodsclient_types.IsAuthError(err) {
+		return false
+	}
+
+	return irodsclient_types.IsConnectionError(err) || irodsclient_types.IsConnectionPoolFullError(err) || isIRODSProtocolError(err)
+}
+
+// irodsRetry runs fn, and reruns it on errors that may go away by retrying, so attempts are bounded by the sum of the retries configured
+// protocol errors are rerun right away up to the protocol error retry, as the client drops the broken connection
+// connection errors reconnect the session and rerun up to the reconnect max retries, if reconnect is set
+// other transient errors, and the errors above once their retries are spent, are rerun up to the transient error retry, waiting exponentially longer between runs
+// stops when the context is done, e.g., the retry budget is spent, the filesystem is terminated, or the next wait would exceed the operation timeout
+// returns ProtocolError if the protocol error persists
+func irodsRetry(ctx context.Context, fs *IRODSFS, path string, reconnect bool, fn func() error) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "irodsRetry",
+	})
+
+	var deadline time.Time
+	if fs.config.OperationTimeout > 0 {
+		deadline = time.Now().Add(time.Duration(fs.config.OperationTimeout))
+	}
+
+	protocolErrorRetry := 0
+	reconnectRetry := 0
+	transientErrorRetry := 0
+	backoff := transientErrorRetryBackoffMin
+
+	generation := fs.getSessionGeneration()
+	err := fn()
+	for isIRODSTransientError(err) {
+		if fs.terminated {
+			break
+		}
+
+		if ctx.Err() != nil {
+			logger.Warnf("stop retrying for path %q - %v", path, ctx.Err())
+			break
+		}
+
+		if isIRODSProtocolError(err) && protocolErrorRetry < fs.config.ProtocolErrorRetry {
+			protocolErrorRetry++
+			logger.Warnf("retrying (%d/%d) on protocol error for path %q - %v", protocolErrorRetry, fs.config.ProtocolErrorRetry, path, err)
+			err = fn()
+			continue
+		}
+
+		if reconnect && isIRODSConnectionError(err) && reconnectRetry < fs.config.ReconnectMaxRetries {
+			reconnectRetry++
+			logger.Warnf("reconnecting and retrying (%d/%d) on connection error for path %q - %v", reconnectRetry, fs.config.ReconnectMaxRetries, path, err)
+
+			reconnectErr := fs.reconnectSession(generation)
+			if reconnectErr != nil {
+				logger.Errorf("%+v", reconnectErr)
+				if irodsclient_types.IsAuthError(reconnectErr) || xerrors.Is(reconnectErr, errReconnectDisabled) {
+					break
+				}
+				continue
+			}
+
+			generation = fs.getSessionGeneration()
+			err = fn()
+			continue
+		}
+
+		if transientErrorRetry >= fs.config.TransientErrorRetry {
+			break
+		}
+
+		if !deadline.IsZero() && time.Now().Add(backoff).After(deadline) {
+			logger.Warnf("stop retrying on transient error for path %q, operation timeout would be exceeded - %v", path, err)
+			break
+		}
+
+		transientErrorRetry++
+		logger.Warnf("retrying (%d/%d) in %s on transient error for path %q - %v", transientErrorRetry, fs.config.TransientErrorRetry, backoff, path, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Warnf("stop retrying on transient error for path %q - %v", path, ctx.Err())
+			return err
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		err = fn()
+	}
+
+	if isIRODSProtocolError(err) {
+		return NewProtocolError(err)
+	}
+	return err
+}
+
+// IRODSStat returns a stat for the given irods path
+func IRODSStat(ctx context.Context, fs *IRODSFS, path string) (*irodsclient_fs.Entry, error) {
+	var entry *irodsclient_fs.Entry
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		var statErr error
+		entry, statErr = fsClient.Stat(path)
+		return statErr
+	})
+	return entry, err
+}
+
+// irodsStatUncached returns a stat for the given irods path, bypassing the metadata cache
+// with irodsfs-pool, the stat may be served from the cache of the pool server
+func irodsStatUncached(ctx context.Context, fs *IRODSFS, path string) (*irodsclient_fs.Entry, error) {
+	if fs.uncachedFSClient == nil {
+		return IRODSStat(ctx, fs, path)
+	}
+
+	// the client is not of the session, so it is not reconnected
+	var entry *irodsclient_fs.Entry
+	err := irodsRetry(ctx, fs, path, false, func() error {
+		var statErr error
+		entry, statErr = fs.uncachedFSClient.Stat(path)
+		return statErr
+	})
+	return entry, err
+}
+
+// irodsStatCached returns an entry for the given irods path, entries cached by listing its dir are used first
+func irodsStatCached(ctx context.Context, fs *IRODSFS, path string) (*irodsclient_fs.Entry, error) {
+	if fs.dirAttrCache != nil {
+		if entry := fs.dirAttrCache.Get(path); entry != nil {
+			return entry, nil
+		}
+	}
+
+	return IRODSStat(ctx, fs, path)
+}
+
+// irodsListWithRetry lists entries for the given irods path, retries on protocol and connection errors
+func irodsListWithRetry(ctx context.Context, fs *IRODSFS, path string) ([]*irodsclient_fs.Entry, error) {
+	var entries []*irodsclient_fs.Entry
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		var listErr error
+		entries, listErr = fsClient.List(path)
+		return listErr
+	})
+	return entries, err
+}
+
+// IRODSList lists entries for the given irods path
+// returns context.DeadlineExceeded if listing does not complete within the list timeout
+// entries returned may be shared by callers, do not modify them
+func IRODSList(ctx context.Context, fs *IRODSFS, path string) ([]*irodsclient_fs.Entry, error) {
+	listTimeout := time.Duration(fs.config.ListTimeout)
+	if listTimeout <= 0 {
+		return irodsListWithRetry(ctx, fs, path)
+	}
+
+	listCtx, cancel := context.WithTimeout(ctx, listTimeout)
+	defer cancel()
+
+	// listing can't be cancelled in the middle, so a listing coming late is shared by callers listing the dir meanwhile
+	// rather than adding one per caller, it retries within the list timeout of its own as it outlives the caller
+	listing := fs.listings.start(path, func() ([]*irodsclient_fs.Entry, error) {
+		sharedCtx, sharedCancel := context.WithTimeout(context.Background(), listTimeout)
+		defer sharedCancel()
+
+		return irodsListWithRetry(sharedCtx, fs, path)
+	})
+
+	select {
+	case <-listing.doneChan:
+		return listing.entries, listing.err
+	case <-listCtx.Done():
+		return nil, listCtx.Err()
+	}
+}
+
+// irodsSynthesizeDirModifyTime returns a copy of the dir entry having the newest modify time of the dir and its children
+// iRODS does not update modify time of a collection when its children change, but rsync expects POSIX behavior
+// children are taken from the dir attr cache, the dir is listed and cached only if not cached
+func irodsSynthesizeDirModifyTime(ctx context.Context, fs *IRODSFS, entry *irodsclient_fs.Entry) *irodsclient_fs.Entry {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "irodsSynthesizeDirModifyTime",
+	})
+
+	var entries []*irodsclient_fs.Entry
+	listed := false
+	if fs.dirAttrCache != nil {
+		entries, listed = fs.dirAttrCache.GetDir(entry.Path)
+	}
+
+	if !listed {
+		var err error
+		entries, err = IRODSList(ctx, fs, entry.Path)
+		if err != nil {
+			logger.Debugf("failed to list dir entries for path %q, using modify time of the dir - %v", entry.Path, err)
+			return entry
+		}
+
+		if fs.dirAttrCache != nil {
+			// following stats of the dir and its entries are served from the cache
+			fs.dirAttrCache.AddDir(entry.Path, entries)
+		}
+	}
+
+	// do not modify the entry given as it may be cached
+	dirEntry := *entry
+	for _, childEntry := range entries {
+		if childEntry.ModifyTime.After(dirEntry.ModifyTime) {
+			dirEntry.ModifyTime = childEntry.ModifyTime
+		}
+	}
+
+	return &dirEntry
+}
+
+// irodsSelectModifyTime returns a copy of the entry having modify time from the iRODS timestamp configured
+func irodsSelectModifyTime(ctx context.Context, fs *IRODSFS, entry *irodsclient_fs.Entry) *irodsclient_fs.Entry {
+	switch fs.config.MTimeSource {
+	case commons.MTimeSourceCreate:
+		// do not modify the entry given as it may be cached
+		selectedEntry := *entry
+		selectedEntry.ModifyTime = entry.CreateTime
+		return &selectedEntry
+	case commons.MTimeSourceReplica:
+		return irodsSelectReplicaModifyTime(ctx, fs, entry)
+	default:
+		return entry
+	}
+}
+
+// irodsSelectReplicaModifyTime returns a copy of the entry having modify time of the newest good replica
+// dirs and data objects without good replicas keep their modify time
+func irodsSelectReplicaModifyTime(ctx context.Context, fs *IRODSFS, entry *irodsclient_fs.Entry) *irodsclient_fs.Entry {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "irodsSelectReplicaModifyTime",
+	})
+
+	if entry.IsDir() {
+		return entry
+	}
+
+	replicas, err := irodsListReplicas(ctx, fs, entry.Path)
+	if err != nil {
+		logger.Debugf("failed to list replicas of path %q, using modify time of the data object - %v", entry.Path, err)
+		return entry
+	}
+
+	var replicaModifyTime time.Time
+	for _, replica := range replicas {
+		if irodsGetReplicaStatus(replica.Status) != "good" {
+			continue
+		}
+
+		if replica.ModifyTime.After(replicaModifyTime) {
+			replicaModifyTime = replica.ModifyTime
+		}
+	}
+
+	if replicaModifyTime.IsZero() {
+		return entry
+	}
+
+	// do not modify the entry given as it may be cached
+	selectedEntry := *entry
+	selectedEntry.ModifyTime = replicaModifyTime
+	return &selectedEntry
+}
+
+// irodsAdjustClockSkew returns a copy of the entry having modify time in the client clock
+func irodsAdjustClockSkew(fs *IRODSFS, entry *irodsclient_fs.Entry) *irodsclient_fs.Entry {
+	if !fs.config.AdjustClockSkew || fs.clockSkewChecker == nil {
+		return entry
+	}
+
+	skew := fs.clockSkewChecker.GetSkew()
+	if skew == 0 {
+		return entry
+	}
+
+	// do not modify the entry given as it may be cached
+	adjustedEntry := *entry
+	adjustedEntry.ModifyTime = entry.ModifyTime.Add(skew)
+	return &adjustedEntry
+}
+
+// IRODSSetModifyTime persists the modify time for the given irods path in xattr
+// the xattr also holds the iRODS modify time, so the persisted time is dropped once the entry is modified after
+func IRODSSetModifyTime(ctx context.Context, fs *IRODSFS, path string, modifyTime time.Time) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSSetModifyTime",
+	})
+
+	entry, err := IRODSStat(ctx, fs, path)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	value := fmt.Sprintf("%d:%d", modifyTime.UnixNano(), entry.ModifyTime.UnixNano())
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	err = fsClient.SetXattr(path, ModifyTimeXattrName, value)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		fs.invalidateModifyTimeCache(path)
+		return syscall.EREMOTEIO
+	}
+
+	if fs.modifyTimeCache != nil {
+		fs.modifyTimeCache.Set(path, value)
+	}
+
+	fs.invalidateDirAttrCache(path)
+	return fusefs.OK
+}
+
+// irodsApplyPersistedModifyTime returns a copy of the entry having modify time persisted in xattr
+// irodsEntry is the entry from iRODS, before modify time is selected or adjusted
+func irodsApplyPersistedModifyTime(fs *IRODSFS, irodsEntry *irodsclient_fs.Entry, entry *irodsclient_fs.Entry) *irodsclient_fs.Entry {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "irodsApplyPersistedModifyTime",
+	})
+
+	if !fs.config.PersistTimestamps {
+		return entry
+	}
+
+	value, ok := irodsGetPersistedModifyTime(fs, irodsEntry.Path)
+	if !ok || len(value) == 0 {
+		return entry
+	}
+
+	modifyTimeString, baseString, ok := strings.Cut(value, ":")
+	if !ok {
+		logger.Debugf("failed to parse persisted modify time %q of path %q", value, irodsEntry.Path)
+		return entry
+	}
+
+	modifyTimeNano, err := strconv.ParseInt(modifyTimeString, 10, 64)
+	if err != nil {
+		logger.Debugf("failed to parse persisted modify time %q of path %q", value, irodsEntry.Path)
+		return entry
+	}
+
+	baseNano, err := strconv.ParseInt(baseString, 10, 64)
+	if err != nil {
+		logger.Debugf("failed to parse persisted modify time %q of path %q", value, irodsEntry.Path)
+		return entry
+	}
+
+	if irodsEntry.ModifyTime.UnixNano() > baseNano {
+		// modified after the modify time is set
+		return entry
+	}
+
+	// do not modify the entry given as it may be cached
+	persistedEntry := *entry
+	persistedEntry.ModifyTime = time.Unix(0, modifyTimeNano)
+	return &persistedEntry
+}
+
+// irodsGetPersistedModifyTime returns the value of the xattr holding the modify time persisted, empty if the entry does not have it
+// returns false if the xattr cannot be read
+func irodsGetPersistedModifyTime(fs *IRODSFS, path string) (string, bool) {
+	if fs.modifyTimeCache != nil {
+		if value, ok := fs.modifyTimeCache.Get(path); ok {
+			return value, true
+		}
+	}
+
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	irodsMeta, err := fsClient.GetXattr(path, ModifyTimeXattrName)
+	if err != nil {
+		return "", false
+	}
+
+	value := ""
+	if irodsMeta != nil {
+		value = irodsMeta.Value
+	}
+
+	if fs.modifyTimeCache != nil {
+		fs.modifyTimeCache.Set(path, value)
+	}
+	return value, true
+}
+
+// irodsGetReportedEntry returns the entry having modify time reported to clients, selected, adjusted and persisted
+// irodsEntry is the entry from iRODS, entry may have modify time synthesized from children of the dir
+func irodsGetReportedEntry(ctx context.Context, fs *IRODSFS, irodsEntry *irodsclient_fs.Entry, entry *irodsclient_fs.Entry) *irodsclient_fs.Entry {
+	entry = irodsSelectModifyTime(ctx, fs, entry)
+	entry = irodsAdjustClockSkew(fs, entry)
+	return irodsApplyPersistedModifyTime(fs, irodsEntry, entry)
+}
+
+// irodsSetAttrOut sets the attr of the entry reported to clients, with owner and mode of the client user
+// irodsEntry is the entry from iRODS, entry may have modify time synthesized from children of the dir
+func irodsSetAttrOut(ctx context.Context, fs *IRODSFS, irodsEntry *irodsclient_fs.Entry, entry *irodsclient_fs.Entry, readonly bool, out *fuse.Attr) {
+	mode := IRODSGetACL(ctx, fs, entry, readonly)
+	entry = irodsGetReportedEntry(ctx, fs, irodsEntry, entry)
+	uid, gid, mode := fs.getOwnerAttr(entry, mode, readonly)
+	setAttrOutForIRODSEntry(fs.getInodeIDForIRODSEntry(entry.ID, entry.Path), entry, uid, gid, mode, out)
+}
+
+// IRODSGetattr returns an attr for the given irods path
+func IRODSGetattr(ctx context.Context, fs *IRODSFS, path string, vpathReadonly bool, out *fuse.AttrOut) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSGetattr",
+	})
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return syscall.EAGAIN
+	}
+
+	ctx, cancel := withRetryBudget(ctx, fs)
+	defer cancel()
+
+	entry, err := irodsStatCached(ctx, fs, path)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		if isTransitiveConnectionError(err) {
+			// return dummy
+			logger.Errorf("returning dummy attr for path %q", path)
+			setAttrOutForDummy(fs.inodeManager, path, fs.uid, fs.gid, true, &out.Attr)
+			return fusefs.OK
+		}
+
+		if IsProtocolError(err) {
+			return syscall.EIO
+		}
+
+		return syscall.EREMOTEIO
+	}
+
+	irodsEntry := entry
+	if entry.IsDir() && fs.config.DirModifyTimeFromChildren {
+		entry = irodsSynthesizeDirModifyTime(ctx, fs, entry)
+	}
+
+	irodsSetAttrOut(ctx, fs, irodsEntry, entry, vpathReadonly, &out.Attr)
+	return fusefs.OK
+}
+
+// IRODSLookup returns entry for the given irods path
+func IRODSLookup(ctx context.Context, fs *IRODSFS, dir *Dir, path string, vpathReadonly bool, out *fuse.EntryOut) (int64, bool, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSLookup",
+	})
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return 0, false, syscall.EAGAIN
+	}
+
+	ctx, cancel := withRetryBudget(ctx, fs)
+	defer cancel()
+
+	entry, err := irodsStatCached(ctx, fs, path)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return 0, false, syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		if IsProtocolError(err) {
+			return 0, false, syscall.EIO
+		}
+
+		return 0, false, syscall.EREMOTEIO
+	}
+
+	irodsEntry := entry
+	if entry.IsDir() && fs.config.DirModifyTimeFromChildren {
+		entry = irodsSynthesizeDirModifyTime(ctx, fs, entry)
+	}
+
+	irodsSetAttrOut(ctx, fs, irodsEntry, entry, vpathReadonly, &out.Attr)
+	return entry.ID, entry.IsDir(), fusefs.OK
+}
+
+// IRODSListxattr returns all xattrs for the given irods path
+// pseudoXattrNames are names of xattrs served by the caller, listed too
+func IRODSListxattr(ctx context.Context, fs *IRODSFS, path string, pseudoXattrNames []string, dest []byte) (uint32, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSListxattr",
+	})
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return 0, syscall.EAGAIN
+	}
+
+	var irodsMetadata []*irodsclient_types.IRODSMeta
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		var listErr error
+		irodsMetadata, listErr = fsClient.ListXattr(path)
+		return listErr
+	})
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return 0, syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	// convert to a byte array
+	xattrNames := []byte{}
+	for _, irodsMeta := range irodsMetadata {
+		xattrNames = append(xattrNames, []byte(irodsMeta.Name)...)
+		xattrNames = append(xattrNames, byte(0))
+	}
+
+	if fs.config.ExposeXattrUnits {
+		for _, unitXattrName := range irodsListUnitXattrNames(irodsMetadata) {
+			xattrNames = append(xattrNames, []byte(unitXattrName)...)
+			xattrNames = append(xattrNames, byte(0))
+		}
+	}
+
+	if fs.config.ExposeZone {
+		xattrNames = append(xattrNames, []byte(ZoneXattrName)...)
+		xattrNames = append(xattrNames, byte(0))
+	}
+
+	// list pseudo xattrs only when Getxattr returns them
+	entry, err := IRODSStat(ctx, fs, path)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return 0, syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	if fs.config.ExposeEntryInfo {
+		xattrNames = append(xattrNames, []byte(OwnerXattrName)...)
+		xattrNames = append(xattrNames, byte(0))
+
+		if !entry.IsDir() && len(entry.CheckSum) > 0 {
+			xattrNames = append(xattrNames, []byte(ChecksumXattrName)...)
+			xattrNames = append(xattrNames, byte(0))
+		}
+
+		if !entry.IsDir() {
+			// not listed if replicas are unknown, e.g., with irodsfs-pool
+			replicas, err := irodsListReplicas(ctx, fs, path)
+			if err != nil && !xerrors.Is(err, errReplicasNotSupported) {
+				logger.Errorf("%+v", err)
+			}
+
+			if err == nil && len(replicas) > 0 {
+				xattrNames = append(xattrNames, []byte(ResourceXattrName)...)
+				xattrNames = append(xattrNames, byte(0))
+				xattrNames = append(xattrNames, []byte(ReplicaCountXattrName)...)
+				xattrNames = append(xattrNames, byte(0))
+				xattrNames = append(xattrNames, []byte(ReplicasXattrName)...)
+				xattrNames = append(xattrNames, byte(0))
+			}
+		}
+	}
+
+	if fs.config.ExposeReplicaChecksums && !entry.IsDir() {
+		replicas, err := irodsListReplicas(ctx, fs, path)
+		if err != nil && !xerrors.Is(err, errReplicasNotSupported) {
+			logger.Errorf("%+v", err)
+		}
+
+		if err == nil && len(replicas) > 0 {
+			xattrNames = append(xattrNames, []byte(ReplicaChecksumsXattrName)...)
+			xattrNames = append(xattrNames, byte(0))
+		}
+	}
+
+	if fs.config.ExposeOpenHandles && !entry.IsDir() {
+		xattrNames = append(xattrNames, []byte(OpenHandlesXattrName)...)
+		xattrNames = append(xattrNames, byte(0))
+	}
+
+	if fs.config.ExposeDataType && !entry.IsDir() && len(entry.DataType) > 0 {
+		xattrNames = append(xattrNames, []byte(DataTypeXattrName)...)
+		xattrNames = append(xattrNames, byte(0))
+	}
+
+	if fs.config.PosixACL {
+		xattrNames = append(xattrNames, []byte(PosixACLAccessXattrName)...)
+		xattrNames = append(xattrNames, byte(0))
+	}
+
+	for _, pseudoXattrName := range pseudoXattrNames {
+		xattrNames = append(xattrNames, []byte(pseudoXattrName)...)
+		xattrNames = append(xattrNames, byte(0))
+	}
+
+	requiredBytesLen := len(xattrNames)
+	if len(dest) < requiredBytesLen {
+		return uint32(requiredBytesLen), syscall.ERANGE
+	}
+
+	// has any?
+	if len(xattrNames) > 0 {
+		copy(dest, xattrNames)
+		return uint32(requiredBytesLen), fusefs.OK
+	}
+
+	// return empty
+	return 0, fusefs.OK
+}
+
+// irodsCopyXattrNames copies null-terminated names of xattrs into dest, returns ERANGE with the size required if dest is too small
+func irodsCopyXattrNames(xattrNames []string, dest []byte) (uint32, syscall.Errno) {
+	requiredBytesLen := 0
+	for _, xattrName := range xattrNames {
+		requiredBytesLen += len(xattrName) + 1
+	}
+
+	if len(dest) < requiredBytesLen {
+		return uint32(requiredBytesLen), syscall.ERANGE
+	}
+
+	offset := 0
+	for _, xattrName := range xattrNames {
+		offset += copy(dest[offset:], xattrName)
+		dest[offset] = 0
+		offset++
+	}
+	return uint32(requiredBytesLen), fusefs.OK
+}
+
+// irodsListUnitXattrNames returns names of xattrs holding units of AVUs with units
+// an AVU with the same name as the unit xattr hides the unit xattr
+func irodsListUnitXattrNames(irodsMetadata []*irodsclient_types.IRODSMeta) []string {
+	avuNames := map[string]bool{}
+	for _, irodsMeta := range irodsMetadata {
+		avuNames[irodsMeta.Name] = true
+	}
+
+	unitXattrNames := []string{}
+	for _, irodsMeta := range irodsMetadata {
+		unitXattrName := irodsMeta.Name + XattrUnitSuffix
+		if len(irodsMeta.Units) == 0 || avuNames[unitXattrName] {
+			continue
+		}
+
+		unitXattrNames = append(unitXattrNames, unitXattrName)
+		avuNames[unitXattrName] = true
+	}
+	return unitXattrNames
+}
+
+// irodsGetUnitXattr returns the unit of the AVU the unit xattr is for, returns nil if attr is not a unit xattr
+// the caller must check there is no AVU named attr first
+func irodsGetUnitXattr(ctx context.Context, fs *IRODSFS, path string, attr string) (*irodsclient_types.IRODSMeta, error) {
+	if !fs.config.ExposeXattrUnits || !strings.HasSuffix(attr, XattrUnitSuffix) {
+		return nil, nil
+	}
+
+	var irodsMeta *irodsclient_types.IRODSMeta
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		var getErr error
+		irodsMeta, getErr = fsClient.GetXattr(path, strings.TrimSuffix(attr, XattrUnitSuffix))
+		return getErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if irodsMeta == nil || len(irodsMeta.Units) == 0 {
+		return nil, nil
+	}
+
+	return &irodsclient_types.IRODSMeta{
+		Name:  attr,
+		Value: irodsMeta.Units,
+	}, nil
+}
+
+// irodsGetZone returns the zone where the entry lives
+// paths of entries in federated zones start with the zone name, e.g., /remoteZone/home/user
+func irodsGetZone(path string) string {
+	zone := strings.TrimPrefix(path, "/")
+	if idx := strings.Index(zone, "/"); idx >= 0 {
+		zone = zone[:idx]
+	}
+	return zone
+}
+
+// irodsGetEntryInfoXattr returns an xattr presenting information of the iRODS entry, not AVUs
+func irodsGetEntryInfoXattr(ctx context.Context, fs *IRODSFS, path string, attr string, dest []byte) (uint32, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "irodsGetEntryInfoXattr",
+	})
+
+	entry, err := IRODSStat(ctx, fs, path)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return 0, syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	var value []byte
+	switch attr {
+	case OwnerXattrName:
+		value = []byte(entry.Owner)
+	case ChecksumXattrName:
+		if entry.IsDir() || len(entry.CheckSum) == 0 {
+			return 0, syscall.ENODATA
+		}
+
+		value = []byte(string(entry.CheckSumAlgorithm) + ":" + hex.EncodeToString(entry.CheckSum))
+	case ResourceXattrName, ReplicaCountXattrName, ReplicasXattrName:
+		if entry.IsDir() {
+			return 0, syscall.ENODATA
+		}
+
+		replicas, err := irodsListReplicas(ctx, fs, path)
+		if err != nil {
+			if xerrors.Is(err, errReplicasNotSupported) {
+				logger.Debugf("failed to list replicas of path %q, the fs client cannot list replicas", path)
+				return 0, syscall.ENODATA
+			}
+
+			if irodsclient_types.IsFileNotFoundError(err) {
+				logger.Debugf("failed to find file for path %q", path)
+				return 0, syscall.ENOENT
+			}
+
+			logger.Errorf("%+v", err)
+			return 0, syscall.EREMOTEIO
+		}
+
+		if len(replicas) == 0 {
+			return 0, syscall.ENODATA
+		}
+
+		if attr == ReplicaCountXattrName {
+			value = []byte(strconv.Itoa(len(replicas)))
+			break
+		}
+
+		if attr == ReplicasXattrName {
+			replicaStrings := []string{}
+			for _, replica := range replicas {
+				replicaStrings = append(replicaStrings, fmt.Sprintf("%d:%s:%s", replica.Number, replica.ResourceName, irodsGetReplicaStatus(replica.Status)))
+			}
+			value = []byte(strings.Join(replicaStrings, ","))
+			break
+		}
+
+		resources := []string{}
+		for _, replica := range replicas {
+			if !containsString(resources, replica.ResourceName) {
+				resources = append(resources, replica.ResourceName)
+			}
+		}
+		value = []byte(strings.Join(resources, ","))
+	default:
+		return 0, syscall.ENODATA
+	}
+
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+
+	copy(dest, value)
+	return uint32(len(value)), fusefs.OK
+}
+
+// irodsGetReplicaChecksumsXattr returns an xattr presenting checksums of replicas, different checksums tell replicas diverged
+func irodsGetReplicaChecksumsXattr(ctx context.Context, fs *IRODSFS, path string, dest []byte) (uint32, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "irodsGetReplicaChecksumsXattr",
+	})
+
+	entry, err := IRODSStat(ctx, fs, path)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return 0, syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	// dirs have no replicas
+	if entry.IsDir() {
+		return 0, syscall.ENODATA
+	}
+
+	replicas, err := irodsListReplicas(ctx, fs, path)
+	if err != nil {
+		if xerrors.Is(err, errReplicasNotSupported) {
+			logger.Debugf("failed to list replicas of path %q, the fs client cannot list replicas", path)
+			return 0, syscall.ENODATA
+		}
+
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file for path %q", path)
+			return 0, syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	if len(replicas) == 0 {
+		return 0, syscall.ENODATA
+	}
+
+	checksumStrings := []string{}
+	for _, replica := range replicas {
+		checksum := ""
+		if replica.Checksum != nil && len(replica.Checksum.Checksum) > 0 {
+			checksum = string(replica.Checksum.Algorithm) + ":" + hex.EncodeToString(replica.Checksum.Checksum)
+		}
+		checksumStrings = append(checksumStrings, replica.ResourceName+":"+checksum)
+	}
+	value := []byte(strings.Join(checksumStrings, ","))
+
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+
+	copy(dest, value)
+	return uint32(len(value)), fusefs.OK
+}
+
+// irodsGetReplicaStatus returns a readable status of a replica from the status code in the catalog
+func irodsGetReplicaStatus(status string) string {
+	switch status {
+	case "0":
+		return "stale"
+	case "1":
+		return "good"
+	case "2":
+		return "intermediate"
+	case "3":
+		return "read-locked"
+	case "4":
+		return "write-locked"
+	default:
+		return status
+	}
+}
+
+// irodsListReplicas returns replicas of the data object, cached for the metadata cache timeout if replica cache is used
+func irodsListReplicas(ctx context.Context, fs *IRODSFS, path string) ([]*irodsclient_types.IRODSReplica, error) {
+	if fs.replicaCache != nil {
+		if replicas, ok := fs.replicaCache.Get(path); ok {
+			return replicas, nil
+		}
+	}
+
+	var replicas []*irodsclient_types.IRODSReplica
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		var listErr error
+		replicas, listErr = listReplicas(fsClient, path)
+		return listErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.replicaCache != nil {
+		fs.replicaCache.Set(path, replicas)
+	}
+
+	return replicas, nil
+}
+
+// listReplicas returns replicas of the data object, read from the catalog
+func listReplicas(fsClient irodsfs_common_irods.IRODSFSClient, path string) ([]*irodsclient_types.IRODSReplica, error) {
+	if client, ok := extendFSClient(fsClient).(ReplicaLister); ok {
+		return client.ListReplicas(path)
+	}
+
+	return nil, errReplicasNotSupported
+}
+
+// IRODSReplicate queues replication of the data object to the resource, returns once queued
+// replicas xattrs present the progress
+func IRODSReplicate(ctx context.Context, fs *IRODSFS, path string, resource string) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSReplicate",
+	})
+
+	if !IsValidResourceName(resource) {
+		logger.Debugf("failed to replicate path %q, invalid resource name %q", path, resource)
+		return syscall.EINVAL
+	}
+
+	fsClient, done := fs.acquireFSClient()
+	supported := isReplicationSupported(fsClient)
+	done()
+
+	if !supported {
+		logger.Debugf("failed to replicate path %q, the fs client cannot replicate data objects", path)
+		return syscall.ENOTSUP
+	}
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return syscall.EAGAIN
+	}
+
+	// replication copies the whole data object, so do not block the caller
+	fs.runAsync(func() {
+		err := irodsRetry(context.Background(), fs, path, true, func() error {
+			fsClient, done := fs.acquireFSClient()
+			defer done()
+
+			return replicateFile(fsClient, path, resource)
+		})
+		fs.invalidateReplicaCache(path)
+		if err != nil {
+			logger.Errorf("failed to replicate %q to resource %q - %+v", path, resource, err)
+			return
+		}
+
+		logger.Infof("replicated %q to resource %q", path, resource)
+	})
+
+	return fusefs.OK
+}
+
+// isReplicationSupported checks if the fs client can replicate data objects
+func isReplicationSupported(fsClient irodsfs_common_irods.IRODSFSClient) bool {
+	_, ok := extendFSClient(fsClient).(FileReplicator)
+	return ok
+}
+
+// replicateFile replicates the data object to the resource
+func replicateFile(fsClient irodsfs_common_irods.IRODSFSClient, path string, resource string) error {
+	if client, ok := extendFSClient(fsClient).(FileReplicator); ok {
+		return client.ReplicateFile(path, resource)
+	}
+
+	return errReplicationNotSupported
+}
+
+// IRODSCopyFile copies the data object to the dest path on the server, overwriting the dest
+func IRODSCopyFile(ctx context.Context, fs *IRODSFS, srcPath string, destPath string) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSCopyFile",
+	})
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", destPath)
+		return syscall.EAGAIN
+	}
+
+	err := irodsRetry(ctx, fs, destPath, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		return copyFile(fsClient, srcPath, destPath)
+	})
+	if err != nil {
+		if xerrors.Is(err, errCopyNotSupported) {
+			logger.Debugf("%+v", err)
+			return syscall.ENOTSUP
+		}
+
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file %q to copy", srcPath)
+			return syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	fs.invalidateDirAttrCache(destPath)
+	return fusefs.OK
+}
+
+// isCopySupported checks if the fs client can copy data objects on the server
+func isCopySupported(fsClient irodsfs_common_irods.IRODSFSClient) bool {
+	_, ok := extendFSClient(fsClient).(FileCopier)
+	return ok
+}
+
+// copyFile copies the data object on the server, overwriting the dest
+func copyFile(fsClient irodsfs_common_irods.IRODSFSClient, srcPath string, destPath string) error {
+	if client, ok := extendFSClient(fsClient).(FileCopier); ok {
+		return client.CopyFile(srcPath, destPath)
+	}
+
+	return errCopyNotSupported
+}
+
+// IRODSGetxattr returns an xattr for the given irods path and attr name
+func IRODSGetxattr(ctx context.Context, fs *IRODSFS, path string, attr string, dest []byte) (uint32, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSGetxattr",
+	})
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return 0, syscall.EAGAIN
+	}
+
+	if attr == ZoneXattrName && fs.config.ExposeZone {
+		value := []byte(irodsGetZone(path))
+		if len(dest) < len(value) {
+			return uint32(len(value)), syscall.ERANGE
+		}
+
+		copy(dest, value)
+		return uint32(len(value)), fusefs.OK
+	}
+
+	if IsEntryInfoAttr(attr) && fs.config.ExposeEntryInfo {
+		return irodsGetEntryInfoXattr(ctx, fs, path, attr, dest)
+	}
+
+	if attr == ReplicaChecksumsXattrName && fs.config.ExposeReplicaChecksums {
+		return irodsGetReplicaChecksumsXattr(ctx, fs, path, dest)
+	}
+
+	var irodsMeta *irodsclient_types.IRODSMeta
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		var getErr error
+		irodsMeta, getErr = fsClient.GetXattr(path, attr)
+		return getErr
+	})
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return 0, syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	if irodsMeta == nil {
+		irodsMeta, err = irodsGetUnitXattr(ctx, fs, path, attr)
+		if err != nil {
+			logger.Errorf("%+v", err)
+			return 0, syscall.EREMOTEIO
+		}
+	}
+
+	if irodsMeta == nil {
+		return 0, syscall.ENODATA
+	}
+
+	requiredBytesLen := len([]byte(irodsMeta.Value))
+
+	if len(dest) < requiredBytesLen {
+		return uint32(requiredBytesLen), syscall.ERANGE
+	}
+
+	copy(dest, []byte(irodsMeta.Value))
+	return uint32(requiredBytesLen), fusefs.OK
+}
+
+// IRODSSetxattr sets an xattr for the given irods path and attr name
+func IRODSSetxattr(ctx context.Context, fs *IRODSFS, path string, attr string, data []byte) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSSetxattr",
+	})
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return syscall.EAGAIN
+	}
+
+	// reject before writing to avoid leaving partial state
+	if fs.config.XattrValueMax > 0 && len(data) > fs.config.XattrValueMax {
+		logger.Debugf("xattr value for %q of path %q is too large, %d > %d", attr, path, len(data), fs.config.XattrValueMax)
+		return syscall.E2BIG
+	}
+
+	unitAVU, errno := irodsGetUnitXattrAVU(ctx, fs, path, attr)
+	if errno != fusefs.OK {
+		return errno
+	}
+
+	if unitAVU != nil {
+		return irodsSetAVUUnits(ctx, fs, path, unitAVU, string(data))
+	}
+
+	if attr == ModifyTimeXattrName {
+		defer fs.invalidateModifyTimeCache(path)
+	}
+
+	if attr == DefaultResourceXattrName {
+		defer fs.invalidateDefaultResourceCache(path)
+	}
 
-// IRODSGetattr returns an attr for the given irods path
-func IRODSGetattr(ctx context.Context, fs *IRODSFS, path string, vpathReadonly bool, out *fuse.AttrOut) syscall.Errno {
-	logger := log.WithFields(log.Fields{
-		"package":  "irodsfs",
-		"function": "IRODSGetattr",
-	})
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
 
-	entry, err := fs.fsClient.Stat(path)
+		return fsClient.SetXattr(path, attr, string(data))
+	})
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", path)
@@ -138,128 +1395,146 @@ func IRODSGetattr(ctx context.Context, fs *IRODSFS, path string, vpathReadonly b
 		}
 
 		logger.Errorf("%+v", err)
-		if isTransitiveConnectionError(err) {
-			// return dummy
-			logger.Errorf("returning dummy attr for path %q", path)
-			setAttrOutForDummy(fs.inodeManager, path, fs.uid, fs.gid, true, &out.Attr)
-			return fusefs.OK
-		}
-
 		return syscall.EREMOTEIO
 	}
 
-	mode := IRODSGetACL(ctx, fs, entry, vpathReadonly)
-	setAttrOutForIRODSEntry(fs.inodeManager, entry, fs.uid, fs.gid, mode, &out.Attr)
 	return fusefs.OK
 }
 
-// IRODSLookup returns entry for the given irods path
-func IRODSLookup(ctx context.Context, fs *IRODSFS, dir *Dir, path string, vpathReadonly bool, out *fuse.EntryOut) (int64, bool, syscall.Errno) {
+// irodsGetUnitXattrAVU returns the AVU the unit xattr is for, returns nil if attr is not a unit xattr
+// attr is a unit xattr if no AVU is named attr and the AVU named without the suffix exists, even if the AVU has no unit yet
+func irodsGetUnitXattrAVU(ctx context.Context, fs *IRODSFS, path string, attr string) (*irodsclient_types.IRODSMeta, syscall.Errno) {
 	logger := log.WithFields(log.Fields{
 		"package":  "irodsfs",
-		"function": "IRODSLookup",
+		"function": "irodsGetUnitXattrAVU",
 	})
 
-	entry, err := fs.fsClient.Stat(path)
-	if err != nil {
-		if irodsclient_types.IsFileNotFoundError(err) {
-			logger.Debugf("failed to find file or dir for path %q", path)
-			return 0, false, syscall.ENOENT
-		}
-
-		logger.Errorf("%+v", err)
-		return 0, false, syscall.EREMOTEIO
+	if !fs.config.ExposeXattrUnits || !strings.HasSuffix(attr, XattrUnitSuffix) {
+		return nil, fusefs.OK
 	}
 
-	mode := IRODSGetACL(ctx, fs, entry, vpathReadonly)
+	var irodsMeta *irodsclient_types.IRODSMeta
+	var avu *irodsclient_types.IRODSMeta
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
 
-	setAttrOutForIRODSEntry(fs.inodeManager, entry, fs.uid, fs.gid, mode, &out.Attr)
-	return entry.ID, entry.IsDir(), fusefs.OK
-}
+		var getErr error
+		irodsMeta, getErr = fsClient.GetXattr(path, attr)
+		if getErr != nil || irodsMeta != nil {
+			return getErr
+		}
 
-// IRODSListxattr returns all xattrs for the given irods path
-func IRODSListxattr(ctx context.Context, fs *IRODSFS, path string, dest []byte) (uint32, syscall.Errno) {
-	logger := log.WithFields(log.Fields{
-		"package":  "irodsfs",
-		"function": "IRODSListxattr",
+		avu, getErr = fsClient.GetXattr(path, strings.TrimSuffix(attr, XattrUnitSuffix))
+		return getErr
 	})
-
-	irodsMetadata, err := fs.fsClient.ListXattr(path)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", path)
-			return 0, syscall.ENOENT
+			return nil, syscall.ENOENT
 		}
 
 		logger.Errorf("%+v", err)
-		return 0, syscall.EREMOTEIO
-	}
-
-	// convert to a byte array
-	xattrNames := []byte{}
-	for _, irodsMeta := range irodsMetadata {
-		xattrNames = append(xattrNames, []byte(irodsMeta.Name)...)
-		xattrNames = append(xattrNames, byte(0))
-	}
-
-	requiredBytesLen := len(xattrNames)
-	if len(dest) < requiredBytesLen {
-		return uint32(requiredBytesLen), syscall.ERANGE
+		return nil, syscall.EREMOTEIO
 	}
 
-	// has any?
-	if len(xattrNames) > 0 {
-		copy(dest, xattrNames)
-		return uint32(requiredBytesLen), fusefs.OK
+	if irodsMeta != nil {
+		return nil, fusefs.OK
 	}
 
-	// return empty
-	return 0, fusefs.OK
+	return avu, fusefs.OK
 }
 
-// IRODSGetxattr returns an xattr for the given irods path and attr name
-func IRODSGetxattr(ctx context.Context, fs *IRODSFS, path string, attr string, dest []byte) (uint32, syscall.Errno) {
+// irodsSetAVUUnits sets the unit of the AVU keeping its value, empty units clear the unit
+func irodsSetAVUUnits(ctx context.Context, fs *IRODSFS, path string, avu *irodsclient_types.IRODSMeta, units string) syscall.Errno {
 	logger := log.WithFields(log.Fields{
 		"package":  "irodsfs",
-		"function": "IRODSGetxattr",
+		"function": "irodsSetAVUUnits",
 	})
 
-	irodsMeta, err := fs.fsClient.GetXattr(path, attr)
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		return setXattrWithUnits(fsClient, path, avu.Name, avu.Value, units)
+	})
 	if err != nil {
+		if xerrors.Is(err, errXattrUnitsNotSupported) {
+			logger.Debugf("failed to set unit of AVU %q of path %q, the fs client cannot set units", avu.Name, path)
+			return syscall.ENOTSUP
+		}
+
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", path)
-			return 0, syscall.ENOENT
+			return syscall.ENOENT
 		}
 
 		logger.Errorf("%+v", err)
-		return 0, syscall.EREMOTEIO
+		return syscall.EREMOTEIO
 	}
 
-	if irodsMeta == nil {
-		return 0, syscall.ENODATA
+	return fusefs.OK
+}
+
+// setXattrWithUnits sets an AVU with units, replacing AVUs of the name as SetXattr of fs clients does
+func setXattrWithUnits(fsClient irodsfs_common_irods.IRODSFSClient, path string, name string, value string, units string) error {
+	if client, ok := extendFSClient(fsClient).(XattrUnitsSetter); ok {
+		return client.SetXattrWithUnits(path, name, value, units)
 	}
 
-	requiredBytesLen := len([]byte(irodsMeta.Value))
+	return errXattrUnitsNotSupported
+}
 
-	if len(dest) < requiredBytesLen {
-		return uint32(requiredBytesLen), syscall.ERANGE
+// irodsComputeChecksum computes checksum of the data object in iRODS, registering it in the catalog
+func irodsComputeChecksum(ctx context.Context, fs *IRODSFS, path string) error {
+	return irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		return computeChecksum(fsClient, path)
+	})
+}
+
+// computeChecksum computes checksum of the data object on the server
+func computeChecksum(fsClient irodsfs_common_irods.IRODSFSClient, path string) error {
+	if client, ok := extendFSClient(fsClient).(ChecksumComputer); ok {
+		return client.ComputeChecksum(path)
 	}
 
-	copy(dest, []byte(irodsMeta.Value))
-	return uint32(requiredBytesLen), fusefs.OK
+	return errChecksumNotSupported
 }
 
-// IRODSSetxattr sets an xattr for the given irods path and attr name
-func IRODSSetxattr(ctx context.Context, fs *IRODSFS, path string, attr string, data []byte) syscall.Errno {
+// IRODSSetDataType sets the data type of the data object, the type must be registered in the zone
+func IRODSSetDataType(ctx context.Context, fs *IRODSFS, path string, dataType string) syscall.Errno {
 	logger := log.WithFields(log.Fields{
 		"package":  "irodsfs",
-		"function": "IRODSSetxattr",
+		"function": "IRODSSetDataType",
 	})
 
-	err := fs.fsClient.SetXattr(path, attr, string(data))
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return syscall.EAGAIN
+	}
+
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		return setDataType(fsClient, path, dataType)
+	})
 	if err != nil {
+		if xerrors.Is(err, errUnknownDataType) {
+			logger.Debugf("failed to set data type of path %q, %q is not registered in the zone", path, dataType)
+			return syscall.EINVAL
+		}
+
+		if xerrors.Is(err, errDataTypeNotSupported) {
+			logger.Debugf("failed to set data type of path %q, the fs client cannot set data types", path)
+			return syscall.ENOTSUP
+		}
+
 		if irodsclient_types.IsFileNotFoundError(err) {
-			logger.Debugf("failed to find file or dir for path %q", path)
+			logger.Debugf("failed to find file for path %q", path)
 			return syscall.ENOENT
 		}
 
@@ -267,9 +1542,39 @@ func IRODSSetxattr(ctx context.Context, fs *IRODSFS, path string, attr string, d
 		return syscall.EREMOTEIO
 	}
 
+	fs.invalidateDirAttrCache(path)
 	return fusefs.OK
 }
 
+// setDataType validates the data type against types registered in the zone and sets it to the data object
+func setDataType(fsClient irodsfs_common_irods.IRODSFSClient, path string, dataType string) error {
+	client, ok := extendFSClient(fsClient).(DataTypeSetter)
+	if !ok {
+		return errDataTypeNotSupported
+	}
+
+	dataTypes, err := client.ListDataTypes()
+	if err != nil {
+		return err
+	}
+
+	if !containsString(dataTypes, dataType) {
+		return xerrors.Errorf("failed to set data type %q: %w", dataType, errUnknownDataType)
+	}
+
+	return client.SetDataType(path, dataType)
+}
+
+// containsString checks if the value is one of the values given
+func containsString(values []string, value string) bool {
+	for _, known := range values {
+		if known == value {
+			return true
+		}
+	}
+	return false
+}
+
 // IRODSRemovexattr unsets an xattr for the given irods path and attr name
 func IRODSRemovexattr(ctx context.Context, fs *IRODSFS, path string, attr string) syscall.Errno {
 	logger := log.WithFields(log.Fields{
@@ -277,7 +1582,20 @@ func IRODSRemovexattr(ctx context.Context, fs *IRODSFS, path string, attr string
 		"function": "IRODSRemovexattr",
 	})
 
-	irodsMeta, err := fs.fsClient.GetXattr(path, attr)
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return syscall.EAGAIN
+	}
+
+	var irodsMeta *irodsclient_types.IRODSMeta
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		var getErr error
+		irodsMeta, getErr = fsClient.GetXattr(path, attr)
+		return getErr
+	})
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", path)
@@ -289,10 +1607,32 @@ func IRODSRemovexattr(ctx context.Context, fs *IRODSFS, path string, attr string
 	}
 
 	if irodsMeta == nil {
-		return syscall.ENODATA
+		unitAVU, errno := irodsGetUnitXattrAVU(ctx, fs, path, attr)
+		if errno != fusefs.OK {
+			return errno
+		}
+
+		if unitAVU == nil || len(unitAVU.Units) == 0 {
+			return syscall.ENODATA
+		}
+
+		return irodsSetAVUUnits(ctx, fs, path, unitAVU, "")
 	}
 
-	err = fs.fsClient.RemoveXattr(path, attr)
+	if attr == ModifyTimeXattrName {
+		defer fs.invalidateModifyTimeCache(path)
+	}
+
+	if attr == DefaultResourceXattrName {
+		defer fs.invalidateDefaultResourceCache(path)
+	}
+
+	err = irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		return fsClient.RemoveXattr(path, attr)
+	})
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", path)
@@ -313,7 +1653,15 @@ func IRODSOpendir(ctx context.Context, fs *IRODSFS, path string) syscall.Errno {
 		"function": "IRODSOpendir",
 	})
 
-	entry, err := fs.fsClient.Stat(path)
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return syscall.EAGAIN
+	}
+
+	ctx, cancel := withRetryBudget(ctx, fs)
+	defer cancel()
+
+	entry, err := IRODSStat(ctx, fs, path)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", path)
@@ -327,6 +1675,10 @@ func IRODSOpendir(ctx context.Context, fs *IRODSFS, path string) syscall.Errno {
 			return fusefs.OK
 		}
 
+		if IsProtocolError(err) {
+			return syscall.EIO
+		}
+
 		return syscall.EREMOTEIO
 	}
 
@@ -345,9 +1697,28 @@ func IRODSReaddir(ctx context.Context, fs *IRODSFS, path string) ([]fuse.DirEntr
 		"function": "IRODSReaddir",
 	})
 
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return nil, syscall.EAGAIN
+	}
+
+	ctx, cancel := withRetryBudget(ctx, fs)
+	defer cancel()
+
 	dirEntries := []fuse.DirEntry{}
 
-	entries, err := fs.fsClient.List(path)
+	var entries []*irodsclient_fs.Entry
+	listed := false
+	if fs.dirAttrCache != nil && fs.config.DirAttrPrefetch {
+		// the dir is listed in background on opendir
+		entries, listed = fs.dirAttrCache.GetDir(path)
+	}
+
+	var err error
+	if !listed {
+		entries, err = IRODSList(ctx, fs, path)
+	}
+
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find dir for path %q", path)
@@ -361,18 +1732,61 @@ func IRODSReaddir(ctx context.Context, fs *IRODSFS, path string) ([]fuse.DirEntr
 			return dirEntries, fusefs.OK
 		}
 
+		if err == context.DeadlineExceeded {
+			logger.Errorf("listing dir entries for path %q timed out", path)
+			if fs.config.ListTimeoutPartialResults && fs.dirAttrCache != nil {
+				// listings are not streamed, so entries known from the dir attr cache are presented before the error
+				partialEntries, _ := fs.dirAttrCache.GetDirEntries(path)
+				return irodsGetDirEntries(fs, partialEntries), syscall.ETIMEDOUT
+			}
+			return nil, syscall.ETIMEDOUT
+		} else if err == context.Canceled {
+			logger.Debugf("listing dir entries for path %q is cancelled", path)
+			return nil, syscall.EINTR
+		} else if IsProtocolError(err) {
+			return nil, syscall.EIO
+		}
+
+		if fs.config.InaccessibleDirAsEmpty && isPermissionError(err) {
+			// present as an empty dir, so tools walking a tree can skip it
+			logger.Debugf("returning empty dir entries for inaccessible path %q", path)
+			return dirEntries, fusefs.OK
+		}
+
 		return nil, syscall.EREMOTEIO
 	}
 
+	if fs.dirAttrCache != nil && !listed {
+		// following stats of the entries, e.g., ls -l, are served from the cache
+		fs.dirAttrCache.AddDir(path, entries)
+	}
+
+	return irodsGetDirEntries(fs, entries), fusefs.OK
+}
+
+// irodsGetDirEntries returns dir entries presenting the iRODS entries
+func irodsGetDirEntries(fs *IRODSFS, entries []*irodsclient_fs.Entry) []fuse.DirEntry {
+	dirEntries := []fuse.DirEntry{}
 	for _, entry := range entries {
 		entryType := uint32(fuse.S_IFREG)
 
 		if entry.IsDir() {
 			entryType = uint32(fuse.S_IFDIR)
+		} else if irodsMayBeSymlink(fs, entry) {
+			// targets are not asked per entry while listing, the type is resolved on lookup unless known already
+			entryType = 0
+			if fs.dirAttrCache != nil {
+				if target, ok := fs.dirAttrCache.GetSymlinkTarget(entry.Path); ok {
+					entryType = uint32(fuse.S_IFREG)
+					if target != nil {
+						entryType = uint32(fuse.S_IFLNK)
+					}
+				}
+			}
 		}
 
 		dirEntry := fuse.DirEntry{
-			Ino:  fs.inodeManager.GetInodeIDForIRODSEntryID(entry.ID),
+			Ino:  fs.getInodeIDForIRODSEntry(entry.ID, entry.Path),
 			Mode: entryType,
 			Name: entry.Name,
 		}
@@ -380,7 +1794,7 @@ func IRODSReaddir(ctx context.Context, fs *IRODSFS, path string) ([]fuse.DirEntr
 		dirEntries = append(dirEntries, dirEntry)
 	}
 
-	return dirEntries, fusefs.OK
+	return dirEntries
 }
 
 // IRODSRmdir removes dir for the given irods path
@@ -390,7 +1804,10 @@ func IRODSRmdir(ctx context.Context, fs *IRODSFS, path string) syscall.Errno {
 		"function": "IRODSRmdir",
 	})
 
-	entry, err := fs.fsClient.Stat(path)
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	entry, err := fsClient.Stat(path)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find dir for path %q", path)
@@ -407,7 +1824,7 @@ func IRODSRmdir(ctx context.Context, fs *IRODSFS, path string) syscall.Errno {
 	}
 
 	// dir
-	err = fs.fsClient.RemoveDir(entry.Path, false, false)
+	err = fsClient.RemoveDir(entry.Path, false, false)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find dir for path %q", entry.Path)
@@ -421,6 +1838,7 @@ func IRODSRmdir(ctx context.Context, fs *IRODSFS, path string) syscall.Errno {
 		return syscall.EREMOTEIO
 	}
 
+	fs.invalidateDirAttrCache(path)
 	return fusefs.OK
 }
 
@@ -431,7 +1849,10 @@ func IRODSUnlink(ctx context.Context, fs *IRODSFS, path string) syscall.Errno {
 		"function": "IRODSUnlink",
 	})
 
-	entry, err := fs.fsClient.Stat(path)
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	entry, err := fsClient.Stat(path)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file for path %q", path)
@@ -448,7 +1869,7 @@ func IRODSUnlink(ctx context.Context, fs *IRODSFS, path string) syscall.Errno {
 	}
 
 	// file
-	err = fs.fsClient.RemoveFile(entry.Path, false)
+	err = fsClient.RemoveFile(entry.Path, false)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file for path %q", path)
@@ -459,6 +1880,8 @@ func IRODSUnlink(ctx context.Context, fs *IRODSFS, path string) syscall.Errno {
 		return syscall.EREMOTEIO
 	}
 
+	fs.forgetChangePoller(path)
+	fs.invalidateDirAttrCache(path)
 	return fusefs.OK
 }
 
@@ -469,26 +1892,27 @@ func IRODSMkdir(ctx context.Context, fs *IRODSFS, dir *Dir, path string, out *fu
 		"function": "IRODSMkdir",
 	})
 
-	err := fs.fsClient.MakeDir(path, false)
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	err := fsClient.MakeDir(path, false)
 	if err != nil {
 		logger.Errorf("%+v", err)
 		return 0, syscall.EREMOTEIO
 	}
 
-	entry, err := fs.fsClient.Stat(path)
+	entry, err := fsClient.Stat(path)
 	if err != nil {
 		logger.Errorf("%+v", err)
 		return 0, syscall.EREMOTEIO
 	}
 
-	mode := IRODSGetACL(ctx, fs, entry, false)
-
 	if !entry.IsDir() {
 		logger.Errorf("failed to create a dir, but found a file")
 		return 0, syscall.EREMOTEIO
 	}
 
-	setAttrOutForIRODSEntry(fs.inodeManager, entry, fs.uid, fs.gid, mode, &out.Attr)
+	irodsSetAttrOut(ctx, fs, entry, entry, false, &out.Attr)
 	return entry.ID, fusefs.OK
 }
 
@@ -499,7 +1923,16 @@ func IRODSRename(ctx context.Context, fs *IRODSFS, dir *Dir, srcPath string, des
 		"function": "IRODSRename",
 	})
 
-	srcEntry, err := fs.fsClient.Stat(srcPath)
+	// entries cached in both dirs are stale after renaming, even if it fails halfway
+	defer fs.invalidateDirAttrCache(destPath)
+	defer fs.invalidateDirAttrCache(srcPath)
+	defer fs.forgetChangePoller(destPath)
+	defer fs.forgetChangePoller(srcPath)
+
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	srcEntry, err := fsClient.Stat(srcPath)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", srcPath)
@@ -511,7 +1944,7 @@ func IRODSRename(ctx context.Context, fs *IRODSFS, dir *Dir, srcPath string, des
 	}
 
 	if srcEntry.IsDir() {
-		err = dir.fs.fsClient.RenameDirToDir(srcPath, destPath)
+		err = fsClient.RenameDirToDir(srcPath, destPath)
 		if err != nil {
 			logger.Errorf("%+v", err)
 			return syscall.EREMOTEIO
@@ -520,7 +1953,7 @@ func IRODSRename(ctx context.Context, fs *IRODSFS, dir *Dir, srcPath string, des
 		return fusefs.OK
 	}
 
-	destEntry, err := fs.fsClient.Stat(destPath)
+	destEntry, err := fsClient.Stat(destPath)
 	if err != nil {
 		if !irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", destPath)
@@ -531,7 +1964,7 @@ func IRODSRename(ctx context.Context, fs *IRODSFS, dir *Dir, srcPath string, des
 		if destEntry.ID > 0 {
 			// delete first
 			if !destEntry.IsDir() {
-				err = dir.fs.fsClient.RemoveFile(destPath, false)
+				err = fsClient.RemoveFile(destPath, false)
 				if err != nil {
 					logger.Errorf("%+v", err)
 					return syscall.EREMOTEIO
@@ -540,7 +1973,7 @@ func IRODSRename(ctx context.Context, fs *IRODSFS, dir *Dir, srcPath string, des
 		}
 	}
 
-	err = dir.fs.fsClient.RenameFileToFile(srcPath, destPath)
+	err = fsClient.RenameFileToFile(srcPath, destPath)
 	if err != nil {
 		logger.Errorf("%+v", err)
 		return syscall.EREMOTEIO
@@ -549,6 +1982,45 @@ func IRODSRename(ctx context.Context, fs *IRODSFS, dir *Dir, srcPath string, des
 	return fusefs.OK
 }
 
+// IRODSGetDefaultResource returns the default resource of the given irods collection path set in xattr
+// returns empty string if it is not set, so the default resource of the account is used
+func IRODSGetDefaultResource(ctx context.Context, fs *IRODSFS, path string) string {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSGetDefaultResource",
+	})
+
+	if fs.defaultResourceCache != nil {
+		if resource, ok := fs.defaultResourceCache.Get(path); ok {
+			return resource
+		}
+	}
+
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	irodsMeta, err := fsClient.GetXattr(path, DefaultResourceXattrName)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find collection for path %q", path)
+		} else {
+			logger.Warnf("failed to get default resource of path %q, using the default resource of the client - %v", path, err)
+		}
+		return ""
+	}
+
+	resource := ""
+	if irodsMeta != nil {
+		resource = irodsMeta.Value
+	}
+
+	if fs.defaultResourceCache != nil {
+		fs.defaultResourceCache.Set(path, resource)
+	}
+
+	return resource
+}
+
 // IRODSCreate creates file for the given irods path
 func IRODSCreate(ctx context.Context, fs *IRODSFS, dir *Dir, path string, flags uint32, out *fuse.EntryOut) (int64, *FileHandle, syscall.Errno) {
 	logger := log.WithFields(log.Fields{
@@ -559,13 +2031,39 @@ func IRODSCreate(ctx context.Context, fs *IRODSFS, dir *Dir, path string, flags
 	openMode := IRODSGetOpenFlags(flags)
 	logger.Infof("Create file %q with flag %d, mode %q", path, flags, openMode)
 
-	handle, err := fs.fsClient.CreateFile(path, "", string(openMode))
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	if flags&uint32(syscall.O_EXCL) != 0 {
+		// creating the data object overwrites an existing one, so check first, bypassing the metadata cache not to miss entries created by others
+		// exclusive creates of the path through this mount are serialized, but other iRODS clients may create it in between
+		unlock := fs.createLocks.Lock(path)
+		defer unlock()
+
+		_, err := irodsStatUncached(ctx, fs, path)
+		if err == nil {
+			logger.Debugf("file or dir for path %q already exists", path)
+			return 0, nil, syscall.EEXIST
+		}
+
+		if !irodsclient_types.IsFileNotFoundError(err) {
+			logger.Errorf("%+v", err)
+			return 0, nil, syscall.EREMOTEIO
+		}
+	}
+
+	resource := ""
+	if fs.config.CollectionDefaultResource {
+		resource = IRODSGetDefaultResource(ctx, fs, irodsfs_common_utils.GetDirname(path))
+	}
+
+	handle, err := fsClient.CreateFile(path, resource, string(openMode))
 	if err != nil {
 		logger.Errorf("%+v", err)
 		return 0, nil, syscall.EREMOTEIO
 	}
 
-	entry, err := fs.fsClient.Stat(path)
+	entry, err := fsClient.Stat(path)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find file or dir for path %q", path)
@@ -576,8 +2074,8 @@ func IRODSCreate(ctx context.Context, fs *IRODSFS, dir *Dir, path string, flags
 		return 0, nil, syscall.EREMOTEIO
 	}
 
-	if fs.instanceReportClient != nil {
-		fs.instanceReportClient.StartFileAccess(handle)
+	if reportClient := fs.getAccessReportClient(handle.GetOpenMode()); reportClient != nil {
+		reportClient.StartFileAccess(handle)
 	}
 
 	fileHandle, err := NewFileHandle(fs, handle)
@@ -586,11 +2084,123 @@ func IRODSCreate(ctx context.Context, fs *IRODSFS, dir *Dir, path string, flags
 		return 0, nil, syscall.EREMOTEIO
 	}
 
-	mode := IRODSGetACL(ctx, fs, entry, false)
-	setAttrOutForIRODSEntry(fs.inodeManager, entry, fs.uid, fs.gid, mode, &out.Attr)
+	irodsSetAttrOut(ctx, fs, entry, entry, false, &out.Attr)
 	return entry.ID, fileHandle, fusefs.OK
 }
 
+// IRODSSymlink creates a symlink for the given irods path
+// creates an empty data object holding the target in xattr, as iRODS does not have symlinks for data objects
+func IRODSSymlink(ctx context.Context, fs *IRODSFS, dir *Dir, path string, target string, out *fuse.EntryOut) (int64, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSSymlink",
+	})
+
+	logger.Infof("Create symlink %q to %q", path, target)
+
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	if fsClient.ExistsFile(path) || fsClient.ExistsDir(path) {
+		return 0, syscall.EEXIST
+	}
+
+	handle, err := fsClient.CreateFile(path, "", string(irodsclient_types.FileOpenModeWriteOnly))
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	err = handle.Close()
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	err = fsClient.SetXattr(path, SymlinkTargetXattrName, target)
+	if err != nil {
+		logger.Errorf("%+v", err)
+
+		// do not leave an empty file
+		removeErr := fsClient.RemoveFile(path, true)
+		if removeErr != nil {
+			logger.Errorf("%+v", removeErr)
+		}
+		return 0, syscall.EREMOTEIO
+	}
+
+	entry, err := IRODSStat(ctx, fs, path)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	entry = irodsGetReportedEntry(ctx, fs, entry, entry)
+	uid, gid := fs.getOwnerID(entry.Owner)
+	setAttrOutForIRODSEntry(fs.getInodeIDForIRODSEntry(entry.ID, entry.Path), entry, uid, gid, 0o777, &out.Attr)
+	setAttrOutForSymlink([]byte(target), &out.Attr)
+	return entry.ID, fusefs.OK
+}
+
+// IRODSReadlink returns the target of the symlink for the given irods path
+// returns ENOENT if the data object is gone or does not hold a target
+func IRODSReadlink(ctx context.Context, fs *IRODSFS, path string) ([]byte, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSReadlink",
+	})
+
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	irodsMeta, err := fsClient.GetXattr(path, SymlinkTargetXattrName)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find symlink for path %q", path)
+			return nil, syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return nil, syscall.EREMOTEIO
+	}
+
+	if irodsMeta == nil {
+		return nil, syscall.ENOENT
+	}
+
+	return []byte(irodsMeta.Value), fusefs.OK
+}
+
+// irodsMayBeSymlink checks if the entry may be a symlink, symlinks are empty data objects holding their target in xattr
+func irodsMayBeSymlink(fs *IRODSFS, entry *irodsclient_fs.Entry) bool {
+	return (fs.config.EnableSymlink || fs.config.ResolveSoftlinks) && !entry.IsDir() && entry.Size == 0
+}
+
+// irodsReadlinkCached returns the target of the symlink for the given irods path, targets resolved while its dir is cached are used first
+func irodsReadlinkCached(ctx context.Context, fs *IRODSFS, path string) ([]byte, syscall.Errno) {
+	if fs.dirAttrCache == nil {
+		return IRODSReadlink(ctx, fs, path)
+	}
+
+	if target, ok := fs.dirAttrCache.GetSymlinkTarget(path); ok {
+		if target == nil {
+			return nil, syscall.ENOENT
+		}
+		return target, fusefs.OK
+	}
+
+	target, errno := IRODSReadlink(ctx, fs, path)
+	switch errno {
+	case fusefs.OK:
+		fs.dirAttrCache.SetSymlinkTarget(path, target)
+	case syscall.ENOENT:
+		// not a symlink
+		fs.dirAttrCache.SetSymlinkTarget(path, nil)
+	}
+
+	return target, errno
+}
+
 // IRODSOpen opens file for the given irods path
 func IRODSOpen(ctx context.Context, fs *IRODSFS, file *File, path string, flags uint32) (*FileHandle, syscall.Errno) {
 	logger := log.WithFields(log.Fields{
@@ -601,7 +2211,7 @@ func IRODSOpen(ctx context.Context, fs *IRODSFS, file *File, path string, flags
 	openMode := IRODSGetOpenFlags(flags)
 	logger.Infof("Open file %q with flag %d, mode %q", path, flags, openMode)
 
-	handle, err := fs.fsClient.OpenFile(path, "", string(openMode))
+	handle, err := fs.openDataFile(path, openMode)
 	if err != nil {
 		if irodsclient_types.IsFileNotFoundError(err) {
 			logger.Debugf("failed to find a file %q", path)
@@ -612,8 +2222,8 @@ func IRODSOpen(ctx context.Context, fs *IRODSFS, file *File, path string, flags
 		return nil, syscall.EREMOTEIO
 	}
 
-	if fs.instanceReportClient != nil {
-		fs.instanceReportClient.StartFileAccess(handle)
+	if reportClient := fs.getAccessReportClient(handle.GetOpenMode()); reportClient != nil {
+		reportClient.StartFileAccess(handle)
 	}
 
 	fileHandle, err := NewFileHandle(fs, handle)
@@ -642,3 +2252,16 @@ func IRODSOpenLazy(ctx context.Context, fs *IRODSFS, file *File, path string, fl
 
 	return fileHandle, fusefs.OK
 }
+
+// IRODSStatfs returns file system statistics
+func IRODSStatfs(ctx context.Context, fs *IRODSFS, out *fuse.StatfsOut) syscall.Errno {
+	out.Bsize = statfsBlockSize
+	out.Frsize = statfsBlockSize
+	out.Blocks = statfsBlocks
+	out.Bfree = statfsBlocks
+	out.Bavail = statfsBlocks
+	out.Files = statfsFiles
+	out.Ffree = statfsFiles
+	out.NameLen = statfsNameLenMax
+	return fusefs.OK
+}
@@ -0,0 +1,1307 @@
+package irodsfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_common "github.com/cyverse/go-irodsclient/irods/common"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/cyverse/irodsfs/commons"
+	"golang.org/x/xerrors"
+)
+
+func TestIRODSRetryBoundsAttempts(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ProtocolErrorRetry = 2
+	fs.config.TransientErrorRetry = 2
+
+	attempts := 0
+	err := irodsRetry(context.Background(), fs, "/testzone/home/testuser", false, func() error {
+		attempts++
+		return irodsclient_types.NewIRODSError(irodsclient_common.SYS_HEADER_READ_LEN_ERR)
+	})
+
+	// retries are added up, not multiplied
+	if attempts != 5 {
+		t.Errorf("expected 5 attempts, got %d", attempts)
+	}
+
+	var protocolErr *ProtocolError
+	if !xerrors.As(err, &protocolErr) {
+		t.Errorf("expected a protocol error, got %v", err)
+	}
+}
+
+func TestIRODSRetryStopsOnPermanentError(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ProtocolErrorRetry = 2
+	fs.config.TransientErrorRetry = 2
+
+	attempts := 0
+	err := irodsRetry(context.Background(), fs, "/testzone/home/testuser", false, func() error {
+		attempts++
+		return irodsclient_types.NewFileNotFoundError("/testzone/home/testuser")
+	})
+
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+
+	if !irodsclient_types.IsFileNotFoundError(err) {
+		t.Errorf("expected file not found, got %v", err)
+	}
+}
+
+func TestIRODSRetryStopsWhenRetryBudgetIsSpent(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.TransientErrorRetry = 10
+
+	// no budget, no deadline
+	ctx, cancel := withRetryBudget(context.Background(), fs)
+	if _, ok := ctx.Deadline(); ok {
+		t.Errorf("expected no deadline without retry budget")
+	}
+	cancel()
+
+	fs.config.RetryBudget = irodsfs_common_utils.Duration(250 * time.Millisecond)
+
+	ctx, cancel = withRetryBudget(context.Background(), fs)
+	defer cancel()
+
+	attempts := 0
+	start := time.Now()
+	err := irodsRetry(ctx, fs, "/testzone/home/testuser", false, func() error {
+		attempts++
+		return irodsclient_types.NewConnectionPoolFullError(1, 1)
+	})
+
+	// waits of 100ms and 200ms fit in the budget, the retry count would wait for minutes
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected retries bounded by the budget, took %v", elapsed)
+	}
+
+	if attempts < 2 || attempts > 3 {
+		t.Errorf("expected 2 or 3 attempts in the budget, got %d", attempts)
+	}
+
+	if !irodsclient_types.IsConnectionPoolFullError(err) {
+		t.Errorf("expected the last error returned, got %v", err)
+	}
+}
+
+func TestIRODSGetattrProtocolError(t *testing.T) {
+	testCases := []struct {
+		name               string
+		protocolErrorRetry int
+		errno              syscall.Errno
+		stats              int
+	}{
+		{"retried", 1, fusefs.OK, 2},
+		{"not retried", 0, syscall.EIO, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+			fs.config.ProtocolErrorRetry = testCase.protocolErrorRetry
+
+			filePath := "/testzone/home/testuser/protocol.txt"
+			client.addFile(filePath, []byte("data"))
+
+			client.setFailNext("Stat", irodsclient_types.NewIRODSError(irodsclient_common.SYS_HEADER_READ_LEN_ERR))
+
+			out := fuse.AttrOut{}
+			if errno := IRODSGetattr(context.Background(), fs, filePath, false, &out); errno != testCase.errno {
+				t.Errorf("expected errno %v, got %v", testCase.errno, errno)
+			}
+
+			if stats := client.getCalls("Stat"); stats != testCase.stats {
+				t.Errorf("expected %d stats, got %d", testCase.stats, stats)
+			}
+		})
+	}
+}
+
+func TestFileHandleWriteIsNotRetried(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.TransientErrorRetry = 2
+
+	filePath := "/testzone/home/testuser/write.txt"
+	client.addFile(filePath, []byte{})
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeWriteOnly)
+
+	client.setFailNext("WriteAt", irodsclient_types.NewConnectionPoolFullError(1, 1))
+
+	_, errno := handle.Write(context.Background(), []byte("data"), 0)
+	if errno == fusefs.OK {
+		t.Errorf("expected the write to fail")
+	}
+
+	if calls := client.getCalls("WriteAt"); calls != 1 {
+		t.Errorf("expected 1 write, got %d", calls)
+	}
+}
+
+func TestGetOwnerAttr(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.uid = 1000
+	fs.gid = 1000
+	fs.userMappings = map[string]commons.UserMapping{
+		"otheruser": {IRODSUser: "otheruser", UID: 2000, GID: 2000},
+	}
+
+	tests := []struct {
+		owner    string
+		mode     os.FileMode
+		readonly bool
+		uid      uint32
+		expected os.FileMode
+	}{
+		// the client user's own entry
+		{testUser, 0o700, false, 1000, 0o700},
+		// an unmapped owner is reported as the mounting user
+		{"unmapped", 0o500, false, 1000, 0o500},
+		// the client user's permission moves to group and other bits of other owner
+		{"otheruser", 0o500, false, 2000, 0o755},
+		{"otheruser", 0o700, false, 2000, 0o777},
+		{"otheruser", 0o500, true, 2000, 0o555},
+	}
+
+	for _, test := range tests {
+		entry := &irodsclient_fs.Entry{
+			Type:  irodsclient_fs.FileEntry,
+			Path:  "/testzone/home/testuser/file.txt",
+			Owner: test.owner,
+		}
+
+		uid, gid, mode := fs.getOwnerAttr(entry, test.mode, test.readonly)
+		if uid != test.uid || gid != test.uid {
+			t.Errorf("owner %q: expected uid/gid %d, got %d/%d", test.owner, test.uid, uid, gid)
+		}
+
+		if mode != test.expected {
+			t.Errorf("owner %q, mode %o: expected mode %o, got %o", test.owner, test.mode, test.expected, mode)
+		}
+	}
+}
+
+func TestGetACLModeOfClientUser(t *testing.T) {
+	testCases := []struct {
+		name     string
+		userType irodsclient_types.IRODSUserType
+		userZone string
+		mode     os.FileMode
+	}{
+		{"rodsuser", irodsclient_types.IRODSUserRodsUser, testZone, 0o700},
+		{"rodsadmin", irodsclient_types.IRODSUserRodsAdmin, testZone, 0o700},
+		{"groupadmin", irodsclient_types.IRODSUserGroupAdmin, testZone, 0o700},
+		{"zone not given", irodsclient_types.IRODSUserRodsUser, "", 0o700},
+		// a user with the same name in other zone is a different user
+		{"other zone", irodsclient_types.IRODSUserRodsUser, "otherzone", 0o500},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+
+			filePath := "/testzone/home/shared/acl.txt"
+			entry := client.addFile(filePath, []byte("data"))
+			entry.Owner = "otheruser"
+
+			client.setACLs(filePath, []*irodsclient_types.IRODSAccess{
+				{Path: filePath, UserName: "otheruser", UserZone: testZone, UserType: irodsclient_types.IRODSUserRodsUser, AccessLevel: irodsclient_types.IRODSAccessLevelOwner},
+				{Path: filePath, UserName: testUser, UserZone: testCase.userZone, UserType: testCase.userType, AccessLevel: irodsclient_types.IRODSAccessLevelModifyObject},
+			})
+
+			if mode := irodsGetACLMode(context.Background(), fs, entry, false); mode != testCase.mode {
+				t.Errorf("expected mode %o, got %o", testCase.mode, mode)
+			}
+		})
+	}
+}
+
+func TestIRODSReaddirInaccessibleDirAsEmpty(t *testing.T) {
+	dirPath := "/testzone/home/testuser/dir"
+
+	tests := []struct {
+		name  string
+		err   error
+		errno syscall.Errno
+	}{
+		{"no access permission", irodsclient_types.NewIRODSError(irodsclient_common.CAT_NO_ACCESS_PERMISSION), fusefs.OK},
+		{"auth error", irodsclient_types.NewAuthError(&irodsclient_types.IRODSAccount{}), fusefs.OK},
+		{"other error", irodsclient_types.NewIRODSError(irodsclient_common.CAT_NAME_EXISTS_AS_DATAOBJ), syscall.EREMOTEIO},
+	}
+
+	for _, test := range tests {
+		client := newFakeFSClient()
+		fs := newTestFS(client)
+		fs.config.InaccessibleDirAsEmpty = true
+
+		client.addDir(dirPath)
+		client.setFailNext("List", test.err)
+
+		entries, errno := IRODSReaddir(context.Background(), fs, dirPath)
+		if errno != test.errno {
+			t.Errorf("%s: expected errno %v, got %v", test.name, test.errno, errno)
+		}
+
+		if errno == fusefs.OK && len(entries) != 0 {
+			t.Errorf("%s: expected no entries, got %d", test.name, len(entries))
+		}
+	}
+}
+
+func TestIRODSReaddirListTimeout(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ListTimeout = irodsfs_common_utils.Duration(50 * time.Millisecond)
+
+	dirPath := "/testzone/home/testuser/slow"
+	client.addDir(dirPath)
+	client.addFile(dirPath+"/a.txt", []byte("a"))
+	client.addFile(dirPath+"/b.txt", []byte("b"))
+	client.listDelay = 500 * time.Millisecond
+
+	// callers listing the slow dir time out, and share one listing
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	errnos := make([]syscall.Errno, 5)
+	for i := range errnos {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errnos[i] = IRODSReaddir(context.Background(), fs, dirPath)
+		}(i)
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed >= client.listDelay {
+		t.Errorf("expected listing to time out before the backend returns, took %v", elapsed)
+	}
+
+	for i, errno := range errnos {
+		if errno != syscall.ETIMEDOUT {
+			t.Errorf("caller %d: expected ETIMEDOUT, got %v", i, errno)
+		}
+	}
+
+	if !waitFor(2*time.Second, func() bool { return client.getCalls("List") > 0 }) {
+		t.Fatalf("expected the dir listed")
+	}
+
+	time.Sleep(client.listDelay)
+	if calls := client.getCalls("List"); calls != 1 {
+		t.Errorf("expected one listing shared by callers, got %d", calls)
+	}
+
+	// entries known are presented before the error with list_timeout_partial_results
+	fs.config.ListTimeoutPartialResults = true
+	fs.dirAttrCache = NewDirAttrCache(time.Minute)
+	knownEntry, err := client.Stat(dirPath + "/a.txt")
+	if err != nil {
+		t.Fatalf("failed to stat - %v", err)
+	}
+	fs.dirAttrCache.AddDir(dirPath, []*irodsclient_fs.Entry{knownEntry})
+
+	entries, errno := IRODSReaddir(context.Background(), fs, dirPath)
+	if errno != syscall.ETIMEDOUT {
+		t.Errorf("expected ETIMEDOUT with partial results, got %v", errno)
+	}
+
+	if len(entries) != 1 || entries[0].Name != "a.txt" {
+		t.Errorf("expected the entry known presented, got %+v", entries)
+	}
+
+	// and discarded otherwise
+	fs.config.ListTimeoutPartialResults = false
+	time.Sleep(client.listDelay)
+
+	entries, errno = IRODSReaddir(context.Background(), fs, dirPath)
+	if errno != syscall.ETIMEDOUT || len(entries) != 0 {
+		t.Errorf("expected ETIMEDOUT without entries, got %v and %+v", errno, entries)
+	}
+
+	// the stream presents entries and then the error
+	stream := &partialDirStream{
+		entries: []fuse.DirEntry{{Name: "a.txt"}},
+		errno:   syscall.ETIMEDOUT,
+	}
+
+	if entry, errno := stream.Next(); !stream.HasNext() || entry.Name != "a.txt" || errno != fusefs.OK {
+		t.Errorf("expected the entry first, got %q (%v)", entry.Name, errno)
+	}
+
+	if _, errno := stream.Next(); errno != syscall.ETIMEDOUT {
+		t.Errorf("expected ETIMEDOUT after entries, got %v", errno)
+	}
+
+	if stream.HasNext() {
+		t.Errorf("expected the stream ended after the error")
+	}
+}
+
+func TestIRODSLookupServedFromReaddir(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ReaddirPlus = true
+	fs.dirAttrCache = NewDirAttrCache(time.Minute)
+
+	dirPath := "/testzone/home/testuser/dir"
+	client.addDir(dirPath)
+	client.addFile(dirPath+"/a.txt", []byte("a"))
+	client.addFile(dirPath+"/b.txt", []byte("bb"))
+
+	dirEntries, errno := IRODSReaddir(context.Background(), fs, dirPath)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to list, errno %v", errno)
+	}
+
+	statCalls := client.getCalls("Stat")
+
+	// readdirplus looks up every entry listed
+	for _, dirEntry := range dirEntries {
+		out := fuse.EntryOut{}
+		_, _, errno := IRODSLookup(context.Background(), fs, nil, dirPath+"/"+dirEntry.Name, false, &out)
+		if errno != fusefs.OK {
+			t.Fatalf("failed to look up %q, errno %v", dirEntry.Name, errno)
+		}
+
+		if out.Attr.Ino != dirEntry.Ino {
+			t.Errorf("%q: expected inode %d of the listing, got %d", dirEntry.Name, dirEntry.Ino, out.Attr.Ino)
+		}
+	}
+
+	if calls := client.getCalls("Stat") - statCalls; calls != 0 {
+		t.Errorf("expected lookups served from the listing, got %d stats", calls)
+	}
+}
+
+func TestIRODSSetAttrOutReportsModifyTime(t *testing.T) {
+	modifyTime := time.Unix(1700000000, 0)
+	createTime := modifyTime.Add(-time.Hour)
+	persistedTime := modifyTime.Add(-2*time.Hour + 123456789)
+
+	testCases := []struct {
+		name        string
+		mtimeSource string
+		skew        time.Duration
+		persisted   bool
+		expected    time.Time
+	}{
+		{"modify time", commons.MTimeSourceModify, 0, false, modifyTime},
+		{"create time", commons.MTimeSourceCreate, 0, false, createTime},
+		{"clock skew", commons.MTimeSourceModify, time.Minute, false, modifyTime.Add(time.Minute)},
+		{"create time with clock skew", commons.MTimeSourceCreate, time.Minute, false, createTime.Add(time.Minute)},
+		{"persisted", commons.MTimeSourceModify, time.Minute, true, persistedTime},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+			fs.config.MTimeSource = testCase.mtimeSource
+			fs.config.AdjustClockSkew = true
+			fs.config.PersistTimestamps = true
+			fs.clockSkewChecker = NewClockSkewChecker(client, "/"+testZone+"/home/"+testUser, time.Hour)
+			fs.clockSkewChecker.skew = testCase.skew
+
+			filePath := "/testzone/home/testuser/mtime.txt"
+			entry := client.addFile(filePath, []byte("0123"))
+			entry.ModifyTime = modifyTime
+			entry.CreateTime = createTime
+
+			if testCase.persisted {
+				value := fmt.Sprintf("%d:%d", persistedTime.UnixNano(), modifyTime.UnixNano())
+				if err := client.SetXattr(filePath, ModifyTimeXattrName, value); err != nil {
+					t.Fatalf("failed to set xattr - %v", err)
+				}
+			}
+
+			attr := fuse.Attr{}
+			irodsSetAttrOut(context.Background(), fs, entry, entry, false, &attr)
+			if reported := attr.ModTime(); !reported.Equal(testCase.expected) {
+				t.Errorf("expected modify time %v, got %v", testCase.expected, reported)
+			}
+
+			// entries reported by other operations have the same modify time
+			attrOut := fuse.AttrOut{}
+			if errno := IRODSGetattr(context.Background(), fs, filePath, false, &attrOut); errno != fusefs.OK {
+				t.Fatalf("failed to get attr - %v", errno)
+			}
+			if attrOut.Attr != attr {
+				t.Errorf("expected attr %v from getattr, got %v", attr, attrOut.Attr)
+			}
+
+			file := NewFile(fs, attr.Ino, "/mtime.txt")
+			fileAttr := fuse.Attr{}
+			file.setAttrOutForIRODSEntry(context.Background(), entry, false, &fileAttr)
+			if fileAttr != attr {
+				t.Errorf("expected attr %v from file, got %v", attr, fileAttr)
+			}
+		})
+	}
+}
+
+func TestReplicaModifyTimeSource(t *testing.T) {
+	modifyTime := time.Unix(1700000000, 0)
+	replicatedTime := modifyTime.Add(time.Hour)
+	staleTime := modifyTime.Add(2 * time.Hour)
+
+	testCases := []struct {
+		name     string
+		replicas []*irodsclient_types.IRODSReplica
+		expected time.Time
+	}{
+		{"newest good replica", []*irodsclient_types.IRODSReplica{
+			{Number: 0, ResourceName: "demoResc", Status: "1", ModifyTime: modifyTime},
+			{Number: 1, ResourceName: "replResc", Status: "1", ModifyTime: replicatedTime},
+			{Number: 2, ResourceName: "archResc", Status: "0", ModifyTime: staleTime},
+		}, replicatedTime},
+		{"no good replica", []*irodsclient_types.IRODSReplica{
+			{Number: 0, ResourceName: "demoResc", Status: "0", ModifyTime: staleTime},
+		}, modifyTime.Add(-time.Minute)},
+		{"no replica", nil, modifyTime.Add(-time.Minute)},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+			fs.config.MTimeSource = commons.MTimeSourceReplica
+			fs.replicaCache = NewReplicaCache(time.Minute)
+
+			filePath := "/testzone/home/testuser/replicated.txt"
+			entry := client.addFile(filePath, []byte("0123"))
+			entry.ModifyTime = modifyTime.Add(-time.Minute)
+			client.setReplicas(filePath, testCase.replicas)
+
+			attrOut := fuse.AttrOut{}
+			if errno := IRODSGetattr(context.Background(), fs, filePath, false, &attrOut); errno != fusefs.OK {
+				t.Fatalf("failed to get attr - %v", errno)
+			}
+
+			if reported := attrOut.Attr.ModTime(); !reported.Equal(testCase.expected) {
+				t.Errorf("expected modify time %v, got %v", testCase.expected, reported)
+			}
+		})
+	}
+
+	// clients which cannot list replicas report modify time of data objects
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.MTimeSource = commons.MTimeSourceReplica
+	fs.session = newFSSession(&unitlessFSClient{IRODSFSClient: client}, nil)
+
+	filePath := "/testzone/home/testuser/replicated.txt"
+	entry := client.addFile(filePath, []byte("0123"))
+	entry.ModifyTime = modifyTime
+	client.setReplicas(filePath, []*irodsclient_types.IRODSReplica{
+		{Number: 0, ResourceName: "demoResc", Status: "1", ModifyTime: replicatedTime},
+	})
+
+	attrOut := fuse.AttrOut{}
+	if errno := IRODSGetattr(context.Background(), fs, filePath, false, &attrOut); errno != fusefs.OK {
+		t.Fatalf("failed to get attr - %v", errno)
+	}
+
+	if reported := attrOut.Attr.ModTime(); !reported.Equal(modifyTime) {
+		t.Errorf("expected modify time %v without replicas, got %v", modifyTime, reported)
+	}
+}
+
+func TestDirModifyTimeFromChildren(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.DirModifyTimeFromChildren = true
+	fs.dirAttrCache = NewDirAttrCache(time.Minute)
+
+	dirModifyTime := time.Unix(1700000000, 0)
+	dirPath := "/testzone/home/testuser/synced"
+	client.addDir(dirPath).ModifyTime = dirModifyTime
+	client.addFile(dirPath+"/a.txt", []byte("a")).ModifyTime = dirModifyTime.Add(time.Hour)
+	client.addFile(dirPath+"/b.txt", []byte("b")).ModifyTime = dirModifyTime.Add(3 * time.Hour)
+	client.addFile(dirPath+"/c.txt", []byte("c")).ModifyTime = dirModifyTime.Add(2 * time.Hour)
+
+	getModifyTime := func() time.Time {
+		attrOut := fuse.AttrOut{}
+		if errno := IRODSGetattr(context.Background(), fs, dirPath, false, &attrOut); errno != fusefs.OK {
+			t.Fatalf("failed to get attr - %v", errno)
+		}
+		return attrOut.Attr.ModTime()
+	}
+
+	// the newest child
+	if modifyTime := getModifyTime(); !modifyTime.Equal(dirModifyTime.Add(3 * time.Hour)) {
+		t.Errorf("expected modify time of the newest child %v, got %v", dirModifyTime.Add(3*time.Hour), modifyTime)
+	}
+
+	// served from the dir attr cache
+	getModifyTime()
+	if calls := client.getCalls("List"); calls != 1 {
+		t.Errorf("expected the dir listed once, got %d", calls)
+	}
+
+	// changes through the mount invalidate the cache
+	childPath := dirPath + "/a.txt"
+	client.addFile(childPath, []byte("aa")).ModifyTime = dirModifyTime.Add(4 * time.Hour)
+	fs.invalidateDirAttrCache(childPath)
+
+	if modifyTime := getModifyTime(); !modifyTime.Equal(dirModifyTime.Add(4 * time.Hour)) {
+		t.Errorf("expected modify time of the child changed %v, got %v", dirModifyTime.Add(4*time.Hour), modifyTime)
+	}
+}
+
+func TestIRODSGetattrCachesPersistedModifyTime(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.PersistTimestamps = true
+	fs.modifyTimeCache = NewModifyTimeCache(time.Minute)
+
+	modifyTime := time.Unix(1700000000, 0)
+	filePath := "/testzone/home/testuser/persisted.txt"
+	entry := client.addFile(filePath, []byte("0123"))
+	entry.ModifyTime = modifyTime
+
+	getModifyTime := func() time.Time {
+		out := fuse.AttrOut{}
+		if errno := IRODSGetattr(context.Background(), fs, filePath, false, &out); errno != fusefs.OK {
+			t.Fatalf("failed to get attr - %v", errno)
+		}
+		return out.Attr.ModTime()
+	}
+
+	// files without the xattr are cached too
+	calls := client.getCalls("GetXattr")
+	for i := 0; i < 3; i++ {
+		if reported := getModifyTime(); !reported.Equal(modifyTime) {
+			t.Errorf("expected modify time %v, got %v", modifyTime, reported)
+		}
+	}
+	if getXattrCalls := client.getCalls("GetXattr") - calls; getXattrCalls != 1 {
+		t.Errorf("expected the xattr read once, got %d", getXattrCalls)
+	}
+
+	// setting the modify time updates the cache
+	persistedTime := time.Unix(1600000000, 123456789)
+	if errno := IRODSSetModifyTime(context.Background(), fs, filePath, persistedTime); errno != fusefs.OK {
+		t.Fatalf("failed to set modify time - %v", errno)
+	}
+
+	calls = client.getCalls("GetXattr")
+	if reported := getModifyTime(); !reported.Equal(persistedTime) {
+		t.Errorf("expected modify time persisted %v, got %v", persistedTime, reported)
+	}
+	if getXattrCalls := client.getCalls("GetXattr") - calls; getXattrCalls != 0 {
+		t.Errorf("expected the xattr served from the cache, got %d reads", getXattrCalls)
+	}
+
+	// modifying the file within the same second drops the modify time persisted
+	entry.ModifyTime = modifyTime.Add(500 * time.Millisecond)
+	if reported := getModifyTime(); !reported.Equal(entry.ModifyTime) {
+		t.Errorf("expected modify time %v after modification, got %v", entry.ModifyTime, reported)
+	}
+}
+
+// unitlessFSClient is a client which cannot set units of AVUs, nor do others beyond IRODSFSClient as irodsfs-pool
+type unitlessFSClient struct {
+	irodsfs_common_irods.IRODSFSClient
+}
+
+func TestIRODSSetxattrSetsUnits(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ExposeXattrUnits = true
+
+	filePath := "/testzone/home/testuser/units.txt"
+	client.addFile(filePath, []byte("0123"))
+	if err := client.SetXattr(filePath, "user.weight", "10"); err != nil {
+		t.Fatalf("failed to set xattr - %v", err)
+	}
+
+	getxattr := func(attr string) (string, syscall.Errno) {
+		dest := make([]byte, 64)
+		size, errno := IRODSGetxattr(context.Background(), fs, filePath, attr, dest)
+		return string(dest[:size]), errno
+	}
+
+	// setting the unit xattr sets the unit, keeping the value
+	if errno := IRODSSetxattr(context.Background(), fs, filePath, "user.weight.unit", []byte("kg")); errno != fusefs.OK {
+		t.Fatalf("failed to set unit xattr - %v", errno)
+	}
+	if unit, errno := getxattr("user.weight.unit"); errno != fusefs.OK || unit != "kg" {
+		t.Errorf("expected unit %q, got %q (%v)", "kg", unit, errno)
+	}
+	if value, errno := getxattr("user.weight"); errno != fusefs.OK || value != "10" {
+		t.Errorf("expected value %q kept, got %q (%v)", "10", value, errno)
+	}
+
+	// removing the unit xattr clears the unit, keeping the AVU
+	if errno := IRODSRemovexattr(context.Background(), fs, filePath, "user.weight.unit"); errno != fusefs.OK {
+		t.Fatalf("failed to remove unit xattr - %v", errno)
+	}
+	if _, errno := getxattr("user.weight.unit"); errno != syscall.ENODATA {
+		t.Errorf("expected ENODATA after removing the unit, got %v", errno)
+	}
+	if value, errno := getxattr("user.weight"); errno != fusefs.OK || value != "10" {
+		t.Errorf("expected value %q kept, got %q (%v)", "10", value, errno)
+	}
+	if errno := IRODSRemovexattr(context.Background(), fs, filePath, "user.weight.unit"); errno != syscall.ENODATA {
+		t.Errorf("expected ENODATA removing an absent unit, got %v", errno)
+	}
+
+	// xattrs with the suffix are AVUs if no AVU holds them as units
+	if errno := IRODSSetxattr(context.Background(), fs, filePath, "user.length.unit", []byte("m")); errno != fusefs.OK {
+		t.Fatalf("failed to set xattr - %v", errno)
+	}
+	if irodsMeta, err := client.GetXattr(filePath, "user.length.unit"); err != nil || irodsMeta == nil || irodsMeta.Value != "m" {
+		t.Errorf("expected AVU %q set, got %+v (%v)", "user.length.unit", irodsMeta, err)
+	}
+
+	// clients which cannot set units reject changing units
+	fs.session = newFSSession(&unitlessFSClient{IRODSFSClient: client}, nil)
+	if errno := IRODSSetxattr(context.Background(), fs, filePath, "user.weight.unit", []byte("g")); errno != syscall.ENOTSUP {
+		t.Errorf("expected ENOTSUP without units support, got %v", errno)
+	}
+}
+
+func TestIRODSSetxattrRejectsLargeValue(t *testing.T) {
+	testCases := []struct {
+		name          string
+		xattrValueMax int
+		size          int
+		errno         syscall.Errno
+	}{
+		{"within limit", 16, 16, fusefs.OK},
+		{"over limit", 16, 17, syscall.E2BIG},
+		{"no limit", 0, 4096, fusefs.OK},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+			fs.config.XattrValueMax = testCase.xattrValueMax
+
+			filePath := "/testzone/home/testuser/large.txt"
+			client.addFile(filePath, []byte("0123"))
+
+			data := []byte(strings.Repeat("x", testCase.size))
+			if errno := IRODSSetxattr(context.Background(), fs, filePath, "user.large", data); errno != testCase.errno {
+				t.Fatalf("expected errno %v, got %v", testCase.errno, errno)
+			}
+
+			// rejected values leave no AVU behind
+			irodsMeta, _ := client.GetXattr(filePath, "user.large")
+			if set := irodsMeta != nil; set != (testCase.errno == fusefs.OK) {
+				t.Errorf("expected AVU set %t, got %+v", testCase.errno == fusefs.OK, irodsMeta)
+			}
+		})
+	}
+}
+
+// listXattrNames returns names of xattrs listed for the path
+func listXattrNames(t *testing.T, fs *IRODSFS, path string) []string {
+	dest := make([]byte, 4096)
+	size, errno := IRODSListxattr(context.Background(), fs, path, nil, dest)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to list xattrs of %q - %v", path, errno)
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(string(dest[:size]), "\x00") {
+		if len(name) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestIRODSListxattrMatchesGetxattr(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ExposeEntryInfo = true
+
+	dirPath := "/testzone/home/testuser/dir"
+	client.addDir(dirPath)
+	filePath := dirPath + "/file.txt"
+	entry := client.addFile(filePath, []byte("data"))
+
+	// every xattr listed can be read, and the checksum is listed only when it can be read
+	checkConsistent := func(path string) {
+		dest := make([]byte, 256)
+		_, errno := IRODSGetxattr(context.Background(), fs, path, ChecksumXattrName, dest)
+
+		listed := false
+		for _, name := range listXattrNames(t, fs, path) {
+			if _, errno := IRODSGetxattr(context.Background(), fs, path, name, dest); errno != fusefs.OK {
+				t.Errorf("%q: xattr %q listed but not readable - %v", path, name, errno)
+			}
+			listed = listed || name == ChecksumXattrName
+		}
+
+		if listed != (errno == fusefs.OK) {
+			t.Errorf("%q: checksum listed %t, but read returns %v", path, listed, errno)
+		}
+	}
+
+	checkConsistent(dirPath)
+	checkConsistent(filePath)
+
+	entry.CheckSumAlgorithm = irodsclient_types.ChecksumAlgorithmSHA256
+	entry.CheckSum = []byte{0xde, 0xad, 0xbe, 0xef}
+	checkConsistent(filePath)
+
+	if names := listXattrNames(t, fs, filePath); len(names) != 2 {
+		t.Errorf("expected owner and checksum listed, got %v", names)
+	}
+}
+
+func TestReplicaXattrs(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ExposeEntryInfo = true
+
+	filePath := "/testzone/home/testuser/replicated.txt"
+	client.addFile(filePath, []byte("data"))
+	client.setReplicas(filePath, []*irodsclient_types.IRODSReplica{
+		{Number: 0, ResourceName: "demoResc", Status: "1"},
+		{Number: 1, ResourceName: "replResc", Status: "0"},
+		{Number: 2, ResourceName: "replResc", Status: "1"},
+	})
+
+	expected := map[string]string{
+		ResourceXattrName:     "demoResc,replResc",
+		ReplicaCountXattrName: "3",
+		ReplicasXattrName:     "0:demoResc:good,1:replResc:stale,2:replResc:good",
+	}
+
+	names := listXattrNames(t, fs, filePath)
+	for attr, value := range expected {
+		listed := false
+		for _, name := range names {
+			listed = listed || name == attr
+		}
+		if !listed {
+			t.Errorf("expected %q listed, got %v", attr, names)
+		}
+
+		dest := make([]byte, 64)
+		size, errno := IRODSGetxattr(context.Background(), fs, filePath, attr, dest)
+		if errno != fusefs.OK || string(dest[:size]) != value {
+			t.Errorf("expected %q of %q, got %q (%v)", value, attr, dest[:size], errno)
+		}
+	}
+
+	// dirs have no replicas
+	dirPath := "/testzone/home/testuser"
+	if _, errno := IRODSGetxattr(context.Background(), fs, dirPath, ResourceXattrName, make([]byte, 64)); errno != syscall.ENODATA {
+		t.Errorf("expected ENODATA for a dir, got %v", errno)
+	}
+}
+
+func TestReplicaChecksumsXattr(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ExposeReplicaChecksums = true
+	fs.replicaCache = NewReplicaCache(time.Minute)
+
+	sha256Checksum := func(digest []byte) *irodsclient_types.IRODSChecksum {
+		return &irodsclient_types.IRODSChecksum{
+			Algorithm: irodsclient_types.ChecksumAlgorithmSHA256,
+			Checksum:  digest,
+		}
+	}
+
+	filePath := "/testzone/home/testuser/audited.txt"
+	client.addFile(filePath, []byte("data"))
+	client.setReplicas(filePath, []*irodsclient_types.IRODSReplica{
+		{Number: 0, ResourceName: "demoResc", Status: "1", Checksum: sha256Checksum([]byte{0xab, 0xcd})},
+		{Number: 1, ResourceName: "replResc", Status: "1", Checksum: sha256Checksum([]byte{0xab, 0xcd})},
+		{Number: 2, ResourceName: "archResc", Status: "1", Checksum: sha256Checksum([]byte{0x12, 0x34})},
+		{Number: 3, ResourceName: "tapeResc", Status: "0"},
+	})
+
+	names := listXattrNames(t, fs, filePath)
+	if !containsString(names, ReplicaChecksumsXattrName) {
+		t.Errorf("expected %q listed, got %v", ReplicaChecksumsXattrName, names)
+	}
+
+	// matching and mismatching checksums are both presented
+	expected := "demoResc:" + string(irodsclient_types.ChecksumAlgorithmSHA256) + ":abcd," +
+		"replResc:" + string(irodsclient_types.ChecksumAlgorithmSHA256) + ":abcd," +
+		"archResc:" + string(irodsclient_types.ChecksumAlgorithmSHA256) + ":1234," +
+		"tapeResc:"
+
+	dest := make([]byte, 256)
+	size, errno := IRODSGetxattr(context.Background(), fs, filePath, ReplicaChecksumsXattrName, dest)
+	if errno != fusefs.OK || string(dest[:size]) != expected {
+		t.Errorf("expected %q, got %q (%v)", expected, dest[:size], errno)
+	}
+
+	// cached for the metadata cache timeout
+	calls := client.getCalls("ListReplicas")
+	client.setReplicas(filePath, nil)
+
+	size, errno = IRODSGetxattr(context.Background(), fs, filePath, ReplicaChecksumsXattrName, dest)
+	if errno != fusefs.OK || string(dest[:size]) != expected {
+		t.Errorf("expected %q cached, got %q (%v)", expected, dest[:size], errno)
+	}
+
+	if client.getCalls("ListReplicas") != calls {
+		t.Errorf("expected replicas cached, listed %d more times", client.getCalls("ListReplicas")-calls)
+	}
+
+	// read-only
+	file := NewFile(fs, 0, "/audited.txt")
+	if errno := file.Setxattr(context.Background(), ReplicaChecksumsXattrName, []byte("demoResc:"), 0); errno != syscall.EPERM {
+		t.Errorf("expected EPERM setting the replica checksums xattr, got %v", errno)
+	}
+
+	// dirs have no replicas
+	dirPath := "/testzone/home/testuser"
+	if _, errno := IRODSGetxattr(context.Background(), fs, dirPath, ReplicaChecksumsXattrName, dest); errno != syscall.ENODATA {
+		t.Errorf("expected ENODATA for a dir, got %v", errno)
+	}
+}
+
+func TestReplicateXattr(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.EnableReplication = true
+
+	filePath := "/testzone/home/testuser/replicate.txt"
+	client.addFile(filePath, []byte("data"))
+	client.setReplicas(filePath, []*irodsclient_types.IRODSReplica{
+		{Number: 0, ResourceName: "demoResc", Status: "1"},
+	})
+	file := NewFile(fs, 0, "/replicate.txt")
+
+	if errno := file.Setxattr(context.Background(), ReplicateXattrName, []byte("bad resource"), 0); errno != syscall.EINVAL {
+		t.Errorf("expected EINVAL for an invalid resource name, got %v", errno)
+	}
+
+	if errno := file.Setxattr(context.Background(), ReplicateXattrName, []byte("replResc"), 0); errno != fusefs.OK {
+		t.Fatalf("failed to replicate, errno %v", errno)
+	}
+
+	// replicated in background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		replicas, _ := client.ListReplicas(filePath)
+		if len(replicas) == 2 && replicas[1].ResourceName == "replResc" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a replica added on replResc, got %+v", replicas)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// an action, nothing is stored
+	if _, errno := file.Getxattr(context.Background(), ReplicateXattrName, make([]byte, 64)); errno != syscall.ENODATA {
+		t.Errorf("expected ENODATA reading the replicate xattr, got %v", errno)
+	}
+
+	if errno := file.Removexattr(context.Background(), ReplicateXattrName); errno != syscall.EPERM {
+		t.Errorf("expected EPERM removing the replicate xattr, got %v", errno)
+	}
+
+	// clients which cannot replicate reject it
+	fs.session = newFSSession(&unitlessFSClient{IRODSFSClient: client}, nil)
+	if errno := file.Setxattr(context.Background(), ReplicateXattrName, []byte("replResc"), 0); errno != syscall.ENOTSUP {
+		t.Errorf("expected ENOTSUP without replication support, got %v", errno)
+	}
+}
+
+// xattrNodeFuncs lists and reads xattrs of a file or dir node
+type xattrNodeFuncs struct {
+	listxattr func(ctx context.Context, dest []byte) (uint32, syscall.Errno)
+	getxattr  func(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno)
+}
+
+func TestListxattrListsPseudoXattrs(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ExposeOpenHandles = true
+	fs.config.ExposeDataType = true
+	fs.config.ExposeMountInfo = true
+	fs.config.ExposeZone = true
+
+	entry := client.addFile("/testzone/home/testuser/typed.txt", []byte("data"))
+	entry.DataType = "generic"
+	file := NewFile(fs, 0, "/typed.txt")
+	root := NewDir(fs, 1, "/")
+
+	tests := []struct {
+		name     string
+		node     xattrNodeFuncs
+		expected []string
+	}{
+		{"file", xattrNodeFuncs{file.Listxattr, file.Getxattr}, []string{ZoneXattrName, OpenHandlesXattrName, DataTypeXattrName}},
+		{"root", xattrNodeFuncs{root.Listxattr, root.Getxattr}, append([]string{ZoneXattrName}, mountInfoXattrNames...)},
+	}
+
+	for _, test := range tests {
+		dest := make([]byte, 4096)
+		size, errno := test.node.listxattr(context.Background(), dest)
+		if errno != fusefs.OK {
+			t.Fatalf("%s: failed to list xattrs - %v", test.name, errno)
+		}
+
+		names := strings.Split(strings.TrimSuffix(string(dest[:size]), "\x00"), "\x00")
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: expected xattrs %v listed, got %v", test.name, test.expected, names)
+		}
+
+		// every xattr listed can be read
+		for _, name := range names {
+			if _, errno := test.node.getxattr(context.Background(), name, make([]byte, 256)); errno != fusefs.OK {
+				t.Errorf("%s: xattr %q listed but not readable - %v", test.name, name, errno)
+			}
+		}
+
+		// ERANGE with the size required
+		if required, errno := test.node.listxattr(context.Background(), make([]byte, 1)); errno != syscall.ERANGE || required != size {
+			t.Errorf("%s: expected ERANGE with size %d, got %d (%v)", test.name, size, required, errno)
+		}
+	}
+}
+
+// staleFSClient is a client whose metadata cache has not seen paths created by other clients yet
+type staleFSClient struct {
+	*fakeFSClient
+
+	mutex      sync.Mutex
+	stalePaths map[string]bool // reported missing until created through the client
+}
+
+func (client *staleFSClient) isStale(entryPath string) bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.stalePaths[entryPath]
+}
+
+func (client *staleFSClient) Stat(entryPath string) (*irodsclient_fs.Entry, error) {
+	if client.isStale(entryPath) {
+		return nil, irodsclient_types.NewFileNotFoundError(entryPath)
+	}
+	return client.fakeFSClient.Stat(entryPath)
+}
+
+func (client *staleFSClient) ExistsFile(filePath string) bool {
+	return !client.isStale(filePath) && client.fakeFSClient.ExistsFile(filePath)
+}
+
+func (client *staleFSClient) ExistsDir(dirPath string) bool {
+	return !client.isStale(dirPath) && client.fakeFSClient.ExistsDir(dirPath)
+}
+
+func (client *staleFSClient) CreateFile(filePath string, resource string, mode string) (irodsfs_common_irods.IRODSFSFileHandle, error) {
+	client.mutex.Lock()
+	delete(client.stalePaths, filePath)
+	client.mutex.Unlock()
+
+	return client.fakeFSClient.CreateFile(filePath, resource, mode)
+}
+
+func TestIRODSCreateExclusive(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	existingPath := "/testzone/home/testuser/existing.lock"
+	newPath := "/testzone/home/testuser/new.lock"
+	staleClient := &staleFSClient{
+		fakeFSClient: client,
+		stalePaths:   map[string]bool{existingPath: true, newPath: true},
+	}
+	fs.session = newFSSession(staleClient, nil)
+	fs.uncachedFSClient = client
+
+	flags := uint32(syscall.O_CREAT | syscall.O_EXCL | syscall.O_WRONLY)
+
+	// created by other client, not in the metadata cache yet
+	client.addFile(existingPath, []byte("pid"))
+	if _, _, errno := IRODSCreate(context.Background(), fs, nil, existingPath, flags, &fuse.EntryOut{}); errno != syscall.EEXIST {
+		t.Errorf("expected EEXIST for a path created by other client, got %v", errno)
+	}
+
+	if data := client.getData(existingPath); string(data) != "pid" {
+		t.Errorf("expected the existing file kept, got %q", data)
+	}
+
+	// concurrent exclusive creates of the same path
+	creators := 8
+	errnos := make(chan syscall.Errno, creators)
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < creators; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			_, _, errno := IRODSCreate(context.Background(), fs, nil, newPath, flags, &fuse.EntryOut{})
+			errnos <- errno
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errnos)
+
+	created := 0
+	for errno := range errnos {
+		switch errno {
+		case fusefs.OK:
+			created++
+		case syscall.EEXIST:
+		default:
+			t.Errorf("expected OK or EEXIST, got %v", errno)
+		}
+	}
+
+	if created != 1 {
+		t.Errorf("expected exactly one exclusive create to succeed, got %d", created)
+	}
+}
+
+func TestZoneXattr(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ExposeZone = true
+
+	localPath := "/testzone/home/testuser/local.txt"
+	client.addFile(localPath, []byte("data"))
+
+	// an object in a federated zone, accessed by a remote user of the local zone
+	federatedPath := "/remotezone/home/testuser#testzone/shared.txt"
+	client.addFile(federatedPath, []byte("data"))
+
+	testCases := []struct {
+		path string
+		zone string
+	}{
+		{localPath, "testzone"},
+		{federatedPath, "remotezone"},
+	}
+
+	for _, testCase := range testCases {
+		names := listXattrNames(t, fs, testCase.path)
+		if !reflect.DeepEqual(names, []string{ZoneXattrName}) {
+			t.Errorf("%q: expected only %q listed, got %v", testCase.path, ZoneXattrName, names)
+		}
+
+		dest := make([]byte, 64)
+		size, errno := IRODSGetxattr(context.Background(), fs, testCase.path, ZoneXattrName, dest)
+		if errno != fusefs.OK {
+			t.Fatalf("%q: failed to get zone, errno %v", testCase.path, errno)
+		}
+
+		if zone := string(dest[:size]); zone != testCase.zone {
+			t.Errorf("%q: expected zone %q, got %q", testCase.path, testCase.zone, zone)
+		}
+	}
+
+	// the zone can't be changed
+	file := NewFile(fs, 0, "/local.txt")
+	if errno := file.Setxattr(context.Background(), ZoneXattrName, []byte("otherzone"), 0); errno != syscall.EPERM {
+		t.Errorf("expected EPERM setting zone, got %v", errno)
+	}
+
+	if errno := file.Removexattr(context.Background(), ZoneXattrName); errno != syscall.EPERM {
+		t.Errorf("expected EPERM removing zone, got %v", errno)
+	}
+
+	if calls := client.getCalls("SetXattr") + client.getCalls("RemoveXattr"); calls != 0 {
+		t.Errorf("expected no AVU changed, got %d calls", calls)
+	}
+
+	// not listed unless exposed
+	fs.config.ExposeZone = false
+	if names := listXattrNames(t, fs, localPath); len(names) != 0 {
+		t.Errorf("expected no xattr listed, got %v", names)
+	}
+}
+
+func TestReadOnlyXattrsOfFeatures(t *testing.T) {
+	testCases := []struct {
+		attr   string
+		enable func(config *commons.Config)
+	}{
+		{LastModifiedByXattrName, func(config *commons.Config) { config.TrackLastModifiedBy = true }},
+		{OpenHandlesXattrName, func(config *commons.Config) { config.ExposeOpenHandles = true }},
+		{ZoneXattrName, func(config *commons.Config) { config.ExposeZone = true }},
+		{ClientProcessXattrName, func(config *commons.Config) { config.AuditClientProcess = true }},
+		{OwnerXattrName, func(config *commons.Config) { config.ExposeEntryInfo = true }},
+		{ChecksumXattrName, func(config *commons.Config) { config.ExposeEntryInfo = true }},
+		{ResourceXattrName, func(config *commons.Config) { config.ExposeEntryInfo = true }},
+		{ReplicaCountXattrName, func(config *commons.Config) { config.ExposeEntryInfo = true }},
+		{ReplicasXattrName, func(config *commons.Config) { config.ExposeEntryInfo = true }},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.attr, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newTestFS(client)
+
+			filePath := "/testzone/home/testuser/features.txt"
+			client.addFile(filePath, []byte("data"))
+			file := NewFile(fs, 0, "/features.txt")
+
+			// without the feature, the name is an AVU of users
+			if errno := file.Setxattr(context.Background(), testCase.attr, []byte("value"), 0); errno != fusefs.OK {
+				t.Fatalf("failed to set xattr, errno %v", errno)
+			}
+			if irodsMeta, err := client.GetXattr(filePath, testCase.attr); err != nil || irodsMeta == nil || irodsMeta.Value != "value" {
+				t.Errorf("expected AVU %q set, got %+v (%v)", testCase.attr, irodsMeta, err)
+			}
+			if errno := file.Removexattr(context.Background(), testCase.attr); errno != fusefs.OK {
+				t.Errorf("failed to remove xattr, errno %v", errno)
+			}
+
+			// the feature manages it
+			testCase.enable(fs.config)
+			if errno := file.Setxattr(context.Background(), testCase.attr, []byte("value"), 0); errno != syscall.EPERM {
+				t.Errorf("expected EPERM setting xattr, got %v", errno)
+			}
+			if errno := file.Removexattr(context.Background(), testCase.attr); errno != syscall.EPERM {
+				t.Errorf("expected EPERM removing xattr, got %v", errno)
+			}
+		})
+	}
+}
+
+func TestDataTypeXattr(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/typed.txt"
+	entry := client.addFile(filePath, []byte("data"))
+	entry.DataType = "generic"
+	file := NewFile(fs, 0, "/typed.txt")
+
+	// not exposed by default
+	if names := listXattrNames(t, fs, filePath); len(names) != 0 {
+		t.Errorf("expected no xattr listed, got %v", names)
+	}
+	if _, errno := file.Getxattr(context.Background(), DataTypeXattrName, make([]byte, 64)); errno != syscall.ENODATA {
+		t.Errorf("expected ENODATA, got %v", errno)
+	}
+
+	fs.config.ExposeDataType = true
+	if names := listXattrNames(t, fs, filePath); !reflect.DeepEqual(names, []string{DataTypeXattrName}) {
+		t.Errorf("expected only %q listed, got %v", DataTypeXattrName, names)
+	}
+
+	dest := make([]byte, 64)
+	size, errno := file.Getxattr(context.Background(), DataTypeXattrName, dest)
+	if errno != fusefs.OK || string(dest[:size]) != "generic" {
+		t.Errorf("expected data type %q, got %q (%v)", "generic", dest[:size], errno)
+	}
+
+	// set to a type registered in the zone, and read back
+	if errno := file.Setxattr(context.Background(), DataTypeXattrName, []byte("text"), 0); errno != fusefs.OK {
+		t.Fatalf("failed to set data type, errno %v", errno)
+	}
+
+	size, errno = file.Getxattr(context.Background(), DataTypeXattrName, dest)
+	if errno != fusefs.OK || string(dest[:size]) != "text" {
+		t.Errorf("expected data type %q, got %q (%v)", "text", dest[:size], errno)
+	}
+
+	// types unknown to the zone are rejected
+	if errno := file.Setxattr(context.Background(), DataTypeXattrName, []byte("nosuchtype"), 0); errno != syscall.EINVAL {
+		t.Errorf("expected EINVAL setting an unknown data type, got %v", errno)
+	}
+
+	if calls := client.getCalls("SetDataType"); calls != 1 {
+		t.Errorf("expected the data type set once, got %d", calls)
+	}
+
+	// the data type is not an AVU
+	if irodsMeta, _ := client.GetXattr(filePath, DataTypeXattrName); irodsMeta != nil {
+		t.Errorf("expected no AVU set, got %+v", irodsMeta)
+	}
+
+	if errno := file.Removexattr(context.Background(), DataTypeXattrName); errno != syscall.EPERM {
+		t.Errorf("expected EPERM removing the data type, got %v", errno)
+	}
+}
+
+// resourceFSClient records resources files are created on
+type resourceFSClient struct {
+	*fakeFSClient
+
+	mutex     sync.Mutex
+	resources []string
+}
+
+func (client *resourceFSClient) CreateFile(filePath string, resource string, mode string) (irodsfs_common_irods.IRODSFSFileHandle, error) {
+	client.mutex.Lock()
+	client.resources = append(client.resources, resource)
+	client.mutex.Unlock()
+
+	return client.fakeFSClient.CreateFile(filePath, resource, mode)
+}
+
+func TestIRODSCreateCachesDefaultResource(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.CollectionDefaultResource = true
+	fs.defaultResourceCache = NewDefaultResourceCache(time.Minute)
+
+	resourceClient := &resourceFSClient{fakeFSClient: client}
+	fs.session = newFSSession(resourceClient, nil)
+
+	dirPath := "/testzone/home/testuser/dir"
+	client.addDir(dirPath)
+	client.SetXattr(dirPath, DefaultResourceXattrName, "fastResc")
+
+	flags := uint32(syscall.O_CREAT | syscall.O_WRONLY)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if _, _, errno := IRODSCreate(context.Background(), fs, nil, dirPath+"/"+name, flags, &fuse.EntryOut{}); errno != fusefs.OK {
+			t.Fatalf("failed to create %q, errno %v", name, errno)
+		}
+	}
+
+	if calls := client.getCalls("GetXattr"); calls != 1 {
+		t.Errorf("expected the default resource asked once, got %d", calls)
+	}
+
+	// changing the default resource through the mount takes effect right away
+	if errno := IRODSSetxattr(context.Background(), fs, dirPath, DefaultResourceXattrName, []byte("archiveResc")); errno != fusefs.OK {
+		t.Fatalf("failed to set the default resource, errno %v", errno)
+	}
+
+	if _, _, errno := IRODSCreate(context.Background(), fs, nil, dirPath+"/c.txt", flags, &fuse.EntryOut{}); errno != fusefs.OK {
+		t.Fatalf("failed to create, errno %v", errno)
+	}
+
+	expected := []string{"fastResc", "fastResc", "archiveResc"}
+	if !reflect.DeepEqual(resourceClient.resources, expected) {
+		t.Errorf("expected resources %v, got %v", expected, resourceClient.resources)
+	}
+}
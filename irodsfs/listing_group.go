@@ -0,0 +1,66 @@
+package irodsfs
+
+import (
+	"sync"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+)
+
+// listingGroup shares a listing of a dir among callers listing the dir while it is in progress
+// listings cannot be cancelled in the middle, so callers giving up on a slow dir, e.g., ls repeated after timeouts,
+// join the listing in progress rather than adding one each
+// the zero value is ready to use
+type listingGroup struct {
+	mutex    sync.Mutex
+	listings map[string]*sharedListing // key is dir path
+}
+
+// sharedListing is a listing of a dir, entries and err are set before doneChan is closed
+type sharedListing struct {
+	doneChan chan bool
+	entries  []*irodsclient_fs.Entry
+	err      error
+}
+
+// start returns the listing of the dir in progress, or starts listing the dir in background with the list function
+func (group *listingGroup) start(dirPath string, list func() ([]*irodsclient_fs.Entry, error)) *sharedListing {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	if group.listings == nil {
+		group.listings = map[string]*sharedListing{}
+	}
+
+	if listing, ok := group.listings[dirPath]; ok {
+		return listing
+	}
+
+	listing := &sharedListing{
+		doneChan: make(chan bool),
+	}
+	group.listings[dirPath] = listing
+
+	go func() {
+		entries, err := list()
+
+		group.mutex.Lock()
+		if group.listings[dirPath] == listing {
+			delete(group.listings, dirPath)
+		}
+		group.mutex.Unlock()
+
+		listing.entries = entries
+		listing.err = err
+		close(listing.doneChan)
+	}()
+
+	return listing
+}
+
+// forget makes following callers start a new listing of the dir, e.g., as the dir is changed after the listing in progress started
+func (group *listingGroup) forget(dirPath string) {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	delete(group.listings, dirPath)
+}
@@ -0,0 +1,252 @@
+package irodsfs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	procMemInfoPath       string = "/proc/meminfo"
+	cgroupMemoryMaxPath   string = "/sys/fs/cgroup/memory.max"
+	cgroupMemoryUsagePath string = "/sys/fs/cgroup/memory.current"
+)
+
+// MemoryPressureMonitor polls available memory and releases the largest buffers and caches when memory is tight
+type MemoryPressureMonitor struct {
+	fs            *IRODSFS
+	interval      time.Duration
+	availableMin  int64
+	terminateChan chan bool
+}
+
+// NewMemoryPressureMonitor creates a new MemoryPressureMonitor
+func NewMemoryPressureMonitor(fs *IRODSFS, interval time.Duration, availableMin int64) *MemoryPressureMonitor {
+	return &MemoryPressureMonitor{
+		fs:            fs,
+		interval:      interval,
+		availableMin:  availableMin,
+		terminateChan: nil,
+	}
+}
+
+// Start polls available memory periodically
+func (monitor *MemoryPressureMonitor) Start() {
+	if monitor.interval <= 0 || monitor.terminateChan != nil {
+		return
+	}
+
+	terminateChan := make(chan bool)
+	monitor.terminateChan = terminateChan
+
+	go func() {
+		logger := log.WithFields(log.Fields{
+			"package":  "irodsfs",
+			"struct":   "MemoryPressureMonitor",
+			"function": "Start",
+		})
+
+		ticker := time.NewTicker(monitor.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-terminateChan:
+				return
+			case <-ticker.C:
+				err := monitor.Check()
+				if err != nil {
+					logger.Errorf("%+v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops polling available memory
+func (monitor *MemoryPressureMonitor) Stop() {
+	if monitor.terminateChan != nil {
+		close(monitor.terminateChan)
+		monitor.terminateChan = nil
+	}
+}
+
+// Check releases the largest buffers and caches if available memory is below the minimum
+func (monitor *MemoryPressureMonitor) Check() error {
+	available, err := getAvailableMemory()
+	if err != nil {
+		return err
+	}
+
+	if available >= monitor.availableMin {
+		return nil
+	}
+
+	monitor.releaseLargest(monitor.availableMin - available)
+	return nil
+}
+
+// memoryOwner holds data in memory which can be released under memory pressure
+type memoryOwner struct {
+	description string
+	size        int64
+	release     func() error
+}
+
+// listMemoryOwners returns write-back buffers, prefetched and cached data of file handles, and cached dir attributes
+func (monitor *MemoryPressureMonitor) listMemoryOwners() []memoryOwner {
+	owners := []memoryOwner{}
+
+	for _, handle := range monitor.fs.fileHandleMap.List() {
+		handle := handle
+
+		dirtySize := handle.getDirtySize()
+		if dirtySize > 0 {
+			owners = append(owners, memoryOwner{
+				description: fmt.Sprintf("write buffer of %q", handle.GetPath()),
+				size:        dirtySize,
+				release: func() error {
+					errno := handle.Flush(context.Background())
+					if errno != 0 {
+						return xerrors.Errorf("failed to flush %q, errno %d", handle.GetPath(), errno)
+					}
+					return nil
+				},
+			})
+		}
+
+		readBufferSize := handle.getReadBufferSize()
+		if readBufferSize > 0 {
+			owners = append(owners, memoryOwner{
+				description: fmt.Sprintf("read buffer of %q", handle.GetPath()),
+				size:        readBufferSize,
+				release: func() error {
+					handle.releaseReadBuffers()
+					return nil
+				},
+			})
+		}
+	}
+
+	if monitor.fs.dirAttrCache != nil {
+		cacheSize := monitor.fs.dirAttrCache.GetMemoryUsage()
+		if cacheSize > 0 {
+			owners = append(owners, memoryOwner{
+				description: "dir attr cache",
+				size:        cacheSize,
+				release: func() error {
+					monitor.fs.dirAttrCache.Clear()
+					return nil
+				},
+			})
+		}
+	}
+
+	return owners
+}
+
+// releaseLargest releases data held in memory in descending order of size until the given bytes are released
+func (monitor *MemoryPressureMonitor) releaseLargest(bytesToRelease int64) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "MemoryPressureMonitor",
+		"function": "releaseLargest",
+	})
+
+	owners := monitor.listMemoryOwners()
+	sort.Slice(owners, func(i int, j int) bool {
+		return owners[i].size > owners[j].size
+	})
+
+	logger.Warnf("Memory is tight, releasing buffers and caches to release %d bytes", bytesToRelease)
+
+	released := int64(0)
+	for _, owner := range owners {
+		if released >= bytesToRelease {
+			break
+		}
+
+		logger.Infof("Releasing %d bytes of %s", owner.size, owner.description)
+
+		err := owner.release()
+		if err != nil {
+			logger.Errorf("%+v", err)
+			continue
+		}
+
+		released += owner.size
+	}
+}
+
+// getAvailableMemory returns available memory in bytes, the smaller of system-wide and cgroup limits
+func getAvailableMemory() (int64, error) {
+	available, err := getSystemAvailableMemory()
+	if err != nil {
+		return 0, err
+	}
+
+	cgroupAvailable, ok := getCgroupAvailableMemory()
+	if ok && cgroupAvailable < available {
+		available = cgroupAvailable
+	}
+
+	return available, nil
+}
+
+// getSystemAvailableMemory returns MemAvailable in /proc/meminfo
+func getSystemAvailableMemory() (int64, error) {
+	memInfo, err := os.Open(procMemInfoPath)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to open %q: %w", procMemInfoPath, err)
+	}
+	defer memInfo.Close()
+
+	scanner := bufio.NewScanner(memInfo)
+	for scanner.Scan() {
+		// e.g., MemAvailable:   12345678 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, xerrors.Errorf("failed to parse MemAvailable %q: %w", fields[1], err)
+			}
+			return kb * 1024, nil
+		}
+	}
+
+	return 0, xerrors.Errorf("failed to find MemAvailable in %q", procMemInfoPath)
+}
+
+// getCgroupAvailableMemory returns memory available under cgroup v2 limit, returns false if not limited
+func getCgroupAvailableMemory() (int64, bool) {
+	maxBytes, err := os.ReadFile(cgroupMemoryMaxPath)
+	if err != nil {
+		return 0, false
+	}
+
+	max, err := strconv.ParseInt(strings.TrimSpace(string(maxBytes)), 10, 64)
+	if err != nil {
+		// "max" means unlimited
+		return 0, false
+	}
+
+	usageBytes, err := os.ReadFile(cgroupMemoryUsagePath)
+	if err != nil {
+		return 0, false
+	}
+
+	usage, err := strconv.ParseInt(strings.TrimSpace(string(usageBytes)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return max - usage, true
+}
@@ -0,0 +1,106 @@
+package irodsfs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+)
+
+func TestMemoryPressureMonitorReleasesLargestFirst(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	// 1KB of cached dir attributes
+	fs.dirAttrCache = NewDirAttrCache(time.Minute)
+	fs.dirAttrCache.AddDir("/testzone/home/testuser", []*irodsclient_fs.Entry{
+		{Path: "/testzone/home/testuser/a.txt"},
+		{Path: "/testzone/home/testuser/b.txt"},
+	})
+
+	// 2KB of write-back buffer
+	writePath := "/testzone/home/testuser/write.txt"
+	client.addFile(writePath, []byte{})
+
+	writeHandle := newTestFileHandle(fs, client, writePath, irodsclient_types.FileOpenModeWriteOnly)
+	writeBackWriter := NewWriteBackWriter(&fakeWriter{handle: writeHandle.iRODSFileHandle}, 4096, 0)
+	writeHandle.writer = writeBackWriter
+	defer writeBackWriter.Release()
+
+	_, err := writeBackWriter.WriteAt(bytes.Repeat([]byte("a"), 2048), 0)
+	if err != nil {
+		t.Fatalf("failed to write - %v", err)
+	}
+
+	// 512B of aligned blocks cached
+	readPath := "/testzone/home/testuser/read.txt"
+	client.addFile(readPath, bytes.Repeat([]byte("b"), 1500))
+
+	readHandle := newTestFileHandle(fs, client, readPath, irodsclient_types.FileOpenModeReadOnly)
+	alignedReader := NewAlignedReader(readHandle.reader, 512, 1500)
+	readHandle.reader = alignedReader
+
+	_, err = alignedReader.ReadAt(make([]byte, 10), 0)
+	if err != nil {
+		t.Fatalf("failed to read - %v", err)
+	}
+
+	monitor := NewMemoryPressureMonitor(fs, time.Second, 0)
+
+	owners := monitor.listMemoryOwners()
+	if len(owners) != 3 {
+		t.Fatalf("expected 3 memory owners, got %d", len(owners))
+	}
+
+	monitor.releaseLargest(1)
+
+	if size := writeHandle.getDirtySize(); size != 0 {
+		t.Errorf("expected the write buffer flushed, %d bytes dirty", size)
+	}
+
+	if data := client.getData(writePath); len(data) != 2048 {
+		t.Errorf("expected 2048 bytes flushed, got %d", len(data))
+	}
+
+	if size := fs.dirAttrCache.GetMemoryUsage(); size != 2*dirAttrCacheEntrySize {
+		t.Errorf("expected the dir attr cache kept, got %d bytes", size)
+	}
+
+	if size := readHandle.getReadBufferSize(); size != 512 {
+		t.Errorf("expected the aligned blocks kept, got %d bytes", size)
+	}
+
+	monitor.releaseLargest(1 << 30)
+
+	if size := fs.dirAttrCache.GetMemoryUsage(); size != 0 {
+		t.Errorf("expected the dir attr cache cleared, got %d bytes", size)
+	}
+
+	if size := readHandle.getReadBufferSize(); size != 0 {
+		t.Errorf("expected the aligned blocks dropped, got %d bytes", size)
+	}
+}
+
+func TestFileHandleReleaseReadBuffersStopsPrefetching(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/prefetch.txt"
+	client.addFile(filePath, []byte("0123"))
+
+	handle := newTestFileHandle(fs, client, filePath, irodsclient_types.FileOpenModeReadOnly)
+	handle.prefetching = true
+	handle.prefetchWindow = 1024
+
+	if size := handle.getReadBufferSize(); size != 1024 {
+		t.Errorf("expected the prefetch window counted, got %d bytes", size)
+	}
+
+	handle.releaseReadBuffers()
+
+	if handle.prefetching || handle.getReadBufferSize() != 0 {
+		t.Errorf("expected prefetching stopped")
+	}
+}
@@ -0,0 +1,254 @@
+package irodsfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// metricsLatencyBuckets are upper bounds of operation latency histograms in seconds
+	metricsLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}
+)
+
+type metricsOperationKey struct {
+	operation string
+	errno     syscall.Errno
+}
+
+type metricsHistogram struct {
+	buckets []uint64 // cumulative counts are computed on export
+	sum     float64
+	count   uint64
+}
+
+// Metrics collects filesystem operation metrics and exports them in Prometheus text format
+type Metrics struct {
+	mutex        sync.Mutex
+	operations   map[metricsOperationKey]uint64
+	latencies    map[string]*metricsHistogram
+	bytesRead    uint64
+	bytesWritten uint64
+	workerPool   *WorkerPool
+
+	server *http.Server
+}
+
+// NewMetrics creates a new Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		mutex:        sync.Mutex{},
+		operations:   map[metricsOperationKey]uint64{},
+		latencies:    map[string]*metricsHistogram{},
+		bytesRead:    0,
+		bytesWritten: 0,
+		workerPool:   nil,
+		server:       nil,
+	}
+}
+
+// ObserveOperation records an operation completed, this is to be deferred at the beginning of the operation
+func (metrics *Metrics) ObserveOperation(operation string, start time.Time, errno *syscall.Errno) {
+	if metrics == nil {
+		return
+	}
+
+	elapsed := time.Since(start).Seconds()
+
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.operations[metricsOperationKey{operation: operation, errno: *errno}]++
+
+	histogram, ok := metrics.latencies[operation]
+	if !ok {
+		histogram = &metricsHistogram{
+			buckets: make([]uint64, len(metricsLatencyBuckets)),
+		}
+		metrics.latencies[operation] = histogram
+	}
+
+	for i, bound := range metricsLatencyBuckets {
+		if elapsed <= bound {
+			histogram.buckets[i]++
+			break
+		}
+	}
+
+	histogram.sum += elapsed
+	histogram.count++
+}
+
+// AddBytesRead counts bytes read
+func (metrics *Metrics) AddBytesRead(size int) {
+	if metrics == nil {
+		return
+	}
+
+	atomic.AddUint64(&metrics.bytesRead, uint64(size))
+}
+
+// AddBytesWritten counts bytes written
+func (metrics *Metrics) AddBytesWritten(size int) {
+	if metrics == nil {
+		return
+	}
+
+	atomic.AddUint64(&metrics.bytesWritten, uint64(size))
+}
+
+// SetWorkerPool sets the I/O worker pool to export utilization
+func (metrics *Metrics) SetWorkerPool(pool *WorkerPool) {
+	if metrics == nil {
+		return
+	}
+
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	metrics.workerPool = pool
+}
+
+// WriteTo writes metrics in Prometheus text format
+func (metrics *Metrics) WriteTo(w io.Writer) (int64, error) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	var written int64
+	printf := func(format string, args ...interface{}) error {
+		n, err := fmt.Fprintf(w, format, args...)
+		written += int64(n)
+		return err
+	}
+
+	operationKeys := []metricsOperationKey{}
+	for key := range metrics.operations {
+		operationKeys = append(operationKeys, key)
+	}
+
+	sort.Slice(operationKeys, func(i int, j int) bool {
+		if operationKeys[i].operation != operationKeys[j].operation {
+			return operationKeys[i].operation < operationKeys[j].operation
+		}
+		return operationKeys[i].errno < operationKeys[j].errno
+	})
+
+	printf("# HELP irodsfs_operations_total Number of filesystem operations by operation and errno.\n")
+	printf("# TYPE irodsfs_operations_total counter\n")
+	for _, key := range operationKeys {
+		err := printf("irodsfs_operations_total{operation=%q,errno=%q} %d\n", key.operation, strconv.Itoa(int(key.errno)), metrics.operations[key])
+		if err != nil {
+			return written, err
+		}
+	}
+
+	operations := []string{}
+	for operation := range metrics.latencies {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+
+	printf("# HELP irodsfs_operation_duration_seconds Latency of filesystem operations.\n")
+	printf("# TYPE irodsfs_operation_duration_seconds histogram\n")
+	for _, operation := range operations {
+		histogram := metrics.latencies[operation]
+
+		cumulative := uint64(0)
+		for i, bound := range metricsLatencyBuckets {
+			cumulative += histogram.buckets[i]
+			printf("irodsfs_operation_duration_seconds_bucket{operation=%q,le=%q} %d\n", operation, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+
+		printf("irodsfs_operation_duration_seconds_bucket{operation=%q,le=\"+Inf\"} %d\n", operation, histogram.count)
+		printf("irodsfs_operation_duration_seconds_sum{operation=%q} %g\n", operation, histogram.sum)
+		err := printf("irodsfs_operation_duration_seconds_count{operation=%q} %d\n", operation, histogram.count)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	printf("# HELP irodsfs_read_bytes_total Bytes read through file handles.\n")
+	printf("# TYPE irodsfs_read_bytes_total counter\n")
+	printf("irodsfs_read_bytes_total %d\n", atomic.LoadUint64(&metrics.bytesRead))
+	printf("# HELP irodsfs_written_bytes_total Bytes written through file handles.\n")
+	printf("# TYPE irodsfs_written_bytes_total counter\n")
+	err := printf("irodsfs_written_bytes_total %d\n", atomic.LoadUint64(&metrics.bytesWritten))
+	if err != nil || metrics.workerPool == nil {
+		return written, err
+	}
+
+	printf("# HELP irodsfs_io_workers Number of I/O workers.\n")
+	printf("# TYPE irodsfs_io_workers gauge\n")
+	printf("irodsfs_io_workers %d\n", metrics.workerPool.GetWorkers())
+	printf("# HELP irodsfs_io_workers_busy Number of I/O workers running tasks.\n")
+	printf("# TYPE irodsfs_io_workers_busy gauge\n")
+	printf("irodsfs_io_workers_busy %d\n", metrics.workerPool.GetBusy())
+	printf("# HELP irodsfs_io_tasks_queued Number of I/O tasks waiting for workers.\n")
+	printf("# TYPE irodsfs_io_tasks_queued gauge\n")
+	err = printf("irodsfs_io_tasks_queued %d\n", metrics.workerPool.GetQueued())
+	return written, err
+}
+
+// ServeHTTP serves metrics
+func (metrics *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.WriteTo(w)
+}
+
+// StartServer starts an HTTP server exporting metrics on /metrics
+func (metrics *Metrics) StartServer(endpoint string) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "Metrics",
+		"function": "StartServer",
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+
+	server := &http.Server{
+		Addr:    endpoint,
+		Handler: mux,
+	}
+
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return xerrors.Errorf("failed to listen on %q for metrics: %w", endpoint, err)
+	}
+
+	metrics.server = server
+
+	go func() {
+		logger.Infof("Starting metrics service at %q", endpoint)
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Errorf("%+v", err)
+		}
+	}()
+
+	return nil
+}
+
+// StopServer stops the HTTP server
+func (metrics *Metrics) StopServer() {
+	if metrics == nil || metrics.server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	metrics.server.Shutdown(ctx)
+	metrics.server = nil
+}
@@ -0,0 +1,88 @@
+package irodsfs
+
+import (
+	"sync"
+	"time"
+)
+
+// ModifyTimeCache retains modify times persisted in xattr, so stats do not ask iRODS for the xattr every time
+// files without the xattr are cached too, as most files do not have it
+type ModifyTimeCache struct {
+	timeout     time.Duration
+	mutex       sync.Mutex
+	entries     map[string]*modifyTimeCacheEntry // key is entry path
+	lastCleanup time.Time
+}
+
+type modifyTimeCacheEntry struct {
+	expireTime time.Time
+	value      string // value of the xattr, empty if the entry does not have the xattr
+}
+
+// NewModifyTimeCache creates a new ModifyTimeCache
+func NewModifyTimeCache(timeout time.Duration) *ModifyTimeCache {
+	return &ModifyTimeCache{
+		timeout:     timeout,
+		mutex:       sync.Mutex{},
+		entries:     map[string]*modifyTimeCacheEntry{},
+		lastCleanup: time.Now(),
+	}
+}
+
+// Get returns the value of the xattr cached, empty if the entry does not have the xattr
+// returns false if not cached
+func (cache *ModifyTimeCache) Get(entryPath string) (string, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cachedEntry, ok := cache.entries[entryPath]
+	if !ok {
+		return "", false
+	}
+
+	if time.Now().After(cachedEntry.expireTime) {
+		delete(cache.entries, entryPath)
+		return "", false
+	}
+
+	return cachedEntry.value, true
+}
+
+// Set caches the value of the xattr, pass empty value if the entry does not have the xattr
+func (cache *ModifyTimeCache) Set(entryPath string, value string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+
+	// clean up expired entries once in a timeout, not to scan all entries on every set
+	if now.Sub(cache.lastCleanup) > cache.timeout {
+		for cachedPath, cachedEntry := range cache.entries {
+			if now.After(cachedEntry.expireTime) {
+				delete(cache.entries, cachedPath)
+			}
+		}
+		cache.lastCleanup = now
+	}
+
+	cache.entries[entryPath] = &modifyTimeCacheEntry{
+		expireTime: now.Add(cache.timeout),
+		value:      value,
+	}
+}
+
+// Invalidate removes the cached value of the path
+func (cache *ModifyTimeCache) Invalidate(entryPath string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	delete(cache.entries, entryPath)
+}
+
+// Clear clears all cached values
+func (cache *ModifyTimeCache) Clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries = map[string]*modifyTimeCacheEntry{}
+}
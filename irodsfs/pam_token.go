@@ -0,0 +1,178 @@
+package irodsfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	"github.com/cyverse/irodsfs/commons"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// pamTokenCacheEntry is a PAM token stored in a file under data root, so mounts reuse it instead of authenticating with PAM every time
+type pamTokenCacheEntry struct {
+	Token      string    `json:"token"`
+	ExpiryTime time.Time `json:"expiry_time"`
+}
+
+// isPAMTokenCacheEnabled checks if PAM tokens are cached for the account
+func isPAMTokenCacheEnabled(config *commons.Config, account *irodsclient_types.IRODSAccount) bool {
+	return config.PamTokenTTL > 0 && account.AuthenticationScheme == irodsclient_types.AuthSchemePAM
+}
+
+// getPAMTokenTTLHours returns the TTL of PAM tokens requested to iRODS, in hours
+func getPAMTokenTTLHours(config *commons.Config) int {
+	return int(math.Ceil(time.Duration(config.PamTokenTTL).Hours()))
+}
+
+// getPAMTokenCacheFilePath returns the path of the file caching the PAM token, tokens are cached per server and user
+func getPAMTokenCacheFilePath(config *commons.Config) string {
+	key := fmt.Sprintf("%s:%d/%s/%s", config.Host, config.Port, config.Zone, config.ProxyUser)
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(config.DataRootPath, fmt.Sprintf("pam_token_%s.json", hex.EncodeToString(hash[:8])))
+}
+
+// loadPAMToken returns the PAM token cached, returns empty string if not cached or expired
+// a cache file accessible by group or others is ignored
+func loadPAMToken(config *commons.Config) string {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "loadPAMToken",
+	})
+
+	cacheFilePath := getPAMTokenCacheFilePath(config)
+
+	st, err := os.Stat(cacheFilePath)
+	if err != nil {
+		return ""
+	}
+
+	if st.Mode().Perm()&0o077 != 0 {
+		logger.Warnf("ignoring PAM token cache %q accessible by group or others", cacheFilePath)
+		return ""
+	}
+
+	cacheBytes, err := os.ReadFile(cacheFilePath)
+	if err != nil {
+		logger.Debugf("failed to read PAM token cache %q - %v", cacheFilePath, err)
+		return ""
+	}
+
+	cacheEntry := pamTokenCacheEntry{}
+	err = json.Unmarshal(cacheBytes, &cacheEntry)
+	if err != nil {
+		logger.Debugf("failed to parse PAM token cache %q - %v", cacheFilePath, err)
+		return ""
+	}
+
+	if len(cacheEntry.Token) == 0 || time.Now().After(cacheEntry.ExpiryTime) {
+		return ""
+	}
+
+	return cacheEntry.Token
+}
+
+// savePAMToken caches the PAM token until it expires, only the user running irodsfs can read it
+func savePAMToken(config *commons.Config, token string, expiryTime time.Time) error {
+	cacheFilePath := getPAMTokenCacheFilePath(config)
+
+	err := os.MkdirAll(config.DataRootPath, 0o700)
+	if err != nil {
+		return xerrors.Errorf("failed to make data root dir %q: %w", config.DataRootPath, err)
+	}
+
+	cacheBytes, err := json.Marshal(pamTokenCacheEntry{
+		Token:      token,
+		ExpiryTime: expiryTime,
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to marshal PAM token cache: %w", err)
+	}
+
+	// replace atomically, not to expose a partial file
+	tempFile, err := os.CreateTemp(config.DataRootPath, ".pam_token_*")
+	if err != nil {
+		return xerrors.Errorf("failed to create PAM token cache: %w", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(cacheBytes)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to write PAM token cache: %w", err)
+	}
+
+	err = os.Rename(tempFile.Name(), cacheFilePath)
+	if err != nil {
+		return xerrors.Errorf("failed to rename PAM token cache to %q: %w", cacheFilePath, err)
+	}
+	return nil
+}
+
+// removePAMToken removes the PAM token cached, e.g., when authentication with it fails
+func removePAMToken(config *commons.Config) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "removePAMToken",
+	})
+
+	cacheFilePath := getPAMTokenCacheFilePath(config)
+	err := os.Remove(cacheFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Errorf("failed to remove PAM token cache %q - %v", cacheFilePath, err)
+	}
+}
+
+// newIRODSFSClientDirect creates a go-irodsclient fs client, and caches the PAM token obtained if PAM tokens are cached
+// if the cached PAM token is rejected, e.g., revoked on the server, it authenticates with PAM again
+func newIRODSFSClientDirect(config *commons.Config, account *irodsclient_types.IRODSAccount, fsConfig *irodsclient_fs.FileSystemConfig) (irodsfs_common_irods.IRODSFSClient, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "newIRODSFSClientDirect",
+	})
+
+	if !isPAMTokenCacheEnabled(config, account) {
+		return irodsfs_common_irods.NewIRODSFSClientDirect(account, fsConfig)
+	}
+
+	cachedToken := account.PamToken
+
+	fsClient, err := irodsfs_common_irods.NewIRODSFSClientDirect(account, fsConfig)
+	if err != nil && irodsclient_types.IsAuthError(err) && len(cachedToken) > 0 {
+		logger.Infof("Authentication with cached PAM token failed, authenticating with PAM - %v", err)
+
+		removePAMToken(config)
+		account.PamToken = ""
+		cachedToken = ""
+
+		fsClient, err = irodsfs_common_irods.NewIRODSFSClientDirect(account, fsConfig)
+	}
+
+	if err != nil {
+		if irodsclient_types.IsAuthError(err) {
+			removePAMToken(config)
+		}
+		return nil, err
+	}
+
+	if len(account.PamToken) > 0 && account.PamToken != cachedToken {
+		expiryTime := time.Now().Add(time.Duration(config.PamTokenTTL))
+		err = savePAMToken(config, account.PamToken, expiryTime)
+		if err != nil {
+			logger.Errorf("%+v", err)
+		}
+	}
+
+	return fsClient, nil
+}
@@ -0,0 +1,179 @@
+package irodsfs
+
+import (
+	"strings"
+	"sync"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
+	irodsfscommon_irods "github.com/cyverse/irodsfs-common/irods"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+var (
+	// errParallelStreamsExhausted is returned when all sub-streams allowed are used by other parallel readers
+	errParallelStreamsExhausted = xerrors.New("all parallel read streams are in use")
+)
+
+// ParallelStreamBudget limits sub-streams opened by all parallel readers, so they do not exhaust connections to iRODS
+type ParallelStreamBudget struct {
+	mutex     sync.Mutex
+	available int
+}
+
+// NewParallelStreamBudget creates a new ParallelStreamBudget allowing the given number of sub-streams
+func NewParallelStreamBudget(streams int) *ParallelStreamBudget {
+	return &ParallelStreamBudget{
+		mutex:     sync.Mutex{},
+		available: streams,
+	}
+}
+
+// Acquire takes up to the given number of sub-streams, returns the number taken
+// a nil budget is unlimited
+func (budget *ParallelStreamBudget) Acquire(streams int) int {
+	if budget == nil {
+		return streams
+	}
+
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	if streams > budget.available {
+		streams = budget.available
+	}
+	budget.available -= streams
+	return streams
+}
+
+// Release returns sub-streams taken
+func (budget *ParallelStreamBudget) Release(streams int) {
+	if budget == nil {
+		return
+	}
+
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	budget.available += streams
+}
+
+// GetAvailable returns the number of sub-streams not taken
+func (budget *ParallelStreamBudget) GetAvailable() int {
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+
+	return budget.available
+}
+
+// ParallelReader reads blocks of a file concurrently through multiple iRODS file handles
+// blocks are fetched by the prefetching reader having a sync reader per handle, and returned in order
+type ParallelReader struct {
+	irodsfscommon_io.Reader
+
+	subFileHandles []irodsfscommon_irods.IRODSFSFileHandle // handles opened in addition to the handle given
+	streamBudget   *ParallelStreamBudget                   // sub-streams are returned to the budget on release
+	bufferSize     int64                                   // blocks fetched ahead by all streams
+	releaseErrors  []error
+	mutex          sync.Mutex
+}
+
+// NewParallelReader creates a new ParallelReader reading through the given number of streams
+// it opens streams-1 handles in addition to the handle given, taken from the sub-streams budget shared by all parallel readers
+// it reads through less streams if the budget runs short or some fail to open, and returns errParallelStreamsExhausted if none is available
+func NewParallelReader(fs *IRODSFS, fileHandle irodsfscommon_irods.IRODSFSFileHandle, streams int) (*ParallelReader, error) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "NewParallelReader",
+	})
+
+	path := fileHandle.GetEntry().Path
+	fsClient := fs.getDataFSClient(irodsclient_types.FileOpenModeReadOnly)
+
+	readers := []irodsfscommon_io.Reader{
+		irodsfscommon_io.NewSyncReader(fsClient, fileHandle, fs.getAccessReportClient(fileHandle.GetOpenMode())),
+	}
+	subFileHandles := []irodsfscommon_irods.IRODSFSFileHandle{}
+
+	subStreams := fs.parallelStreamBudget.Acquire(streams - 1)
+	if subStreams == 0 {
+		return nil, errParallelStreamsExhausted
+	}
+
+	for i := 0; i < subStreams; i++ {
+		subFileHandle, err := fs.openDataFile(path, irodsclient_types.FileOpenModeReadOnly)
+		if err != nil {
+			logger.Warnf("failed to open a stream for %q, reading through %d streams - %v", path, len(readers), err)
+			break
+		}
+
+		subFileHandles = append(subFileHandles, subFileHandle)
+		readers = append(readers, irodsfscommon_io.NewSyncReader(fsClient, subFileHandle, fs.getAccessReportClient(subFileHandle.GetOpenMode())))
+	}
+
+	// streams failed to open are not used
+	fs.parallelStreamBudget.Release(subStreams - len(subFileHandles))
+
+	prefetchingReader, err := NewPrefetchingReader(readers, fs.config.IOBlockSize, fs.submitAsync)
+	if err != nil {
+		for _, subFileHandle := range subFileHandles {
+			subFileHandle.Close()
+		}
+		fs.parallelStreamBudget.Release(len(subFileHandles))
+		return nil, err
+	}
+
+	return &ParallelReader{
+		Reader: prefetchingReader,
+
+		subFileHandles: subFileHandles,
+		streamBudget:   fs.parallelStreamBudget,
+		bufferSize:     int64(fs.config.IOBlockSize) * int64(len(readers)),
+		releaseErrors:  []error{},
+		mutex:          sync.Mutex{},
+	}, nil
+}
+
+// Release releases the reader and closes all sub-streams
+func (reader *ParallelReader) Release() {
+	reader.Reader.Release()
+
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	for _, subFileHandle := range reader.subFileHandles {
+		err := subFileHandle.Close()
+		if err != nil {
+			reader.releaseErrors = append(reader.releaseErrors, err)
+		}
+	}
+	reader.streamBudget.Release(len(reader.subFileHandles))
+	reader.subFileHandles = nil
+}
+
+// GetBufferSize returns the size of blocks the streams fetch ahead
+func (reader *ParallelReader) GetBufferSize() int64 {
+	return reader.bufferSize
+}
+
+// GetError returns an error occurred while reading or closing sub-streams
+func (reader *ParallelReader) GetError() error {
+	err := reader.Reader.GetError()
+	if err != nil {
+		return err
+	}
+
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	if len(reader.releaseErrors) == 0 {
+		return nil
+	}
+
+	messages := []string{}
+	for _, releaseErr := range reader.releaseErrors {
+		messages = append(messages, releaseErr.Error())
+	}
+	return xerrors.Errorf("failed to close %d sub-streams for %q: %s", len(reader.releaseErrors), reader.GetPath(), strings.Join(messages, "; "))
+}
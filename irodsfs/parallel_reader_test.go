@@ -0,0 +1,87 @@
+package irodsfs
+
+import (
+	"testing"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	"golang.org/x/xerrors"
+)
+
+func TestParallelStreamBudget(t *testing.T) {
+	budget := NewParallelStreamBudget(3)
+
+	if streams := budget.Acquire(2); streams != 2 {
+		t.Errorf("expected 2 streams taken, got %d", streams)
+	}
+
+	if streams := budget.Acquire(2); streams != 1 {
+		t.Errorf("expected 1 stream taken, got %d", streams)
+	}
+
+	if streams := budget.Acquire(2); streams != 0 {
+		t.Errorf("expected no stream taken, got %d", streams)
+	}
+
+	budget.Release(3)
+	if available := budget.GetAvailable(); available != 3 {
+		t.Errorf("expected 3 streams available, got %d", available)
+	}
+
+	// a nil budget is unlimited
+	var unlimited *ParallelStreamBudget
+	if streams := unlimited.Acquire(5); streams != 5 {
+		t.Errorf("expected 5 streams taken from unlimited budget, got %d", streams)
+	}
+	unlimited.Release(5)
+}
+
+func TestNewParallelReaderSharesStreams(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.ParallelRead = true
+	fs.config.ConnectionMax = 5
+	fs.config.IOBlockSize = 4
+	fs.parallelStreamBudget = NewParallelStreamBudget(3)
+
+	filePath := "/testzone/home/testuser/large.bin"
+	client.addFile(filePath, []byte("0123456789"))
+
+	firstHandle, err := client.OpenFile(filePath, "", string(irodsclient_types.FileOpenModeReadOnly))
+	if err != nil {
+		t.Fatalf("failed to open - %v", err)
+	}
+
+	firstReader, err := NewParallelReader(fs, firstHandle, 4)
+	if err != nil {
+		t.Fatalf("failed to create a parallel reader - %v", err)
+	}
+
+	if streams := len(firstReader.subFileHandles); streams != 3 {
+		t.Errorf("expected 3 sub-streams opened, got %d", streams)
+	}
+
+	secondHandle, err := client.OpenFile(filePath, "", string(irodsclient_types.FileOpenModeReadOnly))
+	if err != nil {
+		t.Fatalf("failed to open - %v", err)
+	}
+
+	_, err = NewParallelReader(fs, secondHandle, 4)
+	if !xerrors.Is(err, errParallelStreamsExhausted) {
+		t.Errorf("expected streams exhausted, got %v", err)
+	}
+
+	// the second handle reads without sub-streams
+	reader, err := newReadOnlyReader(fs, secondHandle)
+	if err != nil {
+		t.Fatalf("failed to create a reader - %v", err)
+	}
+	if _, ok := reader.(*ParallelReader); ok {
+		t.Errorf("expected a reader without sub-streams")
+	}
+	reader.Release()
+
+	firstReader.Release()
+	if available := fs.parallelStreamBudget.GetAvailable(); available != 3 {
+		t.Errorf("expected 3 streams returned, got %d", available)
+	}
+}
@@ -0,0 +1,104 @@
+package irodsfs
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	// inode ids hashed from paths have the highest bit set, not to collide with inode ids of iRODS entry ids and vpath entries
+	pathInodeIDFlag uint64 = 1 << 63
+)
+
+const (
+	// pathInodeIDMapMax is the number of paths PathInodeIDMap retains without collisions, about 100 bytes each
+	pathInodeIDMapMax int = 256 * 1024
+)
+
+// PathInodeIDMap assigns inode ids hashed from iRODS paths, for entries whose ids change, e.g., data objects recreated by tools
+// a path keeps its inode id while mounted, and gets the same inode id on remount unless its hash collides
+// on collision, the path seen later takes the next free inode id, so the inode id may differ on remount
+// a renamed entry gets the inode id of the new path
+// paths least recently used are evicted beyond the max, they get the same inode id again as it is their hash
+// paths with collided hashes are never evicted, so they keep their inode ids
+type PathInodeIDMap struct {
+	mutex         sync.Mutex
+	maxEntries    int
+	pathToInodeID map[string]uint64
+	inodeIDToPath map[uint64]string
+	lruList       *list.List               // paths evictable, recently used first
+	lruElements   map[string]*list.Element // elements of lruList, by path
+}
+
+// NewPathInodeIDMap creates a new PathInodeIDMap retaining up to maxEntries paths without collisions
+func NewPathInodeIDMap(maxEntries int) *PathInodeIDMap {
+	return &PathInodeIDMap{
+		mutex:         sync.Mutex{},
+		maxEntries:    maxEntries,
+		pathToInodeID: map[string]uint64{},
+		inodeIDToPath: map[uint64]string{},
+		lruList:       list.New(),
+		lruElements:   map[string]*list.Element{},
+	}
+}
+
+// GetInodeID returns inode id for the iRODS path
+func (pathInodeIDMap *PathInodeIDMap) GetInodeID(irodsPath string) uint64 {
+	pathInodeIDMap.mutex.Lock()
+	defer pathInodeIDMap.mutex.Unlock()
+
+	if inodeID, ok := pathInodeIDMap.pathToInodeID[irodsPath]; ok {
+		if element, ok := pathInodeIDMap.lruElements[irodsPath]; ok {
+			pathInodeIDMap.lruList.MoveToFront(element)
+		}
+		return inodeID
+	}
+
+	hashedInodeID := hashPathInodeID(irodsPath)
+	inodeID := hashedInodeID
+	for {
+		if _, ok := pathInodeIDMap.inodeIDToPath[inodeID]; !ok {
+			break
+		}
+
+		// collision
+		inodeID = (inodeID + 1) | pathInodeIDFlag
+	}
+
+	pathInodeIDMap.pathToInodeID[irodsPath] = inodeID
+	pathInodeIDMap.inodeIDToPath[inodeID] = irodsPath
+
+	if inodeID == hashedInodeID {
+		pathInodeIDMap.lruElements[irodsPath] = pathInodeIDMap.lruList.PushFront(irodsPath)
+		pathInodeIDMap.evict()
+	}
+	return inodeID
+}
+
+// evict evicts paths least recently used beyond the max
+func (pathInodeIDMap *PathInodeIDMap) evict() {
+	for pathInodeIDMap.lruList.Len() > pathInodeIDMap.maxEntries {
+		element := pathInodeIDMap.lruList.Back()
+		irodsPath := pathInodeIDMap.lruList.Remove(element).(string)
+
+		delete(pathInodeIDMap.inodeIDToPath, pathInodeIDMap.pathToInodeID[irodsPath])
+		delete(pathInodeIDMap.pathToInodeID, irodsPath)
+		delete(pathInodeIDMap.lruElements, irodsPath)
+	}
+}
+
+// Len returns the number of paths retained
+func (pathInodeIDMap *PathInodeIDMap) Len() int {
+	pathInodeIDMap.mutex.Lock()
+	defer pathInodeIDMap.mutex.Unlock()
+
+	return len(pathInodeIDMap.pathToInodeID)
+}
+
+// hashPathInodeID returns inode id hashed from the iRODS path
+func hashPathInodeID(irodsPath string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(irodsPath))
+	return hash.Sum64() | pathInodeIDFlag
+}
@@ -0,0 +1,87 @@
+package irodsfs
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPathInodeIDMapIsStable(t *testing.T) {
+	pathInodeIDMap := NewPathInodeIDMap(pathInodeIDMapMax)
+
+	inodeID := pathInodeIDMap.GetInodeID("/zone/home/user/file.txt")
+	if inodeID&pathInodeIDFlag == 0 {
+		t.Errorf("expected the flag set in inode id %x", inodeID)
+	}
+
+	if again := pathInodeIDMap.GetInodeID("/zone/home/user/file.txt"); again != inodeID {
+		t.Errorf("expected inode id %x again, got %x", inodeID, again)
+	}
+
+	// a remount hashes the path the same
+	if remounted := NewPathInodeIDMap(pathInodeIDMapMax).GetInodeID("/zone/home/user/file.txt"); remounted != inodeID {
+		t.Errorf("expected inode id %x on remount, got %x", inodeID, remounted)
+	}
+
+	if other := pathInodeIDMap.GetInodeID("/zone/home/user/file2.txt"); other == inodeID {
+		t.Errorf("expected different inode ids of different paths")
+	}
+}
+
+func TestPathInodeIDMapCollision(t *testing.T) {
+	pathInodeIDMap := NewPathInodeIDMap(2)
+
+	// occupy the hash of the path, as a path colliding would
+	collidedPath := "/zone/home/user/collided.txt"
+	hashedInodeID := hashPathInodeID(collidedPath)
+	pathInodeIDMap.GetInodeID("/zone/home/user/first.txt")
+	pathInodeIDMap.inodeIDToPath[hashedInodeID] = "/zone/home/user/first.txt"
+
+	inodeID := pathInodeIDMap.GetInodeID(collidedPath)
+	if inodeID != (hashedInodeID+1)|pathInodeIDFlag {
+		t.Errorf("expected the next inode id %x on collision, got %x", (hashedInodeID+1)|pathInodeIDFlag, inodeID)
+	}
+
+	// collided paths are not evicted, as they would get other inode ids
+	for i := 0; i < 10; i++ {
+		pathInodeIDMap.GetInodeID(fmt.Sprintf("/zone/home/user/file%d.txt", i))
+	}
+
+	if again := pathInodeIDMap.GetInodeID(collidedPath); again != inodeID {
+		t.Errorf("expected inode id %x kept for collided path, got %x", inodeID, again)
+	}
+}
+
+func TestPathInodeIDMapEviction(t *testing.T) {
+	pathInodeIDMap := NewPathInodeIDMap(2)
+
+	inodeIDA := pathInodeIDMap.GetInodeID("/zone/home/user/a.txt")
+	inodeIDB := pathInodeIDMap.GetInodeID("/zone/home/user/b.txt")
+	// a is used recently, b is evicted
+	pathInodeIDMap.GetInodeID("/zone/home/user/a.txt")
+	pathInodeIDMap.GetInodeID("/zone/home/user/c.txt")
+
+	if length := pathInodeIDMap.Len(); length != 2 {
+		t.Errorf("expected 2 paths retained, got %d", length)
+	}
+
+	if _, ok := pathInodeIDMap.pathToInodeID["/zone/home/user/b.txt"]; ok {
+		t.Errorf("expected the path least recently used evicted")
+	}
+
+	// evicted paths get the same inode ids again
+	if again := pathInodeIDMap.GetInodeID("/zone/home/user/b.txt"); again != inodeIDB {
+		t.Errorf("expected inode id %x after eviction, got %x", inodeIDB, again)
+	}
+
+	if again := pathInodeIDMap.GetInodeID("/zone/home/user/a.txt"); again != inodeIDA {
+		t.Errorf("expected inode id %x, got %x", inodeIDA, again)
+	}
+
+	for i := 0; i < 1000; i++ {
+		pathInodeIDMap.GetInodeID(fmt.Sprintf("/zone/home/user/file%d.txt", i))
+	}
+
+	if length := pathInodeIDMap.Len(); length != 2 {
+		t.Errorf("expected 2 paths retained, got %d", length)
+	}
+}
@@ -0,0 +1,52 @@
+package irodsfs
+
+import (
+	"sync"
+)
+
+// pathLock is a lock of a path, shared by goroutines locking the same path
+type pathLock struct {
+	mutex sync.Mutex
+	refs  int
+}
+
+// PathLockMap serializes operations per iRODS path, operations on different paths run concurrently
+// locks are removed when no one holds or waits for them, so the map does not grow with paths accessed
+type PathLockMap struct {
+	mutex sync.Mutex
+	locks map[string]*pathLock
+}
+
+// NewPathLockMap creates a new PathLockMap
+func NewPathLockMap() *PathLockMap {
+	return &PathLockMap{
+		mutex: sync.Mutex{},
+		locks: map[string]*pathLock{},
+	}
+}
+
+// Lock locks the path, returns a function to unlock it
+func (pathLockMap *PathLockMap) Lock(path string) func() {
+	pathLockMap.mutex.Lock()
+	lock, ok := pathLockMap.locks[path]
+	if !ok {
+		lock = &pathLock{}
+		pathLockMap.locks[path] = lock
+	}
+	lock.refs++
+	pathLockMap.mutex.Unlock()
+
+	lock.mutex.Lock()
+
+	return func() {
+		lock.mutex.Unlock()
+
+		pathLockMap.mutex.Lock()
+		defer pathLockMap.mutex.Unlock()
+
+		lock.refs--
+		if lock.refs == 0 {
+			delete(pathLockMap.locks, path)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package irodsfs
+
+import (
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	irodspoolclient "github.com/cyverse/irodsfs-pool/client"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	poolReconnectBackoffMin time.Duration = 1 * time.Second
+)
+
+// poolServiceClient is a connection to irodsfs-pool server, implemented by irodsfs-pool client
+type poolServiceClient interface {
+	Connect() error
+	Disconnect()
+	NewSession(account *irodsclient_types.IRODSAccount, applicationName string) (irodsfs_common_irods.IRODSFSClient, error)
+}
+
+// PoolConnector manages the connection to irodsfs-pool server and sessions on it
+type PoolConnector struct {
+	endpoint         string
+	operationTimeout time.Duration
+	instanceID       string
+	account          *irodsclient_types.IRODSAccount
+
+	newPoolClient func() poolServiceClient
+	poolClient    poolServiceClient
+}
+
+// NewPoolConnector creates a new PoolConnector
+func NewPoolConnector(endpoint string, operationTimeout time.Duration, instanceID string, account *irodsclient_types.IRODSAccount) *PoolConnector {
+	return &PoolConnector{
+		endpoint:         endpoint,
+		operationTimeout: operationTimeout,
+		instanceID:       instanceID,
+		account:          account,
+
+		newPoolClient: func() poolServiceClient {
+			return irodspoolclient.NewPoolServiceClient(endpoint, operationTimeout, instanceID)
+		},
+		poolClient: nil,
+	}
+}
+
+// Connect connects to irodsfs-pool server and creates a new session
+// returns a function disconnecting the connection replaced, for the caller to call once the old session is no longer used
+func (connector *PoolConnector) Connect() (irodsfs_common_irods.IRODSFSClient, func(), error) {
+	poolClient := connector.newPoolClient()
+	err := poolClient.Connect()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to connect to irodsfs-pool server %q: %w", connector.endpoint, err)
+	}
+
+	fsClient, err := poolClient.NewSession(connector.account, FSName)
+	if err != nil {
+		poolClient.Disconnect()
+		return nil, nil, &PoolSessionError{
+			Endpoint: connector.endpoint,
+			Err:      err,
+		}
+	}
+
+	oldPoolClient := connector.poolClient
+	connector.poolClient = poolClient
+
+	disconnectOld := func() {
+		if oldPoolClient != nil {
+			oldPoolClient.Disconnect()
+		}
+	}
+	return fsClient, disconnectOld, nil
+}
+
+// Disconnect disconnects from irodsfs-pool server
+func (connector *PoolConnector) Disconnect() {
+	if connector.poolClient != nil {
+		connector.poolClient.Disconnect()
+		connector.poolClient = nil
+	}
+}
+
+// PoolSessionError is returned when irodsfs-pool server is reachable but fails to create a session, e.g., iRODS is unavailable
+type PoolSessionError struct {
+	Endpoint string
+	Err      error
+}
+
+// Error returns error message
+func (err *PoolSessionError) Error() string {
+	return "failed to create a new irodsfs-pool session on " + err.Endpoint + ": " + err.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (err *PoolSessionError) Unwrap() error {
+	return err.Err
+}
+
+// startPoolMonitor checks the pool session periodically and reconnects when it is lost
+func (fs *IRODSFS) startPoolMonitor() {
+	if fs.poolConnector == nil || fs.config.PoolHealthCheckInterval <= 0 || fs.poolMonitorTerminateChan != nil {
+		return
+	}
+
+	terminateChan := make(chan bool)
+	fs.poolMonitorTerminateChan = terminateChan
+
+	go func() {
+		logger := log.WithFields(log.Fields{
+			"package":  "irodsfs",
+			"struct":   "IRODSFS",
+			"function": "startPoolMonitor",
+		})
+
+		interval := time.Duration(fs.config.PoolHealthCheckInterval)
+		backoff := poolReconnectBackoffMin
+		wait := interval
+
+		for {
+			select {
+			case <-terminateChan:
+				return
+			case <-time.After(wait):
+			}
+
+			generation := fs.getSessionGeneration()
+
+			err := fs.checkSession()
+			if err == nil {
+				backoff = poolReconnectBackoffMin
+				wait = interval
+				continue
+			}
+
+			logger.Warnf("Lost the session on irodsfs-pool server %q, reconnecting - %v", fs.config.PoolEndpoint, err)
+
+			err = fs.reconnectSession(generation)
+			if err == nil {
+				backoff = poolReconnectBackoffMin
+				wait = interval
+				continue
+			}
+
+			var sessionErr *PoolSessionError
+			if xerrors.As(err, &sessionErr) {
+				logger.Errorf("irodsfs-pool server %q is up, but iRODS server seems unavailable, retrying in %s - %v", fs.config.PoolEndpoint, backoff, err)
+			} else {
+				logger.Errorf("irodsfs-pool server %q is unavailable, retrying in %s - %v", fs.config.PoolEndpoint, backoff, err)
+			}
+
+			wait = backoff
+			backoff *= 2
+			backoffMax := time.Duration(fs.config.PoolReconnectBackoffMax)
+			if backoffMax > 0 && backoff > backoffMax {
+				backoff = backoffMax
+			}
+		}
+	}()
+}
+
+// stopPoolMonitor stops checking the pool session
+func (fs *IRODSFS) stopPoolMonitor() {
+	if fs.poolMonitorTerminateChan != nil {
+		close(fs.poolMonitorTerminateChan)
+		fs.poolMonitorTerminateChan = nil
+	}
+}
+
+// reconnectPool reconnects to irodsfs-pool server and replaces the fs client with a new session
+// file handles opened on the old session fail, handles not yet opened on iRODS use the new session
+func (fs *IRODSFS) reconnectPool() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "IRODSFS",
+		"function": "reconnectPool",
+	})
+
+	fsClient, disconnectOld, err := fs.poolConnector.Connect()
+	if err != nil {
+		return err
+	}
+
+	fs.replaceSession(newFSSession(fsClient, nil), disconnectOld)
+
+	logger.Infof("Reconnected to irodsfs-pool server %q", fs.config.PoolEndpoint)
+	return nil
+}
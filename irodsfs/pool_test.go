@@ -0,0 +1,159 @@
+package irodsfs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	"golang.org/x/xerrors"
+)
+
+// fakePoolClient is a connection to a fake irodsfs-pool server, creating sessions on fake clients
+type fakePoolClient struct {
+	mutex        sync.Mutex
+	session      *fakeFSClient
+	sessionErr   error
+	disconnected bool
+}
+
+func (poolClient *fakePoolClient) Connect() error {
+	return nil
+}
+
+func (poolClient *fakePoolClient) Disconnect() {
+	poolClient.mutex.Lock()
+	defer poolClient.mutex.Unlock()
+
+	poolClient.disconnected = true
+}
+
+func (poolClient *fakePoolClient) isDisconnected() bool {
+	poolClient.mutex.Lock()
+	defer poolClient.mutex.Unlock()
+
+	return poolClient.disconnected
+}
+
+func (poolClient *fakePoolClient) NewSession(account *irodsclient_types.IRODSAccount, applicationName string) (irodsfs_common_irods.IRODSFSClient, error) {
+	if poolClient.sessionErr != nil {
+		return nil, poolClient.sessionErr
+	}
+	return poolClient.session, nil
+}
+
+// newTestPoolFS creates a file system connected to the first fake pool client, reconnecting to the others in order
+func newTestPoolFS(poolClients ...*fakePoolClient) *IRODSFS {
+	fs := newTestFS(poolClients[0].session)
+	fs.config.ReconnectMaxRetries = 1
+
+	next := 1
+	connector := NewPoolConnector("unix:///tmp/irodsfs-pool.sock", 0, "test", fs.account)
+	connector.newPoolClient = func() poolServiceClient {
+		poolClient := poolClients[next]
+		next++
+		return poolClient
+	}
+	connector.poolClient = poolClients[0]
+
+	fs.poolConnector = connector
+	return fs
+}
+
+func TestReconnectPoolDrainsOldSession(t *testing.T) {
+	oldPoolClient := &fakePoolClient{session: newFakeFSClient()}
+	newPoolClient := &fakePoolClient{session: newFakeFSClient()}
+	fs := newTestPoolFS(oldPoolClient, newPoolClient)
+
+	fsClient, done := fs.acquireFSClient()
+
+	generation := fs.getSessionGeneration()
+	err := fs.reconnectSession(generation)
+	if err != nil {
+		t.Fatalf("failed to reconnect - %v", err)
+	}
+
+	if fs.getSessionGeneration() != generation+1 {
+		t.Errorf("expected session generation %d, got %d", generation+1, fs.getSessionGeneration())
+	}
+
+	client, newDone := fs.acquireFSClient()
+	if client != newPoolClient.session {
+		t.Errorf("expected the session of the new pool connection")
+	}
+	newDone()
+
+	// the operation in flight still works
+	_, err = fsClient.Stat("/" + testZone)
+	if err != nil {
+		t.Errorf("expected the old session usable while in use, got %v", err)
+	}
+
+	if oldPoolClient.isDisconnected() {
+		t.Fatalf("disconnected the old pool connection while in use")
+	}
+
+	done()
+
+	if !waitFor(time.Second, oldPoolClient.isDisconnected) {
+		t.Fatalf("expected the old pool connection disconnected once no longer used")
+	}
+
+	if !oldPoolClient.session.isReleased() {
+		t.Errorf("expected the old session released before disconnecting")
+	}
+
+	if newPoolClient.isDisconnected() {
+		t.Errorf("disconnected the new pool connection")
+	}
+}
+
+func TestReconnectPoolSessionError(t *testing.T) {
+	oldPoolClient := &fakePoolClient{session: newFakeFSClient()}
+	newPoolClient := &fakePoolClient{sessionErr: xerrors.New("iRODS is unavailable")}
+	fs := newTestPoolFS(oldPoolClient, newPoolClient)
+
+	err := fs.reconnectSession(fs.getSessionGeneration())
+
+	var sessionErr *PoolSessionError
+	if !xerrors.As(err, &sessionErr) {
+		t.Fatalf("expected PoolSessionError, got %v", err)
+	}
+
+	if !newPoolClient.isDisconnected() {
+		t.Errorf("expected the new pool connection disconnected")
+	}
+
+	client, done := fs.acquireFSClient()
+	defer done()
+
+	if client != oldPoolClient.session || oldPoolClient.isDisconnected() {
+		t.Errorf("expected the old session kept")
+	}
+}
+
+func TestIRODSStatReconnectsPool(t *testing.T) {
+	oldPoolClient := &fakePoolClient{session: newFakeFSClient()}
+	newPoolClient := &fakePoolClient{session: newFakeFSClient()}
+	fs := newTestPoolFS(oldPoolClient, newPoolClient)
+
+	filePath := "/testzone/home/testuser/a.txt"
+	newPoolClient.session.addFile(filePath, []byte("a"))
+
+	oldPoolClient.session.setFailNext("Stat", irodsclient_types.NewConnectionError())
+
+	entry, err := IRODSStat(context.Background(), fs, filePath)
+	if err != nil {
+		t.Fatalf("expected stat retried on the new session, got %v", err)
+	}
+
+	if entry.Path != filePath {
+		t.Errorf("expected entry of %q, got %q", filePath, entry.Path)
+	}
+
+	if !waitFor(time.Second, oldPoolClient.isDisconnected) {
+		t.Errorf("expected the old pool connection disconnected")
+	}
+}
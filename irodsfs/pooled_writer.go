@@ -0,0 +1,167 @@
+package irodsfs
+
+import (
+	"sync"
+
+	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
+	irodsfscommon_irods "github.com/cyverse/irodsfs-common/irods"
+)
+
+const (
+	// writes waiting for a PooledAsyncWriter to pass them to its base writer, same as AsyncWriter of irodsfs-common
+	pooledWriterMaxPending int = 10
+)
+
+// pooledWriteBlock is data waiting to be written by a PooledAsyncWriter
+type pooledWriteBlock struct {
+	offset int64
+	data   []byte
+}
+
+// PooledAsyncWriter passes writes to the base writer in background, like AsyncWriter of irodsfs-common,
+// but on tasks submitted to a worker pool instead of a goroutine per writer
+// one task at a time writes pending data in order, and exits when nothing is pending
+// a write waits when too many writes are pending, and writes by itself if the pool does not take the task
+type PooledAsyncWriter struct {
+	baseWriter irodsfscommon_io.Writer
+	submit     func(task func()) bool
+
+	pending   []*pooledWriteBlock
+	draining  bool // a task writing pending data is queued or running
+	lastError error
+	mutex     sync.Mutex
+	condition *sync.Cond // signaled when pending data is written
+}
+
+// NewPooledAsyncWriter creates a new PooledAsyncWriter
+// submit queues tasks without blocking and returns false if not queued
+func NewPooledAsyncWriter(writer irodsfscommon_io.Writer, submit func(task func()) bool) *PooledAsyncWriter {
+	pooledWriter := &PooledAsyncWriter{
+		baseWriter: writer,
+		submit:     submit,
+
+		pending:   []*pooledWriteBlock{},
+		draining:  false,
+		lastError: nil,
+		mutex:     sync.Mutex{},
+	}
+	pooledWriter.condition = sync.NewCond(&pooledWriter.mutex)
+
+	return pooledWriter
+}
+
+// GetFSClient returns fs client
+func (writer *PooledAsyncWriter) GetFSClient() irodsfscommon_irods.IRODSFSClient {
+	return writer.baseWriter.GetFSClient()
+}
+
+// GetPath returns path of the file
+func (writer *PooledAsyncWriter) GetPath() string {
+	return writer.baseWriter.GetPath()
+}
+
+// WriteAt queues data to write, data is written in background
+func (writer *PooledAsyncWriter) WriteAt(data []byte, offset int64) (int, error) {
+	if len(data) == 0 || offset < 0 {
+		return 0, nil
+	}
+
+	writer.mutex.Lock()
+
+	// pending data is being written as draining is set whenever data is pending
+	for writer.lastError == nil && len(writer.pending) >= pooledWriterMaxPending {
+		writer.condition.Wait()
+	}
+
+	if writer.lastError != nil {
+		err := writer.lastError
+		writer.mutex.Unlock()
+		return 0, err
+	}
+
+	// the caller may reuse the buffer
+	writer.pending = append(writer.pending, &pooledWriteBlock{
+		offset: offset,
+		data:   append([]byte{}, data...),
+	})
+
+	if writer.draining {
+		writer.mutex.Unlock()
+		return len(data), nil
+	}
+
+	writer.draining = true
+	writer.mutex.Unlock()
+
+	if !writer.submit(writer.drain) {
+		// the pool is busy, write here rather than adding a goroutine
+		writer.drain()
+		return len(data), writer.GetError()
+	}
+
+	return len(data), nil
+}
+
+// drain writes pending data in order until nothing is pending
+func (writer *PooledAsyncWriter) drain() {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	for len(writer.pending) > 0 {
+		block := writer.pending[0]
+		writer.pending = writer.pending[1:]
+
+		if writer.lastError == nil {
+			writer.mutex.Unlock()
+			_, err := writer.baseWriter.WriteAt(block.data, block.offset)
+			writer.mutex.Lock()
+
+			if err != nil && writer.lastError == nil {
+				writer.lastError = err
+			}
+		}
+
+		writer.condition.Broadcast()
+	}
+
+	writer.draining = false
+	writer.condition.Broadcast()
+}
+
+// Flush waits for pending data written, and flushes the base writer
+func (writer *PooledAsyncWriter) Flush() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	for writer.draining {
+		writer.condition.Wait()
+	}
+
+	err := writer.baseWriter.Flush()
+	if err != nil {
+		return err
+	}
+
+	return writer.lastError
+}
+
+// GetError returns the last error occurred while writing
+func (writer *PooledAsyncWriter) GetError() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return writer.lastError
+}
+
+// Release flushes pending data and releases the base writer
+func (writer *PooledAsyncWriter) Release() {
+	// GetError reports the error
+	writer.Flush()
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.baseWriter != nil {
+		writer.baseWriter.Release()
+	}
+}
@@ -0,0 +1,329 @@
+package irodsfs
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"os/user"
+	"sort"
+	"strconv"
+	"syscall"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// binary format of POSIX ACL xattrs, see linux/posix_acl_xattr.h
+const (
+	posixACLXattrVersion uint32 = 2
+	posixACLUndefinedID  uint32 = 0xffffffff
+
+	posixACLUserObj  uint16 = 0x01
+	posixACLUser     uint16 = 0x02
+	posixACLGroupObj uint16 = 0x04
+	posixACLGroup    uint16 = 0x08
+	posixACLMask     uint16 = 0x10
+	posixACLOther    uint16 = 0x20
+
+	// iRODS group every user belongs to
+	irodsPublicGroupName string = "public"
+)
+
+var (
+	// errACLChangeNotSupported is returned when the fs client cannot change ACLs
+	errACLChangeNotSupported = xerrors.New("changing ACLs is not supported by the fs client")
+)
+
+type posixACLEntry struct {
+	tag  uint16
+	perm uint16
+	id   uint32
+}
+
+// IRODSGetPosixACL returns POSIX ACL in binary xattr format derived from iRODS ACLs of the given irods path
+// iRODS users and groups are mapped to local users and groups with the same names, ones not found locally are omitted
+// the ACL is informational, the kernel checks permissions with mode bits as irodsfs does not ask it to enforce ACLs
+func IRODSGetPosixACL(ctx context.Context, fs *IRODSFS, path string, vpathReadonly bool, dest []byte) (uint32, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSGetPosixACL",
+	})
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return 0, syscall.EAGAIN
+	}
+
+	entry, err := IRODSStat(ctx, fs, path)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return 0, syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	var accesses []*irodsclient_types.IRODSAccess
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	if entry.IsDir() {
+		accesses, err = fsClient.ListDirACLs(path)
+	} else {
+		accesses, err = fsClient.ListFileACLs(path)
+	}
+
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return 0, syscall.EREMOTEIO
+	}
+
+	// owner of the file in the mount is the client user, match mode bits
+	entries := []posixACLEntry{
+		{
+			tag:  posixACLUserObj,
+			perm: posixACLPerm(IRODSGetACL(ctx, fs, entry, vpathReadonly) >> 6),
+			id:   posixACLUndefinedID,
+		},
+		{
+			tag:  posixACLGroupObj,
+			perm: 0,
+			id:   posixACLUndefinedID,
+		},
+	}
+
+	var mask uint16 = 0
+	var other uint16 = 0
+	for _, access := range accesses {
+		perm := posixACLPerm(IRODSGetPermission(access.AccessLevel) >> 6)
+		if vpathReadonly {
+			perm &^= 0o2
+		}
+
+		if access.UserType == irodsclient_types.IRODSUserRodsGroup {
+			if access.UserName == irodsPublicGroupName {
+				other |= perm
+				continue
+			}
+
+			localGroup, err := user.LookupGroup(access.UserName)
+			if err != nil {
+				logger.Debugf("failed to find local group for iRODS group %q, omitting", access.UserName)
+				continue
+			}
+
+			gid, err := strconv.ParseUint(localGroup.Gid, 10, 32)
+			if err != nil {
+				continue
+			}
+
+			entries = append(entries, posixACLEntry{tag: posixACLGroup, perm: perm, id: uint32(gid)})
+			mask |= perm
+			continue
+		}
+
+		if isClientUserAccess(fs, access) {
+			// represented by the owner entry
+			continue
+		}
+
+		if len(access.UserZone) > 0 && access.UserZone != fs.config.Zone {
+			// users in other zones have no local users
+			continue
+		}
+
+		localUser, err := user.Lookup(access.UserName)
+		if err != nil {
+			logger.Debugf("failed to find local user for iRODS user %q, omitting", access.UserName)
+			continue
+		}
+
+		uid, err := strconv.ParseUint(localUser.Uid, 10, 32)
+		if err != nil || uint32(uid) == fs.uid {
+			continue
+		}
+
+		entries = append(entries, posixACLEntry{tag: posixACLUser, perm: perm, id: uint32(uid)})
+		mask |= perm
+	}
+
+	if len(entries) > 2 {
+		// mask is required when named entries exist
+		entries = append(entries, posixACLEntry{tag: posixACLMask, perm: mask, id: posixACLUndefinedID})
+	}
+
+	entries = append(entries, posixACLEntry{tag: posixACLOther, perm: other, id: posixACLUndefinedID})
+
+	// entries must be sorted by tag and id
+	sort.SliceStable(entries, func(i int, j int) bool {
+		if entries[i].tag != entries[j].tag {
+			return entries[i].tag < entries[j].tag
+		}
+		return entries[i].id < entries[j].id
+	})
+
+	value := make([]byte, 4+len(entries)*8)
+	binary.LittleEndian.PutUint32(value[0:4], posixACLXattrVersion)
+	for i, entry := range entries {
+		offset := 4 + i*8
+		binary.LittleEndian.PutUint16(value[offset:offset+2], entry.tag)
+		binary.LittleEndian.PutUint16(value[offset+2:offset+4], entry.perm)
+		binary.LittleEndian.PutUint32(value[offset+4:offset+8], entry.id)
+	}
+
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+
+	copy(dest, value)
+	return uint32(len(value)), fusefs.OK
+}
+
+// posixACLPerm converts rwx bits to POSIX ACL permission
+func posixACLPerm(mode os.FileMode) uint16 {
+	return uint16(mode & 0o7)
+}
+
+// ACLChanger is implemented by fs clients able to change ACLs
+type ACLChanger interface {
+	ChangeACL(path string, access irodsclient_types.IRODSAccessLevelType, user string, zone string) error
+}
+
+// irodsAccessLevelsFromMode returns iRODS access levels of the owner and the public group for the mode given by chmod
+// returns false if iRODS cannot represent the mode
+// - execute bits are ignored, iRODS has no execute access to data objects and collections are searchable with read
+// - write without read cannot be represented, write access of iRODS includes read
+// - owner must have read and write, the client user would lose own access needed to change ACLs back otherwise
+// - group has no iRODS counterpart as the owning group is not mapped, it must not have more than other
+func irodsAccessLevelsFromMode(mode uint32) (irodsclient_types.IRODSAccessLevelType, irodsclient_types.IRODSAccessLevelType, bool) {
+	ownerPerm := (mode >> 6) & 0o6
+	groupPerm := (mode >> 3) & 0o6
+	otherPerm := mode & 0o6
+
+	if ownerPerm != 0o6 {
+		return irodsclient_types.IRODSAccessLevelNull, irodsclient_types.IRODSAccessLevelNull, false
+	}
+
+	if groupPerm&^otherPerm != 0 {
+		return irodsclient_types.IRODSAccessLevelNull, irodsclient_types.IRODSAccessLevelNull, false
+	}
+
+	switch otherPerm {
+	case 0o6:
+		return irodsclient_types.IRODSAccessLevelOwner, irodsclient_types.IRODSAccessLevelModifyObject, true
+	case 0o4:
+		return irodsclient_types.IRODSAccessLevelOwner, irodsclient_types.IRODSAccessLevelReadObject, true
+	case 0o0:
+		return irodsclient_types.IRODSAccessLevelOwner, irodsclient_types.IRODSAccessLevelNull, true
+	default:
+		return irodsclient_types.IRODSAccessLevelNull, irodsclient_types.IRODSAccessLevelNull, false
+	}
+}
+
+// IRODSChmod applies the mode given by chmod to iRODS ACLs of the given irods path
+// other bits are granted to the public group, owner bits are kept by the own access of the client user
+func IRODSChmod(ctx context.Context, fs *IRODSFS, path string, mode uint32) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSChmod",
+	})
+
+	_, publicAccess, ok := irodsAccessLevelsFromMode(mode)
+	if !ok {
+		logger.Debugf("failed to represent mode %o of path %q in iRODS ACLs", mode&0o777, path)
+		return syscall.EOPNOTSUPP
+	}
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", path)
+		return syscall.EAGAIN
+	}
+
+	err := irodsRetry(ctx, fs, path, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		return changeACL(fsClient, path, publicAccess, irodsPublicGroupName, fs.config.Zone)
+	})
+	if err != nil {
+		if xerrors.Is(err, errACLChangeNotSupported) {
+			logger.Debugf("failed to change ACLs of path %q, the fs client cannot change ACLs", path)
+			return syscall.EOPNOTSUPP
+		}
+
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file or dir for path %q", path)
+			return syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	fs.invalidateDirAttrCache(path)
+	return fusefs.OK
+}
+
+// IRODSCopyMode carries the mode given by chmod from the source data object to the dest, e.g., for cp -p
+// the mode is kept by the access of the public group, as IRODSChmod sets
+func IRODSCopyMode(ctx context.Context, fs *IRODSFS, srcPath string, destPath string) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSCopyMode",
+	})
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("metadata operation for path %q exceeds the rate limit", destPath)
+		return syscall.EAGAIN
+	}
+
+	err := irodsRetry(ctx, fs, destPath, true, func() error {
+		fsClient, done := fs.acquireFSClient()
+		defer done()
+
+		accesses, err := fsClient.ListFileACLs(srcPath)
+		if err != nil {
+			return err
+		}
+
+		publicAccess := irodsclient_types.IRODSAccessLevelNull
+		for _, access := range accesses {
+			if access.UserType == irodsclient_types.IRODSUserRodsGroup && access.UserName == irodsPublicGroupName {
+				publicAccess = access.AccessLevel
+			}
+		}
+
+		return changeACL(fsClient, destPath, publicAccess, irodsPublicGroupName, fs.config.Zone)
+	})
+	if err != nil {
+		if xerrors.Is(err, errACLChangeNotSupported) {
+			logger.Debugf("failed to change ACLs of path %q, the fs client cannot change ACLs", destPath)
+			return syscall.EOPNOTSUPP
+		}
+
+		if irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to find file for path %q or %q", srcPath, destPath)
+			return syscall.ENOENT
+		}
+
+		logger.Errorf("%+v", err)
+		return syscall.EREMOTEIO
+	}
+
+	fs.invalidateDirAttrCache(destPath)
+	return fusefs.OK
+}
+
+// changeACL sets access of the user or group to the path, null access removes it
+func changeACL(fsClient irodsfs_common_irods.IRODSFSClient, path string, access irodsclient_types.IRODSAccessLevelType, user string, zone string) error {
+	if client, ok := extendFSClient(fsClient).(ACLChanger); ok {
+		return client.ChangeACL(path, access, user, zone)
+	}
+
+	return errACLChangeNotSupported
+}
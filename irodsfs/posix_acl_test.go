@@ -0,0 +1,212 @@
+package irodsfs
+
+import (
+	"context"
+	"encoding/binary"
+	"reflect"
+	"syscall"
+	"testing"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	fuse "github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/cyverse/irodsfs/commons"
+)
+
+// decodePosixACL decodes POSIX ACL in binary xattr format, as getfacl does
+func decodePosixACL(t *testing.T, value []byte) []posixACLEntry {
+	if len(value) < 4 || (len(value)-4)%8 != 0 {
+		t.Fatalf("invalid ACL size %d", len(value))
+	}
+
+	if version := binary.LittleEndian.Uint32(value[0:4]); version != posixACLXattrVersion {
+		t.Fatalf("expected ACL version %d, got %d", posixACLXattrVersion, version)
+	}
+
+	entries := []posixACLEntry{}
+	for offset := 4; offset < len(value); offset += 8 {
+		entries = append(entries, posixACLEntry{
+			tag:  binary.LittleEndian.Uint16(value[offset : offset+2]),
+			perm: binary.LittleEndian.Uint16(value[offset+2 : offset+4]),
+			id:   binary.LittleEndian.Uint32(value[offset+4 : offset+8]),
+		})
+	}
+	return entries
+}
+
+func TestIRODSGetPosixACLMatchesAccessList(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.PosixACL = true
+	fs.uid = 1000
+	fs.gid = 1000
+
+	filePath := "/testzone/home/testuser/shared.txt"
+	client.addFile(filePath, []byte("data"))
+	// root user and group exist locally with id 0
+	client.setACLs(filePath, []*irodsclient_types.IRODSAccess{
+		{Path: filePath, UserName: testUser, UserZone: testZone, UserType: irodsclient_types.IRODSUserRodsUser, AccessLevel: irodsclient_types.IRODSAccessLevelOwner},
+		{Path: filePath, UserName: "root", UserZone: testZone, UserType: irodsclient_types.IRODSUserRodsUser, AccessLevel: irodsclient_types.IRODSAccessLevelReadObject},
+		{Path: filePath, UserName: "root", UserZone: testZone, UserType: irodsclient_types.IRODSUserRodsGroup, AccessLevel: irodsclient_types.IRODSAccessLevelModifyObject},
+		{Path: filePath, UserName: irodsPublicGroupName, UserZone: testZone, UserType: irodsclient_types.IRODSUserRodsGroup, AccessLevel: irodsclient_types.IRODSAccessLevelReadObject},
+		// no local users
+		{Path: filePath, UserName: "nosuchuser", UserZone: testZone, UserType: irodsclient_types.IRODSUserRodsUser, AccessLevel: irodsclient_types.IRODSAccessLevelOwner},
+		{Path: filePath, UserName: "root", UserZone: "otherzone", UserType: irodsclient_types.IRODSUserRodsUser, AccessLevel: irodsclient_types.IRODSAccessLevelOwner},
+	})
+
+	dest := make([]byte, 256)
+	size, errno := IRODSGetPosixACL(context.Background(), fs, filePath, false, dest)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to get ACL - %v", errno)
+	}
+
+	// user::rwx, user:root:r-x, group::---, group:root:rwx, mask::rwx, other::r-x
+	expected := []posixACLEntry{
+		{tag: posixACLUserObj, perm: 0o7, id: posixACLUndefinedID},
+		{tag: posixACLUser, perm: 0o5, id: 0},
+		{tag: posixACLGroupObj, perm: 0, id: posixACLUndefinedID},
+		{tag: posixACLGroup, perm: 0o7, id: 0},
+		{tag: posixACLMask, perm: 0o7, id: posixACLUndefinedID},
+		{tag: posixACLOther, perm: 0o5, id: posixACLUndefinedID},
+	}
+	if entries := decodePosixACL(t, dest[:size]); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected ACL %+v, got %+v", expected, entries)
+	}
+
+	// read-only mappings drop write permission
+	size, errno = IRODSGetPosixACL(context.Background(), fs, filePath, true, dest)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to get ACL - %v", errno)
+	}
+
+	for _, entry := range decodePosixACL(t, dest[:size]) {
+		if entry.perm&0o2 != 0 {
+			t.Errorf("expected no write permission in read-only ACL, got %+v", entry)
+		}
+	}
+
+	// ERANGE with the size required
+	required, errno := IRODSGetPosixACL(context.Background(), fs, filePath, false, make([]byte, 4))
+	if errno != syscall.ERANGE || required != size {
+		t.Errorf("expected ERANGE with size %d, got %d (%v)", size, required, errno)
+	}
+}
+
+func TestPosixACLIsNotEnforced(t *testing.T) {
+	config := commons.NewDefaultConfig()
+	config.PosixACL = true
+
+	// the kernel must not check permissions with the ACL presented
+	if options := GetFuseOptions(config); options.EnableAcl {
+		t.Errorf("expected the kernel not asked to enforce POSIX ACLs")
+	}
+
+	// the ACL is read-only
+	if !IsUnhandledAttr(PosixACLAccessXattrName) {
+		t.Errorf("expected %q rejected on set", PosixACLAccessXattrName)
+	}
+}
+
+func TestIRODSAccessLevelsFromMode(t *testing.T) {
+	testCases := []struct {
+		mode   uint32
+		owner  irodsclient_types.IRODSAccessLevelType
+		public irodsclient_types.IRODSAccessLevelType
+		ok     bool
+	}{
+		{mode: 0o600, owner: irodsclient_types.IRODSAccessLevelOwner, public: irodsclient_types.IRODSAccessLevelNull, ok: true},
+		{mode: 0o700, owner: irodsclient_types.IRODSAccessLevelOwner, public: irodsclient_types.IRODSAccessLevelNull, ok: true},
+		{mode: 0o644, owner: irodsclient_types.IRODSAccessLevelOwner, public: irodsclient_types.IRODSAccessLevelReadObject, ok: true},
+		{mode: 0o755, owner: irodsclient_types.IRODSAccessLevelOwner, public: irodsclient_types.IRODSAccessLevelReadObject, ok: true},
+		{mode: 0o604, owner: irodsclient_types.IRODSAccessLevelOwner, public: irodsclient_types.IRODSAccessLevelReadObject, ok: true},
+		{mode: 0o666, owner: irodsclient_types.IRODSAccessLevelOwner, public: irodsclient_types.IRODSAccessLevelModifyObject, ok: true},
+		{mode: 0o777, owner: irodsclient_types.IRODSAccessLevelOwner, public: irodsclient_types.IRODSAccessLevelModifyObject, ok: true},
+		{mode: 0o601, owner: irodsclient_types.IRODSAccessLevelOwner, public: irodsclient_types.IRODSAccessLevelNull, ok: true},
+		// owner without read and write
+		{mode: 0o444, ok: false},
+		{mode: 0o200, ok: false},
+		{mode: 0o000, ok: false},
+		// group more than other
+		{mode: 0o640, ok: false},
+		{mode: 0o664, ok: false},
+		// write without read
+		{mode: 0o622, ok: false},
+		{mode: 0o603, ok: false},
+	}
+
+	for _, testCase := range testCases {
+		owner, public, ok := irodsAccessLevelsFromMode(testCase.mode)
+		if ok != testCase.ok {
+			t.Errorf("expected mode %o representable %t, got %t", testCase.mode, testCase.ok, ok)
+			continue
+		}
+
+		if ok && (owner != testCase.owner || public != testCase.public) {
+			t.Errorf("expected mode %o mapped to %q and %q, got %q and %q", testCase.mode, testCase.owner, testCase.public, owner, public)
+		}
+	}
+}
+
+func TestChmodChangesPublicAccess(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/chmod.txt"
+	client.addFile(filePath, []byte("data"))
+	file := NewFile(fs, 0, "/chmod.txt")
+
+	chmod := func(mode uint32) syscall.Errno {
+		in := &fuse.SetAttrIn{}
+		in.Valid = fuse.FATTR_MODE
+		in.Mode = mode
+		return file.Setattr(context.Background(), nil, in, &fuse.AttrOut{})
+	}
+
+	publicAccess := func() irodsclient_types.IRODSAccessLevelType {
+		accesses, _ := client.ListFileACLs(filePath)
+		for _, access := range accesses {
+			if access.UserName == irodsPublicGroupName {
+				return access.AccessLevel
+			}
+		}
+		return irodsclient_types.IRODSAccessLevelNull
+	}
+
+	// chmod is ignored without chmod_acl
+	if errno := chmod(0o644); errno != fusefs.OK {
+		t.Fatalf("expected chmod ignored, got errno %v", errno)
+	}
+
+	if calls := client.getCalls("ChangeACL"); calls != 0 {
+		t.Fatalf("expected no ACL change without chmod_acl, got %d", calls)
+	}
+
+	fs.config.ChmodACL = true
+
+	if errno := chmod(0o644); errno != fusefs.OK {
+		t.Fatalf("failed to chmod - %v", errno)
+	}
+
+	if access := publicAccess(); access != irodsclient_types.IRODSAccessLevelReadObject {
+		t.Errorf("expected public read access, got %q", access)
+	}
+
+	if errno := chmod(0o600); errno != fusefs.OK {
+		t.Fatalf("failed to chmod - %v", errno)
+	}
+
+	if access := publicAccess(); access != irodsclient_types.IRODSAccessLevelNull {
+		t.Errorf("expected no public access, got %q", access)
+	}
+
+	// modes iRODS cannot represent fail without changing ACLs
+	calls := client.getCalls("ChangeACL")
+	if errno := chmod(0o640); errno != syscall.EOPNOTSUPP {
+		t.Errorf("expected EOPNOTSUPP, got errno %v", errno)
+	}
+
+	if changed := client.getCalls("ChangeACL") - calls; changed != 0 {
+		t.Errorf("expected no ACL change for unsupported mode, got %d", changed)
+	}
+}
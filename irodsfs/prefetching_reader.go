@@ -0,0 +1,416 @@
+package irodsfs
+
+import (
+	"io"
+	"sync"
+
+	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
+	irodsfscommon_irods "github.com/cyverse/irodsfs-common/irods"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// size of data read from a base reader at once while transferring a block
+	prefetchReadBufferSize int = 128 * 1024
+	// the next block is fetched when a read passes this ratio of the block, with multiple base readers
+	prefetchTriggerRatio float64 = 0.3
+)
+
+var (
+	// errPrefetchingReaderReleased is returned by reads of a released PrefetchingReader
+	errPrefetchingReaderReleased = xerrors.New("prefetching reader is released")
+)
+
+// prefetchBlock is a block of a file fetched by a PrefetchingReader, fields are protected by the mutex of the reader
+type prefetchBlock struct {
+	index   int64
+	data    []byte
+	eof     bool  // data reaches the end of the file
+	started bool  // transfer is running or ran
+	done    bool  // transfer is completed or failed
+	err     error // set when transfer failed
+}
+
+// PrefetchingReader reads blocks of a file through base readers in background, and serves reads from blocks fetched
+// a read fetches the whole block it falls in, and the next block too when there are multiple base readers
+// unlike AsyncCacheThroughReader of irodsfs-common, Release stops block transfers and waits for them to exit,
+// so the reader can be released while prefetching, e.g., on seeks
+// transfers are submitted to a worker pool if given, a read runs the transfer of its block by itself if the pool has not
+type PrefetchingReader struct {
+	baseReaders      []irodsfscommon_io.Reader
+	availableReaders chan irodsfscommon_io.Reader // base readers not used by transfers, never closed
+	blockSize        int
+	size             int64
+	submit           func(task func()) bool // nil if transfers run in their own goroutines
+
+	blocks         map[int64]*prefetchBlock // block index to block fetched or being fetched
+	blockOrder     []int64                  // block indices in the order fetched
+	stop           chan struct{}            // closed on release to stop transfers
+	transferWaiter sync.WaitGroup
+	lastError      error
+	released       bool
+	mutex          sync.Mutex
+	condition      *sync.Cond // signaled when data of a block is added or its transfer ends
+}
+
+// NewPrefetchingReader creates a new PrefetchingReader fetching blocks of the block size through the base readers given
+// base readers must read the same file, they are released with the reader
+// submit queues transfers without blocking and returns false if not queued, nil runs transfers in their own goroutines
+func NewPrefetchingReader(baseReaders []irodsfscommon_io.Reader, blockSize int, submit func(task func()) bool) (*PrefetchingReader, error) {
+	if len(baseReaders) == 0 {
+		return nil, xerrors.Errorf("failed to create a prefetching reader without base readers")
+	}
+
+	if blockSize <= 0 {
+		return nil, xerrors.Errorf("failed to create a prefetching reader with block size %d", blockSize)
+	}
+
+	reader := &PrefetchingReader{
+		baseReaders:      baseReaders,
+		availableReaders: make(chan irodsfscommon_io.Reader, len(baseReaders)),
+		blockSize:        blockSize,
+		size:             baseReaders[0].GetSize(),
+		submit:           submit,
+
+		blocks:         map[int64]*prefetchBlock{},
+		blockOrder:     []int64{},
+		stop:           make(chan struct{}),
+		transferWaiter: sync.WaitGroup{},
+		lastError:      nil,
+		released:       false,
+		mutex:          sync.Mutex{},
+	}
+	reader.condition = sync.NewCond(&reader.mutex)
+
+	for _, baseReader := range baseReaders {
+		reader.availableReaders <- baseReader
+	}
+
+	return reader, nil
+}
+
+// GetFSClient returns fs client
+func (reader *PrefetchingReader) GetFSClient() irodsfscommon_irods.IRODSFSClient {
+	return reader.baseReaders[0].GetFSClient()
+}
+
+// GetPath returns path of the file
+func (reader *PrefetchingReader) GetPath() string {
+	return reader.baseReaders[0].GetPath()
+}
+
+// GetChecksum returns checksum of the file
+func (reader *PrefetchingReader) GetChecksum() string {
+	return reader.baseReaders[0].GetChecksum()
+}
+
+// GetSize returns size of the file
+func (reader *PrefetchingReader) GetSize() int64 {
+	return reader.size
+}
+
+// ReadAt reads data at the offset, waiting for blocks being fetched
+func (reader *PrefetchingReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	if len(buffer) == 0 || offset < 0 {
+		return 0, nil
+	}
+
+	if offset >= reader.size {
+		return 0, io.EOF
+	}
+
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	readLen := 0
+	for readLen < len(buffer) {
+		current := offset + int64(readLen)
+		blockIndex := current / int64(reader.blockSize)
+		blockOffset := int(current - blockIndex*int64(reader.blockSize))
+
+		block, err := reader.fetchBlock(blockIndex)
+		if err != nil {
+			return readLen, err
+		}
+
+		// wait for the data requested, or the end of the block
+		need := blockOffset + len(buffer) - readLen
+		for len(block.data) < need && !block.done && !reader.released {
+			if !block.started {
+				// the pool has not run the transfer yet, run it here instead of waiting for a worker
+				if reader.startTransfer(block) {
+					reader.mutex.Unlock()
+					reader.transferBlock(block)
+					reader.mutex.Lock()
+				}
+				continue
+			}
+
+			reader.condition.Wait()
+		}
+
+		if reader.released {
+			return readLen, errPrefetchingReaderReleased
+		}
+
+		if block.err != nil && len(block.data) <= blockOffset {
+			// the failed block is fetched again on the next read
+			reader.removeBlock(blockIndex)
+			return readLen, xerrors.Errorf("failed to read block %d of %q: %w", blockIndex, reader.GetPath(), block.err)
+		}
+
+		if blockOffset >= len(block.data) {
+			return readLen, io.EOF
+		}
+
+		copiedLen := copy(buffer[readLen:], block.data[blockOffset:])
+		readLen += copiedLen
+
+		if block.eof && blockOffset+copiedLen >= len(block.data) && readLen < len(buffer) {
+			return readLen, io.EOF
+		}
+	}
+
+	reader.prefetchNext(offset + int64(readLen) - 1)
+	return readLen, nil
+}
+
+// prefetchNext fetches the block following the offset in background if the offset passes the trigger point of its block
+// caller must hold the mutex
+func (reader *PrefetchingReader) prefetchNext(offset int64) {
+	if len(reader.baseReaders) <= 1 {
+		// the only base reader is busy with the current block
+		return
+	}
+
+	blockIndex := offset / int64(reader.blockSize)
+	blockOffset := offset - blockIndex*int64(reader.blockSize)
+	if float64(blockOffset) < float64(reader.blockSize)*prefetchTriggerRatio {
+		return
+	}
+
+	nextIndex := blockIndex + 1
+	if nextIndex*int64(reader.blockSize) >= reader.size {
+		return
+	}
+
+	reader.fetchBlock(nextIndex)
+}
+
+// fetchBlock returns the block of the index, and starts its transfer if not fetched yet
+// caller must hold the mutex
+func (reader *PrefetchingReader) fetchBlock(blockIndex int64) (*prefetchBlock, error) {
+	if reader.released {
+		return nil, errPrefetchingReaderReleased
+	}
+
+	if block, ok := reader.blocks[blockIndex]; ok {
+		return block, nil
+	}
+
+	reader.evictBlocks()
+
+	block := &prefetchBlock{
+		index:   blockIndex,
+		data:    []byte{},
+		eof:     false,
+		started: false,
+		done:    false,
+		err:     nil,
+	}
+
+	reader.blocks[blockIndex] = block
+	reader.blockOrder = append(reader.blockOrder, blockIndex)
+
+	if reader.submit == nil {
+		reader.startTransfer(block)
+		go reader.transferBlock(block)
+		return block, nil
+	}
+
+	// if the pool does not take it, the transfer is run by the read waiting for the block
+	reader.submit(func() {
+		reader.mutex.Lock()
+		// the block may be evicted or transferred by a read while queued
+		start := reader.blocks[block.index] == block && reader.startTransfer(block)
+		reader.mutex.Unlock()
+
+		if start {
+			reader.transferBlock(block)
+		}
+	})
+	return block, nil
+}
+
+// startTransfer marks the transfer of the block started, returns false if it is started already or the reader is released
+// caller must hold the mutex, and run transferBlock if true is returned
+func (reader *PrefetchingReader) startTransfer(block *prefetchBlock) bool {
+	if block.started || reader.released {
+		return false
+	}
+
+	// released is checked with the mutex held, so no transfer is added once Release waits
+	block.started = true
+	reader.transferWaiter.Add(1)
+	return true
+}
+
+// evictBlocks drops the oldest blocks transferred or not started, keeping a block per base reader, caller must hold the mutex
+// blocks being transferred are kept, they are dropped once done
+func (reader *PrefetchingReader) evictBlocks() {
+	for i := 0; i < len(reader.blockOrder) && len(reader.blockOrder) >= len(reader.baseReaders)+1; {
+		blockIndex := reader.blockOrder[i]
+		block := reader.blocks[blockIndex]
+		if block.started && !block.done {
+			i++
+			continue
+		}
+
+		reader.removeBlock(blockIndex)
+	}
+}
+
+// removeBlock drops the block of the index, caller must hold the mutex
+func (reader *PrefetchingReader) removeBlock(blockIndex int64) {
+	delete(reader.blocks, blockIndex)
+
+	for i, index := range reader.blockOrder {
+		if index == blockIndex {
+			reader.blockOrder = append(reader.blockOrder[:i], reader.blockOrder[i+1:]...)
+			return
+		}
+	}
+}
+
+// transferBlock reads data of the block through an available base reader, it exits early when the reader is released
+func (reader *PrefetchingReader) transferBlock(block *prefetchBlock) {
+	defer reader.transferWaiter.Done()
+
+	var baseReader irodsfscommon_io.Reader
+	select {
+	case baseReader = <-reader.availableReaders:
+	case <-reader.stop:
+		reader.endTransfer(block, errPrefetchingReaderReleased)
+		return
+	}
+
+	// the channel has room for all base readers, this never blocks
+	defer func() {
+		reader.availableReaders <- baseReader
+	}()
+
+	blockStart := block.index * int64(reader.blockSize)
+	blockEnd := blockStart + int64(reader.blockSize)
+	if blockEnd > reader.size {
+		blockEnd = reader.size
+	}
+
+	buffer := make([]byte, prefetchReadBufferSize)
+	current := blockStart
+	for current < blockEnd {
+		select {
+		case <-reader.stop:
+			reader.endTransfer(block, errPrefetchingReaderReleased)
+			return
+		default:
+		}
+
+		readBuffer := buffer
+		if int64(len(readBuffer)) > blockEnd-current {
+			readBuffer = buffer[:blockEnd-current]
+		}
+
+		readLen, err := baseReader.ReadAt(readBuffer, current)
+		if readLen > 0 {
+			reader.mutex.Lock()
+			block.data = append(block.data, readBuffer[:readLen]...)
+			reader.condition.Broadcast()
+			reader.mutex.Unlock()
+
+			current += int64(readLen)
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			reader.endTransfer(block, err)
+			return
+		}
+
+		if readLen == 0 {
+			// no progress, e.g., the file is truncated
+			break
+		}
+	}
+
+	reader.mutex.Lock()
+	block.eof = current >= reader.size || current < blockEnd
+	reader.mutex.Unlock()
+
+	reader.endTransfer(block, nil)
+}
+
+// endTransfer marks the transfer of the block done, failed if err is given
+func (reader *PrefetchingReader) endTransfer(block *prefetchBlock, err error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	block.done = true
+	block.err = err
+	if err != nil && err != errPrefetchingReaderReleased {
+		reader.lastError = err
+	}
+
+	reader.condition.Broadcast()
+}
+
+// GetAvailable returns the number of bytes available at the offset without fetching, -1 if the block is not fetched
+func (reader *PrefetchingReader) GetAvailable(offset int64) int64 {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	blockIndex := offset / int64(reader.blockSize)
+	block, ok := reader.blocks[blockIndex]
+	if !ok {
+		return -1
+	}
+
+	blockOffset := offset - blockIndex*int64(reader.blockSize)
+	return int64(len(block.data)) - blockOffset
+}
+
+// GetError returns the last error occurred while transferring blocks
+func (reader *PrefetchingReader) GetError() error {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+
+	return reader.lastError
+}
+
+// Release stops block transfers, waits for them to exit, and releases base readers
+func (reader *PrefetchingReader) Release() {
+	reader.mutex.Lock()
+	if reader.released {
+		reader.mutex.Unlock()
+		return
+	}
+
+	reader.released = true
+	close(reader.stop)
+	reader.condition.Broadcast()
+	reader.mutex.Unlock()
+
+	// transfers check the stop channel between reads from base readers
+	reader.transferWaiter.Wait()
+
+	reader.mutex.Lock()
+	reader.blocks = map[int64]*prefetchBlock{}
+	reader.blockOrder = []int64{}
+	reader.mutex.Unlock()
+
+	for _, baseReader := range reader.baseReaders {
+		baseReader.Release()
+	}
+}
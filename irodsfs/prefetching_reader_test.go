@@ -0,0 +1,136 @@
+package irodsfs
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+)
+
+// gatedReader reads data in memory once the gate is open, like a sync reader waiting for iRODS
+type gatedReader struct {
+	data     []byte
+	gate     chan struct{}
+	started  chan struct{}
+	active   int32
+	released int32
+}
+
+func newGatedReader(data []byte) *gatedReader {
+	return &gatedReader{
+		data:    data,
+		gate:    make(chan struct{}),
+		started: make(chan struct{}, 16),
+	}
+}
+
+func (reader *gatedReader) ReadAt(buffer []byte, offset int64) (int, error) {
+	atomic.AddInt32(&reader.active, 1)
+	defer atomic.AddInt32(&reader.active, -1)
+
+	reader.started <- struct{}{}
+	<-reader.gate
+
+	if offset >= int64(len(reader.data)) {
+		return 0, io.EOF
+	}
+	return copy(buffer, reader.data[offset:]), nil
+}
+
+func (reader *gatedReader) GetAvailable(offset int64) int64                 { return -1 }
+func (reader *gatedReader) GetFSClient() irodsfs_common_irods.IRODSFSClient { return nil }
+func (reader *gatedReader) GetPath() string                                 { return "/testzone/home/testuser/gated.txt" }
+func (reader *gatedReader) GetChecksum() string                             { return "" }
+func (reader *gatedReader) GetSize() int64                                  { return int64(len(reader.data)) }
+func (reader *gatedReader) GetError() error                                 { return nil }
+func (reader *gatedReader) Release()                                        { atomic.AddInt32(&reader.released, 1) }
+
+func TestPrefetchingReaderReadsBlocks(t *testing.T) {
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+	base := newGatedReader(data)
+	close(base.gate)
+
+	reader, err := NewPrefetchingReader([]irodsfscommon_io.Reader{base}, 8, nil)
+	if err != nil {
+		t.Fatalf("failed to create a prefetching reader - %v", err)
+	}
+
+	// reads across blocks
+	buffer := make([]byte, 12)
+	readLen, err := reader.ReadAt(buffer, 6)
+	if err != nil || readLen != len(buffer) || !bytes.Equal(buffer, data[6:18]) {
+		t.Fatalf("failed to read at 6, %d bytes %q, %v", readLen, buffer[:readLen], err)
+	}
+
+	if available := reader.GetAvailable(8); available != 8 {
+		t.Errorf("expected 8 bytes of the block fetched available, got %d", available)
+	}
+
+	// reads the last block
+	readLen, err = reader.ReadAt(buffer, 30)
+	if err != io.EOF || readLen != 6 || !bytes.Equal(buffer[:readLen], data[30:]) {
+		t.Errorf("expected %q with EOF at 30, got %q, %v", data[30:], buffer[:readLen], err)
+	}
+
+	reader.Release()
+	if base.released != 1 {
+		t.Errorf("expected the base reader released once, got %d", base.released)
+	}
+
+	if _, err := reader.ReadAt(buffer, 0); err == nil {
+		t.Errorf("expected an error reading after release")
+	}
+}
+
+func TestPrefetchingReaderReleaseWaitsForTransfers(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4)
+
+	base := newGatedReader(data)
+
+	reader, err := NewPrefetchingReader([]irodsfscommon_io.Reader{base}, 32, nil)
+	if err != nil {
+		t.Fatalf("failed to create a prefetching reader - %v", err)
+	}
+
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		reader.ReadAt(make([]byte, 4), 0)
+	}()
+
+	// a transfer is reading from the base reader
+	<-base.started
+
+	releaseDone := make(chan struct{})
+	go func() {
+		defer close(releaseDone)
+		reader.Release()
+	}()
+
+	select {
+	case <-releaseDone:
+		t.Fatalf("expected release to wait for the transfer in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(base.gate)
+
+	select {
+	case <-releaseDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("failed to release after the transfer ends")
+	}
+	<-readDone
+
+	if active := atomic.LoadInt32(&base.active); active != 0 {
+		t.Errorf("expected no read of the base reader after release, got %d", active)
+	}
+	if base.released != 1 {
+		t.Errorf("expected the base reader released once, got %d", base.released)
+	}
+}
@@ -0,0 +1,114 @@
+package irodsfs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MetadataRateLimiter limits the rate of metadata operations to protect iRODS catalog
+type MetadataRateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration // interval between operations
+	burst    time.Duration // how far the schedule can lag behind now, allows bursts within a second
+	maxWait  time.Duration // max time an operation waits for its turn
+	next     time.Time     // time the next operation is scheduled
+}
+
+// NewMetadataRateLimiter creates a new MetadataRateLimiter
+func NewMetadataRateLimiter(opsPerSec int, maxWait time.Duration) *MetadataRateLimiter {
+	interval := time.Second / time.Duration(opsPerSec)
+
+	return &MetadataRateLimiter{
+		mutex:    sync.Mutex{},
+		interval: interval,
+		burst:    time.Second - interval,
+		maxWait:  maxWait,
+		next:     time.Time{},
+	}
+}
+
+// Wait waits for the turn of an operation, returns false if it has to wait longer than max wait
+func (limiter *MetadataRateLimiter) Wait(ctx context.Context) bool {
+	limiter.mutex.Lock()
+
+	now := time.Now()
+	earliest := now.Add(-limiter.burst)
+	if limiter.next.Before(earliest) {
+		limiter.next = earliest
+	}
+
+	wait := limiter.next.Sub(now)
+	if wait > limiter.maxWait {
+		limiter.mutex.Unlock()
+		return false
+	}
+
+	limiter.next = limiter.next.Add(limiter.interval)
+	limiter.mutex.Unlock()
+
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// BandwidthLimiter limits the rate of data transfer in bytes per second, shared by file handles of the mount or of a uid
+type BandwidthLimiter struct {
+	mutex       sync.Mutex
+	bytesPerSec int64
+	burst       time.Duration // how far the schedule can lag behind now, allows bursts within a second
+	next        time.Time     // time the next transfer is scheduled
+}
+
+// NewBandwidthLimiter creates a new BandwidthLimiter
+func NewBandwidthLimiter(bytesPerSec int) *BandwidthLimiter {
+	return &BandwidthLimiter{
+		mutex:       sync.Mutex{},
+		bytesPerSec: int64(bytesPerSec),
+		burst:       time.Second,
+		next:        time.Time{},
+	}
+}
+
+// Wait waits until the given bytes can be transferred, returns false if ctx is canceled while waiting
+func (limiter *BandwidthLimiter) Wait(ctx context.Context, size int) bool {
+	if limiter == nil || size <= 0 {
+		return true
+	}
+
+	limiter.mutex.Lock()
+
+	now := time.Now()
+	earliest := now.Add(-limiter.burst)
+	if limiter.next.Before(earliest) {
+		limiter.next = earliest
+	}
+
+	wait := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(time.Duration(int64(size) * int64(time.Second) / limiter.bytesPerSec))
+	limiter.mutex.Unlock()
+
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
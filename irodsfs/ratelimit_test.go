@@ -0,0 +1,83 @@
+package irodsfs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestMetadataRateLimiter(t *testing.T) {
+	limiter := NewMetadataRateLimiter(10, 0)
+
+	// a burst within a second passes right away
+	for i := 0; i < 10; i++ {
+		if !limiter.Wait(context.Background()) {
+			t.Fatalf("expected operation %d in the burst to pass", i)
+		}
+	}
+
+	// the next has to wait, longer than max wait
+	if limiter.Wait(context.Background()) {
+		t.Errorf("expected the operation over the rate to be rejected")
+	}
+
+	limiter = NewMetadataRateLimiter(10, time.Second)
+	for i := 0; i < 10; i++ {
+		limiter.Wait(context.Background())
+	}
+
+	start := time.Now()
+	if !limiter.Wait(context.Background()) {
+		t.Errorf("expected the operation to wait for its turn")
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the operation to wait about 100ms, waited %v", elapsed)
+	}
+
+	// canceled while waiting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if limiter.Wait(ctx) {
+		t.Errorf("expected the canceled operation to be rejected")
+	}
+}
+
+func TestWaitMetadataRate(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+
+	filePath := "/testzone/home/testuser/rate.txt"
+	client.addFile(filePath, []byte("data"))
+
+	getattr := func() syscall.Errno {
+		out := fuse.AttrOut{}
+		return IRODSGetattr(context.Background(), fs, filePath, false, &out)
+	}
+
+	// unlimited by default
+	for i := 0; i < 5; i++ {
+		if errno := getattr(); errno != fusefs.OK {
+			t.Fatalf("expected no rate limit, got errno %v", errno)
+		}
+	}
+
+	fs.metadataRateLimiter = NewMetadataRateLimiter(1, 0)
+
+	if errno := getattr(); errno != fusefs.OK {
+		t.Fatalf("expected the first operation to pass, got errno %v", errno)
+	}
+
+	stats := client.getCalls("Stat")
+	if errno := getattr(); errno != syscall.EAGAIN {
+		t.Errorf("expected EAGAIN over the rate, got %v", errno)
+	}
+
+	if calls := client.getCalls("Stat"); calls != stats {
+		t.Errorf("expected no stat over the rate, got %d", calls-stats)
+	}
+}
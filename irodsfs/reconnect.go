@@ -0,0 +1,392 @@
+package irodsfs
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// keepaliveFileName is the name of the file stat in the zone for keep-alive
+	keepaliveFileName string = ".irodsfs_keepalive"
+)
+
+var (
+	// errReconnectDisabled is returned when reconnecting is disabled after authentication failure
+	errReconnectDisabled = xerrors.New("reconnecting is disabled after authentication failure")
+)
+
+// isIRODSConnectionError checks if the error is caused by a broken connection to iRODS server, e.g., the server restarts
+func isIRODSConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if irodsclient_types.IsAuthError(err) {
+		return false
+	}
+
+	// protocol errors, e.g., SYS_HEADER_READ_LEN_ERR, are retried on the same session by irodsRetry
+	return irodsclient_types.IsConnectionError(err)
+}
+
+// getSessionGeneration returns the number of reconnects so far
+func (fs *IRODSFS) getSessionGeneration() uint64 {
+	return atomic.LoadUint64(&fs.sessionGeneration)
+}
+
+// checkSession checks if the session is still valid
+func (fs *IRODSFS) checkSession() error {
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	return checkFSClient(fsClient, fs.config.Zone)
+}
+
+// checkFSClient checks if the fs client can reach iRODS server
+func checkFSClient(fsClient irodsfs_common_irods.IRODSFSClient, zone string) error {
+	zonePath := "/" + zone
+	_, err := fsClient.Stat(zonePath)
+	if err != nil {
+		return xerrors.Errorf("failed to stat %q: %w", zonePath, err)
+	}
+	return nil
+}
+
+// reconnectSession replaces fs clients with new sessions
+// generation is the session generation seen before the failure, it does nothing if others have reconnected since then
+func (fs *IRODSFS) reconnectSession(generation uint64) error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "IRODSFS",
+		"function": "reconnectSession",
+	})
+
+	fs.reconnectMutex.Lock()
+	defer fs.reconnectMutex.Unlock()
+
+	if fs.getSessionGeneration() != generation {
+		// reconnected already
+		return nil
+	}
+
+	if fs.reconnectDisabled {
+		return errReconnectDisabled
+	}
+
+	var err error
+	if fs.poolConnector != nil {
+		err = fs.reconnectPool()
+	} else {
+		err = fs.reconnectDirect()
+	}
+
+	if err != nil {
+		if irodsclient_types.IsAuthError(err) {
+			// permanent, do not retry
+			fs.reconnectDisabled = true
+			logger.Errorf("Authentication failed while reconnecting, not reconnecting anymore - %v", err)
+		}
+		return err
+	}
+
+	atomic.AddUint64(&fs.sessionGeneration, 1)
+	return nil
+}
+
+// reconnectDirect creates new go-irodsclient sessions and replaces fs clients
+func (fs *IRODSFS) reconnectDirect() error {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "IRODSFS",
+		"function": "reconnectDirect",
+	})
+
+	fsClient, err := newIRODSFSClientDirect(fs.config, fs.account, fs.fsConfig)
+	if err != nil {
+		return xerrors.Errorf("failed to create a new go-irodsclient fs client: %w", err)
+	}
+
+	err = checkFSClient(fsClient, fs.config.Zone)
+	if err != nil {
+		fsClient.Release()
+		return err
+	}
+
+	var dataFSClient irodsfs_common_irods.IRODSFSClient
+	if fs.dataFSConfig != nil {
+		dataFSClient, err = irodsfs_common_irods.NewIRODSFSClientDirect(fs.account, fs.dataFSConfig)
+		if err != nil {
+			fsClient.Release()
+			return xerrors.Errorf("failed to create a new go-irodsclient fs client for data transfer: %w", err)
+		}
+	}
+
+	fs.replaceSession(newFSSession(fsClient, dataFSClient), nil)
+
+	logger.Infof("Reconnected to iRODS server %q", fs.config.Host)
+	return nil
+}
+
+// fsSession is a set of fs clients replaced together on reconnect
+type fsSession struct {
+	fsClient     irodsfs_common_irods.IRODSFSClient
+	dataFSClient irodsfs_common_irods.IRODSFSClient // nil if data transfer shares fsClient
+	users        sync.WaitGroup                     // operations using the clients
+
+	keepaliveTerminateChan chan bool // nil if keep-alive is not sent
+	keepaliveStopOnce      sync.Once
+}
+
+// newFSSession creates a new fsSession
+func newFSSession(fsClient irodsfs_common_irods.IRODSFSClient, dataFSClient irodsfs_common_irods.IRODSFSClient) *fsSession {
+	return &fsSession{
+		fsClient:     fsClient,
+		dataFSClient: dataFSClient,
+
+		keepaliveTerminateChan: nil,
+		keepaliveStopOnce:      sync.Once{},
+	}
+}
+
+// stopKeepalive stops sending keep-alive requests on the clients
+func (session *fsSession) stopKeepalive() {
+	session.keepaliveStopOnce.Do(func() {
+		if session.keepaliveTerminateChan != nil {
+			close(session.keepaliveTerminateChan)
+		}
+	})
+}
+
+// release releases the fs clients, except the data client if it is shared with the next session
+func (session *fsSession) release(next *fsSession) {
+	session.stopKeepalive()
+
+	if session.dataFSClient != nil && (next == nil || next.dataFSClient != session.dataFSClient) {
+		session.dataFSClient.Release()
+	}
+
+	if session.fsClient != nil {
+		session.fsClient.Release()
+	}
+}
+
+// acquireSession returns the current session, done must be called when its clients are no longer used
+func (fs *IRODSFS) acquireSession() (*fsSession, func()) {
+	fs.sessionMutex.RLock()
+	defer fs.sessionMutex.RUnlock()
+
+	session := fs.session
+	session.users.Add(1)
+	return session, session.users.Done
+}
+
+// acquireFSClient returns the fs client of the current session, done must be called when the client is no longer used
+// the client stays usable until done is called even if the session is replaced by reconnecting
+func (fs *IRODSFS) acquireFSClient() (irodsfs_common_irods.IRODSFSClient, func()) {
+	session, done := fs.acquireSession()
+	return session.fsClient, done
+}
+
+// replaceSession replaces the current session with the new one
+// the old session is released in background once operations using it are done, then releaseOld is called if given
+// file handles opened on the old session fail after that, handles not yet opened on iRODS use the new session
+func (fs *IRODSFS) replaceSession(session *fsSession, releaseOld func()) {
+	fs.sessionMutex.Lock()
+	oldSession := fs.session
+	if session.dataFSClient == nil && fs.dataFSConfig != nil {
+		// keep the data transfer client if the new session does not replace it
+		session.dataFSClient = oldSession.dataFSClient
+	}
+	fs.startKeepalive(session)
+	fs.session = session
+	fs.sessionMutex.Unlock()
+
+	if fs.clockSkewChecker != nil {
+		fs.clockSkewChecker.SetFSClient(session.fsClient)
+	}
+
+	fs.replaceCacheEventHandler(oldSession.fsClient, session.fsClient)
+	if oldSession.dataFSClient != nil && oldSession.dataFSClient != session.dataFSClient {
+		fs.replaceCacheEventHandler(oldSession.dataFSClient, session.dataFSClient)
+	}
+
+	if fs.dirAttrCache != nil {
+		fs.dirAttrCache.Clear()
+	}
+
+	if fs.modifyTimeCache != nil {
+		fs.modifyTimeCache.Clear()
+	}
+
+	if fs.defaultResourceCache != nil {
+		fs.defaultResourceCache.Clear()
+	}
+
+	if fs.replicaCache != nil {
+		fs.replicaCache.Clear()
+	}
+
+	go func() {
+		oldSession.users.Wait()
+		oldSession.release(session)
+
+		if releaseOld != nil {
+			releaseOld()
+		}
+	}()
+}
+
+// replaceCacheEventHandler moves the cache event handler registered on the old client to the new client
+func (fs *IRODSFS) replaceCacheEventHandler(oldFSClient irodsfs_common_irods.IRODSFSClient, fsClient irodsfs_common_irods.IRODSFSClient) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "IRODSFS",
+		"function": "replaceCacheEventHandler",
+	})
+
+	handlerID, ok := fs.cacheEventHandlers[oldFSClient]
+	if !ok {
+		return
+	}
+
+	delete(fs.cacheEventHandlers, oldFSClient)
+	oldFSClient.RemoveCacheEventHandler(handlerID)
+
+	handlerID, err := fsClient.AddCacheEventHandler(fs.handleCacheEvent)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return
+	}
+
+	fs.cacheEventHandlers[fsClient] = handlerID
+}
+
+// startSessionMonitor checks the go-irodsclient session as often as connections are idled out, and reconnects when it is lost
+// irodsfs-pool sessions are checked by the pool monitor
+func (fs *IRODSFS) startSessionMonitor() {
+	if fs.poolConnector != nil || fs.config.ReconnectMaxRetries <= 0 || fs.config.ConnectionIdleTimeout <= 0 || fs.sessionMonitorTerminateChan != nil {
+		return
+	}
+
+	terminateChan := make(chan bool)
+	fs.sessionMonitorTerminateChan = terminateChan
+
+	go func() {
+		logger := log.WithFields(log.Fields{
+			"package":  "irodsfs",
+			"struct":   "IRODSFS",
+			"function": "startSessionMonitor",
+		})
+
+		ticker := time.NewTicker(time.Duration(fs.config.ConnectionIdleTimeout))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-terminateChan:
+				return
+			case <-ticker.C:
+			}
+
+			generation := fs.getSessionGeneration()
+
+			err := fs.checkSession()
+			if err == nil || !isIRODSConnectionError(err) {
+				continue
+			}
+
+			logger.Warnf("Lost the session on iRODS server %q, reconnecting - %v", fs.config.Host, err)
+
+			err = fs.reconnectSession(generation)
+			if err != nil {
+				logger.Errorf("%+v", err)
+			}
+		}
+	}()
+}
+
+// stopSessionMonitor stops checking the go-irodsclient session
+func (fs *IRODSFS) stopSessionMonitor() {
+	if fs.sessionMonitorTerminateChan != nil {
+		close(fs.sessionMonitorTerminateChan)
+		fs.sessionMonitorTerminateChan = nil
+	}
+}
+
+// getKeepalivePath returns the path stat for keep-alive, it does not exist and is not cached
+func getKeepalivePath(zone string) string {
+	return fmt.Sprintf("/%s/%s", zone, keepaliveFileName)
+}
+
+// startKeepalive sends requests on the clients of the session when no operation is made for the keep-alive interval
+// an idle connection of each client is kept from being dropped by NAT or firewalls, until the session is released
+func (fs *IRODSFS) startKeepalive(session *fsSession) {
+	if fs.poolConnector != nil || fs.config.ConnectionKeepaliveInterval <= 0 || session.fsClient == nil {
+		return
+	}
+
+	terminateChan := make(chan bool)
+	session.keepaliveTerminateChan = terminateChan
+
+	go func() {
+		interval := time.Duration(fs.config.ConnectionKeepaliveInterval)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-terminateChan:
+				return
+			case <-ticker.C:
+			}
+
+			lastOperationTime := time.Unix(0, atomic.LoadInt64(&fs.lastOperationTime))
+			if time.Since(lastOperationTime) < interval {
+				continue
+			}
+
+			fs.sendKeepalive(session)
+		}
+	}()
+}
+
+// sendKeepalive stats the keep-alive path once on each client of the session
+// go-irodsclient does not tell which connections are idle, and concurrent requests would open connections
+// up to the max rather than reuse idle ones, so one request is sent per client and per interval
+// only the connection taking the request is kept alive, others idle longer are left to connection_idle_timeout
+func (fs *IRODSFS) sendKeepalive(session *fsSession) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "IRODSFS",
+		"function": "sendKeepalive",
+	})
+
+	keepalivePath := getKeepalivePath(fs.config.Zone)
+
+	for _, fsClient := range []irodsfs_common_irods.IRODSFSClient{session.fsClient, session.dataFSClient} {
+		if fsClient == nil {
+			continue
+		}
+
+		_, err := fsClient.Stat(keepalivePath)
+		if err != nil && !irodsclient_types.IsFileNotFoundError(err) {
+			logger.Debugf("failed to send keep-alive - %v", err)
+		}
+	}
+}
+
+// stopKeepalive stops sending keep-alive requests on the clients of the current session
+func (fs *IRODSFS) stopKeepalive() {
+	fs.sessionMutex.RLock()
+	defer fs.sessionMutex.RUnlock()
+
+	fs.session.stopKeepalive()
+}
@@ -0,0 +1,246 @@
+package irodsfs
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_common "github.com/cyverse/go-irodsclient/irods/common"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
+)
+
+// waitFor polls the condition until it is true or the timeout expires
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return condition()
+}
+
+func TestIsIRODSConnectionError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{irodsclient_types.NewConnectionError(), true},
+		{irodsclient_types.NewAuthError(&irodsclient_types.IRODSAccount{}), false},
+		{irodsclient_types.NewFileNotFoundError("/testzone/home/testuser/a"), false},
+		// retried on the same session, the session is not dead
+		{irodsclient_types.NewIRODSError(irodsclient_common.SYS_HEADER_READ_LEN_ERR), false},
+		{irodsclient_types.NewIRODSError(irodsclient_common.SYS_HEADER_WRITE_LEN_ERR), false},
+	}
+
+	for _, test := range tests {
+		if isIRODSConnectionError(test.err) != test.expected {
+			t.Errorf("%v: expected %t", test.err, test.expected)
+		}
+	}
+}
+
+func TestReplaceSessionDrainsUsers(t *testing.T) {
+	oldClient := newFakeFSClient()
+	fs := newTestFS(oldClient)
+
+	fsClient, done := fs.acquireFSClient()
+	if fsClient != oldClient {
+		t.Fatalf("expected the old client")
+	}
+
+	newClient := newFakeFSClient()
+	released := make(chan bool, 1)
+	fs.replaceSession(newFSSession(newClient, nil), func() {
+		released <- true
+	})
+
+	// new operations use the new client
+	client, newDone := fs.acquireFSClient()
+	if client != newClient {
+		t.Errorf("expected the new client after replacing the session")
+	}
+	newDone()
+
+	// the operation in flight still works
+	_, err := fsClient.Stat("/" + testZone)
+	if err != nil {
+		t.Errorf("expected the old client usable while in use, got %v", err)
+	}
+
+	if oldClient.isReleased() {
+		t.Fatalf("released the old client while in use")
+	}
+
+	done()
+
+	if !waitFor(time.Second, oldClient.isReleased) {
+		t.Fatalf("expected the old client released once no longer used")
+	}
+
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatalf("expected releaseOld called")
+	}
+
+	if newClient.isReleased() {
+		t.Errorf("released the new client")
+	}
+}
+
+func TestReplaceSessionKeepsDataFSClient(t *testing.T) {
+	client := newFakeFSClient()
+	dataClient := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.session = newFSSession(client, dataClient)
+	fs.dataFSConfig = &irodsclient_fs.FileSystemConfig{}
+
+	newClient := newFakeFSClient()
+	fs.replaceSession(newFSSession(newClient, nil), nil)
+
+	if !waitFor(time.Second, client.isReleased) {
+		t.Fatalf("expected the old client released")
+	}
+
+	if dataClient.isReleased() {
+		t.Errorf("released the data client not replaced")
+	}
+
+	if fs.getDataFSClient(irodsclient_types.FileOpenModeReadOnly) != dataClient {
+		t.Errorf("expected the data client kept")
+	}
+}
+
+func TestReplaceSessionConcurrently(t *testing.T) {
+	fs := newTestFS(newFakeFSClient())
+
+	stop := make(chan bool)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				fsClient, done := fs.acquireFSClient()
+				_, err := fsClient.Stat("/" + testZone)
+				done()
+				if err != nil {
+					t.Errorf("operation failed while reconnecting - %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		fs.replaceSession(newFSSession(newFakeFSClient(), nil), nil)
+		time.Sleep(time.Millisecond)
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+// keepaliveFSClient records paths stat and the number of stats in flight at once
+type keepaliveFSClient struct {
+	*fakeFSClient
+
+	mutex       sync.Mutex
+	paths       []string
+	inFlight    int
+	inFlightMax int
+}
+
+func (client *keepaliveFSClient) Stat(entryPath string) (*irodsclient_fs.Entry, error) {
+	client.mutex.Lock()
+	client.paths = append(client.paths, entryPath)
+	client.inFlight++
+	if client.inFlight > client.inFlightMax {
+		client.inFlightMax = client.inFlight
+	}
+	client.mutex.Unlock()
+
+	// requests of a round overlap, like requests waiting for the server
+	time.Sleep(10 * time.Millisecond)
+
+	client.mutex.Lock()
+	client.inFlight--
+	client.mutex.Unlock()
+
+	return client.fakeFSClient.Stat(entryPath)
+}
+
+func (client *keepaliveFSClient) getPaths() []string {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return append([]string{}, client.paths...)
+}
+
+func TestKeepaliveSendsOneRequestPerClient(t *testing.T) {
+	client := &keepaliveFSClient{fakeFSClient: newFakeFSClient()}
+	dataClient := &keepaliveFSClient{fakeFSClient: newFakeFSClient()}
+	fs := newTestFS(client.fakeFSClient)
+	fs.config.ConnectionKeepaliveInterval = irodsfs_common_utils.Duration(20 * time.Millisecond)
+	fs.config.ConnectionMax = 4
+	fs.config.DataConnectionMax = 4
+	fs.lastOperationTime = 0
+
+	// keep-alive starts with the session
+	fs.replaceSession(newFSSession(client, dataClient), nil)
+	defer fs.stopKeepalive()
+
+	if !waitFor(time.Second, func() bool { return len(client.getPaths()) >= 2 && len(dataClient.getPaths()) >= 2 }) {
+		t.Fatalf("expected keep-alive sent twice on both clients, got %d and %d requests", len(client.getPaths()), len(dataClient.getPaths()))
+	}
+
+	keepalivePath := getKeepalivePath(testZone)
+	for _, path := range append(client.getPaths(), dataClient.getPaths()...) {
+		if path != keepalivePath {
+			t.Fatalf("expected keep-alive to stat %q, got %q", keepalivePath, path)
+		}
+	}
+
+	// concurrent requests would open connections up to the max
+	for _, keepaliveClient := range []*keepaliveFSClient{client, dataClient} {
+		keepaliveClient.mutex.Lock()
+		inFlightMax := keepaliveClient.inFlightMax
+		keepaliveClient.mutex.Unlock()
+
+		if inFlightMax != 1 {
+			t.Errorf("expected one keep-alive request at once, got %d", inFlightMax)
+		}
+	}
+
+	// the next session keeps its connections alive, the old one is released
+	newClient := &keepaliveFSClient{fakeFSClient: newFakeFSClient()}
+	fs.replaceSession(newFSSession(newClient, nil), nil)
+
+	if !waitFor(time.Second, client.isReleased) {
+		t.Fatalf("expected the old client released")
+	}
+
+	if !waitFor(time.Second, func() bool { return len(newClient.getPaths()) >= 2 }) {
+		t.Fatalf("expected keep-alive sent on the new session")
+	}
+
+	// wait for a round in flight
+	time.Sleep(50 * time.Millisecond)
+	sent := len(client.getPaths())
+	time.Sleep(100 * time.Millisecond)
+	if len(client.getPaths()) != sent {
+		t.Errorf("expected no keep-alive sent on the released session")
+	}
+}
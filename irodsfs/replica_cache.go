@@ -0,0 +1,89 @@
+package irodsfs
+
+import (
+	"sync"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+)
+
+// ReplicaCache retains replicas of data objects listed from the catalog, so reading replica checksums of files
+// one after another does not query the catalog every time
+type ReplicaCache struct {
+	timeout     time.Duration
+	mutex       sync.Mutex
+	entries     map[string]*replicaCacheEntry // key is data object path
+	lastCleanup time.Time
+}
+
+type replicaCacheEntry struct {
+	expireTime time.Time
+	replicas   []*irodsclient_types.IRODSReplica
+}
+
+// NewReplicaCache creates a new ReplicaCache
+func NewReplicaCache(timeout time.Duration) *ReplicaCache {
+	return &ReplicaCache{
+		timeout:     timeout,
+		mutex:       sync.Mutex{},
+		entries:     map[string]*replicaCacheEntry{},
+		lastCleanup: time.Now(),
+	}
+}
+
+// Get returns replicas cached, returns false if not cached
+func (cache *ReplicaCache) Get(path string) ([]*irodsclient_types.IRODSReplica, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cachedEntry, ok := cache.entries[path]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(cachedEntry.expireTime) {
+		delete(cache.entries, path)
+		return nil, false
+	}
+
+	return cachedEntry.replicas, true
+}
+
+// Set caches replicas of the data object
+func (cache *ReplicaCache) Set(path string, replicas []*irodsclient_types.IRODSReplica) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+
+	// clean up expired entries once in a timeout, not to scan all entries on every set
+	if now.Sub(cache.lastCleanup) > cache.timeout {
+		for cachedPath, cachedEntry := range cache.entries {
+			if now.After(cachedEntry.expireTime) {
+				delete(cache.entries, cachedPath)
+			}
+		}
+		cache.lastCleanup = now
+	}
+
+	cache.entries[path] = &replicaCacheEntry{
+		expireTime: now.Add(cache.timeout),
+		replicas:   replicas,
+	}
+}
+
+// Invalidate removes replicas cached for the path
+func (cache *ReplicaCache) Invalidate(path string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	delete(cache.entries, path)
+}
+
+// Clear clears all cached replicas
+func (cache *ReplicaCache) Clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries = map[string]*replicaCacheEntry{}
+}
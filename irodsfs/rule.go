@@ -0,0 +1,361 @@
+package irodsfs
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+
+	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	fuse "github.com/hanwen/go-fuse/v2/fuse"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// RuleDirName is the name of the control dir in the root of the mount, present with allow_rule_execution
+	RuleDirName string = ".irodsfs"
+	// RuleFileName is the name of the pseudo-file in the control dir, a rule written to it runs on close
+	RuleFileName string = "rule"
+	// RuleOutputFileName is the name of the pseudo-file in the control dir holding output of the last rule run
+	RuleOutputFileName string = "rule_output"
+
+	// ruleMaxSize is the max size of a rule body written to the rule file
+	ruleMaxSize int = 1024 * 1024
+)
+
+var (
+	// errRuleExecutionNotSupported is returned when the fs client cannot execute rules
+	errRuleExecutionNotSupported = xerrors.New("executing rules is not supported by the fs client")
+)
+
+// RuleExecutor is implemented by fs clients that can execute iRODS rules
+type RuleExecutor interface {
+	ExecuteRule(rule string) (string, error)
+}
+
+// executeRule executes the rule through the fs client, returns its output
+func executeRule(fsClient irodsfs_common_irods.IRODSFSClient, rule string) (string, error) {
+	if client, ok := extendFSClient(fsClient).(RuleExecutor); ok {
+		return client.ExecuteRule(rule)
+	}
+
+	return "", errRuleExecutionNotSupported
+}
+
+// IRODSExecuteRule executes the rule, returns its output
+// rules are not retried, they may not be idempotent
+func IRODSExecuteRule(ctx context.Context, fs *IRODSFS, rule string) (string, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"function": "IRODSExecuteRule",
+	})
+
+	if !fs.waitMetadataRate(ctx) {
+		logger.Debugf("rule execution exceeds the rate limit")
+		return "", syscall.EAGAIN
+	}
+
+	fsClient, done := fs.acquireFSClient()
+	defer done()
+
+	output, err := executeRule(fsClient, rule)
+	if err != nil {
+		if xerrors.Is(err, errRuleExecutionNotSupported) {
+			logger.Debugf("%+v", err)
+			return "", syscall.EOPNOTSUPP
+		}
+
+		logger.Errorf("%+v", err)
+		return err.Error(), syscall.EREMOTEIO
+	}
+
+	return output, fusefs.OK
+}
+
+// RuleRunner keeps output of the last rule run through the rule file of the mount
+type RuleRunner struct {
+	fs         *IRODSFS
+	output     []byte
+	modifyTime time.Time
+	mutex      sync.Mutex
+}
+
+// NewRuleRunner creates a new RuleRunner
+func NewRuleRunner(fs *IRODSFS) *RuleRunner {
+	return &RuleRunner{
+		fs:         fs,
+		output:     []byte{},
+		modifyTime: time.Now(),
+		mutex:      sync.Mutex{},
+	}
+}
+
+// Run executes the rule and keeps its output, or the error message if it fails
+func (runner *RuleRunner) Run(ctx context.Context, rule string) syscall.Errno {
+	output, errno := IRODSExecuteRule(ctx, runner.fs, rule)
+
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	runner.output = []byte(output)
+	runner.modifyTime = time.Now()
+	return errno
+}
+
+// GetOutput returns output of the last rule run and its time
+func (runner *RuleRunner) GetOutput() ([]byte, time.Time) {
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+
+	return runner.output, runner.modifyTime
+}
+
+// isRuleCallerAllowed checks if the caller is the mounting user, rules run with the iRODS account of the mount
+func isRuleCallerAllowed(ctx context.Context, fs *IRODSFS) bool {
+	callerUID, hasCaller := getCallerUID(ctx)
+	return !hasCaller || callerUID == fs.uid
+}
+
+// RuleDir is the control dir holding the rule file and its output file
+type RuleDir struct {
+	fusefs.Inode
+
+	fs *IRODSFS
+}
+
+// NewRuleDir creates a new RuleDir
+func NewRuleDir(fs *IRODSFS) *RuleDir {
+	return &RuleDir{
+		fs: fs,
+	}
+}
+
+// NewSubRuleDirInode creates an inode of the control dir under the dir
+func NewSubRuleDirInode(ctx context.Context, dir *Dir) (*RuleDir, *fusefs.Inode) {
+	ruleDir := NewRuleDir(dir.fs)
+	ruleDirInode := dir.NewInode(ctx, ruleDir, fusefs.StableAttr{
+		Mode: fuse.S_IFDIR,
+	})
+
+	return ruleDir, ruleDirInode
+}
+
+func (ruleDir *RuleDir) setAttrOut(out *fuse.Attr) {
+	now := time.Now()
+
+	out.Uid = ruleDir.fs.uid
+	out.Gid = ruleDir.fs.gid
+	out.SetTimes(&now, &now, &now)
+	out.Size = 0
+	out.Mode = uint32(fuse.S_IFDIR | 0o700)
+}
+
+// Getattr returns an attr of the control dir
+func (ruleDir *RuleDir) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ruleDir.setAttrOut(&out.Attr)
+	return fusefs.OK
+}
+
+// Lookup returns the rule file or its output file
+func (ruleDir *RuleDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+	if name != RuleFileName && name != RuleOutputFileName {
+		return nil, syscall.ENOENT
+	}
+
+	ruleFile := NewRuleFile(ruleDir.fs, name == RuleOutputFileName)
+	ruleFile.setAttrOut(&out.Attr)
+
+	ruleFileInode := ruleDir.NewInode(ctx, ruleFile, fusefs.StableAttr{
+		Mode: fuse.S_IFREG,
+	})
+	return ruleFileInode, fusefs.OK
+}
+
+// Readdir returns the rule file and its output file
+func (ruleDir *RuleDir) Readdir(ctx context.Context) (fusefs.DirStream, syscall.Errno) {
+	dirEntries := getDefaultDirEntries()
+	dirEntries = append(dirEntries, fuse.DirEntry{
+		Mode: uint32(fuse.S_IFREG),
+		Name: RuleFileName,
+	}, fuse.DirEntry{
+		Mode: uint32(fuse.S_IFREG),
+		Name: RuleOutputFileName,
+	})
+
+	return fusefs.NewListDirStream(dirEntries), fusefs.OK
+}
+
+// RuleFile is a pseudo-file in the control dir, the rule file takes rules and the output file returns their output
+type RuleFile struct {
+	fusefs.Inode
+
+	fs     *IRODSFS
+	output bool // the output file, read-only
+}
+
+// NewRuleFile creates a new RuleFile
+func NewRuleFile(fs *IRODSFS, output bool) *RuleFile {
+	return &RuleFile{
+		fs:     fs,
+		output: output,
+	}
+}
+
+func (ruleFile *RuleFile) setAttrOut(out *fuse.Attr) {
+	out.Uid = ruleFile.fs.uid
+	out.Gid = ruleFile.fs.gid
+
+	if ruleFile.output {
+		output, modifyTime := ruleFile.fs.ruleRunner.GetOutput()
+
+		out.SetTimes(&modifyTime, &modifyTime, &modifyTime)
+		out.Size = uint64(len(output))
+		out.Mode = uint32(fuse.S_IFREG | 0o400)
+		return
+	}
+
+	now := time.Now()
+
+	out.SetTimes(&now, &now, &now)
+	out.Size = 0
+	out.Mode = uint32(fuse.S_IFREG | 0o200)
+}
+
+// Getattr returns an attr of the pseudo-file
+func (ruleFile *RuleFile) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	ruleFile.setAttrOut(&out.Attr)
+	return fusefs.OK
+}
+
+// Setattr accepts truncation of the rule file, as shells truncate files they write to
+func (ruleFile *RuleFile) Setattr(ctx context.Context, fh fusefs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if ruleFile.output {
+		return syscall.EPERM
+	}
+
+	if size, ok := in.GetSize(); ok && size != 0 {
+		return syscall.EINVAL
+	}
+
+	ruleFile.setAttrOut(&out.Attr)
+	return fusefs.OK
+}
+
+// Open opens the pseudo-file, only for the mounting user
+func (ruleFile *RuleFile) Open(ctx context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "RuleFile",
+		"function": "Open",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	if !isRuleCallerAllowed(ctx, ruleFile.fs) {
+		callerUID, _ := getCallerUID(ctx)
+		logger.Warnf("denied opening the rule file for uid %d, not the mounting user", callerUID)
+		return nil, 0, syscall.EACCES
+	}
+
+	accessMode := flags & syscall.O_ACCMODE
+	if ruleFile.output && accessMode != syscall.O_RDONLY {
+		return nil, 0, syscall.EACCES
+	}
+
+	if !ruleFile.output && accessMode == syscall.O_RDONLY {
+		return nil, 0, syscall.EACCES
+	}
+
+	// output changes with every rule run, it is not cached by the kernel
+	return NewRuleFileHandle(ruleFile), fuse.FOPEN_DIRECT_IO, fusefs.OK
+}
+
+// RuleFileHandle is a file handle of a RuleFile, it buffers a rule written and runs it on flush
+type RuleFileHandle struct {
+	ruleFile *RuleFile
+	buffer   []byte
+	mutex    sync.Mutex
+}
+
+// NewRuleFileHandle creates a new RuleFileHandle
+func NewRuleFileHandle(ruleFile *RuleFile) *RuleFileHandle {
+	return &RuleFileHandle{
+		ruleFile: ruleFile,
+		buffer:   []byte{},
+		mutex:    sync.Mutex{},
+	}
+}
+
+// Read reads output of the last rule run
+func (handle *RuleFileHandle) Read(ctx context.Context, dest []byte, offset int64) (fuse.ReadResult, syscall.Errno) {
+	if !handle.ruleFile.output {
+		return nil, syscall.EBADF
+	}
+
+	output, _ := handle.ruleFile.fs.ruleRunner.GetOutput()
+	if offset >= int64(len(output)) {
+		return fuse.ReadResultData([]byte{}), fusefs.OK
+	}
+
+	end := offset + int64(len(dest))
+	if end > int64(len(output)) {
+		end = int64(len(output))
+	}
+
+	return fuse.ReadResultData(output[offset:end]), fusefs.OK
+}
+
+// Write buffers the rule written
+func (handle *RuleFileHandle) Write(ctx context.Context, data []byte, offset int64) (uint32, syscall.Errno) {
+	if handle.ruleFile.output {
+		return 0, syscall.EBADF
+	}
+
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	end := offset + int64(len(data))
+	if offset < 0 || end > int64(ruleMaxSize) {
+		return 0, syscall.EFBIG
+	}
+
+	if end > int64(len(handle.buffer)) {
+		buffer := make([]byte, end)
+		copy(buffer, handle.buffer)
+		handle.buffer = buffer
+	}
+
+	copy(handle.buffer[offset:], data)
+	return uint32(len(data)), fusefs.OK
+}
+
+// Flush runs the rule buffered, the error of the run is returned to close
+func (handle *RuleFileHandle) Flush(ctx context.Context) syscall.Errno {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "RuleFileHandle",
+		"function": "Flush",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	if handle.ruleFile.output {
+		return fusefs.OK
+	}
+
+	handle.mutex.Lock()
+	defer handle.mutex.Unlock()
+
+	if len(handle.buffer) == 0 {
+		return fusefs.OK
+	}
+
+	rule := string(handle.buffer)
+	handle.buffer = []byte{}
+
+	logger.Infof("Running a rule of %d bytes", len(rule))
+	return handle.ruleFile.fs.ruleRunner.Run(ctx, rule)
+}
@@ -0,0 +1,107 @@
+package irodsfs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	fuse "github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestRuleFileExecutesRule(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.AllowRuleExecution = true
+	fs.ruleRunner = NewRuleRunner(fs)
+
+	ctx := fuse.NewContext(context.Background(), &fuse.Caller{Owner: fuse.Owner{Uid: fs.uid, Gid: fs.gid}})
+
+	ruleFile := NewRuleFile(fs, false)
+	fh, _, errno := ruleFile.Open(ctx, syscall.O_WRONLY|syscall.O_TRUNC)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to open the rule file, %v", errno)
+	}
+
+	handle := fh.(*RuleFileHandle)
+	rule := "writeLine(\"stdout\", \"hello\")"
+	if written, errno := handle.Write(ctx, []byte(rule), 0); errno != fusefs.OK || int(written) != len(rule) {
+		t.Fatalf("failed to write the rule, %d bytes, %v", written, errno)
+	}
+
+	if errno := handle.Flush(ctx); errno != fusefs.OK {
+		t.Fatalf("failed to execute the rule, %v", errno)
+	}
+
+	// flushing again on close does not run the rule twice
+	if errno := handle.Flush(ctx); errno != fusefs.OK {
+		t.Fatalf("failed to flush, %v", errno)
+	}
+
+	if calls := client.getCalls("ExecuteRule"); calls != 1 {
+		t.Errorf("expected the rule executed once, got %d", calls)
+	}
+
+	outputFile := NewRuleFile(fs, true)
+	out := fuse.AttrOut{}
+	outputFile.Getattr(ctx, nil, &out)
+
+	expected := "executed " + rule
+	if out.Size != uint64(len(expected)) {
+		t.Errorf("expected output size %d, got %d", len(expected), out.Size)
+	}
+
+	fh, _, errno = outputFile.Open(ctx, syscall.O_RDONLY)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to open the output file, %v", errno)
+	}
+
+	result, errno := fh.(*RuleFileHandle).Read(ctx, make([]byte, 4096), 0)
+	if errno != fusefs.OK {
+		t.Fatalf("failed to read the output, %v", errno)
+	}
+
+	output, _ := result.Bytes(nil)
+	if string(output) != expected {
+		t.Errorf("expected output %q, got %q", expected, output)
+	}
+
+	// the output file is read-only
+	if _, _, errno := outputFile.Open(ctx, syscall.O_WRONLY); errno != syscall.EACCES {
+		t.Errorf("expected EACCES opening the output file for write, got %v", errno)
+	}
+}
+
+func TestRuleFileIsRestrictedToMountingUser(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.AllowRuleExecution = true
+	fs.ruleRunner = NewRuleRunner(fs)
+
+	ctx := fuse.NewContext(context.Background(), &fuse.Caller{Owner: fuse.Owner{Uid: fs.uid + 1, Gid: fs.gid}})
+
+	if _, _, errno := NewRuleFile(fs, false).Open(ctx, syscall.O_WRONLY); errno != syscall.EACCES {
+		t.Errorf("expected EACCES opening the rule file as another user, got %v", errno)
+	}
+
+	if _, _, errno := NewRuleFile(fs, true).Open(ctx, syscall.O_RDONLY); errno != syscall.EACCES {
+		t.Errorf("expected EACCES opening the output file as another user, got %v", errno)
+	}
+}
+
+func TestRuleFileWithoutRuleExecutionSupport(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.AllowRuleExecution = true
+	fs.ruleRunner = NewRuleRunner(fs)
+
+	// clients which cannot execute rules, e.g., irodsfs-pool clients, reject it
+	fs.session = newFSSession(&unitlessFSClient{IRODSFSClient: client}, nil)
+
+	handle := NewRuleFileHandle(NewRuleFile(fs, false))
+	handle.Write(context.Background(), []byte("writeLine(\"stdout\", \"hello\")"), 0)
+
+	if errno := handle.Flush(context.Background()); errno != syscall.EOPNOTSUPP {
+		t.Errorf("expected EOPNOTSUPP without rule execution support, got %v", errno)
+	}
+}
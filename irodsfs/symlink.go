@@ -0,0 +1,197 @@
+package irodsfs
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
+	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	fuse "github.com/hanwen/go-fuse/v2/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// Symlink is a symbolic link node
+// iRODS does not have symbolic links for data objects, so a symlink is an empty data object holding its target in xattr
+type Symlink struct {
+	fusefs.Inode
+
+	fs      *IRODSFS
+	inodeID uint64
+	path    string
+	mutex   sync.RWMutex
+}
+
+// NewSymlink creates a new Symlink
+func NewSymlink(fs *IRODSFS, inodeID uint64, path string) *Symlink {
+	return &Symlink{
+		fs:      fs,
+		inodeID: inodeID,
+		path:    path,
+		mutex:   sync.RWMutex{},
+	}
+}
+
+func (symlink *Symlink) getStableAttr() fusefs.StableAttr {
+	return fusefs.StableAttr{
+		Mode: fuse.S_IFLNK,
+		Ino:  symlink.inodeID,
+		Gen:  0,
+	}
+}
+
+func (symlink *Symlink) ensureIRODSPath(vpathEntry *irodsfs_common_vpath.VPathEntry) error {
+	fsClient, done := symlink.fs.acquireFSClient()
+	defer done()
+
+	return ensureVPathEntryIsIRODSEntry(fsClient, vpathEntry)
+}
+
+// getIRODSPath returns iRODS path of the symlink
+func (symlink *Symlink) getIRODSPath() (string, syscall.Errno) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "Symlink",
+		"function": "getIRODSPath",
+	})
+
+	vpathEntry := symlink.fs.vpathManager.GetClosestEntry(symlink.path)
+	if vpathEntry == nil {
+		logger.Errorf("failed to get VPath Entry for %q", symlink.path)
+		return "", syscall.EREMOTEIO
+	}
+
+	// Virtual Dir
+	if vpathEntry.IsVirtualDirEntry() {
+		logger.Errorf("failed to get symlink from a virtual dir mapping")
+		return "", syscall.EREMOTEIO
+	}
+
+	// IRODS File
+	err := symlink.ensureIRODSPath(vpathEntry)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return "", syscall.EREMOTEIO
+	}
+
+	irodsPath, err := vpathEntry.GetIRODSPath(symlink.path)
+	if err != nil {
+		logger.Errorf("%+v", err)
+		return "", syscall.EREMOTEIO
+	}
+
+	return irodsPath, fusefs.OK
+}
+
+// Getattr returns stat of symlink entry
+func (symlink *Symlink) Getattr(ctx context.Context, fh fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if symlink.fs.terminated {
+		return symlink.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "Symlink",
+		"function": "Getattr",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	operID := symlink.fs.GetNextOperationID()
+	logger.Infof("Calling Getattr (%d) - %q", operID, symlink.path)
+	defer logger.Infof("Called Getattr (%d) - %q", operID, symlink.path)
+
+	symlink.mutex.RLock()
+	defer symlink.mutex.RUnlock()
+
+	irodsPath, errno := symlink.getIRODSPath()
+	if errno != fusefs.OK {
+		return errno
+	}
+
+	errno = IRODSGetattr(ctx, symlink.fs, irodsPath, false, out)
+	if errno != fusefs.OK {
+		return errno
+	}
+
+	target, errno := irodsReadlinkCached(ctx, symlink.fs, irodsPath)
+	if errno != fusefs.OK {
+		return errno
+	}
+
+	setAttrOutForSymlink(symlink.fs.getSymlinkTarget(target), &out.Attr)
+	return fusefs.OK
+}
+
+// Readlink returns the target of the symlink
+func (symlink *Symlink) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	if symlink.fs.terminated {
+		return nil, symlink.fs.terminatedErrno
+	}
+
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "Symlink",
+		"function": "Readlink",
+	})
+
+	defer irodsfs_common_utils.StackTraceFromPanic(logger)
+
+	operID := symlink.fs.GetNextOperationID()
+	logger.Infof("Calling Readlink (%d) - %q", operID, symlink.path)
+	defer logger.Infof("Called Readlink (%d) - %q", operID, symlink.path)
+
+	symlink.mutex.RLock()
+	defer symlink.mutex.RUnlock()
+
+	irodsPath, errno := symlink.getIRODSPath()
+	if errno != fusefs.OK {
+		return nil, errno
+	}
+
+	target, errno := irodsReadlinkCached(ctx, symlink.fs, irodsPath)
+	if errno != fusefs.OK {
+		return nil, errno
+	}
+
+	return symlink.fs.getSymlinkTarget(target), fusefs.OK
+}
+
+// getSymlinkTarget returns the target of the symlink for the kernel to follow
+// with resolve_softlinks, absolute targets of iRODS paths mapped are translated to paths in the mount, so they resolve in the mount
+func (fs *IRODSFS) getSymlinkTarget(target []byte) []byte {
+	targetPath := string(target)
+	if !fs.config.ResolveSoftlinks || !path.IsAbs(targetPath) {
+		return target
+	}
+
+	mountPath := path.Clean(fs.config.MountPath)
+	targetPath = path.Clean(targetPath)
+	if mountPath == "/" || targetPath == mountPath || strings.HasPrefix(targetPath, mountPath+"/") {
+		// already in the mount
+		return target
+	}
+
+	// the most specific mapping wins
+	var mappingFound *irodsfs_common_vpath.VPathMapping
+	for idx := range fs.pathMappings {
+		mapping := &fs.pathMappings[idx]
+		if targetPath != mapping.IRODSPath && !strings.HasPrefix(targetPath, strings.TrimSuffix(mapping.IRODSPath, "/")+"/") {
+			continue
+		}
+
+		if mappingFound == nil || len(mapping.IRODSPath) > len(mappingFound.IRODSPath) {
+			mappingFound = mapping
+		}
+	}
+
+	if mappingFound == nil {
+		return target
+	}
+
+	relPath := strings.TrimPrefix(strings.TrimPrefix(targetPath, mappingFound.IRODSPath), "/")
+	return []byte(path.Join(mountPath, mappingFound.MappingPath, relPath))
+}
@@ -0,0 +1,120 @@
+package irodsfs
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+func TestGetSymlinkTarget(t *testing.T) {
+	fs := newTestFS(newFakeFSClient())
+	fs.config.MountPath = "/mnt/irods"
+	fs.config.ResolveSoftlinks = true
+	fs.pathMappings = []irodsfs_common_vpath.VPathMapping{
+		{IRODSPath: "/testzone/home/testuser", MappingPath: "/"},
+		{IRODSPath: "/testzone/home/shared", MappingPath: "/shared"},
+	}
+
+	tests := []struct {
+		target   string
+		expected string
+	}{
+		// relative targets resolve from the dir of the symlink
+		{"a.txt", "a.txt"},
+		{"../b/a.txt", "../b/a.txt"},
+		// already in the mount
+		{"/mnt/irods/a.txt", "/mnt/irods/a.txt"},
+		// iRODS paths mapped
+		{"/testzone/home/testuser/a.txt", "/mnt/irods/a.txt"},
+		{"/testzone/home/testuser", "/mnt/irods"},
+		{"/testzone/home/shared/dir/a.txt", "/mnt/irods/shared/dir/a.txt"},
+		// not a child of a mapping
+		{"/testzone/home/testuser2/a.txt", "/testzone/home/testuser2/a.txt"},
+		// not mapped
+		{"/etc/hosts", "/etc/hosts"},
+	}
+
+	for _, test := range tests {
+		target := string(fs.getSymlinkTarget([]byte(test.target)))
+		if target != test.expected {
+			t.Errorf("target %q: expected %q, got %q", test.target, test.expected, target)
+		}
+	}
+
+	fs.config.ResolveSoftlinks = false
+	target := string(fs.getSymlinkTarget([]byte("/testzone/home/testuser/a.txt")))
+	if target != "/testzone/home/testuser/a.txt" {
+		t.Errorf("expected the target unchanged without resolve_softlinks, got %q", target)
+	}
+}
+
+func TestIRODSReaddirReportsSymlinks(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.EnableSymlink = true
+	fs.config.DirAttrPrefetch = true
+	fs.dirAttrCache = NewDirAttrCache(time.Minute)
+
+	dirPath := "/testzone/home/testuser/dir"
+	client.addDir(dirPath)
+	client.addDir(dirPath + "/subdir")
+	client.addFile(dirPath+"/data.txt", []byte("data"))
+	client.addFile(dirPath+"/empty.txt", []byte{})
+	client.addFile(dirPath+"/link", []byte{})
+	client.SetXattr(dirPath+"/link", SymlinkTargetXattrName, "data.txt")
+
+	readdir := func(expected map[string]uint32) {
+		dirEntries, errno := IRODSReaddir(context.Background(), fs, dirPath)
+		if errno != fusefs.OK {
+			t.Fatalf("failed to list, errno %v", errno)
+		}
+
+		for _, dirEntry := range dirEntries {
+			if dirEntry.Mode != expected[dirEntry.Name] {
+				t.Errorf("%q: expected mode %o, got %o", dirEntry.Name, expected[dirEntry.Name], dirEntry.Mode)
+			}
+		}
+	}
+
+	// empty data objects may be symlinks, their types are unknown until looked up
+	readdir(map[string]uint32{
+		"subdir":    fuse.S_IFDIR,
+		"data.txt":  fuse.S_IFREG,
+		"empty.txt": 0,
+		"link":      0,
+	})
+
+	if calls := client.getCalls("GetXattr"); calls != 0 {
+		t.Errorf("expected no targets asked while listing, got %d", calls)
+	}
+
+	// lookups following the listing ask for targets once
+	for i := 0; i < 2; i++ {
+		target, errno := irodsReadlinkCached(context.Background(), fs, dirPath+"/link")
+		if errno != fusefs.OK || string(target) != "data.txt" {
+			t.Errorf("expected target %q, got %q, errno %v", "data.txt", target, errno)
+		}
+
+		_, errno = irodsReadlinkCached(context.Background(), fs, dirPath+"/empty.txt")
+		if errno != syscall.ENOENT {
+			t.Errorf("expected an empty file not a symlink, got errno %v", errno)
+		}
+	}
+
+	if calls := client.getCalls("GetXattr"); calls != 2 {
+		t.Errorf("expected targets of 2 empty data objects asked, got %d", calls)
+	}
+
+	// listings of the dir cached report types resolved
+	readdir(map[string]uint32{
+		"subdir":    fuse.S_IFDIR,
+		"data.txt":  fuse.S_IFREG,
+		"empty.txt": fuse.S_IFREG,
+		"link":      fuse.S_IFLNK,
+	})
+}
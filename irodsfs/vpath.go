@@ -1,8 +1,14 @@
 package irodsfs
 
 import (
+	"path"
+	"sort"
+
 	irodsclient_fs "github.com/cyverse/go-irodsclient/fs"
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	irodsfs_common_inode "github.com/cyverse/irodsfs-common/inode"
 	irodsfs_common_irods "github.com/cyverse/irodsfs-common/irods"
+	irodsfs_common_utils "github.com/cyverse/irodsfs-common/utils"
 	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
 	"golang.org/x/xerrors"
 )
@@ -47,3 +53,87 @@ func isVPathEntryUnmodifiable(vpathEntry *irodsfs_common_vpath.VPathEntry, targe
 
 	return false
 }
+
+// resolveDataObjectPathMapping returns a file mapping if the dir mapping points to a data object
+// a data object mapped to the mount root is presented as a file with the same name under the root, as the root must be a dir
+func resolveDataObjectPathMapping(fsClient irodsfs_common_irods.IRODSFSClient, mapping irodsfs_common_vpath.VPathMapping) (irodsfs_common_vpath.VPathMapping, error) {
+	if mapping.ResourceType != irodsfs_common_vpath.VPathMappingDirectory {
+		return mapping, nil
+	}
+
+	entry, err := fsClient.Stat(mapping.IRODSPath)
+	if err != nil {
+		if irodsclient_types.IsFileNotFoundError(err) {
+			if mapping.CreateDir || mapping.IgnoreNotExistError {
+				return mapping, nil
+			}
+
+			return mapping, xerrors.Errorf("failed to find %q to mount: %w", mapping.IRODSPath, err)
+		}
+
+		// leave it to the vpath manager
+		return mapping, nil
+	}
+
+	if entry.IsDir() {
+		return mapping, nil
+	}
+
+	fileMapping := mapping
+	fileMapping.ResourceType = irodsfs_common_vpath.VPathMappingFile
+	fileMapping.CreateDir = false
+	if mapping.MappingPath == "/" {
+		fileMapping.MappingPath = path.Join("/", path.Base(mapping.IRODSPath))
+	}
+
+	return fileMapping, nil
+}
+
+// resolveDataObjectPathMappings returns path mappings having dir mappings pointing to data objects replaced with file mappings
+func resolveDataObjectPathMappings(fsClient irodsfs_common_irods.IRODSFSClient, mappings []irodsfs_common_vpath.VPathMapping) ([]irodsfs_common_vpath.VPathMapping, error) {
+	resolvedMappings := make([]irodsfs_common_vpath.VPathMapping, 0, len(mappings))
+	for _, mapping := range mappings {
+		resolvedMapping, err := resolveDataObjectPathMapping(fsClient, mapping)
+		if err != nil {
+			return nil, err
+		}
+
+		resolvedMappings = append(resolvedMappings, resolvedMapping)
+	}
+
+	return resolvedMappings, nil
+}
+
+// newVPathManager creates a vpath manager for the path mappings, mappings nested in others are built first
+// the vpath manager cannot place a mapping under an iRODS dir built already, so a nested mapping makes virtual dirs
+// which the mappings containing it replace later, the replaced virtual dirs are removed from their parent dirs
+func newVPathManager(fsClient irodsfs_common_irods.IRODSFSClient, inodeManager *irodsfs_common_inode.InodeManager, mappings []irodsfs_common_vpath.VPathMapping) (*irodsfs_common_vpath.VPathManager, error) {
+	sortedMappings := append([]irodsfs_common_vpath.VPathMapping{}, mappings...)
+	sort.SliceStable(sortedMappings, func(i int, j int) bool {
+		return len(irodsfs_common_utils.GetParentDirs(sortedMappings[i].MappingPath)) > len(irodsfs_common_utils.GetParentDirs(sortedMappings[j].MappingPath))
+	})
+
+	vpathManager, err := irodsfs_common_vpath.NewVPathManager(fsClient, inodeManager, sortedMappings)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mapping := range sortedMappings {
+		for _, parentDir := range irodsfs_common_utils.GetParentDirs(mapping.MappingPath) {
+			parentEntry := vpathManager.GetEntry(parentDir)
+			if parentEntry == nil || !parentEntry.IsVirtualDirEntry() {
+				continue
+			}
+
+			dirEntries := []*irodsfs_common_vpath.VPathEntry{}
+			for _, dirEntry := range parentEntry.VirtualDirEntry.DirEntries {
+				if vpathManager.GetEntry(dirEntry.Path) == dirEntry {
+					dirEntries = append(dirEntries, dirEntry)
+				}
+			}
+			parentEntry.VirtualDirEntry.DirEntries = dirEntries
+		}
+	}
+
+	return vpathManager, nil
+}
@@ -0,0 +1,128 @@
+package irodsfs
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	irodsfs_common_vpath "github.com/cyverse/irodsfs-common/vpath"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+)
+
+// newOverlayTestFS creates a file system with a mapping nested in an iRODS dir mapping, /data/sub in /data
+func newOverlayTestFS(t *testing.T, client *fakeFSClient) *IRODSFS {
+	client.addDir("/testzone/home/testuser/data")
+	client.addFile("/testzone/home/testuser/data/file.txt", []byte("data"))
+	client.addDir("/testzone/home/testuser/data/sub")
+	client.addDir("/testzone/home/otheruser/shared")
+
+	// the outer mapping comes first
+	mappings := []irodsfs_common_vpath.VPathMapping{
+		{
+			IRODSPath:    "/testzone/home/testuser/data",
+			MappingPath:  "/data",
+			ResourceType: irodsfs_common_vpath.VPathMappingDirectory,
+		},
+		{
+			IRODSPath:    "/testzone/home/otheruser/shared",
+			MappingPath:  "/data/sub",
+			ResourceType: irodsfs_common_vpath.VPathMappingDirectory,
+		},
+	}
+
+	fs := newTestFS(client)
+	vpathManager, err := newVPathManager(client, fs.inodeManager, mappings)
+	if err != nil {
+		t.Fatalf("failed to build nested mappings - %v", err)
+	}
+
+	fs.vpathManager = vpathManager
+	fs.pathMappings = mappings
+	return fs
+}
+
+// readdirNames returns names of entries listed in the dir, except . and ..
+func readdirNames(t *testing.T, dir *Dir) map[string]uint64 {
+	stream, errno := dir.Readdir(context.Background())
+	if errno != fusefs.OK {
+		t.Fatalf("failed to list %q - %v", dir.path, errno)
+	}
+	defer stream.Close()
+
+	names := map[string]uint64{}
+	for stream.HasNext() {
+		entry, errno := stream.Next()
+		if errno != fusefs.OK {
+			t.Fatalf("failed to list %q - %v", dir.path, errno)
+		}
+
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+
+		if _, ok := names[entry.Name]; ok {
+			t.Errorf("expected %q listed once in %q", entry.Name, dir.path)
+		}
+		names[entry.Name] = entry.Ino
+	}
+	return names
+}
+
+func TestNewVPathManagerNestedMappings(t *testing.T) {
+	client := newFakeFSClient()
+	fs := newOverlayTestFS(t, client)
+
+	dataEntry := fs.vpathManager.GetEntry("/data")
+	if dataEntry == nil || !dataEntry.IsIRODSEntry() {
+		t.Fatalf("expected /data mapped to the iRODS dir, got %+v", dataEntry)
+	}
+
+	subEntry := fs.vpathManager.GetClosestEntry("/data/sub")
+	if subEntry == nil || subEntry.Path != "/data/sub" || subEntry.IRODSPath != "/testzone/home/otheruser/shared" {
+		t.Fatalf("expected /data/sub mapped to the nested mapping, got %+v", subEntry)
+	}
+
+	// the virtual dir made for the nested mapping is replaced by the outer mapping
+	names := readdirNames(t, NewDir(fs, 1, "/"))
+	if len(names) != 1 {
+		t.Errorf("expected only data listed in the root, got %v", names)
+	}
+}
+
+func TestReaddirOverlayMappings(t *testing.T) {
+	testCases := []struct {
+		name    string
+		overlay bool
+		shared  bool
+	}{
+		{"without overlay", false, false},
+		{"with overlay", true, true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := newFakeFSClient()
+			fs := newOverlayTestFS(t, client)
+			fs.config.OverlayMappings = testCase.overlay
+
+			names := readdirNames(t, NewDir(fs, 2, "/data"))
+
+			listed := []string{}
+			for name := range names {
+				listed = append(listed, name)
+			}
+			sort.Strings(listed)
+
+			if len(listed) != 2 || listed[0] != "file.txt" || listed[1] != "sub" {
+				t.Fatalf("expected file.txt and sub listed, got %v", listed)
+			}
+
+			// the nested mapping hides the iRODS dir with the same name, as lookup resolves it to the mapping
+			sharedEntry := fs.vpathManager.GetEntry("/data/sub")
+			sharedInode := fs.getInodeIDForIRODSEntry(sharedEntry.IRODSEntry.ID, sharedEntry.IRODSEntry.Path)
+			if shared := names["sub"] == sharedInode; shared != testCase.shared {
+				t.Errorf("expected sub listed from the nested mapping %t, got %t", testCase.shared, shared)
+			}
+		})
+	}
+}
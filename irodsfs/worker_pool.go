@@ -0,0 +1,199 @@
+package irodsfs
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WorkerPool runs background I/O tasks of all file handles with a fixed number of goroutines
+// tasks submitted wait in a queue when all workers are busy, so goroutines do not grow with the number of handles
+// tasks overflowing the queue are not accepted, so submitting never blocks FUSE operations
+type WorkerPool struct {
+	workers   int
+	tasks     chan func()
+	busy      int64
+	waitGroup sync.WaitGroup
+	stopped   bool // tasks are not accepted once stopped
+	mutex     sync.Mutex
+}
+
+// NewWorkerPool creates a new WorkerPool and starts workers
+func NewWorkerPool(workers int, queueSize int) *WorkerPool {
+	pool := &WorkerPool{
+		workers:   workers,
+		tasks:     make(chan func(), queueSize),
+		busy:      0,
+		waitGroup: sync.WaitGroup{},
+		stopped:   false,
+		mutex:     sync.Mutex{},
+	}
+
+	for i := 0; i < workers; i++ {
+		pool.waitGroup.Add(1)
+		go pool.work()
+	}
+
+	return pool
+}
+
+func (pool *WorkerPool) work() {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "WorkerPool",
+		"function": "work",
+	})
+
+	defer pool.waitGroup.Done()
+
+	for task := range pool.tasks {
+		atomic.AddInt64(&pool.busy, 1)
+		func() {
+			defer atomic.AddInt64(&pool.busy, -1)
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Errorf("recovered from panic in I/O task - %v", r)
+				}
+			}()
+
+			task()
+		}()
+	}
+}
+
+// Submit queues a task without blocking
+// returns false if the queue is full or the pool is stopped, the caller runs the task by itself then
+func (pool *WorkerPool) Submit(task func()) bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.stopped {
+		return false
+	}
+
+	select {
+	case pool.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop stops workers after running tasks queued
+func (pool *WorkerPool) Stop() {
+	pool.mutex.Lock()
+	if pool.stopped {
+		pool.mutex.Unlock()
+		return
+	}
+	pool.stopped = true
+	close(pool.tasks)
+	pool.mutex.Unlock()
+
+	pool.waitGroup.Wait()
+}
+
+// GetWorkers returns the number of workers
+func (pool *WorkerPool) GetWorkers() int {
+	return pool.workers
+}
+
+// GetBusy returns the number of workers running tasks
+func (pool *WorkerPool) GetBusy() int {
+	return int(atomic.LoadInt64(&pool.busy))
+}
+
+// GetQueued returns the number of tasks waiting for workers
+func (pool *WorkerPool) GetQueued() int {
+	return len(pool.tasks)
+}
+
+// WriteBackFlusher flushes dirty data of all write-back writers periodically from a single goroutine
+type WriteBackFlusher struct {
+	fs            *IRODSFS
+	writers       map[*WriteBackWriter]bool
+	mutex         sync.Mutex
+	terminateChan chan bool
+}
+
+// NewWriteBackFlusher creates a new WriteBackFlusher
+func NewWriteBackFlusher(fs *IRODSFS) *WriteBackFlusher {
+	return &WriteBackFlusher{
+		fs:            fs,
+		writers:       map[*WriteBackWriter]bool{},
+		mutex:         sync.Mutex{},
+		terminateChan: nil,
+	}
+}
+
+// Add registers a writer to flush periodically
+func (flusher *WriteBackFlusher) Add(writer *WriteBackWriter) {
+	flusher.mutex.Lock()
+	defer flusher.mutex.Unlock()
+
+	flusher.writers[writer] = true
+}
+
+// Remove unregisters a writer
+func (flusher *WriteBackFlusher) Remove(writer *WriteBackWriter) {
+	flusher.mutex.Lock()
+	defer flusher.mutex.Unlock()
+
+	delete(flusher.writers, writer)
+}
+
+// Start flushes writers registered periodically
+func (flusher *WriteBackFlusher) Start(interval time.Duration) {
+	if interval <= 0 || flusher.terminateChan != nil {
+		return
+	}
+
+	terminateChan := make(chan bool)
+	flusher.terminateChan = terminateChan
+
+	go func() {
+		logger := log.WithFields(log.Fields{
+			"package":  "irodsfs",
+			"struct":   "WriteBackFlusher",
+			"function": "Start",
+		})
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-terminateChan:
+				return
+			case <-ticker.C:
+				flusher.mutex.Lock()
+				writers := make([]*WriteBackWriter, 0, len(flusher.writers))
+				for writer := range flusher.writers {
+					writers = append(writers, writer)
+				}
+				flusher.mutex.Unlock()
+
+				for _, writer := range writers {
+					writer := writer
+					flusher.fs.runAsync(func() {
+						err := writer.FlushDirty()
+						if err != nil {
+							// GetError reports it
+							logger.Errorf("%+v", err)
+						}
+					})
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops flushing
+func (flusher *WriteBackFlusher) Stop() {
+	if flusher.terminateChan != nil {
+		close(flusher.terminateChan)
+		flusher.terminateChan = nil
+	}
+}
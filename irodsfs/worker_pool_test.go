@@ -0,0 +1,228 @@
+package irodsfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+)
+
+func TestWorkerPoolRunsTasks(t *testing.T) {
+	pool := NewWorkerPool(2, 8)
+
+	var done int64
+	for i := 0; i < 8; i++ {
+		if !pool.Submit(func() { atomic.AddInt64(&done, 1) }) {
+			t.Fatalf("expected the task queued")
+		}
+	}
+
+	pool.Stop()
+
+	if atomic.LoadInt64(&done) != 8 {
+		t.Errorf("expected tasks queued run before stopping, %d run", done)
+	}
+}
+
+func TestWorkerPoolSubmitDoesNotBlockWhenFull(t *testing.T) {
+	pool := NewWorkerPool(1, 1)
+	defer pool.Stop()
+
+	block := make(chan bool)
+	defer close(block)
+
+	started := make(chan bool)
+	pool.Submit(func() {
+		close(started)
+		<-block
+	})
+	<-started
+
+	// fills the queue
+	pool.Submit(func() {})
+
+	submitted := make(chan bool)
+	go func() {
+		submitted <- pool.Submit(func() {})
+	}()
+
+	select {
+	case ok := <-submitted:
+		if ok {
+			t.Errorf("expected the task rejected when the queue is full")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("submit blocked on a full queue")
+	}
+}
+
+func TestWorkerPoolSubmitWhileStopping(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		pool := NewWorkerPool(2, 4)
+
+		wg := sync.WaitGroup{}
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for k := 0; k < 100; k++ {
+					// must not panic sending on the closed queue
+					pool.Submit(func() {})
+				}
+			}()
+		}
+
+		pool.Stop()
+		wg.Wait()
+
+		if pool.Submit(func() {}) {
+			t.Fatalf("expected the task rejected after stopping")
+		}
+	}
+}
+
+func TestRunAsyncAfterWorkerPoolStopped(t *testing.T) {
+	fs := newTestFS(newFakeFSClient())
+	fs.ioWorkerPool = NewWorkerPool(1, 1)
+	fs.ioWorkerPool.Stop()
+
+	ran := make(chan bool)
+	fs.runAsync(func() { close(ran) })
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the task run in the caller")
+	}
+}
+
+func TestWorkerPoolBoundsGoroutinesOfManyHandles(t *testing.T) {
+	const handles = 200
+	const workers = 4
+
+	client := newFakeFSClient()
+	fs := newTestFS(client)
+	fs.config.IOBlockSize = 1024
+	fs.config.IOWorkersMax = workers
+	fs.ioWorkerPool = NewWorkerPool(workers, workers*ioWorkerQueueSizePerWorker)
+	defer fs.ioWorkerPool.Stop()
+
+	baseline := runtime.NumGoroutine()
+
+	data := bytes.Repeat([]byte("a"), fs.config.IOBlockSize)
+	writeHandles := []*FileHandle{}
+	readHandles := []*FileHandle{}
+	for i := 0; i < handles; i++ {
+		for _, openMode := range []irodsclient_types.FileOpenMode{irodsclient_types.FileOpenModeWriteOnly, irodsclient_types.FileOpenModeReadOnly} {
+			filePath := fmt.Sprintf("/testzone/home/testuser/%s%d", openMode, i)
+			client.addFile(filePath, data)
+
+			handle, err := NewFileHandleLazy(fs, filePath, openMode)
+			if err != nil {
+				t.Fatalf("failed to create a file handle - %v", err)
+			}
+			handle.SetFile(NewFile(fs, 0, filePath))
+
+			if openMode.IsReadOnly() {
+				readHandles = append(readHandles, handle)
+			} else {
+				writeHandles = append(writeHandles, handle)
+			}
+		}
+	}
+
+	// transfers are stuck until the gate is closed
+	gate := make(chan struct{})
+	client.mutex.Lock()
+	client.dataGate = gate
+	client.mutex.Unlock()
+
+	// a goroutine per request stands for FUSE serving requests of all handles at once
+	var running int64
+	requests := sync.WaitGroup{}
+	request := func(fn func() syscall.Errno) {
+		atomic.AddInt64(&running, 1)
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			defer atomic.AddInt64(&running, -1)
+
+			if errno := fn(); errno != fusefs.OK {
+				t.Errorf("failed to serve a request, errno %v", errno)
+			}
+		}()
+	}
+
+	waitFor := func(what string, cond func() bool) {
+		deadline := time.Now().Add(10 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	checkGoroutines := func() {
+		// the runtime and the test may start a few
+		const slack = 10
+
+		goroutines := runtime.NumGoroutine()
+		if limit := baseline + int(atomic.LoadInt64(&running)) + slack; goroutines > limit {
+			t.Errorf("expected goroutines bounded by requests being served, %d running, limit %d", goroutines, limit)
+		}
+	}
+
+	for _, handle := range writeHandles {
+		handle := handle
+		request(func() syscall.Errno {
+			_, errno := handle.Write(context.Background(), data, 0)
+			return errno
+		})
+	}
+
+	// each write is stuck at the gate, in a worker or in the request, or waits in the queue
+	waitFor("writes", func() bool {
+		return atomic.LoadInt64(&client.dataWaiting)+int64(fs.ioWorkerPool.GetQueued()) >= handles
+	})
+	checkGoroutines()
+
+	writesWaiting := atomic.LoadInt64(&client.dataWaiting)
+	for _, handle := range readHandles {
+		handle := handle
+		request(func() syscall.Errno {
+			_, errno := handle.Read(context.Background(), make([]byte, len(data)), 0)
+			return errno
+		})
+	}
+
+	// workers are stuck with writes, so each read transfers its block by itself
+	waitFor("reads", func() bool {
+		return atomic.LoadInt64(&client.dataWaiting) >= writesWaiting+handles
+	})
+	checkGoroutines()
+
+	close(gate)
+	requests.Wait()
+
+	for _, handle := range append(writeHandles, readHandles...) {
+		if errno := handle.Release(context.Background()); errno != fusefs.OK {
+			t.Errorf("failed to release %q, errno %v", handle.path, errno)
+		}
+	}
+
+	for _, handle := range writeHandles {
+		if written := client.getData(handle.path); !bytes.Equal(written, data) {
+			t.Errorf("expected data of %q written, got %d bytes", handle.path, len(written))
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package irodsfs
+
+import (
+	"sync"
+	"time"
+
+	irodsfscommon_io "github.com/cyverse/irodsfs-common/io"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/xerrors"
+)
+
+// WriteBackWriter coalesces small writes in memory and passes them to the underlying writer
+// dirty data is flushed when it exceeds maxDirty, when flushInterval passes, or on Flush/Release
+type WriteBackWriter struct {
+	irodsfscommon_io.Writer
+
+	maxDirty      int
+	dirtyOffset   int64
+	dirty         []byte
+	lastError     error
+	mutex         sync.Mutex
+	terminateChan chan bool
+	terminateWait sync.WaitGroup
+	flusher       *WriteBackFlusher // flushes periodically instead of a goroutine per writer if set
+}
+
+// NewWriteBackWriter creates a new WriteBackWriter
+func NewWriteBackWriter(writer irodsfscommon_io.Writer, maxDirty int, flushInterval time.Duration) *WriteBackWriter {
+	writeBackWriter := &WriteBackWriter{
+		Writer: writer,
+
+		maxDirty:      maxDirty,
+		dirtyOffset:   0,
+		dirty:         make([]byte, 0, maxDirty),
+		lastError:     nil,
+		mutex:         sync.Mutex{},
+		terminateChan: make(chan bool),
+		terminateWait: sync.WaitGroup{},
+		flusher:       nil,
+	}
+
+	if flushInterval > 0 {
+		writeBackWriter.terminateWait.Add(1)
+		go writeBackWriter.flushPeriodically(flushInterval)
+	}
+
+	return writeBackWriter
+}
+
+// NewSharedWriteBackWriter creates a new WriteBackWriter flushed periodically by the given flusher
+func NewSharedWriteBackWriter(writer irodsfscommon_io.Writer, maxDirty int, flusher *WriteBackFlusher) *WriteBackWriter {
+	writeBackWriter := NewWriteBackWriter(writer, maxDirty, 0)
+	writeBackWriter.flusher = flusher
+	flusher.Add(writeBackWriter)
+
+	return writeBackWriter
+}
+
+func (writer *WriteBackWriter) flushPeriodically(flushInterval time.Duration) {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "WriteBackWriter",
+		"function": "flushPeriodically",
+	})
+
+	defer writer.terminateWait.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-writer.terminateChan:
+			return
+		case <-ticker.C:
+			err := writer.FlushDirty()
+			if err != nil {
+				// GetError reports it
+				logger.Errorf("%+v", err)
+			}
+		}
+	}
+}
+
+// FlushDirty passes dirty data to the underlying writer without flushing it
+func (writer *WriteBackWriter) FlushDirty() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return writer.flushDirty()
+}
+
+// flushDirty passes dirty data to the underlying writer, caller must hold the mutex
+func (writer *WriteBackWriter) flushDirty() error {
+	if len(writer.dirty) == 0 {
+		return nil
+	}
+
+	// the underlying writer may hold the data asynchronously, use a new buffer
+	dirty := writer.dirty
+	writer.dirty = make([]byte, 0, writer.maxDirty)
+
+	_, err := writer.Writer.WriteAt(dirty, writer.dirtyOffset)
+	if err != nil {
+		err = xerrors.Errorf("failed to write back %q: %w", writer.GetPath(), err)
+		writer.lastError = err
+		return err
+	}
+	return nil
+}
+
+// WriteAt writes data to memory, data is written back later
+func (writer *WriteBackWriter) WriteAt(data []byte, offset int64) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.lastError != nil {
+		return 0, writer.lastError
+	}
+
+	if len(writer.dirty) > 0 && offset != writer.dirtyOffset+int64(len(writer.dirty)) {
+		// not contiguous
+		err := writer.flushDirty()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if len(data) >= writer.maxDirty {
+		// too big to coalesce
+		err := writer.flushDirty()
+		if err != nil {
+			return 0, err
+		}
+
+		return writer.Writer.WriteAt(data, offset)
+	}
+
+	if len(writer.dirty) == 0 {
+		writer.dirtyOffset = offset
+	}
+
+	writer.dirty = append(writer.dirty, data...)
+
+	if len(writer.dirty) >= writer.maxDirty {
+		err := writer.flushDirty()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Flush writes back dirty data and flushes the underlying writer
+func (writer *WriteBackWriter) Flush() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	err := writer.flushDirty()
+	if err != nil {
+		return err
+	}
+
+	return writer.Writer.Flush()
+}
+
+// Release writes back dirty data and releases the underlying writer
+func (writer *WriteBackWriter) Release() {
+	logger := log.WithFields(log.Fields{
+		"package":  "irodsfs",
+		"struct":   "WriteBackWriter",
+		"function": "Release",
+	})
+
+	if writer.flusher != nil {
+		writer.flusher.Remove(writer)
+	}
+
+	close(writer.terminateChan)
+	writer.terminateWait.Wait()
+
+	writer.mutex.Lock()
+	err := writer.flushDirty()
+	writer.mutex.Unlock()
+
+	if err != nil {
+		// GetError reports it
+		logger.Errorf("%+v", err)
+	}
+
+	writer.Writer.Release()
+}
+
+// GetDirtySize returns the size of dirty data not written back yet
+func (writer *WriteBackWriter) GetDirtySize() int64 {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return int64(len(writer.dirty))
+}
+
+// GetError returns an error occurred while writing back
+func (writer *WriteBackWriter) GetError() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.lastError != nil {
+		return writer.lastError
+	}
+
+	return writer.Writer.GetError()
+}
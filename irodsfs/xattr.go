@@ -1,6 +1,92 @@
 package irodsfs
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+
+	irodsclient_types "github.com/cyverse/go-irodsclient/irods/types"
+
+	"github.com/cyverse/irodsfs/commons"
+)
+
+const (
+	// LastModifiedByXattrName is an xattr holding the iRODS user who last modified the file through the mount
+	LastModifiedByXattrName string = "user.irods.last_modified_by"
+	// OpenHandlesXattrName is an xattr of a file holding the number of file handles opened in this process
+	OpenHandlesXattrName string = "user.irods.open_handles"
+	// SymlinkTargetXattrName is an xattr of a data object holding the target when the object is a symlink
+	SymlinkTargetXattrName string = "user.irods.symlink_target"
+	// DefaultResourceXattrName is an xattr of a dir holding the resource where new files in the dir are created
+	DefaultResourceXattrName string = "user.irods.default_resource"
+	// DataTypeXattrName is an xattr of a data object holding the data type registered in iRODS
+	DataTypeXattrName string = "user.irods.data_type"
+	// RemoteLockXattrPrefix is a prefix of xattrs of a data object holding locks shared between mounts
+	RemoteLockXattrPrefix string = "user.irods.lock."
+	// InstanceIDXattrName is an xattr of the mount root holding the ID of irodsfs instance serving the mount
+	InstanceIDXattrName string = "user.irods.instance_id"
+	// ConfigPathXattrName is an xattr of the mount root holding the path of config file used
+	ConfigPathXattrName string = "user.irods.config_path"
+	// MountTimeXattrName is an xattr of the mount root holding the time mounted
+	MountTimeXattrName string = "user.irods.mount_time"
+	// VersionXattrName is an xattr of the mount root holding the version of irodsfs
+	VersionXattrName string = "user.irods.version"
+	// ZoneXattrName is an xattr holding the zone where the entry lives
+	ZoneXattrName string = "user.irods.zone"
+	// OwnerXattrName is an xattr holding the iRODS owner of the entry
+	OwnerXattrName string = "user.irods.owner"
+	// ChecksumXattrName is an xattr of a data object holding the checksum registered in iRODS, in "algorithm:hex digest" form
+	ChecksumXattrName string = "user.irods.checksum"
+	// ResourceXattrName is an xattr of a data object holding resources where its replicas are, separated by commas
+	ResourceXattrName string = "user.irods.resource"
+	// ReplicaCountXattrName is an xattr of a data object holding the number of its replicas
+	ReplicaCountXattrName string = "user.irods.replica_count"
+	// ReplicasXattrName is an xattr of a data object holding its replicas in "number:resource:status" form, separated by commas
+	ReplicasXattrName string = "user.irods.replicas"
+	// ReplicaChecksumsXattrName is an xattr of a data object holding checksums of its replicas in "resource:algorithm:hex digest" form,
+	// separated by commas, "resource:" if the replica has no checksum
+	ReplicaChecksumsXattrName string = "user.irods.replica_checksums"
+	// ReplicateXattrName is an xattr of a data object, setting a resource to it replicates the data object to the resource
+	ReplicateXattrName string = "user.irods.replicate"
+	// ClientProcessXattrName is an xattr of a data object holding the local process which wrote it through the mount
+	ClientProcessXattrName string = "user.irods.client_process"
+	// ModifyTimeXattrName is an xattr holding the modify time set through the mount, as users cannot set modify time in iRODS
+	ModifyTimeXattrName string = "user.irods.mtime"
+	// XattrUnitSuffix is a suffix of xattrs holding the unit of AVUs, e.g., "user.foo.unit" holds the unit of AVU "user.foo"
+	XattrUnitSuffix string = ".unit"
+	// PosixACLAccessXattrName is an xattr holding POSIX access ACL, synthesized from iRODS ACLs
+	PosixACLAccessXattrName string = "system.posix_acl_access"
+)
+
+// XattrUnitsSetter is implemented by fs clients able to set AVUs with units
+type XattrUnitsSetter interface {
+	SetXattrWithUnits(path string, name string, value string, units string) error
+}
+
+// DataTypeSetter is implemented by fs clients able to set data types of data objects
+type DataTypeSetter interface {
+	ListDataTypes() ([]string, error)
+	SetDataType(path string, dataType string) error
+}
+
+// ReplicaLister is implemented by fs clients able to list replicas of data objects
+type ReplicaLister interface {
+	ListReplicas(path string) ([]*irodsclient_types.IRODSReplica, error)
+}
+
+// FileReplicator is implemented by fs clients able to replicate data objects
+type FileReplicator interface {
+	ReplicateFile(path string, resource string) error
+}
+
+// IsEntryInfoAttr checks if given attr presents information of the iRODS entry with expose_entry_info
+func IsEntryInfoAttr(attr string) bool {
+	switch attr {
+	case OwnerXattrName, ChecksumXattrName, ResourceXattrName, ReplicaCountXattrName, ReplicasXattrName:
+		return true
+	default:
+		return false
+	}
+}
 
 // IsUnhandledAttr checks if given attr is ignored
 func IsUnhandledAttr(attr string) bool {
@@ -15,7 +101,8 @@ func IsUnhandledAttr(attr string) bool {
 
 	switch attr {
 	// we suppress attr "system.posix_acl_access" as it may cause wrong permission check
-	case "system.posix_acl_access", "system.posix_acl_default", "system.dos_attrib":
+	// posix_acl presents it read-only, safe as the kernel is not asked to enforce ACLs, see GetFuseOptions
+	case PosixACLAccessXattrName, "system.posix_acl_default", "system.dos_attrib":
 		return true
 	case "security.selinux", "security.apparmor", "security.capability":
 		return true
@@ -25,3 +112,50 @@ func IsUnhandledAttr(attr string) bool {
 		return false
 	}
 }
+
+// IsReadOnlyAttr checks if given attr is managed by irodsfs, thus cannot be changed by users
+// attrs provided by features are managed only if the features are enabled, otherwise they are AVUs of users
+func IsReadOnlyAttr(config *commons.Config, attr string) bool {
+	if strings.HasPrefix(attr, RemoteLockXattrPrefix) {
+		return true
+	}
+
+	switch attr {
+	case InstanceIDXattrName, ConfigPathXattrName, MountTimeXattrName, VersionXattrName, SymlinkTargetXattrName:
+		return true
+	case LastModifiedByXattrName:
+		return config.TrackLastModifiedBy
+	case OpenHandlesXattrName:
+		return config.ExposeOpenHandles
+	case DataTypeXattrName:
+		// File.Setxattr sets the data type, it cannot be removed
+		return config.ExposeDataType
+	case ZoneXattrName:
+		return config.ExposeZone
+	case ClientProcessXattrName:
+		return config.AuditClientProcess
+	case OwnerXattrName, ChecksumXattrName, ResourceXattrName, ReplicaCountXattrName, ReplicasXattrName:
+		return config.ExposeEntryInfo
+	case ReplicaChecksumsXattrName:
+		return config.ExposeReplicaChecksums
+	case ReplicateXattrName:
+		// File.Setxattr replicates, nothing is stored to remove
+		return config.EnableReplication
+	default:
+		return false
+	}
+}
+
+// IsValidResourceName checks if given name can be an iRODS resource name
+func IsValidResourceName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+
+	for _, r := range name {
+		if r == '/' || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
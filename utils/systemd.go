@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"net"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	// SystemdNotifySocketEnvName is the environment variable systemd sets to the socket taking notifications of Type=notify services
+	SystemdNotifySocketEnvName string = "NOTIFY_SOCKET"
+	// SystemdNotifyReady tells systemd the service is ready
+	SystemdNotifyReady string = "READY=1"
+)
+
+// NotifySystemd sends the state to systemd, does nothing if not run by systemd as a Type=notify service
+// a child process running in background notifies too, which requires NotifyAccess=all in the unit
+func NotifySystemd(state string) error {
+	socketPath := os.Getenv(SystemdNotifySocketEnvName)
+	if len(socketPath) == 0 {
+		return nil
+	}
+
+	// abstract socket
+	if socketPath[0] == '@' {
+		socketPath = "\x00" + socketPath[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{
+		Name: socketPath,
+		Net:  "unixgram",
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to connect to systemd notify socket %q: %w", socketPath, err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return xerrors.Errorf("failed to notify %q to systemd: %w", state, err)
+	}
+
+	return nil
+}
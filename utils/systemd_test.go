@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNotifySystemd(t *testing.T) {
+	// not run by systemd
+	t.Setenv(SystemdNotifySocketEnvName, "")
+	if err := NotifySystemd(SystemdNotifyReady); err != nil {
+		t.Errorf("expected nothing done without notify socket, got %v", err)
+	}
+
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen on %q - %v", socketPath, err)
+	}
+	defer conn.Close()
+
+	t.Setenv(SystemdNotifySocketEnvName, socketPath)
+	if err := NotifySystemd(SystemdNotifyReady); err != nil {
+		t.Fatalf("failed to notify - %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buffer := make([]byte, 64)
+	size, err := conn.Read(buffer)
+	if err != nil {
+		t.Fatalf("failed to read notification - %v", err)
+	}
+
+	if string(buffer[:size]) != SystemdNotifyReady {
+		t.Errorf("expected %q, got %q", SystemdNotifyReady, buffer[:size])
+	}
+}